@@ -0,0 +1,88 @@
+// Package apierror writes the JSON error envelope shared by the lab servers:
+//
+//	{"error": {"code": "not_found", "message": "Document not found.", "details": [...]}}
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Detail is one item of an error, e.g. a rejected file of an upload or an
+// invalid field of a request
+type Detail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	File    string `json:"file,omitempty"`
+	Field   string `json:"field,omitempty"`
+}
+
+type Body struct {
+	Code    string   `json:"code"`
+	Message string   `json:"message"`
+	Details []Detail `json:"details,omitempty"`
+}
+
+type Envelope struct {
+	Error Body `json:"error"`
+}
+
+// Coder is implemented by errors that carry their own code
+type Coder interface {
+	ErrorCode() string
+}
+
+// codes of errors that have none more specific
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            "invalid_request",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusPreconditionFailed:    "precondition_failed",
+	http.StatusRequestEntityTooLarge: "too_large",
+	http.StatusUnprocessableEntity:   "unprocessable",
+	http.StatusPreconditionRequired:  "precondition_required",
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusInternalServerError:   "internal",
+	http.StatusBadGateway:            "upstream_failed",
+	http.StatusServiceUnavailable:    "unavailable",
+}
+
+// CodeFor is the generic code of an HTTP status
+func CodeFor(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	return strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+}
+
+// Write sends the error envelope
+func Write(w http.ResponseWriter, status int, code, message string, details ...Detail) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Envelope{Error: Body{Code: code, Message: message, Details: details}})
+}
+
+// Error replaces http.Error: the code follows from the status and the "Error: "
+// prefix of the message is dropped
+func Error(w http.ResponseWriter, message string, status int) {
+	Write(w, status, CodeFor(status), strings.TrimPrefix(message, "Error: "))
+}
+
+// InvalidJSON answers a request body that does not decode
+func InvalidJSON(w http.ResponseWriter) {
+	Write(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
+}
+
+// DetailOf describes err, using its own code when it has one
+func DetailOf(file string, err error, fallback string) Detail {
+	code := fallback
+	var coder Coder
+	if errors.As(err, &coder) {
+		code = coder.ErrorCode()
+	}
+	return Detail{Code: code, Message: err.Error(), File: file}
+}
@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Analyzed is a document stream after character filtering and tokenization
+type Analyzed struct {
+	Content  string // normalized text, empty for documents over MaxStoredContentSize
+	Raw      string // text as read, before the character filters; same size limit
+	TermFreq map[string]int
+	Length   int    // number of tokens
+	Language string // of the analyzer the tokens went through, empty without one
+}
+
+// AnalysisError explains why a document was not indexed
+type AnalysisError struct {
+	Name    string
+	Code    string // "invalid_characters", "read_error" or "empty_file"
+	message string
+}
+
+func (e *AnalysisError) Error() string     { return e.message }
+func (e *AnalysisError) ErrorCode() string { return e.Code }
+
+// Analyze filters and tokenizes the named stream; safe to call without any lock
+func Analyze(name string, r io.Reader, config AnalysisConfig) (Analyzed, error) {
+	analyzed := Analyzed{TermFreq: make(map[string]int)}
+	capture := &ContentCapture{Limit: MaxStoredContentSize}
+	raw := &ContentCapture{Limit: MaxStoredContentSize}
+
+	var analyzer *Analyzer
+	if config.Language != "" {
+		buffered := bufio.NewReaderSize(r, LanguageSampleSize)
+		r = buffered
+		language := config.Language
+		if language == "auto" {
+			sample, _ := buffered.Peek(LanguageSampleSize)
+			language, _ = DetectLanguage(string(sample))
+		}
+		if found, ok := LookupAnalyzer(language); ok {
+			analyzer = &found
+			analyzed.Language = language
+		}
+	}
+
+	var tagger *posTagger
+	if len(config.PartsOfSpeech) > 0 {
+		tagger = &posTagger{}
+	}
+
+	filtered := NewCharFilterReader(NewTokenFilterReader(NewCodeFilterReader(io.TeeReader(r, raw), config), config), config)
+	tokenize := TokenizeStream
+	if config.CharacterPolicy() == "accept" {
+		tokenize = TokenizeUnicodeStream
+	}
+	err := tokenize(io.TeeReader(filtered, capture), func(token string) {
+		if tagger != nil && !slices.Contains(config.PartsOfSpeech, tagger.tag(token)) {
+			return
+		}
+		if analyzer != nil {
+			var keep bool
+			if token, keep = analyzer.Filter(token); !keep {
+				return
+			}
+		}
+		analyzed.TermFreq[token]++
+		analyzed.Length++
+	})
+	if errors.Is(err, ErrInvalidCharacters) {
+		return Analyzed{}, &AnalysisError{Name: name, Code: "invalid_characters", message: fmt.Sprintf("File '%s' ignored: invalid characters.", name)}
+	}
+	if err != nil {
+		return Analyzed{}, &AnalysisError{Name: name, Code: "read_error", message: fmt.Sprintf("Error reading %s", name)}
+	}
+	if analyzed.Length == 0 {
+		return Analyzed{}, &AnalysisError{Name: name, Code: "empty_file", message: fmt.Sprintf("File '%s' is empty", name)}
+	}
+
+	if content, ok := capture.Text(); ok {
+		analyzed.Content = strings.ToLower(content)
+	}
+	analyzed.Raw, _ = raw.Text()
+	return analyzed, nil
+}
+
+// SectionOffsets numbers the tokens of consecutive parts of a text as Analyze
+// stores them in Content, returning where each part starts; the parts must end
+// in whitespace so that joining them splits no token
+func SectionOffsets(parts []string, config AnalysisConfig) []int {
+	offsets := make([]int, len(parts))
+	total := 0
+	for i, part := range parts {
+		offsets[i] = total
+		filtered, _ := io.ReadAll(NewCharFilterReader(NewTokenFilterReader(NewCodeFilterReader(strings.NewReader(part), config), config), config))
+		total += len(strings.Fields(string(filtered)))
+	}
+	return offsets
+}
+
+// Terms returns the set of unique terms
+func (a Analyzed) Terms() map[string]bool {
+	terms := make(map[string]bool, len(a.TermFreq))
+	for t := range a.TermFreq {
+		terms[t] = true
+	}
+	return terms
+}
@@ -0,0 +1,193 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// AnalysisConfig configures the character filters applied before tokenization
+type AnalysisConfig struct {
+	// characters outside a-z and 0-9 left after filtering: "strict" drops the
+	// file, "strip" removes the characters, "accept" indexes any letters and
+	// digits; snapshots may still hold the older names "reject" and "clean"
+	Policy             string `json:"policy" enum:"strict|strip|accept"`
+	Punctuation        string `json:"punctuation" enum:"keep|strip|space"` // "strip" removes, "space" maps to whitespace
+	DecodeEntities     bool   `json:"decodeEntities"`
+	CollapseWhitespace bool   `json:"collapseWhitespace"`
+	FoldDiacritics     bool   `json:"foldDiacritics"` // "Köln" is indexed as "koln", the raw text keeps the original
+
+	// token filters ahead of the character filters: numbers lose their thousands
+	// separators and get "." as decimal mark, dates like "15.01.2024" or "01/2024"
+	// become the tokens "2024 202401 20240115"
+	NormalizeNumbers bool `json:"normalizeNumbers"`
+	NormalizeDates   bool `json:"normalizeDates"`
+
+	// analyzer removing stop words and stemming the tokens: a language code,
+	// "auto" to detect each document's language, empty to index tokens as they are
+	Language string `json:"language" enum:"|auto|de|en|es|fr"`
+
+	// parts of speech to index, e.g. ["noun", "adjective"] for topical retrieval;
+	// tagged by English rules ahead of the analyzer, empty to index every token
+	PartsOfSpeech []string `json:"partsOfSpeech"`
+
+	// source code: identifiers are indexed whole and split at camelCase and
+	// snake_case, operators dropped, string literals and comments kept as text
+	Code bool `json:"code"`
+}
+
+// DefaultAnalysisConfig keeps the original all-or-nothing validation
+var DefaultAnalysisConfig = AnalysisConfig{
+	Policy:      "strict",
+	Punctuation: "keep",
+}
+
+// Validate checks the policy and punctuation modes, the language and the parts of speech
+func (c AnalysisConfig) Validate() error {
+	if policy := c.CharacterPolicy(); policy != "strict" && policy != "strip" && policy != "accept" {
+		return fmt.Errorf("policy must be 'strict', 'strip' or 'accept'")
+	}
+	if c.Punctuation != "keep" && c.Punctuation != "strip" && c.Punctuation != "space" {
+		return fmt.Errorf("punctuation must be 'keep', 'strip' or 'space'")
+	}
+	if _, ok := LookupAnalyzer(c.Language); c.Language != "" && c.Language != "auto" && !ok {
+		return fmt.Errorf("language must be 'auto' or one of %s", strings.Join(Languages, ", "))
+	}
+	for _, tag := range c.PartsOfSpeech {
+		if !slices.Contains(PartsOfSpeech, tag) {
+			return fmt.Errorf("partsOfSpeech must be among %s", strings.Join(PartsOfSpeech, ", "))
+		}
+	}
+	return nil
+}
+
+// older names of the policies, as earlier snapshots store them
+var policyAliases = map[string]string{"reject": "strict", "clean": "strip"}
+
+// CharacterPolicy returns the policy under its current name
+func (c AnalysisConfig) CharacterPolicy() string {
+	if policy, ok := policyAliases[c.Policy]; ok {
+		return policy
+	}
+	return c.Policy
+}
+
+// longest entity we try to decode, e.g. "&thetasym;"
+const maxEntityLength = 12
+
+// applies the configured character filters to a stream
+type charFilterReader struct {
+	src       *bufio.Reader
+	config    AnalysisConfig
+	pending   []byte
+	lastSpace bool
+}
+
+// NewCharFilterReader wraps the stream in the configured character filters
+func NewCharFilterReader(r io.Reader, config AnalysisConfig) io.Reader {
+	return &charFilterReader{src: bufio.NewReader(r), config: config}
+}
+
+func (f *charFilterReader) Read(p []byte) (int, error) {
+	for len(f.pending) == 0 {
+		r, _, err := f.src.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+
+		if r == '&' && f.config.DecodeEntities {
+			if decoded, ok := f.decodeEntity(); ok {
+				for _, dr := range decoded {
+					f.fold(dr)
+				}
+				continue
+			}
+		}
+		f.fold(r)
+	}
+
+	n := copy(p, f.pending)
+	f.pending = f.pending[n:]
+	return n, nil
+}
+
+// decodes the entity following an already consumed '&'
+func (f *charFilterReader) decodeEntity() (string, bool) {
+	ahead, _ := f.src.Peek(maxEntityLength)
+	for i, b := range ahead {
+		if b == ';' {
+			entity := "&" + string(ahead[:i+1])
+			decoded := html.UnescapeString(entity)
+			if decoded == entity {
+				return "", false
+			}
+			f.src.Discard(i + 1)
+			return decoded, true
+		}
+		if isSpace(b) || b == '&' {
+			break
+		}
+	}
+	return "", false
+}
+
+// writes a rune through the diacritic folding, if enabled, and the other filters
+func (f *charFilterReader) fold(r rune) {
+	if !f.config.FoldDiacritics || r < utf8.RuneSelf {
+		f.emit(r)
+		return
+	}
+	for _, fr := range FoldRune(r) {
+		f.emit(fr)
+	}
+}
+
+// writes a rune through the punctuation, whitespace and policy filters
+func (f *charFilterReader) emit(r rune) {
+	if unicode.IsPunct(r) || unicode.IsSymbol(r) {
+		switch f.config.Punctuation {
+		case "strip":
+			return
+		case "space":
+			r = ' '
+		}
+	}
+
+	policy := f.config.CharacterPolicy()
+	if policy != "strict" && unicode.IsSpace(r) {
+		r = ' '
+	}
+
+	if r < utf8.RuneSelf && isSpace(byte(r)) {
+		if f.config.CollapseWhitespace {
+			if f.lastSpace {
+				return
+			}
+			r = ' '
+		}
+		f.lastSpace = true
+		f.pending = append(f.pending, byte(r))
+		return
+	}
+
+	switch policy {
+	case "strip":
+		r = unicode.ToLower(r)
+		if !(r >= 'a' && r <= 'z') && !(r >= '0' && r <= '9') {
+			return
+		}
+	case "accept":
+		// control characters and undecodable bytes would still split no word
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) || r == utf8.RuneError {
+			return
+		}
+	}
+
+	f.lastSpace = false
+	f.pending = utf8.AppendRune(f.pending, r)
+}
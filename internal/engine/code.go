@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// identifiers longer than this are indexed whole, without their parts
+const maxIdentifier = 128
+
+// rewrites source code for indexing, ahead of the number and date filters:
+// identifiers are indexed whole and by their camelCase and snake_case parts,
+// "getUserName" as "getusername get user name", operators and punctuation
+// become whitespace, and string literals and comments pass as they are so their
+// words are searched like text
+type codeFilterReader struct {
+	src     *bufio.Reader
+	ident   []rune
+	pending []byte
+	quote   rune // of the string literal being read, 0 outside one
+	escaped bool
+	comment string // "line" or "block" inside a comment
+}
+
+// NewCodeFilterReader wraps the stream in the source code filter when the config
+// enables it, the stream itself otherwise
+func NewCodeFilterReader(r io.Reader, config AnalysisConfig) io.Reader {
+	if !config.Code {
+		return r
+	}
+	return &codeFilterReader{src: bufio.NewReader(r)}
+}
+
+func (f *codeFilterReader) Read(p []byte) (int, error) {
+	for len(f.pending) == 0 {
+		r, _, err := f.src.ReadRune()
+		if err != nil {
+			f.flush()
+			if len(f.pending) == 0 {
+				return 0, err
+			}
+			break
+		}
+		f.step(r)
+	}
+
+	n := copy(p, f.pending)
+	f.pending = f.pending[n:]
+	return n, nil
+}
+
+func (f *codeFilterReader) step(r rune) {
+	switch {
+	case f.comment == "line":
+		if r == '\n' {
+			f.comment = ""
+		}
+		f.pending = utf8.AppendRune(f.pending, r)
+	case f.comment == "block":
+		if r == '*' && f.next('/') {
+			f.comment = ""
+			f.pending = append(f.pending, ' ')
+			return
+		}
+		f.pending = utf8.AppendRune(f.pending, r)
+	case f.quote != 0:
+		switch {
+		case f.escaped:
+			f.escaped = false
+		case r == '\\' && f.quote != '`':
+			f.escaped = true
+			return
+		case r == f.quote || r == '\n' && f.quote != '`':
+			f.quote = 0
+			r = ' '
+		}
+		f.pending = utf8.AppendRune(f.pending, r)
+	case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+		f.ident = append(f.ident, r)
+		if len(f.ident) > maxIdentifier {
+			f.pending = append(f.pending, string(f.ident)...)
+			f.ident = f.ident[:0]
+		}
+	default:
+		f.flush()
+		switch {
+		case r == '"' || r == '\'' || r == '`':
+			f.quote = r
+			r = ' '
+		case r == '/' && f.next('/'), r == '#':
+			f.comment = "line"
+			r = ' '
+		case r == '/' && f.next('*'):
+			f.comment = "block"
+			r = ' '
+		case !unicode.IsSpace(r):
+			r = ' ' // operators and punctuation
+		}
+		f.pending = utf8.AppendRune(f.pending, r)
+	}
+}
+
+// consumes the next rune if it is r
+func (f *codeFilterReader) next(r rune) bool {
+	next, _, err := f.src.ReadRune()
+	if err != nil {
+		return false
+	}
+	if next != r {
+		f.src.UnreadRune()
+		return false
+	}
+	return true
+}
+
+func (f *codeFilterReader) flush() {
+	if len(f.ident) == 0 {
+		return
+	}
+	parts := IdentifierParts(string(f.ident))
+	f.pending = append(f.pending, strings.Join(parts, "")...)
+	if len(parts) > 1 {
+		for _, part := range parts {
+			f.pending = append(f.pending, ' ')
+			f.pending = append(f.pending, part...)
+		}
+	}
+	f.ident = f.ident[:0]
+}
+
+// IdentifierParts splits an identifier at underscores and case changes, an
+// acronym staying one part: "parseHTTPRequest_v2" is parse, HTTP, Request, v2
+func IdentifierParts(identifier string) []string {
+	var parts []string
+	runes := []rune(identifier)
+	start := 0
+	cut := func(end int) {
+		if end > start {
+			parts = append(parts, string(runes[start:end]))
+		}
+		start = end
+	}
+	for i, r := range runes {
+		switch {
+		case r == '_':
+			cut(i)
+			start = i + 1
+		case i > start && unicode.IsUpper(r):
+			previous := runes[i-1]
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) ||
+				unicode.IsUpper(previous) && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+				cut(i)
+			}
+		}
+	}
+	cut(len(runes))
+	return parts
+}
+
+// joins the snake_case identifiers of a query, as the code filter indexes them
+// whole without their underscores
+func joinSnakeCase(text string) string {
+	words := strings.Fields(text)
+	for i, word := range words {
+		if strings.Trim(word, "_") != word || !strings.Contains(word, "_") {
+			continue
+		}
+		words[i] = strings.ReplaceAll(word, "_", "")
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,245 @@
+package engine
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+)
+
+// CompressedPostings is a postings list stored as its length, a skip table and
+// the variable-byte encoded gaps between consecutive document IDs. As in
+// Postings, every sqrt(len)-th position carries a skip: the table holds, for
+// each, the document ID there and the offset of the gaps after it, both as
+// uvarint gaps from the previous entry, preceded by the table's size in bytes.
+type CompressedPostings []byte
+
+// Compress gap-encodes a sorted postings list
+func Compress(p Postings) CompressedPostings {
+	var gaps, skips []byte
+	stride := skipStride(len(p))
+	last, lastSkip, lastOffset := 0, 0, 0
+	for i, docID := range p {
+		gaps = binary.AppendUvarint(gaps, uint64(docID-last))
+		last = docID
+		if stride > 0 && i > 0 && i%stride == 0 {
+			skips = binary.AppendUvarint(skips, uint64(docID-lastSkip))
+			skips = binary.AppendUvarint(skips, uint64(len(gaps)-lastOffset))
+			lastSkip, lastOffset = docID, len(gaps)
+		}
+	}
+	buf := binary.AppendUvarint(make([]byte, 0, len(skips)+len(gaps)+4), uint64(len(p)))
+	buf = binary.AppendUvarint(buf, uint64(len(skips)))
+	buf = append(buf, skips...)
+	return append(buf, gaps...)
+}
+
+// the distance between skips for a list of n documents, 0 when it has none
+func skipStride(n int) int {
+	stride := int(math.Sqrt(float64(n)))
+	if stride < 2 {
+		return 0
+	}
+	return stride
+}
+
+// Len is the number of documents, read without decoding the list
+func (c CompressedPostings) Len() int {
+	n, _ := binary.Uvarint(c)
+	return int(n)
+}
+
+// Decode expands the whole list
+func (c CompressedPostings) Decode() Postings {
+	result := make(Postings, 0, c.Len())
+	for it := c.Iterator(); ; {
+		docID, ok := it.Next()
+		if !ok {
+			return result
+		}
+		result = append(result, docID)
+	}
+}
+
+// PostingsIterator decodes a compressed list one document at a time
+type PostingsIterator struct {
+	data   []byte // gaps after the current document
+	gaps   []byte // all gaps, which the skip offsets point into
+	skips  []byte // skip entries after the next one
+	stride int
+	pos    int // documents read so far
+
+	next                  int // position of the next skip, 0 when there is none
+	nextDocID, nextOffset int
+	last                  int
+}
+
+func (c CompressedPostings) Iterator() *PostingsIterator {
+	count, n := binary.Uvarint(c)
+	if n <= 0 {
+		return &PostingsIterator{}
+	}
+	size, m := binary.Uvarint(c[n:])
+	if m <= 0 || uint64(len(c)-n-m) < size {
+		return &PostingsIterator{}
+	}
+	table := c[n+m:]
+	it := &PostingsIterator{
+		data:   table[size:],
+		gaps:   table[size:],
+		skips:  table[:size],
+		stride: skipStride(int(count)),
+	}
+	it.loadSkip()
+	return it
+}
+
+// reads the next skip entry
+func (it *PostingsIterator) loadSkip() {
+	docGap, n := binary.Uvarint(it.skips)
+	if n <= 0 {
+		it.next = 0
+		return
+	}
+	offsetGap, m := binary.Uvarint(it.skips[n:])
+	if m <= 0 {
+		it.next = 0
+		return
+	}
+	it.skips = it.skips[n+m:]
+	it.next += it.stride
+	it.nextDocID += int(docGap)
+	it.nextOffset += int(offsetGap)
+}
+
+// Next returns the next document ID, false at the end of the list
+func (it *PostingsIterator) Next() (int, bool) {
+	gap, n := binary.Uvarint(it.data)
+	if n <= 0 {
+		return 0, false
+	}
+	it.data = it.data[n:]
+	it.last += int(gap)
+	it.pos++
+	return it.last, true
+}
+
+// SkipTo returns the first of the documents not read yet whose ID is at least
+// target, following skips past the documents before it
+func (it *PostingsIterator) SkipTo(target int) (int, bool) {
+	jumped := false
+	for it.next > 0 && it.nextDocID <= target {
+		if it.next >= it.pos && it.nextOffset <= len(it.gaps) {
+			it.last, it.data, it.pos = it.nextDocID, it.gaps[it.nextOffset:], it.next+1
+			jumped = true
+		}
+		it.loadSkip()
+	}
+	if jumped && it.last == target {
+		return it.last, true
+	}
+	for {
+		docID, ok := it.Next()
+		if !ok || docID >= target {
+			return docID, ok
+		}
+	}
+}
+
+// IntersectCompressed intersects a decoded list with a compressed one, decoding
+// the compressed list only as far as needed and following the skips of both
+func IntersectCompressed(p Postings, c CompressedPostings) Postings {
+	result := Postings{}
+	it := c.Iterator()
+	docID, ok := it.Next()
+	for i := 0; i < len(p) && ok; {
+		switch {
+		case p[i] == docID:
+			result = append(result, docID)
+			i++
+			docID, ok = it.Next()
+		case p[i] < docID:
+			if target, skip := p.skip(i); skip && p[target] <= docID {
+				for skip && p[target] <= docID {
+					i = target
+					target, skip = p.skip(i)
+				}
+			} else {
+				i++
+			}
+		default:
+			docID, ok = it.SkipTo(p[i])
+		}
+	}
+	return result
+}
+
+// CompressedIndex is an inverted index with compressed postings
+type CompressedIndex map[string]CompressedPostings
+
+// CompressIndex compresses every postings list of the index
+func CompressIndex(idx Index) CompressedIndex {
+	compressed := make(CompressedIndex, len(idx))
+	for term, postings := range idx {
+		compressed[term] = Compress(postings)
+	}
+	return compressed
+}
+
+func (ci CompressedIndex) Postings(term string) CompressedPostings {
+	return ci[term]
+}
+
+// Decode expands the index again
+func (ci CompressedIndex) Decode() Index {
+	idx := make(Index, len(ci))
+	for term, postings := range ci {
+		idx[term] = postings.Decode()
+	}
+	return idx
+}
+
+// CompressionStats compares compressed postings with plain 32-bit document IDs
+type CompressionStats struct {
+	Terms             int     `json:"terms"`
+	Postings          int     `json:"postings"`
+	UncompressedBytes int     `json:"uncompressedBytes"` // 4 bytes per posting
+	CompressedBytes   int     `json:"compressedBytes"`   // variable-byte gaps with their skip tables, as stored
+	GammaBytes        int     `json:"gammaBytes"`        // Elias gamma coded gaps, for comparison
+	Ratio             float64 `json:"ratio"`             // uncompressed / compressed
+
+	gammaBits int
+}
+
+// gammaBits is the length of the Elias gamma code of n >= 1
+func gammaBits(n int) int {
+	return 2*(bits.Len(uint(n))-1) + 1
+}
+
+// Add accounts for the postings list of one term
+func (stats *CompressionStats) Add(postings CompressedPostings) {
+	stats.Terms++
+	stats.Postings += postings.Len()
+	stats.CompressedBytes += len(postings)
+	last := -1
+	for it := postings.Iterator(); ; {
+		docID, ok := it.Next()
+		if !ok {
+			break
+		}
+		stats.gammaBits += gammaBits(docID - last) // gaps shifted by one, gamma cannot code 0
+		last = docID
+	}
+	stats.UncompressedBytes = 4 * stats.Postings
+	stats.GammaBytes = (stats.gammaBits + 7) / 8
+	if stats.CompressedBytes > 0 {
+		stats.Ratio = float64(stats.UncompressedBytes) / float64(stats.CompressedBytes)
+	}
+}
+
+func (ci CompressedIndex) Stats() CompressionStats {
+	var stats CompressionStats
+	for _, postings := range ci {
+		stats.Add(postings)
+	}
+	return stats
+}
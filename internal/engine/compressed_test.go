@@ -0,0 +1,165 @@
+package engine
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// every step-th document from start below n
+func every(start, step, n int) Postings {
+	p := Postings{}
+	for docID := start; docID < n; docID += step {
+		p = append(p, docID)
+	}
+	return p
+}
+
+// a sorted list of the documents below n, each kept with probability keep
+func sample(rng *rand.Rand, n int, keep float64) Postings {
+	p := Postings{}
+	for docID := range n {
+		if rng.Float64() < keep {
+			p = append(p, docID)
+		}
+	}
+	return p
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	lists := []Postings{
+		{},
+		{0},
+		{7},
+		{0, 1, 2},
+		{3, 300, 30000, 3000000},
+		every(0, 1, 100),
+		every(5, 17, 10000),
+		sample(rng, 5000, 0.3),
+	}
+	for _, p := range lists {
+		c := Compress(p)
+		if c.Len() != len(p) {
+			t.Errorf("Compress(%d documents).Len() = %d", len(p), c.Len())
+		}
+		if got := c.Decode(); !slices.Equal(got, p) {
+			t.Errorf("Compress(%v).Decode() = %v", p, got)
+		}
+	}
+}
+
+func TestSkipTo(t *testing.T) {
+	p := every(0, 3, 300) // 100 documents, skips every 10
+	c := Compress(p)
+	tests := []struct {
+		targets []int
+		want    []int // -1 at the end of the list
+	}{
+		{[]int{0}, []int{0}},
+		{[]int{1}, []int{3}},
+		{[]int{30}, []int{30}},
+		{[]int{31, 32, 33}, []int{33, 36, 39}}, // a returned document counts as read
+		{[]int{29, 150, 151, 297}, []int{30, 150, 153, 297}},
+		{[]int{296, 298}, []int{297, -1}},
+		{[]int{1000}, []int{-1}},
+	}
+	for _, test := range tests {
+		it := c.Iterator()
+		var got []int
+		for _, target := range test.targets {
+			docID, ok := it.SkipTo(target)
+			if !ok {
+				docID = -1
+			}
+			got = append(got, docID)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("SkipTo(%v) = %v, want %v", test.targets, got, test.want)
+		}
+	}
+}
+
+func TestIntersectCompressed(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	lists := []Postings{
+		{},
+		{42},
+		every(0, 2, 2000),
+		every(1, 2, 2000),
+		every(0, 7, 2000),
+		every(1990, 1, 2000),
+		sample(rng, 2000, 0.01),
+		sample(rng, 2000, 0.2),
+		sample(rng, 2000, 0.9),
+	}
+	for _, p1 := range lists {
+		for _, p2 := range lists {
+			want := Intersect(p1, p2)
+			if got := IntersectCompressed(p1, Compress(p2)); !slices.Equal(got, want) {
+				t.Errorf("IntersectCompressed(%d documents, %d documents) = %v, want %v", len(p1), len(p2), got, want)
+			}
+		}
+	}
+}
+
+// the test collection with compressed postings
+type compressedTestSource struct {
+	testSource
+	compressed CompressedIndex
+}
+
+func (s compressedTestSource) CompressedPostings(node *QueryNode) CompressedPostings {
+	return s.compressed.Postings(node.Term)
+}
+
+func (s compressedTestSource) Documents() int { return 5000 }
+
+type largeTestSource struct{ testSource }
+
+func (s largeTestSource) Documents() int { return 5000 }
+
+func TestEvaluateCompressed(t *testing.T) {
+	rng := rand.New(rand.NewPCG(5, 6))
+	index := Index{
+		"rare":   sample(rng, 5000, 0.005),
+		"some":   sample(rng, 5000, 0.05),
+		"many":   sample(rng, 5000, 0.4),
+		"most":   sample(rng, 5000, 0.9),
+		"even":   every(0, 2, 5000),
+		"tenths": every(3, 10, 5000),
+	}
+	plain := largeTestSource{testSource{index}}
+	compressed := compressedTestSource{testSource{index}, CompressIndex(index)}
+
+	queries := []string{
+		"rare and most",
+		"some and many and most",
+		"even and tenths",
+		"rare and even and not many",
+		"(some or rare) and most and not even",
+		"many and missing",
+		"tenths and not (even xor some)",
+	}
+	for _, query := range queries {
+		node, err := ParseQuery(query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q): %v", query, err)
+		}
+		want := Evaluate(Plan(node, plain), plain)
+		node, _ = ParseQuery(query)
+		got := Evaluate(Plan(node, compressed), compressed)
+		if !slices.Equal(got, want) {
+			t.Errorf("Evaluate(%q) compressed = %s, want %s", query, summary(got), summary(want))
+		}
+	}
+}
+
+// a short description of a long postings list for failure messages
+func summary(p Postings) string {
+	if len(p) <= 10 {
+		return fmt.Sprint(p)
+	}
+	return fmt.Sprintf("%v... (%d documents)", p[:10], len(p))
+}
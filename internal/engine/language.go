@@ -0,0 +1,295 @@
+package engine
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// bytes of a stream read ahead to detect its language before tokenization
+const LanguageSampleSize = 4096
+
+// trigrams ranked per language profile (Cavnar & Trenkle, 1994)
+const profileSize = 300
+
+// letters a text needs before its language is guessed
+const minDetectionLetters = 20
+
+// Analyzer removes the stop words of a language and stems the other tokens
+type Analyzer struct {
+	Language  string
+	stopwords map[string]bool
+	stem      func(string) string
+}
+
+// Filter returns the indexed form of a lowercased token, false for stop words
+func (a Analyzer) Filter(token string) (string, bool) {
+	if a.stopwords[token] {
+		return "", false
+	}
+	return a.stem(token), true
+}
+
+// languages with an analyzer and a detection profile
+var Languages = []string{"de", "en", "es", "fr"}
+
+var analyzers = map[string]Analyzer{
+	"en": {Language: "en", stopwords: wordSet(englishStopwords), stem: stemEnglish},
+	"de": {Language: "de", stopwords: wordSet(germanStopwords), stem: stemGerman},
+	"fr": {Language: "fr", stopwords: wordSet(frenchStopwords), stem: stemFrench},
+	"es": {Language: "es", stopwords: wordSet(spanishStopwords), stem: stemSpanish},
+}
+
+// LookupAnalyzer returns the analyzer of the language code
+func LookupAnalyzer(language string) (Analyzer, bool) {
+	analyzer, ok := analyzers[language]
+	return analyzer, ok
+}
+
+// trigram ranks per language, built from the samples at startup
+var profiles = map[string]map[string]int{}
+
+func init() {
+	for language, sample := range languageSamples {
+		profiles[language] = trigramProfile(sample)
+	}
+}
+
+// DetectLanguage guesses the language of the text by the out-of-place distance
+// of its trigram ranks to the language profiles; returns "" and 0 for texts too
+// short to tell, otherwise the language and a confidence in (0, 1)
+func DetectLanguage(text string) (string, float64) {
+	letters := 0
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	if letters < minDetectionLetters {
+		return "", 0
+	}
+
+	profile := trigramProfile(text)
+	best, bestDistance, second := "", math.MaxInt, math.MaxInt
+	for _, language := range Languages {
+		distance := 0
+		for gram, rank := range profile {
+			if reference, ok := profiles[language][gram]; ok {
+				distance += abs(rank - reference)
+			} else {
+				distance += profileSize
+			}
+		}
+		if distance < bestDistance {
+			best, bestDistance, second = language, distance, bestDistance
+		} else if distance < second {
+			second = distance
+		}
+	}
+	// margin over the runner-up
+	return best, math.Max(float64(second-bestDistance)/float64(second), 0.01)
+}
+
+// ranks of the most frequent letter trigrams of the text, words padded with spaces
+func trigramProfile(text string) map[string]int {
+	counts := map[string]int{}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) })
+	for _, word := range words {
+		runes := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			counts[string(runes[i:i+3])]++
+		}
+	}
+	grams := make([]string, 0, len(counts))
+	for gram := range counts {
+		grams = append(grams, gram)
+	}
+	sort.Slice(grams, func(i, j int) bool {
+		if counts[grams[i]] != counts[grams[j]] {
+			return counts[grams[i]] > counts[grams[j]]
+		}
+		return grams[i] < grams[j]
+	})
+	profile := make(map[string]int, min(len(grams), profileSize))
+	for rank, gram := range grams[:min(len(grams), profileSize)] {
+		profile[gram] = rank
+	}
+	return profile
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func wordSet(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
+
+func isVowel(b byte) bool {
+	return strings.IndexByte("aeiouy", b) >= 0
+}
+
+func hasVowel(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if isVowel(s[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// drops one of two equal final consonants, e.g. "runn" -> "run"
+func undouble(s string, keep string) string {
+	n := len(s)
+	if n > 3 && s[n-1] == s[n-2] && !isVowel(s[n-1]) && strings.IndexByte(keep, s[n-1]) < 0 {
+		return s[:n-1]
+	}
+	return s
+}
+
+// light English stemmer: plurals, -ed and -ing, a final e
+func stemEnglish(w string) string {
+	if len(w) <= 3 {
+		return w
+	}
+	switch {
+	case strings.HasSuffix(w, "sses"):
+		w = w[:len(w)-2]
+	case strings.HasSuffix(w, "ies") && len(w) > 4:
+		w = w[:len(w)-3] + "y"
+	case strings.HasSuffix(w, "ss"), strings.HasSuffix(w, "us"), strings.HasSuffix(w, "is"):
+	case strings.HasSuffix(w, "s"):
+		w = w[:len(w)-1]
+	}
+	for _, suffix := range []string{"ingly", "edly", "ing", "ed"} {
+		if stem := strings.TrimSuffix(w, suffix); stem != w && len(stem) >= 3 && hasVowel(stem) {
+			w = undouble(stem, "lsz")
+			break
+		}
+	}
+	if len(w) > 4 && strings.HasSuffix(w, "e") {
+		w = w[:len(w)-1]
+	}
+	return w
+}
+
+// light German stemmer after Caumanns: inflectional endings in two steps
+func stemGerman(w string) string {
+	switch n := len(w); {
+	case n > 5 && strings.HasSuffix(w, "ern"):
+		w = w[:n-3]
+	case n > 4 && (strings.HasSuffix(w, "em") || strings.HasSuffix(w, "en") || strings.HasSuffix(w, "er") || strings.HasSuffix(w, "es")):
+		w = w[:n-2]
+	case n > 3 && (strings.HasSuffix(w, "e") || strings.HasSuffix(w, "n") || strings.HasSuffix(w, "s") && strings.IndexByte("bdfghklmnrt", w[n-2]) >= 0):
+		w = w[:n-1]
+	}
+	switch n := len(w); {
+	case n > 5 && strings.HasSuffix(w, "est"):
+		w = w[:n-3]
+	case n > 4 && (strings.HasSuffix(w, "er") || strings.HasSuffix(w, "en")):
+		w = w[:n-2]
+	case n > 5 && strings.HasSuffix(w, "st") && strings.IndexByte("bdfghklmnt", w[n-3]) >= 0:
+		w = w[:n-2]
+	}
+	return w
+}
+
+// light French stemmer after Savoy: plurals, feminine and infinitive endings
+func stemFrench(w string) string {
+	switch n := len(w); {
+	case n > 4 && strings.HasSuffix(w, "aux"):
+		w = w[:n-3] + "al"
+	case n > 3 && (strings.HasSuffix(w, "s") || strings.HasSuffix(w, "x")):
+		w = w[:n-1]
+	}
+	if len(w) > 5 && strings.HasSuffix(w, "er") {
+		w = w[:len(w)-2]
+	}
+	for range 2 {
+		if len(w) > 4 && strings.HasSuffix(w, "e") {
+			w = w[:len(w)-1]
+		}
+	}
+	return undouble(w, "")
+}
+
+// light Spanish stemmer: plurals and the final gender vowel
+func stemSpanish(w string) string {
+	switch n := len(w); {
+	case n > 4 && strings.HasSuffix(w, "ces"):
+		w = w[:n-3] + "z"
+	case n > 4 && strings.HasSuffix(w, "es") && !isVowel(w[n-3]):
+		w = w[:n-2]
+	case n > 3 && strings.HasSuffix(w, "s"):
+		w = w[:n-1]
+	}
+	if n := len(w); n > 4 && (w[n-1] == 'a' || w[n-1] == 'o' || w[n-1] == 'e') {
+		w = w[:n-1]
+	}
+	return w
+}
+
+const englishStopwords = `a about above after again against all am an and any are as at be because been
+before being below between both but by can could did do does doing down during each few for from further
+had has have having he her here hers herself him himself his how i if in into is it its itself just me
+more most my myself no nor not now of off on once only or other our ours ourselves out over own same she
+should so some such than that the their theirs them themselves then there these they this those through
+to too under until up very was we were what when where which while who whom why will with would you your
+yours yourself yourselves`
+
+const germanStopwords = `aber alle allem allen aller alles als also am an ander andere anderen auch auf
+aus bei bin bis bist da damit dann das dass dem den denn der des dich die dies diese diesem diesen dieser
+dieses dir doch dort du durch ein eine einem einen einer eines er es etwas euch euer fur hab habe haben
+hat hatte hier hin hinter ich ihm ihn ihnen ihr ihre im in ist ja jede jedem jeden jeder jedes jetzt kann
+kein keine mich mir mit muss nach nicht nichts noch nun nur ob oder ohne sehr sein seine sich sie sind so
+solche soll sondern sonst uber um und uns unser unter viel vom von vor war waren was weil welche wenn wer
+werden wie wieder will wir wird wo zu zum zur zwischen`
+
+const frenchStopwords = `a au aux avec ce ces cette dans de des du elle elles en est et eu il ils je la
+le les leur leurs lui ma mais me meme mes moi mon ne nos notre nous on ont ou par pas pour qu que qui sa
+sans se ses son sont sur ta te tes toi ton tu un une vos votre vous y c d j l m n s t etait etre fait
+comme tout tous plus aussi bien sous entre`
+
+const spanishStopwords = `a al algo algunos ante antes como con contra cual cuando de del desde donde
+durante e el ella ellas ellos en entre era es esa esas ese eso esos esta estas este esto estos fue ha hay
+la las le les lo los mas me mi muy nada ni no nos nosotros o otra otro para pero poco por porque que quien
+se sea ser si sin sobre son su sus tambien te tiene todo todos tu un una uno unos y ya yo`
+
+// detection samples: short everyday prose, enough for the frequent trigrams
+var languageSamples = map[string]string{
+	"en": `The quick development of information technology has changed the way people search for
+documents. When a user types a query, the system looks through the index and returns the results that
+are most relevant to the words of the query. There are many ways to measure how well a document matches,
+and each of them has its own strengths and weaknesses. In this course we will study the most important
+models and compare them on a collection of texts that students have written themselves. It is also
+interesting to see how the ranking changes when the collection grows and when new terms appear.`,
+	"de": `Die schnelle Entwicklung der Informationstechnik hat die Art verändert, wie Menschen nach
+Dokumenten suchen. Wenn ein Benutzer eine Anfrage eingibt, durchsucht das System den Index und liefert
+die Ergebnisse, die für die Wörter der Anfrage am wichtigsten sind. Es gibt viele Möglichkeiten zu
+messen, wie gut ein Dokument passt, und jede von ihnen hat ihre eigenen Stärken und Schwächen. In diesem
+Kurs werden wir die wichtigsten Modelle untersuchen und sie auf einer Sammlung von Texten vergleichen,
+die die Studenten selbst geschrieben haben. Es ist auch interessant zu sehen, wie sich die Reihenfolge
+ändert, wenn die Sammlung wächst und neue Begriffe erscheinen.`,
+	"fr": `Le développement rapide des technologies de l'information a changé la façon dont les gens
+cherchent des documents. Quand un utilisateur tape une requête, le système parcourt l'index et renvoie
+les résultats qui sont les plus pertinents pour les mots de la requête. Il existe de nombreuses façons de
+mesurer si un document correspond bien, et chacune d'entre elles a ses propres forces et faiblesses. Dans
+ce cours nous allons étudier les modèles les plus importants et les comparer sur une collection de textes
+que les étudiants ont écrits eux-mêmes. Il est aussi intéressant de voir comment le classement change
+quand la collection grandit et quand de nouveaux termes apparaissent.`,
+	"es": `El rápido desarrollo de la tecnología de la información ha cambiado la forma en que las
+personas buscan documentos. Cuando un usuario escribe una consulta, el sistema recorre el índice y
+devuelve los resultados que son más relevantes para las palabras de la consulta. Hay muchas maneras de
+medir qué tan bien coincide un documento, y cada una de ellas tiene sus propias ventajas y debilidades.
+En este curso vamos a estudiar los modelos más importantes y compararlos en una colección de textos que
+los estudiantes han escrito ellos mismos. También es interesante ver cómo cambia la clasificación cuando
+la colección crece y cuando aparecen nuevos términos.`,
+}
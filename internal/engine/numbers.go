@@ -0,0 +1,215 @@
+package engine
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// longest word the number and date filters look at
+const maxNormalizedWord = 64
+
+// punctuation around a number or date that is kept as it is
+const (
+	leadingPunctuation  = `("'[+-`
+	trailingPunctuation = `.,;:!?)"']`
+)
+
+var (
+	numberPattern = regexp.MustCompile(`^\d[\d,.']*\d$`)
+	ymdPattern    = regexp.MustCompile(`^(\d{4})[-/.](\d{1,2})[-/.](\d{1,2})$`)
+	dmyPattern    = regexp.MustCompile(`^(\d{1,2})[-/.](\d{1,2})[-/.](\d{4})$`)
+	ymPattern     = regexp.MustCompile(`^(\d{4})[-/.](\d{1,2})$`)
+	myPattern     = regexp.MustCompile(`^(\d{1,2})[-/.](\d{4})$`)
+)
+
+// rewrites the numbers and dates among the whitespace-separated words of a
+// stream, ahead of the character filters
+type tokenFilterReader struct {
+	src         *bufio.Reader
+	config      AnalysisConfig
+	word        []byte
+	pending     []byte
+	passThrough bool // the current word is too long to be a number or date
+}
+
+// NewTokenFilterReader wraps the stream in the number and date filters enabled
+// by the config, the stream itself when there are none
+func NewTokenFilterReader(r io.Reader, config AnalysisConfig) io.Reader {
+	if !config.NormalizeNumbers && !config.NormalizeDates {
+		return r
+	}
+	return &tokenFilterReader{src: bufio.NewReader(r), config: config}
+}
+
+func (f *tokenFilterReader) Read(p []byte) (int, error) {
+	for len(f.pending) == 0 {
+		b, err := f.src.ReadByte()
+		if err != nil {
+			f.flush()
+			if len(f.pending) == 0 {
+				return 0, err
+			}
+			break
+		}
+		switch {
+		case isSpace(b):
+			f.flush()
+			f.passThrough = false
+			f.pending = append(f.pending, b)
+		case f.passThrough:
+			f.pending = append(f.pending, b)
+		default:
+			f.word = append(f.word, b)
+			if len(f.word) > maxNormalizedWord {
+				f.pending = append(f.pending, f.word...)
+				f.word = f.word[:0]
+				f.passThrough = true
+			}
+		}
+	}
+
+	n := copy(p, f.pending)
+	f.pending = f.pending[n:]
+	return n, nil
+}
+
+func (f *tokenFilterReader) flush() {
+	if len(f.word) > 0 {
+		f.pending = append(f.pending, normalizeWord(string(f.word), f.config)...)
+		f.word = f.word[:0]
+	}
+}
+
+// NormalizeText applies the number and date filters to a text such as a query,
+// joining its snake_case identifiers for code collections
+func NormalizeText(text string, config AnalysisConfig) string {
+	if config.Code {
+		text = joinSnakeCase(text)
+	}
+	normalized, err := io.ReadAll(NewTokenFilterReader(strings.NewReader(text), config))
+	if err != nil {
+		return text
+	}
+	return string(normalized)
+}
+
+// rewrites a word that is a number or a date, punctuation around it kept
+func normalizeWord(word string, config AnalysisConfig) string {
+	core := strings.TrimLeft(word, leadingPunctuation)
+	lead := word[:len(word)-len(core)]
+	core = strings.TrimRight(core, trailingPunctuation)
+	trail := word[len(lead)+len(core):]
+	if core == "" {
+		return word
+	}
+
+	if config.NormalizeDates {
+		if tokens, ok := dateTokens(core); ok {
+			return lead + strings.Join(tokens, " ") + trail
+		}
+	}
+	if config.NormalizeNumbers {
+		if number, ok := normalizeNumber(core); ok {
+			// the decimal mark goes the way the character filters treat punctuation,
+			// so queries, which skip them, get the same tokens
+			switch {
+			case config.Punctuation == "space":
+				number = strings.ReplaceAll(number, ".", " ")
+			case config.Punctuation == "strip" || config.CharacterPolicy() == "strip":
+				number = strings.ReplaceAll(number, ".", "")
+			}
+			return lead + number + trail
+		}
+	}
+	return word
+}
+
+// the canonical tokens of a date: its year, year and month ("202401"), and with
+// a day also the full date ("20240115"), so a query for the year matches them
+// all; day-first unless the second field cannot be a month
+func dateTokens(core string) ([]string, bool) {
+	var year, month, day string
+	if m := ymdPattern.FindStringSubmatch(core); m != nil {
+		year, month, day = m[1], m[2], m[3]
+	} else if m := dmyPattern.FindStringSubmatch(core); m != nil {
+		day, month, year = m[1], m[2], m[3]
+		if n, _ := strconv.Atoi(month); n > 12 {
+			day, month = month, day
+		}
+	} else if m := ymPattern.FindStringSubmatch(core); m != nil {
+		year, month = m[1], m[2]
+	} else if m := myPattern.FindStringSubmatch(core); m != nil {
+		month, year = m[1], m[2]
+	} else {
+		return nil, false
+	}
+
+	y, _ := strconv.Atoi(year)
+	mo, _ := strconv.Atoi(month)
+	if y < 1000 || y > 2999 || mo < 1 || mo > 12 {
+		return nil, false
+	}
+	tokens := []string{year, year + two(mo)}
+	if day != "" {
+		d, _ := strconv.Atoi(day)
+		if d < 1 || d > 31 {
+			return nil, false
+		}
+		tokens = append(tokens, year+two(mo)+two(d))
+	}
+	return tokens, true
+}
+
+func two(n int) string {
+	if n < 10 {
+		return "0" + strconv.Itoa(n)
+	}
+	return strconv.Itoa(n)
+}
+
+// strips the thousands separators of a number and writes its decimal mark as
+// ".", e.g. "1,234,567" -> "1234567" and "1.234,5" -> "1234.5"; the last "," or
+// "." is the decimal mark unless it is a lone separator before three digits.
+// Words whose groups are not thousands, like "1.2.3", are no numbers
+func normalizeNumber(core string) (string, bool) {
+	if !numberPattern.MatchString(core) || !strings.ContainsAny(core, ",.'") {
+		return "", false
+	}
+
+	integer, fraction := core, ""
+	last := strings.LastIndexAny(core, ",.")
+	if last >= 0 {
+		mark := core[last]
+		other := byte(',')
+		if mark == ',' {
+			other = '.'
+		}
+		lone := strings.Count(core, string(mark)) == 1
+		if lone && (strings.IndexByte(core, other) >= 0 || len(core)-last-1 != 3) {
+			integer, fraction = core[:last], core[last+1:]
+		}
+	}
+
+	groups := strings.FieldsFunc(integer, func(r rune) bool { return r == ',' || r == '.' || r == '\'' })
+	if len(groups) > 1 {
+		if len(groups[0]) > 3 {
+			return "", false
+		}
+		for _, group := range groups[1:] {
+			if len(group) != 3 {
+				return "", false
+			}
+		}
+	}
+	if strings.ContainsAny(fraction, ",.'") {
+		return "", false
+	}
+	number := strings.Join(groups, "")
+	if fraction != "" {
+		number += "." + fraction
+	}
+	return number, true
+}
@@ -0,0 +1,205 @@
+package engine
+
+import "sort"
+
+// PostingsSource resolves query terms against a collection
+type PostingsSource interface {
+	TermPostings(node *QueryNode) Postings // postings of a term node in the field it targets
+	Documents() int
+}
+
+// CompressedSource is implemented by sources that keep their postings compressed;
+// the planner then reads list lengths and intersects without decoding whole lists
+type CompressedSource interface {
+	CompressedPostings(node *QueryNode) CompressedPostings
+}
+
+// Plan rewrites the parsed query into an equivalent plan that is cheaper to evaluate:
+// NOT is pushed down to terms, nested groups are flattened, duplicate operands
+// are merged and AND operands are ordered by ascending estimated result size
+func Plan(node *QueryNode, source PostingsSource) *QueryNode {
+	plan := simplify(pushNotInward(node, false))
+	estimate(plan, source)
+	return plan
+}
+
+// applies De Morgan's laws so that NOT only wraps terms
+func pushNotInward(node *QueryNode, negate bool) *QueryNode {
+	switch node.Op {
+	case "term":
+		if negate {
+			return &QueryNode{Op: "not", Children: []*QueryNode{node}}
+		}
+		return node
+	case "not":
+		return pushNotInward(node.Children[0], !negate)
+	}
+
+	if node.Op == "xor" {
+		// not(a xor b) = not(a) xor b
+		children := make([]*QueryNode, len(node.Children))
+		for i, child := range node.Children {
+			children[i] = pushNotInward(child, negate && i == 0)
+		}
+		return &QueryNode{Op: "xor", Children: children}
+	}
+
+	op := node.Op
+	if negate {
+		// not(a and b) = not(a) or not(b); not(a or b) = not(a) and not(b)
+		if op == "and" {
+			op = "or"
+		} else {
+			op = "and"
+		}
+	}
+
+	children := make([]*QueryNode, len(node.Children))
+	for i, child := range node.Children {
+		children[i] = pushNotInward(child, negate)
+	}
+	return &QueryNode{Op: op, Children: children}
+}
+
+// flattens nested groups of the same operator and merges duplicate operands
+// (XOR operands are only flattened: a xor a is not a)
+func simplify(node *QueryNode) *QueryNode {
+	if node.Op != "and" && node.Op != "or" && node.Op != "xor" {
+		return node
+	}
+
+	var children []*QueryNode
+	seen := make(map[string]bool)
+
+	var collect func(*QueryNode)
+	collect = func(child *QueryNode) {
+		child = simplify(child)
+		if child.Op == node.Op {
+			for _, grandchild := range child.Children {
+				collect(grandchild)
+			}
+			return
+		}
+		key := child.String()
+		if seen[key] && node.Op != "xor" {
+			return
+		}
+		seen[key] = true
+		children = append(children, child)
+	}
+
+	for _, child := range node.Children {
+		collect(child)
+	}
+
+	if len(children) == 1 {
+		return children[0]
+	}
+	return &QueryNode{Op: node.Op, Children: children}
+}
+
+// fills in the estimated number of matching documents bottom-up, orders
+// AND operands by selectivity and marks groups that are known to be empty
+func estimate(node *QueryNode, source PostingsSource) int {
+	total := source.Documents()
+
+	switch node.Op {
+	case "term":
+		if compressed, ok := source.(CompressedSource); ok {
+			node.Estimate = compressed.CompressedPostings(node).Len()
+		} else {
+			node.Estimate = len(source.TermPostings(node))
+		}
+		return node.Estimate
+
+	case "not":
+		node.Estimate = total - estimate(node.Children[0], source)
+		return node.Estimate
+
+	case "and":
+		node.Estimate = total
+		for _, child := range node.Children {
+			if childEstimate := estimate(child, source); childEstimate < node.Estimate {
+				node.Estimate = childEstimate
+			}
+		}
+
+		// positive operands first (rarest first), negations are applied last as subtractions
+		sort.SliceStable(node.Children, func(i, j int) bool {
+			a, b := node.Children[i], node.Children[j]
+			if (a.Op == "not") != (b.Op == "not") {
+				return b.Op == "not"
+			}
+			return a.Estimate < b.Estimate
+		})
+
+		// estimates are upper bounds, so an empty operand makes the whole group empty
+		node.ShortCircuit = node.Estimate == 0
+		return node.Estimate
+
+	default: // "or", "xor"
+		node.Estimate = 0
+		for _, child := range node.Children {
+			node.Estimate += estimate(child, source)
+		}
+		if node.Estimate > total {
+			node.Estimate = total
+		}
+		return node.Estimate
+	}
+}
+
+// Evaluate runs the planned query against the source's index
+func Evaluate(node *QueryNode, source PostingsSource) Postings {
+	switch node.Op {
+	case "term":
+		return source.TermPostings(node)
+
+	case "not":
+		return Subtract(AllDocuments(source.Documents()), Evaluate(node.Children[0], source))
+
+	case "and":
+		if node.ShortCircuit {
+			return Postings{}
+		}
+
+		var result Postings
+		started := false
+		compressed, isCompressed := source.(CompressedSource)
+		for _, child := range node.Children {
+			if started && len(result) == 0 {
+				break
+			}
+			switch {
+			case child.Op == "term" && started && isCompressed:
+				result = IntersectCompressed(result, compressed.CompressedPostings(child))
+			case child.Op == "not" && started:
+				result = Subtract(result, Evaluate(child.Children[0], source))
+			case !started:
+				result = Evaluate(child, source)
+				started = true
+			default:
+				result = Intersect(result, Evaluate(child, source))
+			}
+		}
+		return result
+
+	default: // "or", "xor"
+		var result Postings
+		for _, child := range node.Children {
+			// empty operands change neither a union nor a symmetric difference
+			if child.Estimate == 0 {
+				continue
+			}
+			if node.Op == "xor" {
+				result = SymmetricDifference(result, Evaluate(child, source))
+			} else {
+				result = Union(result, Evaluate(child, source))
+			}
+		}
+		if result == nil {
+			return Postings{}
+		}
+		return result
+	}
+}
@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"slices"
+	"testing"
+)
+
+// a collection of six documents: a in 0-2, b in 1-3, c in 2 and 4
+type testSource struct{ index Index }
+
+func (s testSource) TermPostings(node *QueryNode) Postings { return s.index[node.Term] }
+func (s testSource) Documents() int                        { return 6 }
+
+var collection = testSource{Index{
+	"a": {0, 1, 2},
+	"b": {1, 2, 3},
+	"c": {2, 4},
+}}
+
+func plan(t *testing.T, query string) *QueryNode {
+	t.Helper()
+	node, err := ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q): %v", query, err)
+	}
+	return Plan(node, collection)
+}
+
+func TestPlanRewrites(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		// De Morgan: not only wraps terms
+		{"not (a and b)", "not(a) or not(b)"},
+		{"not (a or b)", "not(a) and not(b)"},
+		{"not (a xor b)", "not(a) xor b"},
+		{"not not a", "a"},
+		{"not (a and not b)", "not(a) or b"},
+
+		// nested groups are flattened, duplicates merged except under xor
+		{"a or (b or c)", "a or b or c"},
+		{"a or a", "a"},
+		{"(a and b) and a", "a and b"},
+		{"a xor (b xor c)", "a xor b xor c"},
+		{"a xor a", "a xor a"},
+
+		// and operands rarest first, negations last
+		{"a and c", "c and a"},
+		{"not c and a and c", "c and a and not(c)"},
+		{"b and not a and c", "c and b and not(a)"},
+	}
+	for _, test := range tests {
+		if got := plan(t, test.query).String(); got != test.want {
+			t.Errorf("Plan(%q) = %s, want %s", test.query, got, test.want)
+		}
+	}
+}
+
+func TestPlanEstimates(t *testing.T) {
+	node := plan(t, "a and missing")
+	if node.Estimate != 0 || !node.ShortCircuit {
+		t.Errorf("a and missing: estimate %d, short circuit %v, want 0, true", node.Estimate, node.ShortCircuit)
+	}
+	if node := plan(t, "not c"); node.Estimate != 4 {
+		t.Errorf("not c: estimate %d, want 4", node.Estimate)
+	}
+	if node := plan(t, "a or b or c"); node.Estimate != 6 {
+		t.Errorf("a or b or c: estimate %d, want the collection size 6", node.Estimate)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		query string
+		want  Postings
+	}{
+		{"a xor b", Postings{0, 3}},
+		{"a xor b xor c", Postings{0, 2, 3, 4}},
+		{"a xor a", Postings{}},
+		{"a xor missing", Postings{0, 1, 2}},
+		{"a and not b", Postings{0}},
+		{"b and not a and not c", Postings{3}},
+		{"not a", Postings{3, 4, 5}},
+		{"not (a xor b)", Postings{1, 2, 4, 5}},
+		{"a or b and c", Postings{0, 1, 2}},
+		{"a and not b or c", Postings{0, 2, 4}},
+		{"(a or c) and not (b xor c)", Postings{0, 2}},
+		{"missing and a", Postings{}},
+	}
+	for _, test := range tests {
+		if got := Evaluate(plan(t, test.query), collection); !slices.Equal(got, test.want) {
+			t.Errorf("Evaluate(%q) = %v, want %v", test.query, got, test.want)
+		}
+	}
+}
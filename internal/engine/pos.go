@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"strings"
+	"unicode"
+)
+
+// PartsOfSpeech are the tags of the part-of-speech filter; "other" covers the
+// function words: determiners, pronouns, prepositions, conjunctions and auxiliaries
+var PartsOfSpeech = []string{"noun", "verb", "adjective", "adverb", "number", "other"}
+
+var (
+	determiners = wordSet(`a an the this that these those my your his her its our their some any each
+every no another either neither such what which whose`)
+	pronouns = wordSet(`i you he she it we they me him us them myself yourself himself herself itself
+ourselves themselves who whom one`)
+	modals      = wordSet("can could may might must shall should will would to")
+	functionals = wordSet(`and or but nor so yet if then than because while although though as of in
+on at by for with from into onto upon about above below over under between through during before
+after against among without within along across behind beyond is are was were be been being am
+have has had having do does did doing not there here`)
+	adverbs = wordSet(`very too also often always never sometimes usually already still just soon
+again almost quite rather really perhaps however therefore thus now then once well even only`)
+	// words in -ly that are no adverbs
+	lyNouns = wordSet("family supply reply ally assembly anomaly italy july monopoly butterfly early daily likely only")
+)
+
+var (
+	nounSuffixes      = []string{"tion", "sion", "ment", "ness", "ity", "ance", "ence", "ship", "ism", "ist", "ure", "age", "ery"}
+	adjectiveSuffixes = []string{"able", "ible", "ful", "ous", "ive", "less", "ical", "ish", "ic", "al", "ary", "ent", "ant"}
+	verbSuffixes      = []string{"ize", "ise", "ify", "ate"}
+)
+
+// posTagger tags English tokens one after another by a closed-class lexicon,
+// suffixes and the class of the token before, after Brill's initial-state
+// tagger; a rough tagging, good enough to keep the content words
+type posTagger struct {
+	previous string // "determiner", "pronoun", "modal" or the tag of the last token
+}
+
+func hasAnySuffix(token string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if len(token) > len(suffix)+2 && strings.HasSuffix(token, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// the part of speech of the lowercased token in its context
+func (t *posTagger) tag(token string) string {
+	class, tag := "", "noun"
+	switch {
+	case unicode.IsDigit(rune(token[0])):
+		tag = "number"
+	case determiners[token]:
+		class, tag = "determiner", "other"
+	case pronouns[token]:
+		class, tag = "pronoun", "other"
+	case modals[token]:
+		class, tag = "modal", "other"
+	case functionals[token]:
+		tag = "other"
+	case adverbs[token]:
+		tag = "adverb"
+	case t.previous == "modal" || t.previous == "pronoun":
+		tag = "verb"
+	case strings.HasSuffix(token, "ly") && len(token) > 4 && !lyNouns[token]:
+		tag = "adverb"
+	case strings.HasSuffix(token, "ing") && len(token) > 5, strings.HasSuffix(token, "ed") && len(token) > 4:
+		// "the running water", "a closed door"
+		if t.previous == "determiner" || t.previous == "adjective" {
+			tag = "adjective"
+		} else {
+			tag = "verb"
+		}
+	case hasAnySuffix(token, nounSuffixes):
+	case hasAnySuffix(token, adjectiveSuffixes):
+		tag = "adjective"
+	case hasAnySuffix(token, verbSuffixes) && t.previous != "determiner" && t.previous != "adjective":
+		tag = "verb"
+	}
+	if class == "" {
+		class = tag
+	}
+	t.previous = class
+	return tag
+}
@@ -0,0 +1,113 @@
+package engine
+
+import "math"
+
+// Postings is a sorted list of document IDs (indexes into the collection's documents).
+// Skip pointers are implicit: every sqrt(len)-th position points sqrt(len) entries ahead.
+type Postings []int
+
+// returns the skip target from position i, if position i carries a skip pointer
+func (p Postings) skip(i int) (int, bool) {
+	stride := int(math.Sqrt(float64(len(p))))
+	if stride < 2 || i%stride != 0 || i+stride >= len(p) {
+		return 0, false
+	}
+	return i + stride, true
+}
+
+// Index is an inverted index from term to postings
+type Index map[string]Postings
+
+// Add adds a document's unique terms to the index; IDs are assigned in
+// upload order, so appending keeps every postings list sorted
+func (idx Index) Add(docID int, terms map[string]bool) {
+	for term := range terms {
+		idx[term] = append(idx[term], docID)
+	}
+}
+
+// AllDocuments is the postings list of documents 0..n-1, used as the base for purely negative conjuncts
+func AllDocuments(n int) Postings {
+	all := make(Postings, n)
+	for i := range all {
+		all[i] = i
+	}
+	return all
+}
+
+// Intersect returns the intersection of two postings lists, following skip pointers on both sides
+func Intersect(p1, p2 Postings) Postings {
+	result := Postings{}
+	i, j := 0, 0
+
+	for i < len(p1) && j < len(p2) {
+		switch {
+		case p1[i] == p2[j]:
+			result = append(result, p1[i])
+			i++
+			j++
+		case p1[i] < p2[j]:
+			if target, ok := p1.skip(i); ok && p1[target] <= p2[j] {
+				for ok && p1[target] <= p2[j] {
+					i = target
+					target, ok = p1.skip(i)
+				}
+			} else {
+				i++
+			}
+		default:
+			if target, ok := p2.skip(j); ok && p2[target] <= p1[i] {
+				for ok && p2[target] <= p1[i] {
+					j = target
+					target, ok = p2.skip(j)
+				}
+			} else {
+				j++
+			}
+		}
+	}
+	return result
+}
+
+// Subtract returns the documents of p1 that are not in p2
+func Subtract(p1, p2 Postings) Postings {
+	result := Postings{}
+	j := 0
+	for _, docID := range p1 {
+		for j < len(p2) && p2[j] < docID {
+			j++
+		}
+		if j < len(p2) && p2[j] == docID {
+			continue
+		}
+		result = append(result, docID)
+	}
+	return result
+}
+
+// Union merges the documents of both postings lists
+func Union(p1, p2 Postings) Postings {
+	result := make(Postings, 0, len(p1)+len(p2))
+	i, j := 0, 0
+	for i < len(p1) && j < len(p2) {
+		switch {
+		case p1[i] == p2[j]:
+			result = append(result, p1[i])
+			i++
+			j++
+		case p1[i] < p2[j]:
+			result = append(result, p1[i])
+			i++
+		default:
+			result = append(result, p2[j])
+			j++
+		}
+	}
+	result = append(result, p1[i:]...)
+	return append(result, p2[j:]...)
+}
+
+// SymmetricDifference returns the documents in exactly one of the postings lists
+func SymmetricDifference(p1, p2 Postings) Postings {
+	return Union(Subtract(p1, p2), Subtract(p2, p1))
+}
@@ -0,0 +1,191 @@
+package engine
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// prefix that targets the filename/path field in boolean queries, e.g. name:report
+const NameFieldPrefix = "name:"
+
+// QueryNode is a node of the parsed boolean query
+type QueryNode struct {
+	Op       string       `json:"op"` // "term", "and", "or", "xor", "not"
+	Term     string       `json:"term,omitempty"`
+	Field    string       `json:"field,omitempty"` // "name" for name:term, otherwise the content
+	Children []*QueryNode `json:"children,omitempty"`
+
+	// filled in by the planner
+	Estimate     int  `json:"estimate"`
+	ShortCircuit bool `json:"shortCircuit,omitempty"`
+}
+
+// canonical text form of the node, used for de-duplication and plan output
+func (n *QueryNode) String() string {
+	switch n.Op {
+	case "term":
+		if n.Field == "name" {
+			return NameFieldPrefix + n.Term
+		}
+		return n.Term
+	case "not":
+		return "not(" + n.Children[0].String() + ")"
+	}
+
+	parts := make([]string, len(n.Children))
+	for i, child := range n.Children {
+		parts[i] = child.String()
+		if child.Op != "term" && child.Op != "not" && child.Op != n.Op {
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+	return strings.Join(parts, " "+n.Op+" ")
+}
+
+// splits the query into words and parentheses
+func tokenizeQuery(query string) []string {
+	var tokens []string
+	var current strings.Builder
+
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+
+	for _, r := range query {
+		switch {
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+type queryParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *queryParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *queryParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+// ParseQuery parses a lowercase boolean query; returns nil for an empty query
+//
+//	expr  := xor ("or" xor)*
+//	xor   := and ("xor" and)*
+//	and   := unary ("and" unary)*      "a and not b" is and(a, not(b))
+//	unary := "not" unary | "(" expr ")" | term
+func ParseQuery(query string) (*QueryNode, error) {
+	p := &queryParser{tokens: tokenizeQuery(query)}
+	if len(p.tokens) == 0 {
+		return nil, nil
+	}
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s' at position %d", p.peek(), p.pos+1)
+	}
+	return node, nil
+}
+
+func (p *queryParser) parseOr() (*QueryNode, error) {
+	return p.parseBinary("or", p.parseXor)
+}
+
+func (p *queryParser) parseXor() (*QueryNode, error) {
+	return p.parseBinary("xor", p.parseAnd)
+}
+
+func (p *queryParser) parseAnd() (*QueryNode, error) {
+	return p.parseBinary("and", p.parseUnary)
+}
+
+// parses operands separated by the operator into one n-ary node
+func (p *queryParser) parseBinary(op string, operand func() (*QueryNode, error)) (*QueryNode, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	children := []*QueryNode{first}
+	for p.peek() == op {
+		p.next()
+		child, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+
+	if len(children) == 1 {
+		return first, nil
+	}
+	return &QueryNode{Op: op, Children: children}, nil
+}
+
+func (p *queryParser) parseUnary() (*QueryNode, error) {
+	token := p.next()
+	switch token {
+	case "":
+		return nil, fmt.Errorf("unexpected end of query")
+	case "not":
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &QueryNode{Op: "not", Children: []*QueryNode{child}}, nil
+	case "(":
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return node, nil
+	case ")", "and", "or", "xor":
+		return nil, fmt.Errorf("unexpected '%s' at position %d", token, p.pos)
+	}
+	if field, ok := strings.CutPrefix(token, NameFieldPrefix); ok {
+		if field == "" {
+			return nil, fmt.Errorf("missing term after '%s'", NameFieldPrefix)
+		}
+		return &QueryNode{Op: "term", Field: "name", Term: field}, nil
+	}
+	return &QueryNode{Op: "term", Term: token}, nil
+}
+
+// NameTokens are the tokens of a document path: the lowercased base name and every alphanumeric part
+func NameTokens(docPath string) map[string]bool {
+	lowered := strings.ToLower(docPath)
+	tokens := map[string]bool{path.Base(lowered): true}
+	for _, part := range strings.FieldsFunc(lowered, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		tokens[part] = true
+	}
+	return tokens
+}
@@ -0,0 +1,64 @@
+package engine
+
+import "testing"
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"a", "a"},
+		{"a and b", "a and b"},
+		{"a xor b", "a xor b"},
+		{"a xor b xor c", "a xor b xor c"},
+		{"a and not b", "a and not(b)"},
+		{"not a and b", "not(a) and b"},
+		{"not not a", "not(not(a))"},
+		{"name:report and a", "name:report and a"},
+
+		// precedence: and binds tighter than xor, xor tighter than or
+		{"a or b and c", "a or (b and c)"},
+		{"a and b or c", "(a and b) or c"},
+		{"a xor b and c", "a xor (b and c)"},
+		{"a or b xor c", "a or (b xor c)"},
+		{"a xor b or c xor d", "(a xor b) or (c xor d)"},
+		{"a and not b or c", "(a and not(b)) or c"},
+		{"(a or b) and c", "(a or b) and c"},
+		{"(a xor b) and not (c or d)", "(a xor b) and not(c or d)"},
+	}
+	for _, test := range tests {
+		node, err := ParseQuery(test.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", test.query, err)
+			continue
+		}
+		if got := node.String(); got != test.want {
+			t.Errorf("ParseQuery(%q) = %s, want %s", test.query, got, test.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, query := range []string{
+		"a and",
+		"xor a",
+		"a xor",
+		"a and not",
+		"(a or b",
+		"a or b)",
+		"and not a",
+		"a not b",
+		"name:",
+	} {
+		if node, err := ParseQuery(query); err == nil {
+			t.Errorf("ParseQuery(%q) = %s, want an error", query, node)
+		}
+	}
+}
+
+func TestParseEmptyQuery(t *testing.T) {
+	node, err := ParseQuery("   ")
+	if node != nil || err != nil {
+		t.Errorf("ParseQuery of a blank query = %v, %v, want nil, nil", node, err)
+	}
+}
@@ -0,0 +1,248 @@
+package engine
+
+import (
+	"maps"
+	"math"
+	"sort"
+	"sync"
+)
+
+// TermStats are the term frequencies and length of a query or document
+type TermStats struct {
+	TermFreq map[string]int
+	Length   int // number of tokens
+}
+
+// CollectionStats are the corpus statistics shared by the scorers
+type CollectionStats struct {
+	Documents      int
+	TotalLength    int // tokens over all documents
+	DocFreq        map[string]int
+	CollectionFreq map[string]int
+}
+
+// NewCollectionStats accumulates the statistics of the documents
+func NewCollectionStats(docs []TermStats) CollectionStats {
+	stats := CollectionStats{
+		Documents:      len(docs),
+		DocFreq:        make(map[string]int),
+		CollectionFreq: make(map[string]int),
+	}
+	for _, doc := range docs {
+		stats.add(doc)
+	}
+	return stats
+}
+
+// WithDocuments returns the statistics with the documents added; the maps are
+// copied, so the receiver is left as it was for whoever still reads it
+func (c CollectionStats) WithDocuments(docs []TermStats) CollectionStats {
+	stats := CollectionStats{
+		Documents:      c.Documents + len(docs),
+		TotalLength:    c.TotalLength,
+		DocFreq:        maps.Clone(c.DocFreq),
+		CollectionFreq: maps.Clone(c.CollectionFreq),
+	}
+	for _, doc := range docs {
+		stats.add(doc)
+	}
+	return stats
+}
+
+func (c *CollectionStats) add(doc TermStats) {
+	c.TotalLength += doc.Length
+	for t, tf := range doc.TermFreq {
+		c.DocFreq[t]++
+		c.CollectionFreq[t] += tf
+	}
+}
+
+// AverageLength is the mean document length in tokens
+func (c CollectionStats) AverageLength() float64 {
+	if c.Documents == 0 {
+		return 0.0
+	}
+	return float64(c.TotalLength) / float64(c.Documents)
+}
+
+// IDF is log(N / df), 0 for unknown terms
+func (c CollectionStats) IDF(term string) float64 {
+	df := c.DocFreq[term]
+	if df == 0 || c.Documents == 0 {
+		return 0.0
+	}
+	return math.Log(float64(c.Documents) / float64(df))
+}
+
+// Scorer is a ranking function; higher scores rank first
+type Scorer interface {
+	Score(query, doc TermStats, collection CollectionStats) float64
+}
+
+var (
+	scorersMu sync.RWMutex
+	scorers   = map[string]Scorer{}
+)
+
+// RegisterScorer makes the scorer selectable by name, replacing an earlier one
+func RegisterScorer(name string, scorer Scorer) {
+	scorersMu.Lock()
+	defer scorersMu.Unlock()
+	scorers[name] = scorer
+}
+
+// LookupScorer returns the scorer registered under the name
+func LookupScorer(name string) (Scorer, bool) {
+	scorersMu.RLock()
+	defer scorersMu.RUnlock()
+	scorer, ok := scorers[name]
+	return scorer, ok
+}
+
+// ScorerNames lists the registered scorers alphabetically
+func ScorerNames() []string {
+	scorersMu.RLock()
+	defer scorersMu.RUnlock()
+	names := make([]string, 0, len(scorers))
+	for name := range scorers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterScorer("tfidf", TFIDFCosine{})
+	RegisterScorer("bm25", BM25{K1: 1.2, B: 0.75})
+	RegisterScorer("jaccard", Jaccard{})
+	RegisterScorer("dice", Dice{})
+	RegisterScorer("lm", LanguageModel{Mu: 2000})
+	RegisterScorer("lm-jm", JelinekMercer{Lambda: 0.1})
+}
+
+// TFIDFCosine is the cosine between length-normalized tf * log(N/df) vectors
+type TFIDFCosine struct{}
+
+func (TFIDFCosine) Score(query, doc TermStats, collection CollectionStats) float64 {
+	weight := func(stats TermStats, term string) float64 {
+		if stats.Length == 0 {
+			return 0.0
+		}
+		return float64(stats.TermFreq[term]) / float64(stats.Length) * collection.IDF(term)
+	}
+
+	dot, queryNorm, docNorm := 0.0, 0.0, 0.0
+	for t := range query.TermFreq {
+		q := weight(query, t)
+		dot += q * weight(doc, t)
+		queryNorm += q * q
+	}
+	for t := range doc.TermFreq {
+		d := weight(doc, t)
+		docNorm += d * d
+	}
+	if queryNorm == 0 || docNorm == 0 {
+		return 0.0
+	}
+	return dot / (math.Sqrt(queryNorm) * math.Sqrt(docNorm))
+}
+
+// BM25 is Okapi BM25 with an idf smoothed so that it never becomes negative
+type BM25 struct {
+	K1 float64
+	B  float64
+}
+
+func (s BM25) Score(query, doc TermStats, collection CollectionStats) float64 {
+	lengthNorm := 1 - s.B + s.B*float64(doc.Length)/collection.AverageLength()
+	score := 0.0
+	for term, qtf := range query.TermFreq {
+		tf := float64(doc.TermFreq[term])
+		if tf == 0 {
+			continue
+		}
+		df := float64(collection.DocFreq[term])
+		idf := math.Log(1 + (float64(collection.Documents)-df+0.5)/(df+0.5))
+		score += float64(qtf) * idf * tf * (s.K1 + 1) / (tf + s.K1*lengthNorm)
+	}
+	return score
+}
+
+// Jaccard is the overlap of the query and document term sets, |Q ∩ D| / |Q ∪ D|
+type Jaccard struct{}
+
+func (Jaccard) Score(query, doc TermStats, collection CollectionStats) float64 {
+	common := commonTerms(query, doc)
+	union := len(query.TermFreq) + len(doc.TermFreq) - common
+	if union == 0 {
+		return 0.0
+	}
+	return float64(common) / float64(union)
+}
+
+// Dice is the overlap of the query and document term sets, 2|Q ∩ D| / (|Q| + |D|);
+// it ranks like Jaccard for one query but weighs the overlap higher
+type Dice struct{}
+
+func (Dice) Score(query, doc TermStats, collection CollectionStats) float64 {
+	total := len(query.TermFreq) + len(doc.TermFreq)
+	if total == 0 {
+		return 0.0
+	}
+	return 2 * float64(commonTerms(query, doc)) / float64(total)
+}
+
+// number of distinct query terms occurring in the document
+func commonTerms(query, doc TermStats) int {
+	common := 0
+	for t := range query.TermFreq {
+		if doc.TermFreq[t] > 0 {
+			common++
+		}
+	}
+	return common
+}
+
+// LanguageModel is the query log-likelihood under the document language model
+// with Dirichlet smoothing; query terms unknown to the collection are skipped
+type LanguageModel struct {
+	Mu float64
+}
+
+func (s LanguageModel) Score(query, doc TermStats, collection CollectionStats) float64 {
+	score := 0.0
+	for term, qtf := range query.TermFreq {
+		cf := collection.CollectionFreq[term]
+		if cf == 0 || collection.TotalLength == 0 {
+			continue
+		}
+		background := float64(cf) / float64(collection.TotalLength)
+		p := (float64(doc.TermFreq[term]) + s.Mu*background) / (float64(doc.Length) + s.Mu)
+		score += float64(qtf) * math.Log(p)
+	}
+	return score
+}
+
+// JelinekMercer is the query log-likelihood under the document language model
+// interpolated with the collection model, Lambda being the weight of the latter;
+// query terms unknown to the collection are skipped
+type JelinekMercer struct {
+	Lambda float64
+}
+
+func (s JelinekMercer) Score(query, doc TermStats, collection CollectionStats) float64 {
+	score := 0.0
+	for term, qtf := range query.TermFreq {
+		cf := collection.CollectionFreq[term]
+		if cf == 0 || collection.TotalLength == 0 {
+			continue
+		}
+		background := float64(cf) / float64(collection.TotalLength)
+		foreground := 0.0
+		if doc.Length > 0 {
+			foreground = float64(doc.TermFreq[term]) / float64(doc.Length)
+		}
+		score += float64(qtf) * math.Log((1-s.Lambda)*foreground+s.Lambda*background)
+	}
+	return score
+}
@@ -0,0 +1,37 @@
+package engine
+
+import (
+	"hash/fnv"
+	"math/bits"
+)
+
+// SimHash is the 64-bit fingerprint of the terms weighted by their frequency
+// (Charikar, 2002): every term votes on each bit with its hash, so documents
+// sharing most of their terms differ in only a few bits
+func SimHash(termFreq map[string]int) uint64 {
+	var votes [64]int
+	for term, tf := range termFreq {
+		h := fnv.New64a()
+		h.Write([]byte(term))
+		hash := h.Sum64()
+		for bit := range 64 {
+			if hash&(1<<bit) != 0 {
+				votes[bit] += tf
+			} else {
+				votes[bit] -= tf
+			}
+		}
+	}
+	var fingerprint uint64
+	for bit, vote := range votes {
+		if vote > 0 {
+			fingerprint |= 1 << bit
+		}
+	}
+	return fingerprint
+}
+
+// HammingDistance counts the bits in which the fingerprints differ
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
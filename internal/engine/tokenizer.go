@@ -0,0 +1,99 @@
+// Package engine holds the tokenization, analysis and boolean indexing shared by the labs.
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+)
+
+// longest accepted run of non-whitespace characters
+const MaxTokenSize = 64 << 10
+
+// documents up to this size keep their normalized text in memory
+const MaxStoredContentSize = 1 << 20
+
+var ErrInvalidCharacters = errors.New("invalid characters")
+
+// Regex to validate document tokens
+var validationRegex = regexp.MustCompile(`^[a-z0-9\s\n\r]+$`)
+
+// ASCII whitespace, as matched by \s in the validation regex
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f'
+}
+
+// bufio.SplitFunc yielding runs of non-whitespace bytes
+func scanTokens(data []byte, atEOF bool) (int, []byte, error) {
+	start := 0
+	for start < len(data) && isSpace(data[start]) {
+		start++
+	}
+	for i := start; i < len(data); i++ {
+		if isSpace(data[i]) {
+			return i + 1, data[start:i], nil
+		}
+	}
+	if atEOF && len(data) > start {
+		return len(data), data[start:], nil
+	}
+	// request more data, dropping the whitespace already skipped
+	return start, nil, nil
+}
+
+// TokenizeStream reads the stream token by token with bounded memory, lowercasing
+// each token and rejecting the stream on the first token with invalid characters
+func TokenizeStream(r io.Reader, emit func(token string)) error {
+	return tokenizeStream(r, true, emit)
+}
+
+// TokenizeUnicodeStream reads the stream like TokenizeStream, accepting tokens
+// of any characters, for the "accept" policy
+func TokenizeUnicodeStream(r io.Reader, emit func(token string)) error {
+	return tokenizeStream(r, false, emit)
+}
+
+func tokenizeStream(r io.Reader, validate bool, emit func(token string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), MaxTokenSize)
+	scanner.Split(scanTokens)
+
+	for scanner.Scan() {
+		token := bytes.ToLower(scanner.Bytes())
+		// validation characters: a-z, 0-9
+		if validate && !validationRegex.Match(token) {
+			return ErrInvalidCharacters
+		}
+		emit(string(token))
+	}
+	return scanner.Err()
+}
+
+// ContentCapture keeps a copy of the stream until it grows past the limit
+type ContentCapture struct {
+	Limit    int
+	buf      bytes.Buffer
+	overflow bool
+}
+
+func (c *ContentCapture) Write(p []byte) (int, error) {
+	if c.overflow {
+		return len(p), nil
+	}
+	if c.buf.Len()+len(p) > c.Limit {
+		c.overflow = true
+		c.buf = bytes.Buffer{}
+		return len(p), nil
+	}
+	return c.buf.Write(p)
+}
+
+// Text returns the captured text and false when the stream overflowed the limit
+func (c *ContentCapture) Text() (string, bool) {
+	if c.overflow {
+		return "", false
+	}
+	return c.buf.String(), true
+}
@@ -0,0 +1,138 @@
+// Package grpcwire serves gRPC over cleartext HTTP/2 with the standard library:
+// length-prefixed protobuf messages, grpc-status trailers and streaming in
+// both directions. Messages are encoded by hand with the helpers below.
+package grpcwire
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("grpcwire: truncated message")
+
+// Encoder appends protobuf fields; zero values are skipped as in proto3
+type Encoder struct {
+	buf []byte
+}
+
+func (e *Encoder) Bytes() []byte { return e.buf }
+
+func (e *Encoder) tag(field, wire int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(field)<<3|uint64(wire))
+}
+
+func (e *Encoder) Uint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, wireVarint)
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+// Int writes an int32 or int64 field, negative values as ten-byte varints
+func (e *Encoder) Int(field int, v int64) {
+	e.Uint(field, uint64(v))
+}
+
+func (e *Encoder) Bool(field int, v bool) {
+	if v {
+		e.Uint(field, 1)
+	}
+}
+
+func (e *Encoder) Double(field int, v float64) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, wireFixed64)
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(v))
+}
+
+func (e *Encoder) String(field int, v string) {
+	if v == "" {
+		return
+	}
+	e.tag(field, wireBytes)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *Encoder) RawBytes(field int, v []byte) {
+	if len(v) == 0 {
+		return
+	}
+	e.String(field, string(v))
+}
+
+// Message writes an embedded message, also when it is empty, so that repeated
+// fields keep their elements
+func (e *Encoder) Message(field int, v []byte) {
+	e.tag(field, wireBytes)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+// Field is one decoded field; Value holds varints and fixed-width numbers,
+// Data the payload of length-delimited ones
+type Field struct {
+	Number int
+	Wire   int
+	Value  uint64
+	Data   []byte
+}
+
+func (f Field) Int() int64      { return int64(f.Value) }
+func (f Field) Bool() bool      { return f.Value != 0 }
+func (f Field) Double() float64 { return math.Float64frombits(f.Value) }
+func (f Field) String() string  { return string(f.Data) }
+
+// Decode calls fn for every field of a message in order; unknown fields can
+// simply be ignored by fn
+func Decode(msg []byte, fn func(Field) error) error {
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return errTruncated
+		}
+		msg = msg[n:]
+		f := Field{Number: int(key >> 3), Wire: int(key & 7)}
+		switch f.Wire {
+		case wireVarint:
+			if f.Value, n = binary.Uvarint(msg); n <= 0 {
+				return errTruncated
+			}
+			msg = msg[n:]
+		case wireFixed64:
+			if len(msg) < 8 {
+				return errTruncated
+			}
+			f.Value, msg = binary.LittleEndian.Uint64(msg), msg[8:]
+		case wireFixed32:
+			if len(msg) < 4 {
+				return errTruncated
+			}
+			f.Value, msg = uint64(binary.LittleEndian.Uint32(msg)), msg[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < size {
+				return errTruncated
+			}
+			f.Data, msg = msg[n:n+int(size)], msg[n+int(size):]
+		default:
+			return errors.New("grpcwire: unsupported wire type")
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
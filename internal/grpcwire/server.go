@@ -0,0 +1,156 @@
+package grpcwire
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// MaxMessageSize is the largest message accepted, the gRPC default
+const MaxMessageSize = 4 << 20
+
+// status codes used by the lab servers
+const (
+	OK                 = 0
+	InvalidArgument    = 3
+	NotFound           = 5
+	AlreadyExists      = 6
+	ResourceExhausted  = 8
+	FailedPrecondition = 9
+	Unimplemented      = 12
+	Internal           = 13
+)
+
+// Status is an error that carries a gRPC status code
+type Status struct {
+	Code    int
+	Message string
+}
+
+func (s *Status) Error() string {
+	return fmt.Sprintf("rpc error: code = %d desc = %s", s.Code, s.Message)
+}
+
+func Errorf(code int, format string, args ...any) error {
+	return &Status{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Stream is one call; unary methods receive and send a single message
+type Stream struct {
+	r *http.Request
+	w http.ResponseWriter
+}
+
+func (s *Stream) Context() context.Context { return s.r.Context() }
+
+// Recv reads the next request message, io.EOF once the client closed its side
+func (s *Stream) Recv() ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(s.r.Body, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, Errorf(InvalidArgument, "truncated message header")
+		}
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, Errorf(Unimplemented, "compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > MaxMessageSize {
+		return nil, Errorf(InvalidArgument, "message of %d bytes exceeds the limit of %d", size, MaxMessageSize)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(s.r.Body, msg); err != nil {
+		return nil, Errorf(InvalidArgument, "truncated message")
+	}
+	return msg, nil
+}
+
+// Send writes a response message and flushes it to the client
+func (s *Stream) Send(msg []byte) error {
+	var header [5]byte
+	binary.BigEndian.PutUint32(header[1:], uint32(len(msg)))
+	if _, err := s.w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := s.w.Write(msg); err != nil {
+		return err
+	}
+	http.NewResponseController(s.w).Flush()
+	return nil
+}
+
+// Handler serves one method; the returned error becomes the status of the call
+type Handler func(stream *Stream) error
+
+// Server routes "/package.Service/Method" paths to their handlers
+type Server struct {
+	methods map[string]Handler
+}
+
+func NewServer() *Server {
+	return &Server{methods: map[string]Handler{}}
+}
+
+// Handle registers a method by its full name, e.g. "ir.v1.SearchService/Search"
+func (s *Server) Handle(method string, h Handler) {
+	s.methods["/"+method] = h
+}
+
+// Unary adapts a function of one request message to a Handler
+func Unary(fn func(ctx context.Context, req []byte) ([]byte, error)) Handler {
+	return func(stream *Stream) error {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return Errorf(InvalidArgument, "missing request message")
+		}
+		if err != nil {
+			return err
+		}
+		resp, err := fn(stream.Context(), req)
+		if err != nil {
+			return err
+		}
+		return stream.Send(resp)
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+
+	err := Errorf(Unimplemented, "unknown method %s", r.URL.Path)
+	if h, ok := s.methods[r.URL.Path]; ok {
+		err = h(&Stream{r: r, w: w})
+	}
+
+	status := &Status{Code: OK}
+	if err != nil {
+		var ok bool
+		if status, ok = err.(*Status); !ok {
+			status = &Status{Code: Internal, Message: err.Error()}
+		}
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(status.Code))
+	if status.Message != "" {
+		w.Header().Set("Grpc-Message", url.PathEscape(status.Message))
+	}
+}
+
+// ListenAndServe serves the methods on addr over cleartext HTTP/2, which is
+// what gRPC clients dial without TLS
+func (s *Server) ListenAndServe(addr string) error {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	server := &http.Server{Addr: addr, Handler: s, Protocols: &protocols}
+	return server.ListenAndServe()
+}
@@ -0,0 +1,339 @@
+// Package kv is a small embedded key-value store: an append-only log file with an
+// in-memory map from key to record position, so values are read from disk on demand.
+package kv
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	opPut    byte = 0
+	opDelete byte = 1
+)
+
+// record layout: crc32 (4 bytes) | op (1) | key length (uvarint) | value length (uvarint) | key | value;
+// the checksum covers everything after it
+type location struct {
+	offset int64 // of the value
+	size   int
+}
+
+// DB is safe for concurrent use
+type DB struct {
+	mu      sync.RWMutex
+	file    *os.File
+	size    int64
+	keys    map[string]location
+	garbage int64 // bytes of overwritten and deleted records
+}
+
+// Open opens or creates the log at path; a torn record at the end, e.g. after a
+// crash during a write, is cut off. A record that fails its checksum is
+// corruption rather than an interrupted write and fails the Open, leaving the
+// file as it is
+func Open(path string) (*DB, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{file: file, keys: make(map[string]location)}
+	if err := db.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func (db *DB) load() error {
+	info, err := db.file.Stat()
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReader(db.file)
+	var offset int64
+	for {
+		op, key, value, n, err := readRecord(reader, info.Size()-offset)
+		if err == io.EOF {
+			break
+		}
+		if err == io.ErrUnexpectedEOF {
+			// the last write stopped partway: only the records before it were acknowledged
+			if err := db.file.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("kv: record at offset %d of %s: %w", offset, db.file.Name(), err)
+		}
+		if old, ok := db.keys[key]; ok {
+			db.garbage += int64(old.size + len(key))
+		}
+		if op == opDelete {
+			delete(db.keys, key)
+			db.garbage += n
+		} else {
+			db.keys[key] = location{offset: offset + n - int64(len(value)), size: len(value)}
+		}
+		offset += n
+	}
+	db.size = offset
+	return nil
+}
+
+var (
+	errChecksum = errors.New("checksum mismatch")
+	errOp       = errors.New("unknown operation")
+)
+
+// reads the next record of the remaining bytes of the log: io.EOF at the end of
+// the last record, io.ErrUnexpectedEOF when the log ends inside a record
+func readRecord(r *bufio.Reader, remaining int64) (op byte, key string, value []byte, n int64, err error) {
+	var header [5]byte
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		return
+	}
+	keyLength, err := binary.ReadUvarint(r)
+	if err != nil {
+		err = io.ErrUnexpectedEOF
+		return
+	}
+	valueLength, err := binary.ReadUvarint(r)
+	if err != nil {
+		err = io.ErrUnexpectedEOF
+		return
+	}
+	// the lengths are not checked by the checksum yet, a record cannot be longer
+	// than the rest of the log
+	body := remaining - int64(len(header)+uvarintLength(keyLength)+uvarintLength(valueLength))
+	if body < 0 || keyLength > uint64(body) || valueLength > uint64(body)-keyLength {
+		err = io.ErrUnexpectedEOF
+		return
+	}
+	data := make([]byte, keyLength+valueLength)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return
+	}
+
+	op = header[4]
+	record := encodeRecord(op, string(data[:keyLength]), data[keyLength:])
+	if binary.LittleEndian.Uint32(header[:4]) != binary.LittleEndian.Uint32(record[:4]) {
+		err = errChecksum
+		return
+	}
+	if op != opPut && op != opDelete {
+		err = errOp
+		return
+	}
+	return op, string(data[:keyLength]), data[keyLength:], int64(len(record)), nil
+}
+
+func uvarintLength(x uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], x)
+}
+
+func encodeRecord(op byte, key string, value []byte) []byte {
+	record := make([]byte, 5, 5+2*binary.MaxVarintLen64+len(key)+len(value))
+	record[4] = op
+	record = binary.AppendUvarint(record, uint64(len(key)))
+	record = binary.AppendUvarint(record, uint64(len(value)))
+	record = append(record, key...)
+	record = append(record, value...)
+	binary.LittleEndian.PutUint32(record[:4], crc32.ChecksumIEEE(record[4:]))
+	return record
+}
+
+// Get returns the value of the key, or false when it does not exist
+func (db *DB) Get(key string) ([]byte, bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	loc, ok := db.keys[key]
+	if !ok {
+		return nil, false, nil
+	}
+	value := make([]byte, loc.size)
+	if _, err := db.file.ReadAt(value, loc.offset); err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Keys lists the keys with the prefix in ascending order
+func (db *DB) Keys(prefix string) []string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	keys := []string{}
+	for key := range db.keys {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Len is the number of live keys
+func (db *DB) Len() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return len(db.keys)
+}
+
+// Batch collects writes that are applied together by Write
+type Batch struct {
+	records [][]byte
+	ops     []batchOp
+}
+
+type batchOp struct {
+	op    byte
+	key   string
+	value []byte
+}
+
+func (b *Batch) Put(key string, value []byte) {
+	b.records = append(b.records, encodeRecord(opPut, key, value))
+	b.ops = append(b.ops, batchOp{op: opPut, key: key, value: value})
+}
+
+func (b *Batch) Delete(key string) {
+	b.records = append(b.records, encodeRecord(opDelete, key, nil))
+	b.ops = append(b.ops, batchOp{op: opDelete, key: key})
+}
+
+// Len is the number of queued writes
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Write appends the batch with a single write and sync
+func (db *DB) Write(b *Batch) error {
+	if b.Len() == 0 {
+		return nil
+	}
+
+	var buf []byte
+	for _, record := range b.records {
+		buf = append(buf, record...)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, err := db.file.WriteAt(buf, db.size); err != nil {
+		db.file.Truncate(db.size)
+		return err
+	}
+	if err := db.file.Sync(); err != nil {
+		return err
+	}
+
+	offset := db.size
+	for i, op := range b.ops {
+		n := int64(len(b.records[i]))
+		if old, ok := db.keys[op.key]; ok {
+			db.garbage += int64(old.size + len(op.key))
+		}
+		if op.op == opDelete {
+			delete(db.keys, op.key)
+			db.garbage += n
+		} else {
+			db.keys[op.key] = location{offset: offset + n - int64(len(op.value)), size: len(op.value)}
+		}
+		offset += n
+	}
+	db.size = offset
+	return nil
+}
+
+// Put writes a single key
+func (db *DB) Put(key string, value []byte) error {
+	var b Batch
+	b.Put(key, value)
+	return db.Write(&b)
+}
+
+// Stats reports the log size and the share taken by overwritten or deleted records
+func (db *DB) Stats() (size, garbage int64) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.size, db.garbage
+}
+
+// Compact rewrites the log with only the live records
+func (db *DB) Compact() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tmpPath := db.file.Name() + ".compact"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(db.keys))
+	for key := range db.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	writer := bufio.NewWriter(tmp)
+	live := make(map[string]location, len(keys))
+	var offset int64
+	for _, key := range keys {
+		loc := db.keys[key]
+		value := make([]byte, loc.size)
+		if _, err := db.file.ReadAt(value, loc.offset); err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+		record := encodeRecord(opPut, key, value)
+		writer.Write(record)
+		n := int64(len(record))
+		live[key] = location{offset: offset + n - int64(len(value)), size: len(value)}
+		offset += n
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, db.file.Name()); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	db.file.Close()
+	db.file, db.keys, db.size, db.garbage = tmp, live, offset, 0
+	return nil
+}
+
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.file == nil {
+		return fmt.Errorf("kv: already closed")
+	}
+	err := db.file.Close()
+	db.file = nil
+	return err
+}
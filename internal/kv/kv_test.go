@@ -0,0 +1,224 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func open(t *testing.T, path string) *DB {
+	t.Helper()
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return db
+}
+
+func get(t *testing.T, db *DB, key string) (string, bool) {
+	t.Helper()
+	value, ok, err := db.Get(key)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", key, err)
+	}
+	return string(value), ok
+}
+
+// writes a, b and c, then overwrites a and deletes b
+func fill(t *testing.T, db *DB) {
+	t.Helper()
+	var batch Batch
+	batch.Put("a", []byte("1"))
+	batch.Put("b", []byte("2"))
+	batch.Put("c", []byte("3"))
+	if err := db.Write(&batch); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	batch = Batch{}
+	batch.Put("a", []byte("one"))
+	batch.Delete("b")
+	if err := db.Write(&batch); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+}
+
+func checkFilled(t *testing.T, db *DB) {
+	t.Helper()
+	want := map[string]string{"a": "one", "c": "3"}
+	if keys := db.Keys(""); !slices.Equal(keys, []string{"a", "c"}) {
+		t.Errorf("Keys = %v, want [a c]", keys)
+	}
+	for key, value := range want {
+		if got, ok := get(t, db, key); !ok || got != value {
+			t.Errorf("Get(%q) = %q, %v, want %q", key, got, ok, value)
+		}
+	}
+	if _, ok := get(t, db, "b"); ok {
+		t.Errorf("Get(b) found a deleted key")
+	}
+}
+
+func TestReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.kv")
+	db := open(t, path)
+	fill(t, db)
+	checkFilled(t, db)
+	db.Close()
+
+	db = open(t, path)
+	defer db.Close()
+	checkFilled(t, db)
+	if keys := db.Keys("c"); !slices.Equal(keys, []string{"c"}) {
+		t.Errorf("Keys(c) = %v, want [c]", keys)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.kv")
+	db := open(t, path)
+	fill(t, db)
+	if _, garbage := db.Stats(); garbage == 0 {
+		t.Errorf("no garbage after an overwrite and a delete")
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	size, garbage := db.Stats()
+	if garbage != 0 {
+		t.Errorf("garbage = %d after Compact, want 0", garbage)
+	}
+	checkFilled(t, db)
+
+	// the compacted log is the one written to and reopened
+	if err := db.Put("d", []byte("4")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	db.Close()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := size + int64(len(encodeRecord(opPut, "d", []byte("4")))); info.Size() != want {
+		t.Errorf("log size = %d, want %d", info.Size(), want)
+	}
+	db = open(t, path)
+	defer db.Close()
+	if got, ok := get(t, db, "d"); !ok || got != "4" {
+		t.Errorf("Get(d) = %q, %v after reopening the compacted log", got, ok)
+	}
+	if keys := db.Keys(""); !slices.Equal(keys, []string{"a", "c", "d"}) {
+		t.Errorf("Keys = %v, want [a c d]", keys)
+	}
+}
+
+func TestTornTail(t *testing.T) {
+	record := encodeRecord(opPut, "d", []byte("a value cut short"))
+	tests := []struct {
+		name string
+		tail []byte
+	}{
+		{"header", record[:3]},
+		{"lengths", record[:6]},
+		{"body", record[:len(record)-4]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.kv")
+			db := open(t, path)
+			fill(t, db)
+			size, _ := db.Stats()
+			db.Close()
+			appendBytes(t, path, test.tail)
+
+			db = open(t, path)
+			defer db.Close()
+			checkFilled(t, db)
+			if info, _ := os.Stat(path); info.Size() != size {
+				t.Errorf("log size = %d, want the torn record cut off at %d", info.Size(), size)
+			}
+			if err := db.Put("e", []byte("5")); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			if got, ok := get(t, db, "e"); !ok || got != "5" {
+				t.Errorf("Get(e) = %q, %v after writing past the cut", got, ok)
+			}
+		})
+	}
+}
+
+func TestCorruptRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(log []byte)
+		want    error
+	}{
+		// a flipped bit in the value of b, the first record but one
+		{"value", func(log []byte) { log[bytes.Index(log, []byte("b2"))+1] ^= 1 }, errChecksum},
+		{"operation", func(log []byte) {
+			i := bytes.Index(log, []byte("b2")) - 7
+			log[i+4] = 7
+			binary.LittleEndian.PutUint32(log[i:], crc32.ChecksumIEEE(log[i+4:i+9]))
+		}, errOp},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.kv")
+			db := open(t, path)
+			fill(t, db)
+			db.Close()
+			log, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.corrupt(log)
+			if err := os.WriteFile(path, log, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := Open(path); !errors.Is(err, test.want) {
+				t.Fatalf("Open = %v, want %v", err, test.want)
+			}
+			// the records after the corrupt one are still in the file
+			if after, _ := os.ReadFile(path); !bytes.Equal(after, log) {
+				t.Errorf("Open changed the corrupt log: %d bytes, was %d", len(after), len(log))
+			}
+		})
+	}
+}
+
+// a record claiming a length past the end of the log is not read into memory
+func TestOversizedLength(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.kv")
+	db := open(t, path)
+	fill(t, db)
+	size, _ := db.Stats()
+	db.Close()
+	header := []byte{0, 0, 0, 0, opPut}
+	header = binary.AppendUvarint(header, 1)
+	header = binary.AppendUvarint(header, 1<<62)
+	appendBytes(t, path, header)
+
+	db = open(t, path)
+	defer db.Close()
+	checkFilled(t, db)
+	if got, _ := db.Stats(); got != size {
+		t.Errorf("log size = %d, want %d", got, size)
+	}
+}
+
+func appendBytes(t *testing.T, path string, data []byte) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,165 @@
+// Package robots parses robots.txt files (RFC 9309) and answers whether a user
+// agent may fetch a path, including the non-standard Crawl-delay.
+package robots
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bytes of a robots.txt that are read, as RFC 9309 allows parsers to limit it
+const MaxSize = 500 << 10
+
+type rule struct {
+	allow   bool
+	pattern string
+}
+
+type group struct {
+	agents     []string // lowercased product tokens, "*" for every agent
+	rules      []rule
+	crawlDelay time.Duration
+}
+
+// Rules are the groups of a parsed robots.txt
+type Rules struct {
+	groups   []group
+	Sitemaps []string
+}
+
+// AllowAll are the rules of a site without a robots.txt
+var AllowAll = &Rules{}
+
+// DisallowAll are the rules of a site whose robots.txt could not be fetched
+var DisallowAll = &Rules{groups: []group{{agents: []string{"*"}, rules: []rule{{allow: false, pattern: "/"}}}}}
+
+// Parse reads the groups of user agents with their allow and disallow rules;
+// unknown lines and lines outside a group are ignored
+func Parse(r io.Reader) *Rules {
+	rules := &Rules{}
+	var current *group
+	inAgents := false // consecutive user-agent lines start one group
+
+	scanner := bufio.NewScanner(io.LimitReader(r, MaxSize))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				rules.groups = append(rules.groups, group{})
+				current = &rules.groups[len(rules.groups)-1]
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			inAgents = true
+			continue
+		case "allow", "disallow":
+			if current != nil && (value != "" || key == "allow") {
+				current.rules = append(current.rules, rule{allow: key == "allow", pattern: value})
+			}
+		case "crawl-delay":
+			if seconds, err := strconv.ParseFloat(value, 64); current != nil && err == nil && seconds >= 0 {
+				current.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		case "sitemap":
+			rules.Sitemaps = append(rules.Sitemaps, value)
+		}
+		inAgents = false
+	}
+	return rules
+}
+
+// the product token of a user agent string, e.g. "irbot" of "IRBot/1.0 (+https://...)"
+func productToken(userAgent string) string {
+	token, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(userAgent)), "/")
+	token, _, _ = strings.Cut(token, " ")
+	return token
+}
+
+// the groups that apply to the agent: those naming its product token, merged,
+// otherwise those for "*"
+func (r *Rules) groupsFor(userAgent string) []group {
+	token := productToken(userAgent)
+	var named, any []group
+	for _, g := range r.groups {
+		for _, agent := range g.agents {
+			if agent == token && token != "" {
+				named = append(named, g)
+				break
+			}
+			if agent == "*" {
+				any = append(any, g)
+				break
+			}
+		}
+	}
+	if len(named) > 0 {
+		return named
+	}
+	return any
+}
+
+// Allowed reports whether the agent may fetch the path (with its query): the
+// longest matching rule decides, allow wins a tie, and no match allows it
+func (r *Rules) Allowed(userAgent, path string) bool {
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+	allowed, longest := true, -1
+	for _, g := range r.groupsFor(userAgent) {
+		for _, rule := range g.rules {
+			if !match(rule.pattern, path) {
+				continue
+			}
+			if n := len(rule.pattern); n > longest || n == longest && rule.allow {
+				allowed, longest = rule.allow, n
+			}
+		}
+	}
+	return allowed
+}
+
+// CrawlDelay is the delay the site asks of the agent between requests, 0 without one
+func (r *Rules) CrawlDelay(userAgent string) time.Duration {
+	var delay time.Duration
+	for _, g := range r.groupsFor(userAgent) {
+		delay = max(delay, g.crawlDelay)
+	}
+	return delay
+}
+
+// matches a path against a pattern where "*" is any sequence of characters and
+// a final "$" anchors the end; patterns are prefixes otherwise
+func match(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if i == len(parts)-2 && anchored {
+			return strings.HasSuffix(rest, part)
+		}
+		j := strings.Index(rest, part)
+		if j < 0 {
+			return false
+		}
+		rest = rest[j+len(part):]
+	}
+	return !anchored || rest == ""
+}
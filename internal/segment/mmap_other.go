@@ -0,0 +1,14 @@
+//go:build !unix
+
+package segment
+
+import "os"
+
+// no mmap outside unix, the file is read into memory instead
+func mmapFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func munmap(data []byte) error {
+	return nil
+}
@@ -0,0 +1,172 @@
+// Package segment stores an inverted index as immutable segments, in memory or as
+// memory-mapped files of which only the term dictionary is held in RAM.
+package segment
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+
+	"ir/internal/engine"
+)
+
+// file layout: magic | postings | dictionary | footer. The dictionary holds, for
+// each term, term length and term followed by offset and length of its compressed
+// postings (uvarints); the footer holds base, documents, terms and the dictionary
+// offset as little-endian uint64s followed by the magic again.
+const (
+	magic      = "IRSEG02\n" // 02: postings carry skip tables
+	footerSize = 4*8 + len(magic)
+)
+
+var ErrCorrupt = errors.New("segment: corrupt file")
+
+type span struct {
+	offset, length int
+}
+
+// Segment is an opened, read-only segment covering the documents
+// base .. base+documents-1
+type Segment struct {
+	path      string // empty for segments held in memory
+	data      []byte // memory-mapped file or encoded segment
+	base      int
+	documents int
+	terms     map[string]span
+}
+
+// encodes the index of documents base .. base+documents-1
+func encode(index engine.Index, base, documents int) []byte {
+	data := []byte(magic)
+	var dictionary []byte
+	for term, postings := range index {
+		compressed := engine.Compress(postings)
+		dictionary = binary.AppendUvarint(dictionary, uint64(len(term)))
+		dictionary = append(dictionary, term...)
+		dictionary = binary.AppendUvarint(dictionary, uint64(len(data)))
+		dictionary = binary.AppendUvarint(dictionary, uint64(len(compressed)))
+		data = append(data, compressed...)
+	}
+	dictOffset := len(data)
+	data = append(data, dictionary...)
+	for _, n := range []int{base, documents, len(index), dictOffset} {
+		data = binary.LittleEndian.AppendUint64(data, uint64(n))
+	}
+	return append(data, magic...)
+}
+
+// Build encodes the index of documents base .. base+documents-1 as a segment kept in memory
+func Build(index engine.Index, base, documents int) *Segment {
+	seg := &Segment{data: encode(index, base, documents)}
+	seg.load() // cannot fail on freshly encoded data
+	return seg
+}
+
+// Write stores the index of documents base .. base+documents-1 at path
+func Write(path string, index engine.Index, base, documents int) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	if _, err := file.Write(encode(index, base, documents)); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Open maps the segment file and reads its term dictionary
+func Open(path string) (*Segment, error) {
+	data, err := mmapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	seg := &Segment{path: path, data: data}
+	if err := seg.load(); err != nil {
+		munmap(data)
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return seg, nil
+}
+
+func (seg *Segment) load() error {
+	data := seg.data
+	if len(data) < len(magic)+footerSize || string(data[:len(magic)]) != magic || string(data[len(data)-len(magic):]) != magic {
+		return ErrCorrupt
+	}
+	footer := data[len(data)-footerSize:]
+	field := func(i int) int { return int(binary.LittleEndian.Uint64(footer[8*i:])) }
+	seg.base, seg.documents = field(0), field(1)
+	terms, dictOffset := field(2), field(3)
+	dictEnd := len(data) - footerSize
+	if dictOffset < len(magic) || dictOffset > dictEnd {
+		return ErrCorrupt
+	}
+
+	seg.terms = make(map[string]span, terms)
+	dictionary := data[dictOffset:dictEnd]
+	next := func() (int, bool) {
+		n, size := binary.Uvarint(dictionary)
+		if size <= 0 {
+			return 0, false
+		}
+		dictionary = dictionary[size:]
+		return int(n), true
+	}
+	for range terms {
+		termLen, ok := next()
+		if !ok || termLen > len(dictionary) {
+			return ErrCorrupt
+		}
+		term := string(dictionary[:termLen])
+		dictionary = dictionary[termLen:]
+		offset, ok1 := next()
+		length, ok2 := next()
+		if !ok1 || !ok2 || offset < len(magic) || offset+length > dictOffset {
+			return ErrCorrupt
+		}
+		seg.terms[term] = span{offset, length}
+	}
+	return nil
+}
+
+// Postings returns the compressed postings of the term; the slice points into the
+// segment data and is only valid until the segment is closed
+func (seg *Segment) Postings(term string) engine.CompressedPostings {
+	s, ok := seg.terms[term]
+	if !ok {
+		return nil
+	}
+	return seg.data[s.offset : s.offset+s.length]
+}
+
+func (seg *Segment) Base() int      { return seg.base }
+func (seg *Segment) Documents() int { return seg.documents }
+func (seg *Segment) Size() int      { return len(seg.data) }
+
+// Terms lists the dictionary in no particular order
+func (seg *Segment) Terms() []string {
+	terms := make([]string, 0, len(seg.terms))
+	for term := range seg.terms {
+		terms = append(terms, term)
+	}
+	return terms
+}
+
+func (seg *Segment) Close() error {
+	if seg.path == "" {
+		return nil
+	}
+	return munmap(seg.data)
+}
@@ -0,0 +1,95 @@
+package segment
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"ir/internal/engine"
+)
+
+// documents 10-14: a in all, b in 11 and 13, c in 14
+var testIndex = engine.Index{
+	"a": {10, 11, 12, 13, 14},
+	"b": {11, 13},
+	"c": {14},
+}
+
+func checkPostings(t *testing.T, name string, postings func(string) engine.CompressedPostings, want engine.Index) {
+	t.Helper()
+	for term, p := range want {
+		if got := postings(term).Decode(); !slices.Equal(got, p) {
+			t.Errorf("%s: Postings(%q) = %v, want %v", name, term, got, p)
+		}
+	}
+	if got := postings("missing"); got.Len() != 0 {
+		t.Errorf("%s: Postings(missing) = %v, want none", name, got.Decode())
+	}
+}
+
+func TestWriteOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.seg")
+	if err := Write(path, testIndex, 10, 5); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+	seg, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer seg.Close()
+
+	if seg.Base() != 10 || seg.Documents() != 5 {
+		t.Errorf("Open: base %d, documents %d, want 10, 5", seg.Base(), seg.Documents())
+	}
+	terms := seg.Terms()
+	slices.Sort(terms)
+	if !slices.Equal(terms, []string{"a", "b", "c"}) {
+		t.Errorf("Terms = %v, want [a b c]", terms)
+	}
+	checkPostings(t, "Open", seg.Postings, testIndex)
+
+	built := Build(testIndex, 10, 5)
+	checkPostings(t, "Build", built.Postings, testIndex)
+	if built.Size() != seg.Size() {
+		t.Errorf("Build: %d bytes, the file has %d", built.Size(), seg.Size())
+	}
+}
+
+func TestOpenCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.seg")
+	if err := Write(good, testIndex, 0, 15); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	data, err := os.ReadFile(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated", data[:len(data)-3]},
+		{"no footer", data[:len(magic)+4]},
+		{"other magic", append([]byte("IRSEG00\n"), data[len(magic):]...)},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, "bad.seg")
+		if err := os.WriteFile(path, test.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if seg, err := Open(path); !errors.Is(err, ErrCorrupt) {
+			if err == nil {
+				seg.Close()
+			}
+			t.Errorf("Open(%s) = %v, want ErrCorrupt", test.name, err)
+		}
+	}
+}
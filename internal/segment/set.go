@@ -0,0 +1,686 @@
+package segment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"ir/internal/engine"
+)
+
+// segments of a similar size are merged once this many have accumulated
+// (logarithmic merging, Manning et al., Introduction to IR, 4.5)
+const mergeFactor = 4
+
+// the buffer is flushed early once it holds this many documents
+const flushDocuments = 1000
+
+const manifestName = "segments.json"
+
+// the manifest lists the live segments; files not in it are leftovers of an
+// interrupted write or merge
+type manifest struct {
+	Next     int      `json:"next"`
+	Segments []string `json:"segments"`
+}
+
+// Info describes one segment
+type Info struct {
+	File      string `json:"file,omitempty"`
+	Base      int    `json:"base"`
+	Documents int    `json:"documents"`
+	Terms     int    `json:"terms"`
+	Bytes     int    `json:"bytes"`
+	Deleted   int    `json:"deleted"` // tombstoned documents still in the segment
+}
+
+// OptimizeStats reports what Optimize reclaimed
+type OptimizeStats struct {
+	SegmentsBefore int `json:"segmentsBefore"`
+	SegmentsAfter  int `json:"segmentsAfter"`
+	BytesBefore    int `json:"bytesBefore"`
+	BytesAfter     int `json:"bytesAfter"`
+	Purged         int `json:"purged"` // tombstoned documents removed from the segments
+}
+
+// documents indexed in memory but not yet written as a segment
+type buffer struct {
+	index     engine.Index
+	base      int
+	documents int
+}
+
+func (b *buffer) end() int {
+	return b.base + b.documents
+}
+
+// Set is the index of a sequence of segments with consecutive document ranges.
+// New documents go to an in-memory buffer that is flushed into a segment
+// periodically, and small segments are merged in the background, so writers
+// only hold the lock briefly. Deleted documents are tombstoned and filtered
+// from the postings until a merge drops them. Set is safe for concurrent use.
+type Set struct {
+	mu       sync.RWMutex
+	dir      string     // empty to keep the segments in memory
+	segments []*Segment // ordered by base
+	flushing *buffer    // being written as a segment, still searched
+	buffer   *buffer
+	next     int // sequence number of the next segment file
+	merging  bool
+
+	tombstones map[int]bool // deleted document IDs
+
+	// lock order: flushMu, mergeMu, mu
+	flushMu sync.Mutex // held while a flush writes its segment
+	mergeMu sync.Mutex // held while a merge reads its segments
+
+	kick chan struct{} // asks the flusher for an early flush
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewSet creates a set that keeps its segments in memory
+func NewSet() *Set {
+	return &Set{next: 1, kick: make(chan struct{}, 1), tombstones: make(map[int]bool)}
+}
+
+// OpenSet opens or creates a directory of memory-mapped segment files
+func OpenSet(dir string) (*Set, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := NewSet()
+	s.dir = dir
+
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	var m manifest
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("segment: invalid manifest: %v", err)
+		}
+		s.next = max(m.Next, 1)
+	}
+
+	live := make(map[string]bool)
+	for _, name := range m.Segments {
+		seg, err := Open(filepath.Join(dir, name))
+		if err != nil {
+			s.closeSegments()
+			return nil, err
+		}
+		if seg.base != s.documents() {
+			seg.Close()
+			s.closeSegments()
+			return nil, fmt.Errorf("segment: %s does not continue the document range", name)
+		}
+		s.segments = append(s.segments, seg)
+		live[name] = true
+	}
+
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		name := entry.Name()
+		if (strings.HasSuffix(name, ".seg") || strings.HasSuffix(name, ".tmp")) && !live[name] {
+			os.Remove(filepath.Join(dir, name))
+		}
+	}
+	return s, nil
+}
+
+// documents covered by the segments alone (caller holds the lock)
+func (s *Set) flushed() int {
+	if len(s.segments) == 0 {
+		return 0
+	}
+	last := s.segments[len(s.segments)-1]
+	return last.base + last.documents
+}
+
+// documents covered including the buffers (caller holds the lock)
+func (s *Set) documents() int {
+	switch {
+	case s.buffer != nil:
+		return s.buffer.end()
+	case s.flushing != nil:
+		return s.flushing.end()
+	}
+	return s.flushed()
+}
+
+// Documents is one past the highest document ID covered by the set
+func (s *Set) Documents() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.documents()
+}
+
+// Buffered is the number of documents not yet written as a segment
+func (s *Set) Buffered() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.documents() - s.flushed()
+}
+
+// Buffer indexes the terms of a document with an ID past the covered range in
+// memory; documents the segments already cover, e.g. after a restart, are
+// skipped, and IDs skipped over stay empty
+func (s *Set) Buffer(docID int, terms map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if docID < s.documents() {
+		return
+	}
+	if s.buffer == nil {
+		s.buffer = &buffer{index: engine.Index{}, base: s.documents()}
+	}
+	for term := range terms {
+		s.buffer.index[term] = append(s.buffer.index[term], docID)
+	}
+	s.buffer.documents = docID + 1 - s.buffer.base
+
+	if s.buffer.documents >= flushDocuments {
+		select {
+		case s.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Delete tombstones a document; its postings stay in the segment until the next
+// merge or Optimize
+func (s *Set) Delete(docID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if docID < s.documents() {
+		s.tombstones[docID] = true
+	}
+}
+
+// Deleted is the number of tombstoned documents
+func (s *Set) Deleted() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.tombstones)
+}
+
+// writes the manifest atomically (caller holds the write lock)
+func (s *Set) writeManifest() error {
+	if s.dir == "" {
+		return nil
+	}
+	m := manifest{Next: s.next, Segments: []string{}}
+	for _, seg := range s.segments {
+		m.Segments = append(m.Segments, filepath.Base(seg.path))
+	}
+	data, _ := json.Marshal(m)
+	path := filepath.Join(s.dir, manifestName)
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// path of a new segment file, empty for in-memory sets (caller holds the write lock)
+func (s *Set) newPath() string {
+	if s.dir == "" {
+		return ""
+	}
+	path := filepath.Join(s.dir, fmt.Sprintf("%06d.seg", s.next))
+	s.next++
+	return path
+}
+
+// writes a segment file at path, or builds it in memory when path is empty
+func create(path string, index engine.Index, base, documents int) (*Segment, error) {
+	if path == "" {
+		return Build(index, base, documents), nil
+	}
+	if err := Write(path, index, base, documents); err != nil {
+		return nil, err
+	}
+	return Open(path)
+}
+
+// Add stores the index of documents base .. base+documents-1 as a new segment;
+// base must continue the documents already covered
+func (s *Set) Add(index engine.Index, base, documents int) error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if base != s.documents() {
+		return fmt.Errorf("segment: documents start at %d, expected %d", base, s.documents())
+	}
+	if documents == 0 {
+		return nil
+	}
+	seg, err := create(s.newPath(), index, base, documents)
+	if err != nil {
+		return err
+	}
+	s.segments = append(s.segments, seg)
+	if err := s.writeManifest(); err != nil {
+		return err
+	}
+	s.maybeMerge()
+	return nil
+}
+
+// Flush writes the buffered documents as a new segment; searches see the buffer
+// until the segment replaces it. A failed flush is retried by the next one.
+func (s *Set) Flush() error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	if s.flushing == nil {
+		s.flushing, s.buffer = s.buffer, nil
+	}
+	pending := s.flushing
+	if pending == nil {
+		s.mu.Unlock()
+		return nil
+	}
+	path := s.newPath()
+	s.mu.Unlock()
+
+	seg, err := create(path, pending.index, pending.base, pending.documents)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.segments = append(s.segments, seg)
+	s.flushing = nil
+	if err := s.writeManifest(); err != nil {
+		return err
+	}
+	s.maybeMerge()
+	return nil
+}
+
+// Start flushes the buffer every interval, and early once it is full, until Close
+func (s *Set) Start(interval time.Duration) {
+	s.stop, s.done = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			case <-s.kick:
+			}
+			if err := s.Flush(); err != nil {
+				fmt.Println("Segment flush failed:", err)
+			}
+		}
+	}()
+}
+
+func tier(documents int) int {
+	if documents <= 1 {
+		return 0
+	}
+	return int(math.Log(float64(documents)) / math.Log(mergeFactor))
+}
+
+// starts a background merge when the last segments share a tier (caller holds the write lock)
+func (s *Set) maybeMerge() {
+	if s.merging || len(s.segments) < mergeFactor {
+		return
+	}
+	run := s.segments[len(s.segments)-mergeFactor:]
+	t := tier(run[0].documents)
+	for _, seg := range run[1:] {
+		if tier(seg.documents) != t {
+			return
+		}
+	}
+	s.merging = true
+	go s.merge(append([]*Segment(nil), run...))
+}
+
+// merges the run of consecutive segments into one; searches keep using the old
+// segments until the merged one replaces them
+func (s *Set) merge(run []*Segment) {
+	s.mergeMu.Lock()
+	defer s.mergeMu.Unlock()
+
+	if err := s.mergeRun(run); err != nil {
+		fmt.Println("Segment merge failed:", err)
+	}
+	s.finishMerge()
+}
+
+// writes the run as one segment without its tombstoned documents and swaps it
+// in (caller holds mergeMu)
+func (s *Set) mergeRun(run []*Segment) error {
+	last := run[len(run)-1]
+	base, end := run[0].base, last.base+last.documents
+
+	s.mu.Lock()
+	live := s.contains(run)
+	path := s.newPath()
+	purged := make(map[int]bool)
+	for docID := range s.tombstones {
+		if docID >= base && docID < end {
+			purged[docID] = true
+		}
+	}
+	s.mu.Unlock()
+	if !live { // reset meanwhile
+		return nil
+	}
+
+	merged := engine.Index{}
+	for _, seg := range run {
+		for term := range seg.terms {
+			for _, docID := range seg.Postings(term).Decode() {
+				if !purged[docID] {
+					merged[term] = append(merged[term], docID)
+				}
+			}
+		}
+	}
+	seg, err := create(path, merged, base, end-base)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	start := 0 // position of the run
+	for i, candidate := range s.segments {
+		if candidate == run[0] {
+			start = i
+			break
+		}
+	}
+	s.segments = append(append(s.segments[:start:start], seg), s.segments[start+len(run):]...)
+	for docID := range purged {
+		delete(s.tombstones, docID)
+	}
+	err = s.writeManifest()
+	s.mu.Unlock()
+
+	for _, old := range run {
+		// readers copy postings under the read lock, none refers to the old segments any more
+		old.Close()
+		if old.path != "" {
+			os.Remove(old.path)
+		}
+	}
+	return err
+}
+
+// Optimize flushes the buffer and merges all segments into one, dropping the
+// tombstoned documents
+func (s *Set) Optimize() (OptimizeStats, error) {
+	var stats OptimizeStats
+	if err := s.Flush(); err != nil {
+		return stats, err
+	}
+	s.mergeMu.Lock()
+	defer s.mergeMu.Unlock()
+
+	s.mu.RLock()
+	run := append([]*Segment(nil), s.segments...)
+	stats.Purged = len(s.tombstones)
+	s.mu.RUnlock()
+	stats.SegmentsBefore = len(run)
+	for _, seg := range run {
+		stats.BytesBefore += seg.Size()
+	}
+
+	if len(run) > 1 || len(run) == 1 && stats.Purged > 0 {
+		if err := s.mergeRun(run); err != nil {
+			return stats, err
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stats.SegmentsAfter = len(s.segments)
+	for _, seg := range s.segments {
+		stats.BytesAfter += seg.Size()
+	}
+	return stats, nil
+}
+
+func (s *Set) finishMerge() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.merging = false
+	s.maybeMerge()
+}
+
+// reports whether the run is still part of the set (caller holds the lock)
+func (s *Set) contains(run []*Segment) bool {
+	for i, seg := range s.segments {
+		if seg == run[0] {
+			return i+len(run) <= len(s.segments) && s.segments[i+len(run)-1] == run[len(run)-1]
+		}
+	}
+	return false
+}
+
+// Postings returns the term's postings across segments and buffers as a copy
+func (s *Set) Postings(term string) engine.CompressedPostings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var parts []engine.CompressedPostings
+	for _, seg := range s.segments {
+		if postings := seg.Postings(term); postings != nil {
+			parts = append(parts, postings)
+		}
+	}
+	var buffered engine.Postings
+	for _, b := range []*buffer{s.flushing, s.buffer} {
+		if b != nil {
+			buffered = append(buffered, b.index[term]...)
+		}
+	}
+	if len(parts) == 1 && len(buffered) == 0 && len(s.tombstones) == 0 {
+		return append(engine.CompressedPostings(nil), parts[0]...)
+	}
+	if len(parts) == 0 && len(buffered) == 0 {
+		return nil
+	}
+	var all engine.Postings
+	for _, part := range parts {
+		all = append(all, part.Decode()...)
+	}
+	return engine.Compress(s.live(append(all, buffered...)))
+}
+
+// drops tombstoned documents from the postings (caller holds the lock)
+func (s *Set) live(postings engine.Postings) engine.Postings {
+	if len(s.tombstones) == 0 {
+		return postings
+	}
+	kept := postings[:0]
+	for _, docID := range postings {
+		if !s.tombstones[docID] {
+			kept = append(kept, docID)
+		}
+	}
+	return kept
+}
+
+// Decode reads the whole index into memory
+func (s *Set) Decode() engine.Index {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	index := engine.Index{}
+	for _, seg := range s.segments {
+		for term := range seg.terms {
+			index[term] = append(index[term], seg.Postings(term).Decode()...)
+		}
+	}
+	for _, b := range []*buffer{s.flushing, s.buffer} {
+		if b != nil {
+			for term, postings := range b.index {
+				index[term] = append(index[term], postings...)
+			}
+		}
+	}
+	for term, postings := range index {
+		if postings = s.live(postings); len(postings) > 0 {
+			index[term] = postings
+		} else {
+			delete(index, term)
+		}
+	}
+	return index
+}
+
+// Stats measures the postings as stored in the segments; buffered postings are
+// counted as if they were flushed
+func (s *Set) Stats() engine.CompressionStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var stats engine.CompressionStats
+	terms := make(map[string]bool)
+	for _, seg := range s.segments {
+		for term := range seg.terms {
+			stats.Add(seg.Postings(term))
+			terms[term] = true
+		}
+	}
+	for _, b := range []*buffer{s.flushing, s.buffer} {
+		if b != nil {
+			for term, postings := range b.index {
+				stats.Add(engine.Compress(postings))
+				terms[term] = true
+			}
+		}
+	}
+	stats.Terms = len(terms)
+	return stats
+}
+
+// Segments describes the live segments in document order
+func (s *Set) Segments() []Info {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	infos := make([]Info, 0, len(s.segments))
+	for _, seg := range s.segments {
+		info := Info{Base: seg.base, Documents: seg.documents, Terms: len(seg.terms), Bytes: seg.Size()}
+		for docID := range s.tombstones {
+			if docID >= seg.base && docID < seg.base+seg.documents {
+				info.Deleted++
+			}
+		}
+		if seg.path != "" {
+			info.File = filepath.Base(seg.path)
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// Reset removes all segments and buffered documents
+func (s *Set) Reset() error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	s.mergeMu.Lock()
+	defer s.mergeMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, seg := range s.segments {
+		seg.Close()
+		if seg.path != "" {
+			os.Remove(seg.path)
+		}
+	}
+	s.segments, s.flushing, s.buffer = nil, nil, nil
+	s.tombstones = make(map[int]bool)
+	return s.writeManifest()
+}
+
+// Replace swaps all segments and buffered documents for one segment of the
+// index of documents 0 .. documents-1; the new segment is written before the
+// old ones are dropped, so the set is unchanged when that fails
+func (s *Set) Replace(index engine.Index, documents int) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	s.mergeMu.Lock()
+	defer s.mergeMu.Unlock()
+
+	s.mu.Lock()
+	path := s.newPath()
+	s.mu.Unlock()
+	var segments []*Segment
+	if documents > 0 {
+		seg, err := create(path, index, 0, documents)
+		if err != nil {
+			return err
+		}
+		segments = append(segments, seg)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.segments
+	s.segments = segments
+	if err := s.writeManifest(); err != nil {
+		s.segments = old
+		for _, seg := range segments {
+			seg.Close()
+			os.Remove(seg.path)
+		}
+		return err
+	}
+	for _, seg := range old {
+		seg.Close()
+		if seg.path != "" {
+			os.Remove(seg.path)
+		}
+	}
+	s.flushing, s.buffer = nil, nil
+	s.tombstones = make(map[int]bool)
+	return nil
+}
+
+func (s *Set) closeSegments() {
+	for _, seg := range s.segments {
+		seg.Close()
+	}
+	s.segments = nil
+}
+
+// Close stops the flusher, flushes the buffer and waits for a running merge
+func (s *Set) Close() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+	}
+	err := s.Flush()
+	s.mergeMu.Lock()
+	defer s.mergeMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeSegments()
+	return err
+}
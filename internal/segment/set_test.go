@@ -0,0 +1,232 @@
+package segment
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"ir/internal/engine"
+)
+
+func openSet(t *testing.T, dir string) *Set {
+	t.Helper()
+	s, err := OpenSet(dir)
+	if err != nil {
+		t.Fatalf("OpenSet: %v", err)
+	}
+	return s
+}
+
+// buffers documents first .. first+n-1, even ones with "even", all with "all"
+// and each with its own term, and flushes them as one segment
+func addDocuments(t *testing.T, s *Set, first, n int) {
+	t.Helper()
+	for docID := first; docID < first+n; docID++ {
+		terms := map[string]int{"all": 1, term(docID): 1}
+		if docID%2 == 0 {
+			terms["even"] = 1
+		}
+		s.Buffer(docID, terms)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+}
+
+func term(docID int) string {
+	return "doc" + string(rune('a'+docID%26)) + string(rune('a'+docID/26))
+}
+
+// files of the segments in the directory, in name order
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, match := range matches {
+		matches[i] = filepath.Base(match)
+	}
+	return matches
+}
+
+func checkSet(t *testing.T, name string, s *Set, documents int, deleted map[int]bool) {
+	t.Helper()
+	var all, even engine.Postings
+	for docID := range documents {
+		if deleted[docID] {
+			continue
+		}
+		all = append(all, docID)
+		if docID%2 == 0 {
+			even = append(even, docID)
+		}
+	}
+	if got := s.Documents(); got != documents {
+		t.Errorf("%s: Documents = %d, want %d", name, got, documents)
+	}
+	checkPostings(t, name, s.Postings, engine.Index{"all": all, "even": even})
+	if got := s.Decode()["all"]; !slices.Equal(got, all) {
+		t.Errorf("%s: Decode()[all] = %v, want %v", name, got, all)
+	}
+	for docID := range deleted {
+		if got := s.Postings(term(docID)); got.Len() != 0 {
+			t.Errorf("%s: deleted document %d still has postings %v", name, docID, got.Decode())
+		}
+	}
+}
+
+func TestSetReopen(t *testing.T) {
+	dir := t.TempDir()
+	s := openSet(t, dir)
+	addDocuments(t, s, 0, 10)
+	addDocuments(t, s, 10, 5)
+	s.Buffer(15, map[string]int{"all": 1, term(15): 1}) // written by Close
+	checkSet(t, "open", s, 16, nil)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	s = openSet(t, dir)
+	defer s.Close()
+	checkSet(t, "reopened", s, 16, nil)
+	if got := len(s.Segments()); got != 3 {
+		t.Errorf("reopened: %d segments, want 3", got)
+	}
+	if got := s.Buffered(); got != 0 {
+		t.Errorf("reopened: %d buffered documents, want 0", got)
+	}
+	// documents the segments cover are not buffered again
+	s.Buffer(3, map[string]int{"all": 1})
+	if got := s.Buffered(); got != 0 {
+		t.Errorf("Buffer(3) after reopening: %d buffered documents, want 0", got)
+	}
+}
+
+func TestOptimizePurgesTombstones(t *testing.T) {
+	dir := t.TempDir()
+	s := openSet(t, dir)
+	defer s.Close()
+	addDocuments(t, s, 0, 8)
+	addDocuments(t, s, 8, 100)
+	deleted := map[int]bool{0: true, 3: true, 50: true, 107: true}
+	for docID := range deleted {
+		s.Delete(docID)
+	}
+	checkSet(t, "tombstoned", s, 108, deleted)
+
+	stats, err := s.Optimize()
+	if err != nil {
+		t.Fatalf("Optimize: %v", err)
+	}
+	if stats.SegmentsBefore != 2 || stats.SegmentsAfter != 1 || stats.Purged != len(deleted) {
+		t.Errorf("Optimize = %+v, want 2 segments merged into 1 and %d purged", stats, len(deleted))
+	}
+	if stats.BytesAfter >= stats.BytesBefore {
+		t.Errorf("Optimize: %d bytes after, %d before", stats.BytesAfter, stats.BytesBefore)
+	}
+	if got := s.Deleted(); got != 0 {
+		t.Errorf("Deleted after Optimize = %d, want 0", got)
+	}
+	checkSet(t, "optimized", s, 108, deleted)
+	if files := segmentFiles(t, dir); len(files) != 1 {
+		t.Errorf("segment files after Optimize = %v, want one", files)
+	}
+
+	// the purged postings are gone from the file, not only filtered
+	reopened := openSet(t, dir)
+	defer reopened.Close()
+	checkSet(t, "reopened", reopened, 108, deleted)
+}
+
+func TestBackgroundMerge(t *testing.T) {
+	s := NewSet()
+	defer s.Close()
+	for i := range mergeFactor {
+		addDocuments(t, s, 10*i, 10)
+	}
+	s.Delete(15)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.Segments()) > 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := len(s.Segments()); got != 1 {
+		t.Fatalf("%d segments of the same tier, want them merged into 1", got)
+	}
+	if got := s.Deleted(); got != 0 {
+		t.Errorf("Deleted after the merge = %d, want 0", got)
+	}
+	checkSet(t, "merged", s, 10*mergeFactor, map[int]bool{15: true})
+}
+
+// a crash between writing a segment and renaming the manifest over the old
+// one leaves the new segment, the temporary manifest and possibly a partly
+// written segment behind; reopening keeps the segments of the old manifest
+func TestCrashDuringManifestWrite(t *testing.T) {
+	dir := t.TempDir()
+	s := openSet(t, dir)
+	addDocuments(t, s, 0, 10)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	kept := segmentFiles(t, dir)
+
+	orphan := filepath.Join(dir, "000099.seg")
+	if err := Write(orphan, engine.Index{"all": {10, 11}}, 10, 2); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	partial := filepath.Join(dir, "000100.seg.tmp")
+	torn := filepath.Join(dir, manifestName+".tmp")
+	for path, data := range map[string]string{partial: magic + "\x01\x02", torn: `{"next":101,"segments":["000001.seg","0000`} {
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s = openSet(t, dir)
+	checkSet(t, "reopened", s, 10, nil)
+	if files := segmentFiles(t, dir); !slices.Equal(files, kept) {
+		t.Errorf("segment files after reopening = %v, want %v", files, kept)
+	}
+	for _, path := range []string{orphan, partial, torn} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s left behind after reopening", filepath.Base(path))
+		}
+	}
+
+	// the next flush continues the documents of the old manifest
+	addDocuments(t, s, 10, 5)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	s = openSet(t, dir)
+	defer s.Close()
+	checkSet(t, "after the next flush", s, 15, nil)
+}
+
+func TestReplace(t *testing.T) {
+	dir := t.TempDir()
+	s := openSet(t, dir)
+	defer s.Close()
+	addDocuments(t, s, 0, 10)
+	addDocuments(t, s, 10, 10)
+	s.Delete(4)
+
+	if err := s.Replace(engine.Index{"all": {0, 1, 2}, "even": {0, 2}}, 3); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	checkSet(t, "replaced", s, 3, nil)
+	if got := s.Deleted(); got != 0 {
+		t.Errorf("Deleted after Replace = %d, want 0", got)
+	}
+	if files := segmentFiles(t, dir); len(files) != 1 {
+		t.Errorf("segment files after Replace = %v, want one", files)
+	}
+
+	reopened := openSet(t, dir)
+	defer reopened.Close()
+	checkSet(t, "reopened", reopened, 3, nil)
+}
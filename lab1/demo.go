@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"ir/internal/apierror"
+)
+
+// sample corpus bundled into the binary
+//
+//go:embed test/*.txt
+var demoCorpus embed.FS
+
+// DemoQuery is an example query with the documents it is expected to return
+type DemoQuery struct {
+	Query    string   `json:"query"`
+	Expected []string `json:"expected"`
+}
+
+const (
+	demoTermsFile   = "Terms.txt"
+	demoQueriesFile = "Search query.txt"
+)
+
+// indexes the bundled corpus and terms (caller holds the lock when serving requests)
+func loadDemoCorpus() ([]string, []DemoQuery) {
+	var errorMessages []string
+
+	entries, _ := demoCorpus.ReadDir("test")
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == demoTermsFile || name == demoQueriesFile {
+			continue
+		}
+		contentBytes, err := demoCorpus.ReadFile(path.Join("test", name))
+		if err != nil {
+			errorMessages = append(errorMessages, fmt.Sprintf("Error reading %s", name))
+			continue
+		}
+		if err := addDocument(name, bytes.NewReader(contentBytes)); err != nil {
+			errorMessages = append(errorMessages, err.Error())
+		}
+	}
+
+	if rawTerms, err := demoCorpus.ReadFile(path.Join("test", demoTermsFile)); err == nil {
+		state.Terms = normalizeTerms(string(rawTerms))
+	}
+
+	fmt.Printf("[Log] Demo corpus loaded. Documents: %d, Terms: %d\n", len(state.Documents), len(state.Terms))
+	return errorMessages, demoQueries()
+}
+
+// parses "query<TAB>doc1.txt, doc2.txt" lines from the bundled query file
+func demoQueries() []DemoQuery {
+	queries := []DemoQuery{}
+
+	raw, err := demoCorpus.ReadFile(path.Join("test", demoQueriesFile))
+	if err != nil {
+		return queries
+	}
+
+	for _, line := range strings.Split(string(raw), "\n") {
+		query, expected, found := strings.Cut(line, "\t")
+		if !found || strings.TrimSpace(query) == "" {
+			continue // only lines with an expected-result column
+		}
+		demoQuery := DemoQuery{Query: strings.TrimSpace(query), Expected: []string{}}
+		for _, name := range strings.Split(expected, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				demoQuery.Expected = append(demoQuery.Expected, name)
+			}
+		}
+		queries = append(queries, demoQuery)
+	}
+	return queries
+}
+
+// one-click loading of the demo corpus
+func demoLoadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	errorMessages, queries := loadDemoCorpus()
+
+	response := map[string]interface{}{
+		"documents": documentNames(),
+		"terms":     state.Terms,
+		"queries":   queries,
+		"errors":    errorMessages,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -1,3 +0,0 @@
-module lab1
-
-go 1.25.0
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"ir/internal/apierror"
+)
+
+// IncidenceMatrix is the binary terms x documents matrix
+type IncidenceMatrix struct {
+	Terms     []string `json:"terms"`
+	Documents []string `json:"documents"`
+	Matrix    [][]int  `json:"matrix"` // Matrix[term][document] is 1 if the term occurs in the document
+}
+
+// builds the incidence matrix over the given terms
+func buildIncidenceMatrix(terms []string) IncidenceMatrix {
+	matrix := IncidenceMatrix{
+		Terms:     terms,
+		Documents: documentNames(),
+		Matrix:    make([][]int, len(terms)),
+	}
+
+	for i, term := range terms {
+		row := make([]int, len(state.Documents))
+		for _, docID := range state.Index[term] {
+			row[docID] = 1
+		}
+		matrix.Matrix[i] = row
+	}
+	return matrix
+}
+
+// the whole vocabulary in alphabetical order
+func vocabulary() []string {
+	terms := make([]string, 0, len(state.Index))
+	for term := range state.Index {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	return terms
+}
+
+// the user-supplied terms without duplicates, in the order they were entered
+func definedTerms() []string {
+	terms := []string{}
+	seen := make(map[string]bool)
+	for _, term := range state.Terms {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// GET /api/incidence-matrix?format=json|csv&restrict=true
+func incidenceMatrixHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	format := params.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		apierror.Error(w, "Error: Unsupported format. Use json or csv.", http.StatusBadRequest)
+		return
+	}
+	restrict := params.Get("restrict") == "true"
+
+	state.Lock()
+	defer state.Unlock()
+
+	if restrict && len(state.Terms) == 0 {
+		apierror.Write(w, http.StatusBadRequest, "no_terms", "No terms defined. Please enter terms first.")
+		return
+	}
+
+	terms := vocabulary()
+	if restrict {
+		terms = definedTerms()
+	}
+	matrix := buildIncidenceMatrix(terms)
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="incidence-matrix.csv"`)
+
+		writer := csv.NewWriter(w)
+		writer.Write(append([]string{"term"}, matrix.Documents...))
+		for i, term := range matrix.Terms {
+			record := []string{term}
+			for _, v := range matrix.Matrix[i] {
+				record = append(record, strconv.Itoa(v))
+			}
+			writer.Write(record)
+		}
+		writer.Flush()
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(matrix)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"ir/internal/engine"
+)
+
+// above this share of damaged terms the whole index is rebuilt instead of single terms
+const fullReindexThreshold = 0.5
+
+type IntegrityReport struct {
+	Documents     int
+	Terms         int
+	Postings      int      // sum of document frequencies
+	RepairedTerms []string // terms whose postings were rebuilt
+	FullReindex   bool
+	NameIndex     bool // name index was rebuilt
+	Unverifiable  int  // documents without stored text, their postings are only range-checked
+}
+
+// postings are valid when strictly ascending and pointing into the document store
+func validPostings(postings engine.Postings) bool {
+	for i, docID := range postings {
+		if docID < 0 || docID >= len(state.Documents) || (i > 0 && postings[i-1] >= docID) {
+			return false
+		}
+	}
+	return true
+}
+
+// rebuilds the expected inverted index from the stored document text; documents
+// without text keep the in-range postings they currently have
+func expectedIndex() (engine.Index, int) {
+	expected := engine.Index{}
+	unverifiable := 0
+
+	for docID, doc := range state.Documents {
+		if doc.Content == "" {
+			unverifiable++
+			continue
+		}
+		terms := make(map[string]bool)
+		engine.TokenizeStream(strings.NewReader(doc.Content), func(token string) {
+			terms[token] = true
+		})
+		expected.Add(docID, terms)
+	}
+
+	if unverifiable > 0 {
+		for term, postings := range state.Index {
+			kept := engine.Postings{}
+			for _, docID := range postings {
+				if docID >= 0 && docID < len(state.Documents) && state.Documents[docID].Content == "" {
+					kept = append(kept, docID)
+				}
+			}
+			sort.Ints(kept)
+			if len(kept) > 0 {
+				expected[term] = engine.Union(expected[term], slices.Compact(kept))
+			}
+		}
+	}
+	return expected, unverifiable
+}
+
+// checks the index against the document store and repairs it in place,
+// logging every repair (caller holds the lock)
+func checkIndexIntegrity() IntegrityReport {
+	expected, unverifiable := expectedIndex()
+	report := IntegrityReport{Documents: len(state.Documents), Unverifiable: unverifiable}
+
+	structural := false
+	for term, postings := range state.Index {
+		if !validPostings(postings) {
+			fmt.Printf("[Log] Integrity: postings of '%s' are unsorted or out of range\n", term)
+			structural = true
+		}
+		if !slices.Equal(postings, expected[term]) {
+			report.RepairedTerms = append(report.RepairedTerms, term)
+		}
+	}
+	for term := range expected {
+		if _, ok := state.Index[term]; !ok {
+			report.RepairedTerms = append(report.RepairedTerms, term)
+		}
+	}
+	sort.Strings(report.RepairedTerms)
+
+	indexed, stored := 0, 0
+	for _, postings := range state.Index {
+		indexed += len(postings)
+	}
+	for _, postings := range expected {
+		stored += len(postings)
+	}
+	if indexed != stored {
+		fmt.Printf("[Log] Integrity: df sum is %d, document store implies %d\n", indexed, stored)
+	}
+
+	if len(report.RepairedTerms) > 0 {
+		report.FullReindex = structural || float64(len(report.RepairedTerms)) > fullReindexThreshold*float64(len(expected))
+		if report.FullReindex {
+			fmt.Printf("[Log] Integrity: %d of %d terms damaged, full reindex\n", len(report.RepairedTerms), len(expected))
+			state.Index = expected
+		} else {
+			for _, term := range report.RepairedTerms {
+				fmt.Printf("[Log] Integrity: rebuilt postings of '%s'\n", term)
+				if postings, ok := expected[term]; ok {
+					state.Index[term] = postings
+				} else {
+					delete(state.Index, term)
+				}
+			}
+		}
+	}
+
+	names := engine.Index{}
+	for docID, doc := range state.Documents {
+		names.Add(docID, engine.NameTokens(doc.Path))
+	}
+	if !equalIndexes(state.NameIndex, names) {
+		fmt.Println("[Log] Integrity: name index does not match the document paths, rebuilt")
+		state.NameIndex = names
+		report.NameIndex = true
+	}
+
+	report.Terms = len(state.Index)
+	for _, postings := range state.Index {
+		report.Postings += len(postings)
+	}
+	if len(report.RepairedTerms) == 0 && !report.NameIndex {
+		fmt.Printf("[Log] Integrity: OK (%d documents, %d terms, %d postings)\n", report.Documents, report.Terms, report.Postings)
+	}
+	return report
+}
+
+func equalIndexes(a, b engine.Index) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for term, postings := range a {
+		if !slices.Equal(postings, b[term]) {
+			return false
+		}
+	}
+	return true
+}
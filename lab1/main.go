@@ -2,40 +2,79 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"html/template"
 	"io"
 	"net/http"
-	"regexp"
 	"strings"
 	"sync"
+	"unicode"
+
+	"ir/internal/apierror"
+	"ir/internal/engine"
 )
 
 type SystemState struct {
 	sync.Mutex
-	Terms     []string
-	Documents []Document
+	Terms      []string
+	Documents  []Document
+	Templates  map[string]QueryTemplate
+	ResultSets map[string]ResultSet
+	Index      engine.Index
+	NameIndex  engine.Index
+	Analysis   engine.AnalysisConfig
 }
 
 type Document struct {
 	Name    string
-	Content string
+	Path    string // relative path when uploaded from a directory, otherwise the name
+	Content string // normalized text, empty for documents over engine.MaxStoredContentSize
 }
 
-var state = SystemState{
-	Terms:     []string{},
-	Documents: []Document{},
+type SearchResponse struct {
+	Results []string          `json:"results"`
+	Plan    *engine.QueryNode `json:"plan,omitempty"` // chosen evaluation order, on request
 }
 
-// Regex to validate document content
-var validationRegex = regexp.MustCompile(`^[a-z0-9\s\n\r]+$`)
+var state = SystemState{
+	Terms:      []string{},
+	Documents:  []Document{},
+	Templates:  map[string]QueryTemplate{},
+	ResultSets: map[string]ResultSet{},
+	Index:      engine.Index{},
+	NameIndex:  engine.Index{},
+	Analysis:   engine.DefaultAnalysisConfig,
+}
 
 func main() {
+	demo := flag.Bool("demo", false, "index the bundled demo corpus on startup")
+	flag.Parse()
+
+	if *demo {
+		if errorMessages, _ := loadDemoCorpus(); len(errorMessages) > 0 {
+			fmt.Println("[Log] Demo corpus skipped files:", strings.Join(errorMessages, "; "))
+		}
+	}
+
+	state.Lock()
+	checkIndexIntegrity()
+	state.Unlock()
+
 	http.HandleFunc("/", indexHandler)
 	http.HandleFunc("/api/update-terms", updateTermsHandler)
 	http.HandleFunc("/api/upload-doc", uploadDocHandler)
 	http.HandleFunc("/api/clear-docs", clearDocsHandler)
 	http.HandleFunc("/api/search", searchHandler)
+	http.HandleFunc("/api/templates", templatesHandler)
+	http.HandleFunc("/api/templates/run", runTemplateHandler)
+	http.HandleFunc("/api/demo/load", demoLoadHandler)
+	http.HandleFunc("/api/incidence-matrix", incidenceMatrixHandler)
+	http.HandleFunc("/api/analysis-config", analysisConfigHandler)
+	http.HandleFunc("/api/documents/lookup", documentLookupHandler)
+	http.HandleFunc("/api/result-sets", resultSetsHandler)
+	http.HandleFunc("/api/result-sets/combine", combineResultSetsHandler)
+	http.HandleFunc("/api/result-sets/materialize", materializeResultSetHandler)
 
 	fmt.Println("Server started at http://localhost:8080")
 	if err := http.ListenAndServe(":8080", nil); err != nil {
@@ -47,7 +86,7 @@ func main() {
 func indexHandler(w http.ResponseWriter, r *http.Request) {
 	tmpl, err := template.ParseFiles("index.html")
 	if err != nil {
-		http.Error(w, "Could not load index.html", http.StatusInternalServerError)
+		apierror.Error(w, "Could not load index.html", http.StatusInternalServerError)
 		return
 	}
 	tmpl.Execute(w, nil)
@@ -56,7 +95,7 @@ func indexHandler(w http.ResponseWriter, r *http.Request) {
 // saves the terms from the text area
 func updateTermsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -65,96 +104,124 @@ func updateTermsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		apierror.InvalidJSON(w)
 		return
 	}
 
 	state.Lock()
 	defer state.Unlock()
 
-	// Normalize: lowercase and split by whitespace
-	normalized := strings.ToLower(requestData.RawTerms)
-	state.Terms = strings.Fields(normalized)
+	state.Terms = normalizeTerms(requestData.RawTerms)
 
 	fmt.Printf("[Log] Terms updated. Count: %d\n", len(state.Terms))
 	w.WriteHeader(http.StatusOK)
 }
 
+// Normalize: lowercase and split by whitespace or commas
+func normalizeTerms(rawTerms string) []string {
+	return strings.FieldsFunc(strings.ToLower(rawTerms), func(r rune) bool {
+		return unicode.IsSpace(r) || r == ','
+	})
+}
+
 // saves the document content from uploaded files
 func uploadDocHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	r.ParseMultipartForm(10 << 20)
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		apierror.Error(w, "Error: Expected a multipart form with the files as 'documents'.", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
 	files := r.MultipartForm.File["documents"]
+	paths := r.MultipartForm.Value["paths"] // optional, one per file
+
+	state.Lock()
+	config := state.Analysis
+	state.Unlock()
+
+	// parse and analyze files concurrently, outside the lock
+	analyzed := analyzeUploads(files, config)
 
 	state.Lock()
 	defer state.Unlock()
 
-	var errorMessages []string
-
-	for _, fileHeader := range files {
-		func() {
-			file, err := fileHeader.Open()
-			if err != nil {
-				errorMessages = append(errorMessages, fmt.Sprintf("Error opening %s", fileHeader.Filename))
-				return
-			}
-			defer file.Close()
-
-			contentBytes, err := io.ReadAll(file)
-			if err != nil {
-				errorMessages = append(errorMessages, fmt.Sprintf("Error reading %s", fileHeader.Filename))
-				return
-			}
-
-			content := strings.ToLower(string(contentBytes))
-
-			if len(strings.TrimSpace(content)) == 0 {
-				errorMessages = append(errorMessages, fmt.Sprintf("File '%s' is empty", fileHeader.Filename))
-				return
-			}
-
-			// validation characters: a-z, 0-9, whitespace, newlines
-			if !validationRegex.MatchString(content) {
-				errorMessages = append(errorMessages, fmt.Sprintf("File '%s' ignored: invalid characters.", fileHeader.Filename))
-				return // continue
-			}
-
-			// check for duplicates by name
-			for _, doc := range state.Documents {
-				if doc.Name == fileHeader.Filename {
-					return
-				}
-			}
-			state.Documents = append(state.Documents, Document{
-				Name:    fileHeader.Filename,
-				Content: content,
-			})
-		}()
+	var uploadErrors []apierror.Detail
+	for i, upload := range analyzed {
+		if upload.err != nil {
+			uploadErrors = append(uploadErrors, apierror.DetailOf(files[i].Filename, upload.err, "read_error"))
+			continue
+		}
+		if len(paths) == len(files) && paths[i] != "" {
+			upload.doc.Path = paths[i]
+		}
+		insertDocument(upload.doc, upload.terms)
 	}
-
-	docNames := []string{}
-	for _, d := range state.Documents {
-		docNames = append(docNames, d.Name)
+	if len(files) > 0 && len(uploadErrors) == len(files) {
+		apierror.Write(w, http.StatusBadRequest, "upload_failed", "None of the files could be indexed.", uploadErrors...)
+		return
 	}
 
 	response := map[string]interface{}{
-		"documents": docNames,
-		"errors":    errorMessages,
+		"documents": documentNames(),
+		"errors":    uploadErrors,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// tokenizes the stream and stores it as a new document (caller holds the lock)
+func addDocument(name string, r io.Reader) error {
+	doc, terms, err := analyzeDocument(name, r, state.Analysis)
+	if err != nil {
+		return err
+	}
+	insertDocument(doc, terms)
+	return nil
+}
+
+// tokenizes the stream into a document and its unique terms; safe to call without the lock
+func analyzeDocument(name string, r io.Reader, config engine.AnalysisConfig) (Document, map[string]bool, error) {
+	analyzed, err := engine.Analyze(name, r, config)
+	if err != nil {
+		return Document{}, nil, err
+	}
+	return Document{Name: name, Path: name, Content: analyzed.Content}, analyzed.Terms(), nil
+}
+
+// stores and indexes an analyzed document unless one with the same name exists (caller holds the lock)
+func insertDocument(doc Document, terms map[string]bool) bool {
+	for _, existing := range state.Documents {
+		if existing.Name == doc.Name {
+			return false
+		}
+	}
+	state.Documents = append(state.Documents, doc)
+	state.Index.Add(len(state.Documents)-1, terms)
+	indexName(len(state.Documents)-1, doc.Path)
+	return true
+}
+
+// names of all uploaded documents in upload order
+func documentNames() []string {
+	docNames := []string{}
+	for _, d := range state.Documents {
+		docNames = append(docNames, d.Name)
+	}
+	return docNames
+}
+
 func clearDocsHandler(w http.ResponseWriter, r *http.Request) {
 	state.Lock()
 	defer state.Unlock()
 
 	state.Documents = []Document{}
+	state.Index = engine.Index{}
+	state.NameIndex = engine.Index{}
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -164,119 +231,53 @@ func searchHandler(w http.ResponseWriter, r *http.Request) {
 	defer state.Unlock()
 
 	if len(state.Terms) == 0 {
-		http.Error(w, "Error: No terms defined. Please enter terms first.", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "no_terms", "No terms defined. Please enter terms first.")
 		return
 	}
 	if len(state.Documents) == 0 {
-		http.Error(w, "Error: No documents uploaded. Please add documents first.", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "no_documents", "No documents uploaded. Please add documents first.")
 		return
 	}
 
 	var requestData struct {
 		Query string `json:"query"`
+		Plan  bool   `json:"plan"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		apierror.InvalidJSON(w)
 		return
 	}
 
-	response := booleanSearch(requestData.Query)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
-
-// boolean search logic (DNF)
-func booleanSearch(query string) []string {
-	query = strings.ToLower(query)
-
-	// Split OR
-	conjuncts := strings.Split(query, " or ")
-	finalResultMap := make(map[string]bool)
-
-	for _, conjunct := range conjuncts {
-		// AND-group
-		conjunctDocs := evaluateConjunct(conjunct)
-
-		// merge conjunct results
-		for docName := range conjunctDocs {
-			finalResultMap[docName] = true
-		}
+	results, plan, err := booleanSearch(requestData.Query)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_query", "Invalid query: "+err.Error())
+		return
 	}
 
-	var response []string
-	for docName := range finalResultMap {
-		response = append(response, docName)
+	response := SearchResponse{Results: results}
+	if requestData.Plan {
+		response.Plan = plan
 	}
-
-	return response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
 
-// AND-group and returns the intersection of document sets
-func evaluateConjunct(conjunct string) map[string]bool {
-	// Split AND operation
-	parts := strings.Split(conjunct, "and")
-
-	var conjunctResult map[string]bool
-	firstTerm := true
-
-	for _, term := range parts {
-		term = strings.TrimSpace(term)
-		if term == "" {
-			continue
-		}
-
-		isNot := false
-		// Check for NOT(...) syntax
-		if strings.HasPrefix(term, "not(") && strings.HasSuffix(term, ")") {
-			isNot = true
-			term = strings.TrimPrefix(term, "not(")
-			term = strings.TrimSuffix(term, ")")
-			term = strings.TrimSpace(term)
-		}
-
-		// Find documents for this specific term
-		termDocs := getDocsForTerm(term, isNot)
-
-		// Intersection Logic (AND)
-		if firstTerm {
-			conjunctResult = termDocs
-			firstTerm = false
-		} else {
-			intersected := make(map[string]bool)
-			for docName := range conjunctResult {
-				if termDocs[docName] {
-					intersected[docName] = true // append
-				}
-			}
-			conjunctResult = intersected
-		}
+// boolean search logic: parse, plan and evaluate against the index
+func booleanSearch(query string) ([]string, *engine.QueryNode, error) {
+	ast, err := engine.ParseQuery(strings.ToLower(query))
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if conjunctResult == nil {
-		return make(map[string]bool)
+	response := []string{}
+	if ast == nil {
+		return response, nil, nil
 	}
-	return conjunctResult
-}
-
-// returns document names that match the term criteria
-func getDocsForTerm(term string, isNot bool) map[string]bool {
-	resultSet := make(map[string]bool)
-
-	for _, doc := range state.Documents {
-		words := strings.Fields(doc.Content)
-		contains := false
 
-		for _, w := range words {
-			if w == term {
-				contains = true
-				break
-			}
-		}
-
-		// If isNot is true => document with: contains == false
-		if contains != isNot {
-			resultSet[doc.Name] = true
-		}
+	plan := engine.Plan(ast, indexSource{})
+	for _, docID := range engine.Evaluate(plan, indexSource{}) {
+		response = append(response, state.Documents[docID].Name)
 	}
-	return resultSet
+
+	return response, plan, nil
 }
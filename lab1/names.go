@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+
+	"ir/internal/apierror"
+	"ir/internal/engine"
+)
+
+// adds the document's name and path tokens to the name index
+func indexName(docID int, docPath string) {
+	state.NameIndex.Add(docID, engine.NameTokens(docPath))
+}
+
+// indexSource resolves boolean query terms against the collection's indexes
+type indexSource struct{}
+
+// postings of a query term, looked up in the field it targets
+func (indexSource) TermPostings(node *engine.QueryNode) engine.Postings {
+	if node.Field == "name" {
+		return state.NameIndex[node.Term]
+	}
+	return state.Index[node.Term]
+}
+
+func (indexSource) Documents() int {
+	return len(state.Documents)
+}
+
+type DocumentLocation struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// GET /api/documents/lookup?glob=reports/*.txt
+// the glob is matched case-insensitively against both the file name and the path
+func documentLookupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	glob := strings.ToLower(r.URL.Query().Get("glob"))
+	if glob == "" {
+		glob = "*"
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		apierror.Error(w, "Error: Invalid glob pattern.", http.StatusBadRequest)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	matches := []DocumentLocation{}
+	for _, doc := range state.Documents {
+		nameMatch, _ := path.Match(glob, strings.ToLower(doc.Name))
+		pathMatch, _ := path.Match(glob, strings.ToLower(doc.Path))
+		if nameMatch || pathMatch {
+			matches = append(matches, DocumentLocation{Name: doc.Name, Path: doc.Path})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(matches)
+}
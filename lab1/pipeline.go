@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"mime/multipart"
+	"runtime"
+	"sync"
+
+	"ir/internal/engine"
+)
+
+// number of uploaded files analyzed in parallel
+var uploadWorkers = runtime.NumCPU()
+
+type analyzedUpload struct {
+	doc   Document
+	terms map[string]bool
+	err   error
+}
+
+// analyzes the uploaded files on a pool of workers; results keep the upload order
+func analyzeUploads(files []*multipart.FileHeader, config engine.AnalysisConfig) []analyzedUpload {
+	results := make([]analyzedUpload, len(files))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for range min(uploadWorkers, len(files)) {
+		wg.Go(func() {
+			for i := range jobs {
+				results[i] = analyzeUpload(files[i], config)
+			}
+		})
+	}
+
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+func analyzeUpload(fileHeader *multipart.FileHeader, config engine.AnalysisConfig) analyzedUpload {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return analyzedUpload{err: fmt.Errorf("Error opening %s", fileHeader.Filename)}
+	}
+	defer file.Close()
+
+	doc, terms, err := analyzeDocument(fileHeader.Filename, file, config)
+	return analyzedUpload{doc: doc, terms: terms, err: err}
+}
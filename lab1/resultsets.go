@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"ir/internal/apierror"
+	"ir/internal/engine"
+)
+
+// ResultSet is a saved list of matching documents, kept by name so that it
+// survives changes of the collection
+type ResultSet struct {
+	Name      string   `json:"name"`
+	Query     string   `json:"query"` // query or set expression that produced it
+	Documents []string `json:"documents"`
+}
+
+// postings of the saved documents that are still in the collection
+func resultSetPostings(set ResultSet) engine.Postings {
+	wanted := make(map[string]bool, len(set.Documents))
+	for _, name := range set.Documents {
+		wanted[name] = true
+	}
+	postings := engine.Postings{}
+	for docID, doc := range state.Documents {
+		if wanted[doc.Name] {
+			postings = append(postings, docID)
+		}
+	}
+	return postings
+}
+
+func postingsNames(postings engine.Postings) []string {
+	names := make([]string, 0, len(postings))
+	for _, docID := range postings {
+		names = append(names, state.Documents[docID].Name)
+	}
+	return names
+}
+
+// combines saved sets from left to right with the given operation
+func combineResultSets(op string, names []string) (engine.Postings, error) {
+	if len(names) < 2 {
+		return nil, fmt.Errorf("at least two result sets are required")
+	}
+
+	var result engine.Postings
+	for i, name := range names {
+		set, ok := state.ResultSets[name]
+		if !ok {
+			return nil, fmt.Errorf("result set '%s' not found", name)
+		}
+		postings := resultSetPostings(set)
+		if i == 0 {
+			result = postings
+			continue
+		}
+		switch op {
+		case "union":
+			result = engine.Union(result, postings)
+		case "intersection":
+			result = engine.Intersect(result, postings)
+		case "difference":
+			result = engine.Subtract(result, postings)
+		default:
+			return nil, fmt.Errorf("unknown operation '%s'", op)
+		}
+	}
+	return result, nil
+}
+
+// lists, saves (from a query) and deletes result sets
+func resultSetsHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		sets := make([]ResultSet, 0, len(state.ResultSets))
+		for _, set := range state.ResultSets {
+			sets = append(sets, set)
+		}
+		sort.Slice(sets, func(i, j int) bool {
+			return sets[i].Name < sets[j].Name
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sets)
+
+	case http.MethodPost:
+		var requestData struct {
+			Name  string `json:"name"`
+			Query string `json:"query"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+
+		name := strings.TrimSpace(requestData.Name)
+		query := strings.ToLower(strings.TrimSpace(requestData.Query))
+		if name == "" || query == "" {
+			apierror.Error(w, "Error: Result set name and query are required.", http.StatusBadRequest)
+			return
+		}
+
+		results, _, err := booleanSearch(query)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, "invalid_query", "Invalid query: "+err.Error())
+			return
+		}
+
+		set := ResultSet{Name: name, Query: query, Documents: results}
+		state.ResultSets[name] = set
+
+		fmt.Printf("[Log] Result set '%s' saved: %d documents\n", name, len(results))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(set)
+
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		if _, ok := state.ResultSets[name]; !ok {
+			apierror.Error(w, "Error: Result set not found.", http.StatusNotFound)
+			return
+		}
+		delete(state.ResultSets, name)
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// computes the union, intersection or difference of saved result sets,
+// optionally saving the outcome as a new set
+func combineResultSetsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData struct {
+		Op   string   `json:"op"` // "union", "intersection" or "difference"
+		Sets []string `json:"sets"`
+		Name string   `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		apierror.InvalidJSON(w)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	postings, err := combineResultSets(requestData.Op, requestData.Sets)
+	if err != nil {
+		apierror.Error(w, "Error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	set := ResultSet{
+		Name:      strings.TrimSpace(requestData.Name),
+		Query:     requestData.Op + "(" + strings.Join(requestData.Sets, ", ") + ")",
+		Documents: postingsNames(postings),
+	}
+	if set.Name != "" {
+		state.ResultSets[set.Name] = set
+		fmt.Printf("[Log] Result set '%s' saved: %d documents\n", set.Name, len(set.Documents))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(set)
+}
+
+// turns a result set into the working collection: documents outside the set are
+// dropped and the index is rebuilt over the remaining ones
+func materializeResultSetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		apierror.InvalidJSON(w)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	set, ok := state.ResultSets[requestData.Name]
+	if !ok {
+		apierror.Error(w, "Error: Result set not found.", http.StatusNotFound)
+		return
+	}
+
+	keep := resultSetPostings(set)
+	remapped := make(map[int]int, len(keep))
+	documents := make([]Document, 0, len(keep))
+	for _, docID := range keep {
+		remapped[docID] = len(documents)
+		documents = append(documents, state.Documents[docID])
+	}
+
+	state.Documents = documents
+	state.Index = remapPostings(state.Index, remapped)
+	state.NameIndex = remapPostings(state.NameIndex, remapped)
+
+	fmt.Printf("[Log] Result set '%s' materialized: %d documents kept\n", set.Name, len(documents))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"documents": documentNames(),
+	})
+}
+
+// keeps only the remapped documents of every postings list; old IDs are
+// visited in ascending order, so the new lists stay sorted
+func remapPostings(index engine.Index, remapped map[int]int) engine.Index {
+	result := make(engine.Index, len(index))
+	for term, postings := range index {
+		var kept engine.Postings
+		for _, docID := range postings {
+			if newID, ok := remapped[docID]; ok {
+				kept = append(kept, newID)
+			}
+		}
+		if len(kept) > 0 {
+			result[term] = kept
+		}
+	}
+	return result
+}
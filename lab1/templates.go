@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"ir/internal/apierror"
+)
+
+// QueryTemplate is a saved boolean query with {{param}} placeholders
+type QueryTemplate struct {
+	Name   string   `json:"name"`
+	Query  string   `json:"query"`
+	Params []string `json:"params"`
+}
+
+// matches {{param}} placeholders inside a template query
+var placeholderRegex = regexp.MustCompile(`\{\{\s*([a-z0-9_]+)\s*\}\}`)
+
+// parameter values are substituted as single terms, never as operators
+var paramValueRegex = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// returns the unique placeholder names in order of first appearance
+func templateParams(query string) []string {
+	params := []string{}
+	seen := make(map[string]bool)
+	for _, match := range placeholderRegex.FindAllStringSubmatch(query, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			params = append(params, match[1])
+		}
+	}
+	return params
+}
+
+// substitutes parameter values into the template query
+func renderTemplate(tmpl QueryTemplate, values map[string]string) (string, error) {
+	substitutions := make(map[string]string)
+	for _, param := range tmpl.Params {
+		value, ok := values[param]
+		if !ok {
+			return "", fmt.Errorf("missing value for parameter '%s'", param)
+		}
+		value = strings.ToLower(strings.TrimSpace(value))
+		if !paramValueRegex.MatchString(value) {
+			return "", fmt.Errorf("invalid value for parameter '%s': must be a single term", param)
+		}
+		substitutions[param] = value
+	}
+
+	rendered := placeholderRegex.ReplaceAllStringFunc(tmpl.Query, func(placeholder string) string {
+		name := placeholderRegex.FindStringSubmatch(placeholder)[1]
+		return substitutions[name]
+	})
+	return rendered, nil
+}
+
+// lists, saves and deletes query templates
+func templatesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		state.Lock()
+		templates := make([]QueryTemplate, 0, len(state.Templates))
+		for _, tmpl := range state.Templates {
+			templates = append(templates, tmpl)
+		}
+		state.Unlock()
+
+		sort.Slice(templates, func(i, j int) bool {
+			return templates[i].Name < templates[j].Name
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(templates)
+
+	case http.MethodPost:
+		var requestData struct {
+			Name  string `json:"name"`
+			Query string `json:"query"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+
+		name := strings.TrimSpace(requestData.Name)
+		query := strings.ToLower(strings.TrimSpace(requestData.Query))
+		if name == "" || query == "" {
+			apierror.Error(w, "Error: Template name and query are required.", http.StatusBadRequest)
+			return
+		}
+
+		tmpl := QueryTemplate{
+			Name:   name,
+			Query:  query,
+			Params: templateParams(query),
+		}
+
+		state.Lock()
+		state.Templates[name] = tmpl
+		state.Unlock()
+
+		fmt.Printf("[Log] Template '%s' saved. Params: %v\n", name, tmpl.Params)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tmpl)
+
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+
+		state.Lock()
+		defer state.Unlock()
+
+		if _, ok := state.Templates[name]; !ok {
+			apierror.Error(w, "Error: Template not found.", http.StatusNotFound)
+			return
+		}
+		delete(state.Templates, name)
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// runs a saved template with the given parameter values
+func runTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData struct {
+		Name   string            `json:"name"`
+		Params map[string]string `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		apierror.InvalidJSON(w)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	tmpl, ok := state.Templates[requestData.Name]
+	if !ok {
+		apierror.Error(w, "Error: Template not found.", http.StatusNotFound)
+		return
+	}
+	if len(state.Terms) == 0 {
+		apierror.Write(w, http.StatusBadRequest, "no_terms", "No terms defined. Please enter terms first.")
+		return
+	}
+	if len(state.Documents) == 0 {
+		apierror.Write(w, http.StatusBadRequest, "no_documents", "No documents uploaded. Please add documents first.")
+		return
+	}
+
+	query, err := renderTemplate(tmpl, requestData.Params)
+	if err != nil {
+		apierror.Error(w, "Error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fmt.Printf("[Log] Running template '%s': %s\n", tmpl.Name, query)
+	results, _, err := booleanSearch(query)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_query", "Invalid query: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SearchResponse{Results: results})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ir/internal/apierror"
+)
+
+type AnonymizedDocument struct {
+	Name     string         `json:"name"`
+	Length   int            `json:"length"`
+	TermFreq map[string]int `json:"termFreq"`
+	Tokens   []string       `json:"tokens,omitempty"` // pseudonymized text, only when the document text is stored
+}
+
+type AnonymizedCorpus struct {
+	Documents      []AnonymizedDocument `json:"documents"`
+	VocabularySize int                  `json:"vocabularySize"`
+	TotalTokens    int                  `json:"totalTokens"`
+}
+
+// assigns every term a pseudonym "t<id>"; IDs follow a seeded random permutation
+// so they reveal neither the alphabetical nor the frequency order of the terms
+func termPseudonyms(seed uint64) map[string]string {
+	vocabulary := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, doc := range state.Documents {
+		for t := range doc.TermFreq {
+			if !seen[t] {
+				seen[t] = true
+				vocabulary = append(vocabulary, t)
+			}
+		}
+	}
+	sort.Strings(vocabulary)
+
+	rng := rand.New(rand.NewPCG(seed, seed))
+	rng.Shuffle(len(vocabulary), func(i, j int) {
+		vocabulary[i], vocabulary[j] = vocabulary[j], vocabulary[i]
+	})
+
+	pseudonyms := make(map[string]string, len(vocabulary))
+	for id, t := range vocabulary {
+		pseudonyms[t] = "t" + strconv.Itoa(id)
+	}
+	return pseudonyms
+}
+
+// replaces terms and document names by pseudonyms, keeping frequencies,
+// lengths and token order intact (caller holds the lock)
+func anonymizeCorpus(seed uint64) AnonymizedCorpus {
+	pseudonyms := termPseudonyms(seed)
+	corpus := AnonymizedCorpus{
+		Documents:      make([]AnonymizedDocument, 0, len(state.Documents)),
+		VocabularySize: len(pseudonyms),
+	}
+
+	for i, doc := range state.Documents {
+		anonymized := AnonymizedDocument{
+			Name:     fmt.Sprintf("doc%d", i+1),
+			Length:   doc.Length,
+			TermFreq: make(map[string]int, len(doc.TermFreq)),
+		}
+		for t, tf := range doc.TermFreq {
+			anonymized.TermFreq[pseudonyms[t]] = tf
+		}
+		if content := doc.content(); content != "" {
+			anonymized.Tokens = make([]string, 0, doc.Length)
+			for t := range strings.FieldsSeq(content) {
+				anonymized.Tokens = append(anonymized.Tokens, pseudonyms[t])
+			}
+		}
+		corpus.TotalTokens += doc.Length
+		corpus.Documents = append(corpus.Documents, anonymized)
+	}
+	return corpus
+}
+
+// GET /api/export/anonymized?seed=42; without a seed the pseudonyms differ on every export
+func anonymizedExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	seed := rand.Uint64()
+	if raw := r.URL.Query().Get("seed"); raw != "" {
+		parsed, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			apierror.Error(w, "Error: Invalid seed.", http.StatusBadRequest)
+			return
+		}
+		seed = parsed
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	corpus := anonymizeCorpus(seed)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="corpus-anonymized.json"`)
+	json.NewEncoder(w).Encode(corpus)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"ir/internal/engine"
+	"ir/internal/segment"
+)
+
+// BooleanSearchResponse is returned by /api/search?mode=boolean
+type BooleanSearchResponse struct {
+	TookMs    float64           `json:"tookMs"`
+	TotalHits int               `json:"totalHits"` // matching documents before the limit
+	Results   []string          `json:"results"`
+	Plan      *engine.QueryNode `json:"plan,omitempty"` // chosen evaluation order, on request
+}
+
+// inverted indexes over the content and the document names for boolean queries;
+// content postings live in compressed segments and are decoded during evaluation
+type booleanIndex struct {
+	terms     *segment.Set
+	names     engine.Index
+	positions map[int]int // document ID -> position in state.Documents
+}
+
+// returns the cached boolean index; the content postings are maintained
+// incrementally, only the small name index is rebuilt (caller holds the lock)
+func booleanIndexes() *booleanIndex {
+	if state.boolean == nil {
+		state.boolean = newNameIndex()
+	}
+	return state.boolean
+}
+
+// replaces the content postings by the given index over the current documents
+// (caller holds the lock)
+func newBooleanIndex(terms engine.Index) *booleanIndex {
+	if err := replaceSegments(terms); err != nil {
+		fmt.Println("Error writing index segment:", err)
+	}
+	return newNameIndex()
+}
+
+// indexes the document names over the current documents; content postings are
+// shared through the segments
+func newNameIndex() *booleanIndex {
+	index := &booleanIndex{terms: state.segments, names: engine.Index{}, positions: make(map[int]int, len(state.Documents))}
+	for i, doc := range state.Documents {
+		index.names.Add(doc.id, engine.NameTokens(doc.Name))
+		index.positions[doc.id] = i
+	}
+	return index
+}
+
+// the content index with document IDs mapped to positions, e.g. for export
+func positionalIndex() engine.Index {
+	index := booleanIndexes()
+	positional := engine.Index{}
+	for term, postings := range index.terms.Decode() {
+		for _, docID := range postings {
+			if i, ok := index.positions[docID]; ok {
+				positional[term] = append(positional[term], i)
+			}
+		}
+	}
+	return positional
+}
+
+func (index *booleanIndex) TermPostings(node *engine.QueryNode) engine.Postings {
+	if node.Field == "name" {
+		return index.names[node.Term]
+	}
+	return index.terms.Postings(node.Term).Decode()
+}
+
+func (index *booleanIndex) CompressedPostings(node *engine.QueryNode) engine.CompressedPostings {
+	if node.Field == "name" {
+		return engine.Compress(index.names[node.Term])
+	}
+	return index.terms.Postings(node.Term)
+}
+
+// the ID range including deleted documents, which the evaluation results are filtered for
+func (index *booleanIndex) Documents() int {
+	return state.nextID
+}
+
+// TermOperators are the "+must -mustnot" terms of a ranked query
+type TermOperators struct {
+	Required []string `json:"required"`
+	Excluded []string `json:"excluded"`
+}
+
+// splits "+must -mustnot optional" into the operators and the query to score,
+// which keeps the required and the optional terms
+func parseTermOperators(query string) (string, TermOperators) {
+	operators := TermOperators{Required: []string{}, Excluded: []string{}}
+	scored := []string{}
+	for _, word := range strings.Fields(query) {
+		switch {
+		case len(word) > 1 && word[0] == '+':
+			operators.Required = append(operators.Required, strings.ToLower(word[1:]))
+			scored = append(scored, word[1:])
+		case len(word) > 1 && word[0] == '-':
+			operators.Excluded = append(operators.Excluded, strings.ToLower(word[1:]))
+		default:
+			scored = append(scored, word)
+		}
+	}
+	return strings.Join(scored, " "), operators
+}
+
+// names of the documents that contain every required and no excluded term,
+// looked up in the postings; nil when there are no operators (caller holds the lock)
+func (operators TermOperators) allowed() map[string]bool {
+	if len(operators.Required)+len(operators.Excluded) == 0 {
+		return nil
+	}
+	index := booleanIndexes()
+	candidates := engine.AllDocuments(index.Documents())
+	for _, term := range operators.Required {
+		candidates = engine.Intersect(candidates, index.terms.Postings(term).Decode())
+	}
+	for _, term := range operators.Excluded {
+		candidates = engine.Subtract(candidates, index.terms.Postings(term).Decode())
+	}
+
+	allowed := map[string]bool{}
+	for _, docID := range candidates {
+		if i, ok := index.positions[docID]; ok {
+			allowed[state.Documents[i].Name] = true
+		}
+	}
+	return allowed
+}
+
+// boolean search logic: parse, plan and evaluate against the index
+func booleanSearch(query string) ([]string, *engine.QueryNode, error) {
+	ast, err := engine.ParseQuery(strings.ToLower(query))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	response := []string{}
+	if ast == nil {
+		return response, nil, nil
+	}
+
+	index := booleanIndexes()
+	plan := engine.Plan(ast, index)
+	for _, docID := range engine.Evaluate(plan, index) {
+		if i, ok := index.positions[docID]; ok {
+			response = append(response, state.Documents[i].Name)
+		}
+	}
+	return response, plan, nil
+}
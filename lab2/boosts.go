@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// TermExplanation is the share of one query term in a cosine score
+type TermExplanation struct {
+	Term           string  `json:"term"`
+	Boost          float64 `json:"boost"`
+	QueryWeight    float64 `json:"queryWeight"`    // tf * idf * boost in the query vector
+	DocumentWeight float64 `json:"documentWeight"` // tf * idf in the document vector
+	Contribution   float64 `json:"contribution"`   // the term's part of the cosine, the parts sum to the score
+}
+
+// splits "term^2.5" weights off the query words; returns the query without them
+// and the boost of each boosted term
+func parseBoosts(query string) (string, map[string]float64) {
+	boosts := map[string]float64{}
+	words := strings.Fields(query)
+	for i, word := range words {
+		at := strings.LastIndexByte(word, '^')
+		if at <= 0 {
+			continue
+		}
+		boost, err := strconv.ParseFloat(word[at+1:], 64)
+		if err != nil || boost < 0 || math.IsInf(boost, 0) {
+			continue
+		}
+		words[i] = word[:at]
+		boosts[strings.ToLower(words[i])] = boost
+	}
+	return strings.Join(words, " "), boosts
+}
+
+// puts the boosts back on the terms of an expanded query
+func withBoosts(query string, boosts map[string]float64) string {
+	words := strings.Fields(query)
+	for i, word := range words {
+		if boost, ok := boosts[strings.ToLower(word)]; ok {
+			words[i] = word + "^" + strconv.FormatFloat(boost, 'g', -1, 64)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// the query drops the boosts of the rankers that cannot weight terms
+func stripBoosts(query string) string {
+	query, _ = parseBoosts(query)
+	return query
+}
+
+func boostOf(boosts map[string]float64, term string) float64 {
+	if boost, ok := boosts[term]; ok {
+		return boost
+	}
+	return 1
+}
+
+// breaks the cosine score of the document down by query term, weighted as in
+// search (caller holds the lock)
+func explainCosine(query string, doc Document) []TermExplanation {
+	query, boosts := parseBoosts(query)
+	queryDoc := newTermsDocument("query", strings.Fields(strings.ToLower(query)))
+
+	queryNorm, docNorm := 0.0, 0.0
+	for term := range queryDoc.TermFreq {
+		weight := calculateTF(term, queryDoc) * calculateIDF(term, state.Documents) * boostOf(boosts, term)
+		queryNorm += weight * weight
+	}
+	for term := range doc.TermFreq {
+		weight := calculateTF(term, doc) * calculateIDF(term, state.Documents)
+		docNorm += weight * weight
+	}
+	if queryNorm == 0 || docNorm == 0 {
+		return nil
+	}
+
+	explanation := []TermExplanation{}
+	seen := map[string]bool{}
+	for _, term := range strings.Fields(strings.ToLower(query)) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		part := TermExplanation{
+			Term:           term,
+			Boost:          boostOf(boosts, term),
+			QueryWeight:    calculateTF(term, queryDoc) * calculateIDF(term, state.Documents) * boostOf(boosts, term),
+			DocumentWeight: calculateTF(term, doc) * calculateIDF(term, state.Documents),
+		}
+		part.Contribution = part.QueryWeight * part.DocumentWeight / (math.Sqrt(queryNorm) * math.Sqrt(docNorm))
+		explanation = append(explanation, part)
+	}
+	return explanation
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"ir/internal/apierror"
+)
+
+const (
+	bulkBatchSize = 256      // lines analyzed and stored together
+	maxBulkLine   = 16 << 20 // bytes of one line
+	maxBulkErrors = 1000     // failed lines reported, the rest only counted
+)
+
+// BulkDocument is one line of a POST /api/bulk body
+type BulkDocument struct {
+	Name     string           `json:"name" maxLength:"1000"`
+	Content  string           `json:"content"`
+	Metadata DocumentMetadata `json:"metadata,omitempty"`
+}
+
+type BulkError struct {
+	Line    int    `json:"line"`
+	Name    string `json:"name,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type BulkResponse struct {
+	TookMs  float64     `json:"tookMs"`
+	Lines   int         `json:"lines"`
+	Indexed int         `json:"indexed"`
+	Failed  int         `json:"failed"`
+	Errors  []BulkError `json:"errors"`
+}
+
+func (b *BulkResponse) fail(line int, name, code string, err error) {
+	b.Failed++
+	if len(b.Errors) < maxBulkErrors {
+		b.Errors = append(b.Errors, BulkError{Line: line, Name: name, Code: code, Message: err.Error()})
+	}
+}
+
+// a decoded line waiting for its batch
+type bulkLine struct {
+	number int
+	doc    BulkDocument
+}
+
+// POST /api/bulk indexes a JSON Lines body, one {"name", "content", "metadata"}
+// document per line. The body is read a batch at a time and the next batch only
+// once the previous one is stored, so a client sending faster than the server
+// indexes is held back by the connection; failed lines are listed by number and
+// the others are indexed regardless
+func bulkHandler(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
+	response := BulkResponse{Errors: []BulkError{}}
+
+	state.Lock()
+	config := currentIndexConfig()
+	state.Unlock()
+
+	var batch []bulkLine
+	var storeErr error
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		archived := make([]archivedDocument, len(batch))
+		for i, line := range batch {
+			archived[i] = archivedDocument{name: line.doc.Name, text: line.doc.Content, metadata: line.doc.Metadata}
+		}
+		analyzed := analyzeArchived(archived, config)
+		storeErr = storeBulk(batch, analyzed, &response)
+		batch = batch[:0]
+	}
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 64<<10), maxBulkLine)
+	for storeErr == nil && scanner.Scan() {
+		response.Lines++
+		data := scanner.Bytes()
+		if len(data) == 0 {
+			continue
+		}
+		var doc BulkDocument
+		if err := json.Unmarshal(data, &doc); err != nil {
+			response.fail(response.Lines, "", "invalid_json", err)
+			continue
+		}
+		if doc.Name == "" || doc.Content == "" || len(doc.Name) > 1000 {
+			response.fail(response.Lines, doc.Name, "invalid_value", errors.New("name and content are required, names have at most 1000 bytes"))
+			continue
+		}
+		batch = append(batch, bulkLine{number: response.Lines, doc: doc})
+		if len(batch) == bulkBatchSize {
+			flush()
+		}
+	}
+	flush()
+	if storeErr != nil {
+		// the batches before the failing one stay indexed
+		apierror.Error(w, fmt.Sprintf("Error: Could not store the documents after %d were indexed: %v", response.Indexed, storeErr), http.StatusInternalServerError)
+		return
+	}
+	if err := scanner.Err(); err != nil {
+		// the rest of the body is lost, the lines before it are stored
+		response.fail(response.Lines+1, "", "read_error", fmt.Errorf("reading the body stopped: %v", err))
+	}
+	sort.SliceStable(response.Errors, func(i, j int) bool { return response.Errors[i].Line < response.Errors[j].Line })
+	response.TookMs = float64(time.Since(started).Microseconds()) / 1000
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// screens and stores one analyzed batch with its metadata, none of it when the
+// store fails
+func storeBulk(batch []bulkLine, analyzed []analyzedUpload, response *BulkResponse) error {
+	state.Lock()
+	defer state.Unlock()
+
+	var docs []Document
+	metadata := map[string]DocumentMetadata{}
+	for i, upload := range analyzed {
+		line := batch[i].number
+		doc, err := upload.doc, upload.err
+		code := "read_error"
+		if _, batched := metadata[doc.Name]; err == nil && (documentIndex(doc.Name) >= 0 || batched) {
+			err, code = fmt.Errorf("document %s already exists", doc.Name), "already_exists"
+		}
+		if err == nil {
+			doc, err = screenDuplicate(doc, docs)
+		}
+		if err == nil && upload.metadata != nil {
+			err, code = checkMetadataTypes(upload.metadata), "invalid_value"
+		}
+		if err != nil {
+			response.fail(line, upload.name, apierror.DetailOf(upload.name, err, code).Code, err)
+			continue
+		}
+		docs = append(docs, doc)
+		metadata[doc.Name] = upload.metadata
+	}
+
+	added, err := insertDocuments(docs)
+	if err != nil {
+		return err
+	}
+	for _, doc := range added {
+		response.Indexed++
+		if fields := metadata[doc.Name]; fields != nil {
+			state.Metadata[doc.Name] = fields
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"ir/internal/apierror"
+	"ir/internal/engine"
+)
+
+// reads or replaces the character filter configuration of the collection;
+// changes apply to documents uploaded afterwards
+func analysisConfigHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		config := engine.DefaultAnalysisConfig
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+		if err := config.Validate(); err != nil {
+			apierror.Error(w, "Error: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		config.Policy = config.CharacterPolicy()
+		state.Analysis = config
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state.Analysis)
+}
+
+// puts a query through the number, date and diacritic filters the documents
+// were indexed with, so every search path matches the same terms (caller holds the lock)
+func normalizeQuery(query string) string {
+	query = engine.NormalizeText(query, state.Analysis)
+	if state.Analysis.FoldDiacritics {
+		query = engine.FoldDiacritics(query)
+	}
+	return query
+}
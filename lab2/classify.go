@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"ir/internal/apierror"
+)
+
+const defaultNeighbors = 5
+
+type Neighbor struct {
+	FileName   string  `json:"fileName"`
+	Label      string  `json:"label"`
+	Similarity float64 `json:"similarity"`
+}
+
+type LabelVote struct {
+	Label string  `json:"label"`
+	Votes float64 `json:"votes"`
+}
+
+type Classification struct {
+	Label     string      `json:"label"` // empty when no labeled neighbor is similar at all
+	K         int         `json:"k"`
+	Weighting string      `json:"weighting"`
+	Votes     []LabelVote `json:"votes"`
+	Neighbors []Neighbor  `json:"neighbors"`
+}
+
+// labels the source by a vote among its k most cosine-similar labeled documents;
+// with "similarity" weighting each neighbor votes with its similarity (caller holds the lock)
+func classifyDocument(source Document, exclude string, k int, weighting string) Classification {
+	result := Classification{K: k, Weighting: weighting, Votes: []LabelVote{}, Neighbors: []Neighbor{}}
+
+	votes := make(map[string]float64)
+	for _, similar := range similarDocuments(source, exclude, "cosine", 0) {
+		label, ok := state.Labels[similar.FileName]
+		if !ok {
+			continue
+		}
+		result.Neighbors = append(result.Neighbors, Neighbor{FileName: similar.FileName, Label: label, Similarity: similar.Score})
+		if weighting == "similarity" {
+			votes[label] += similar.Score
+		} else {
+			votes[label]++
+		}
+		if len(result.Neighbors) == k {
+			break
+		}
+	}
+
+	for label, count := range votes {
+		result.Votes = append(result.Votes, LabelVote{Label: label, Votes: count})
+	}
+	// ties go to the label whose best neighbor ranks higher
+	firstSeen := make(map[string]int)
+	for i := len(result.Neighbors) - 1; i >= 0; i-- {
+		firstSeen[result.Neighbors[i].Label] = i
+	}
+	sort.Slice(result.Votes, func(i, j int) bool {
+		a, b := result.Votes[i], result.Votes[j]
+		if a.Votes != b.Votes {
+			return a.Votes > b.Votes
+		}
+		return firstSeen[a.Label] < firstSeen[b.Label]
+	})
+	if len(result.Votes) > 0 {
+		result.Label = result.Votes[0].Label
+	}
+	return result
+}
+
+type LabelsRequest struct {
+	Labels map[string]string `json:"labels"`
+}
+
+type ClassifyRequest struct {
+	Document  string `json:"document"`
+	Text      string `json:"text"`
+	K         int    `json:"k" minimum:"1"`
+	Weighting string `json:"weighting" enum:"|uniform|similarity"` // "uniform" by default
+}
+
+// GET lists the document labels, POST {"labels": {"Doc1.txt": "sports"}} sets them
+// (an empty label removes it)
+func labelsHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var requestData LabelsRequest
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+
+		known := make(map[string]bool, len(state.Documents))
+		for _, doc := range state.Documents {
+			known[doc.Name] = true
+		}
+		for name := range requestData.Labels {
+			if !known[name] {
+				apierror.Error(w, fmt.Sprintf("Error: Document '%s' not found.", name), http.StatusNotFound)
+				return
+			}
+		}
+		for name, label := range requestData.Labels {
+			if label = strings.TrimSpace(label); label == "" {
+				delete(state.Labels, name)
+			} else {
+				state.Labels[name] = label
+			}
+		}
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state.Labels)
+}
+
+// POST /api/classify {"document": "Doc1.txt"} or {"text": "...", "k": 5, "weighting": "uniform"}
+func classifyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData ClassifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		apierror.InvalidJSON(w)
+		return
+	}
+	if (requestData.Document == "") == (strings.TrimSpace(requestData.Text) == "") {
+		apierror.Error(w, "Error: Provide either a document name or text.", http.StatusBadRequest)
+		return
+	}
+	if requestData.Weighting == "" {
+		requestData.Weighting = "uniform"
+	}
+	if requestData.Weighting != "uniform" && requestData.Weighting != "similarity" {
+		apierror.Error(w, "Error: weighting must be 'uniform' or 'similarity'.", http.StatusBadRequest)
+		return
+	}
+	if requestData.K <= 0 {
+		requestData.K = defaultNeighbors
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	if len(state.Labels) == 0 {
+		apierror.Error(w, "Error: No labeled documents. Please label documents first.", http.StatusBadRequest)
+		return
+	}
+
+	source, status, err := querySource(requestData.Document, requestData.Text)
+	if err != nil {
+		apierror.Error(w, "Error: "+err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(classifyDocument(source, requestData.Document, requestData.K, requestData.Weighting))
+}
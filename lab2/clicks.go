@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"ir/internal/apierror"
+)
+
+const (
+	impressionDepth = 10 // results counted as shown per search
+
+	// pseudo-impressions that shrink the click-through rate of rarely shown documents
+	clickSmoothing = 5
+)
+
+// ClickEvent records a result the user opened
+type ClickEvent struct {
+	Query    string    `json:"query"`
+	Document string    `json:"document"`
+	Rank     int       `json:"rank,omitempty" minimum:"0"` // 1-based position in the result list
+	Time     time.Time `json:"time"`
+}
+
+type ClickStats struct {
+	Document         string  `json:"document"`
+	Clicks           int     `json:"clicks"`
+	Impressions      int     `json:"impressions"`
+	ClickThroughRate float64 `json:"clickThroughRate"`
+}
+
+// counts the top results of a search as shown (caller holds the lock)
+func recordImpressions(results []SearchResult) {
+	for _, result := range results[:min(impressionDepth, len(results))] {
+		state.Impressions[result.FileName]++
+	}
+}
+
+func clickCounts() map[string]int {
+	counts := make(map[string]int)
+	for _, click := range state.Clicks {
+		counts[click.Document]++
+	}
+	return counts
+}
+
+// smoothed click-through rate; clicks without a counted impression still count as shown
+func clickThroughRate(clicks, impressions int) float64 {
+	return float64(clicks) / float64(max(impressions, clicks)+clickSmoothing)
+}
+
+// per-document click statistics, most clicked first
+func clickStatistics() []ClickStats {
+	counts := clickCounts()
+	names := make(map[string]bool)
+	for name := range counts {
+		names[name] = true
+	}
+	for name := range state.Impressions {
+		names[name] = true
+	}
+
+	stats := make([]ClickStats, 0, len(names))
+	for name := range names {
+		clicks, impressions := counts[name], state.Impressions[name]
+		stats = append(stats, ClickStats{
+			Document:         name,
+			Clicks:           clicks,
+			Impressions:      impressions,
+			ClickThroughRate: clickThroughRate(clicks, impressions),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Clicks != stats[j].Clicks {
+			return stats[i].Clicks > stats[j].Clicks
+		}
+		if stats[i].ClickThroughRate != stats[j].ClickThroughRate {
+			return stats[i].ClickThroughRate > stats[j].ClickThroughRate
+		}
+		return stats[i].Document < stats[j].Document
+	})
+	return stats
+}
+
+// multiplies each score by 1 + weight * CTR and re-sorts
+func applyClickBoost(results []SearchResult, weight float64) []SearchResult {
+	counts := clickCounts()
+	for i := range results {
+		name := results[i].FileName
+		results[i].Score *= 1 + weight*clickThroughRate(counts[name], state.Impressions[name])
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results
+}
+
+// POST /api/feedback/click {"query": "...", "document": "Doc1.txt", "rank": 2}
+func clickHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var click ClickEvent
+	if err := json.NewDecoder(r.Body).Decode(&click); err != nil {
+		apierror.InvalidJSON(w)
+		return
+	}
+	if click.Rank < 0 {
+		apierror.Error(w, "Error: rank must not be negative.", http.StatusBadRequest)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	if documentIndex(click.Document) < 0 {
+		apierror.Error(w, "Error: Document not found.", http.StatusNotFound)
+		return
+	}
+	click.Query = strings.Join(strings.Fields(strings.ToLower(click.Query)), " ")
+	click.Time = time.Now()
+	state.Clicks = append(state.Clicks, click)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(click)
+}
+
+// GET /api/feedback/clicks returns the aggregated statistics, DELETE resets clicks and impressions
+func clickStatsHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		state.Clicks = []ClickEvent{}
+		state.Impressions = map[string]int{}
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clickStatistics())
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+
+	"ir/internal/apierror"
+)
+
+const (
+	defaultClusterSeed       = 1
+	defaultClusterIterations = 100
+	clusterTopTerms          = 10
+)
+
+// TermWeight is a term with a real-valued weight, e.g. in a centroid
+type TermWeight struct {
+	Term   string  `json:"term"`
+	Weight float64 `json:"weight"`
+}
+
+type Cluster struct {
+	ID        int          `json:"id"`
+	Documents []string     `json:"documents"`
+	TopTerms  []TermWeight `json:"topTerms"`
+	Cohesion  float64      `json:"cohesion"` // mean cosine similarity of the members to the centroid
+}
+
+type ClusteringResult struct {
+	K           int            `json:"k"`
+	Seed        uint64         `json:"seed"`
+	Iterations  int            `json:"iterations"`
+	Converged   bool           `json:"converged"`
+	Assignments map[string]int `json:"assignments"`
+	Clusters    []Cluster      `json:"clusters"`
+}
+
+// scales the vector to unit length
+func (v SparseVector) normalized() SparseVector {
+	norm := v.norm()
+	unit := make(SparseVector, len(v))
+	if norm == 0.0 {
+		return unit
+	}
+	for t, weight := range v {
+		unit[t] = weight / norm
+	}
+	return unit
+}
+
+// terms with the largest weights
+func topWeights(v SparseVector, n int) []TermWeight {
+	terms := make([]TermWeight, 0, len(v))
+	for t, weight := range v {
+		terms = append(terms, TermWeight{Term: t, Weight: weight})
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].Weight != terms[j].Weight {
+			return terms[i].Weight > terms[j].Weight
+		}
+		return terms[i].Term < terms[j].Term
+	})
+	if len(terms) > n {
+		terms = terms[:n]
+	}
+	return terms
+}
+
+// picks the initial centroids with k-means++, every document already normalized
+func seedCentroids(points []SparseVector, k int, rng *rand.Rand) []SparseVector {
+	centroids := []SparseVector{points[rng.IntN(len(points))]}
+	distances := make([]float64, len(points))
+
+	for len(centroids) < k {
+		total := 0.0
+		for i, p := range points {
+			// squared euclidean distance between unit vectors is 2 - 2cos
+			nearest := 2.0
+			for _, c := range centroids {
+				nearest = min(nearest, 2-2*p.dot(c))
+			}
+			distances[i] = max(nearest, 0)
+			total += distances[i]
+		}
+
+		next := 0
+		if total == 0.0 {
+			// all remaining documents coincide with a centroid
+			next = rng.IntN(len(points))
+		} else {
+			target := rng.Float64() * total
+			for i, d := range distances {
+				target -= d
+				if target < 0 {
+					next = i
+					break
+				}
+			}
+		}
+		centroids = append(centroids, points[next])
+	}
+	return centroids
+}
+
+// spherical k-means over the TF-IDF vectors of the collection (caller holds the lock)
+func clusterDocuments(k int, seed uint64, maxIterations int) ClusteringResult {
+	cache := documentVectors()
+	points := make([]SparseVector, len(cache.vectors))
+	for i, v := range cache.vectors {
+		points[i] = v.normalized()
+	}
+
+	rng := rand.New(rand.NewPCG(seed, seed))
+	centroids := seedCentroids(points, k, rng)
+	assignments := make([]int, len(points))
+	for i := range assignments {
+		assignments[i] = -1
+	}
+
+	result := ClusteringResult{K: k, Seed: seed}
+	for result.Iterations < maxIterations {
+		result.Iterations++
+
+		changed := false
+		for i, p := range points {
+			best, bestScore := 0, -1.0
+			for c, centroid := range centroids {
+				if score := p.dot(centroid); score > bestScore {
+					best, bestScore = c, score
+				}
+			}
+			if assignments[i] != best {
+				assignments[i] = best
+				changed = true
+			}
+		}
+		if !changed {
+			result.Converged = true
+			break
+		}
+
+		sums := make([]SparseVector, k)
+		for c := range sums {
+			sums[c] = SparseVector{}
+		}
+		for i, p := range points {
+			for t, weight := range p {
+				sums[assignments[i]][t] += weight
+			}
+		}
+		for c, sum := range sums {
+			// an empty cluster keeps its previous centroid
+			if len(sum) > 0 {
+				centroids[c] = sum.normalized()
+			}
+		}
+	}
+
+	result.Assignments = make(map[string]int, len(points))
+	result.Clusters = make([]Cluster, k)
+	for c := range result.Clusters {
+		result.Clusters[c] = Cluster{ID: c, Documents: []string{}, TopTerms: topWeights(centroids[c], clusterTopTerms)}
+	}
+	for i, c := range assignments {
+		name := state.Documents[i].Name
+		result.Assignments[name] = c
+		result.Clusters[c].Documents = append(result.Clusters[c].Documents, name)
+		result.Clusters[c].Cohesion += points[i].dot(centroids[c])
+	}
+	for c := range result.Clusters {
+		if n := len(result.Clusters[c].Documents); n > 0 {
+			result.Clusters[c].Cohesion /= float64(n)
+		}
+	}
+	return result
+}
+
+type ClusterRequest struct {
+	K             int    `json:"k" minimum:"1"`
+	Seed          uint64 `json:"seed"`
+	MaxIterations int    `json:"maxIterations" minimum:"1"`
+}
+
+// POST /api/cluster {"k": 5, "seed": 1}
+func clusterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	requestData := ClusterRequest{Seed: defaultClusterSeed, MaxIterations: defaultClusterIterations}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		apierror.InvalidJSON(w)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	if len(state.Documents) == 0 {
+		apierror.Write(w, http.StatusBadRequest, "no_documents", "No documents uploaded. Please add documents first.")
+		return
+	}
+	if requestData.K < 1 || requestData.K > len(state.Documents) {
+		apierror.Error(w, fmt.Sprintf("Error: k must be between 1 and %d.", len(state.Documents)), http.StatusBadRequest)
+		return
+	}
+	if requestData.MaxIterations < 1 {
+		requestData.MaxIterations = defaultClusterIterations
+	}
+
+	result := clusterDocuments(requestData.K, requestData.Seed, requestData.MaxIterations)
+	fmt.Println("Clustering finished after", result.Iterations, "iterations")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
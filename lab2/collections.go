@@ -0,0 +1,153 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"ir/internal/apierror"
+	"ir/internal/engine"
+)
+
+// a result set materialized as a collection of its own: a frozen snapshot of
+// its documents and their postings, searched and exported apart from the
+// working collection, which keeps every document
+type materializedCollection struct {
+	source   string // result set it was materialized from
+	snapshot Snapshot
+	names    engine.Index // name tokens, for name: terms
+}
+
+// CollectionSummary describes a materialized collection
+type CollectionSummary struct {
+	Name      string    `json:"name"`
+	ResultSet string    `json:"resultSet"`
+	CreatedAt time.Time `json:"createdAt"`
+	Documents []string  `json:"documents"`
+}
+
+type CollectionSearchRequest struct {
+	Query string `json:"query" maxLength:"10000"` // boolean query
+	Plan  bool   `json:"plan"`
+}
+
+func (c *materializedCollection) summary(name string) CollectionSummary {
+	summary := CollectionSummary{Name: name, ResultSet: c.source, CreatedAt: c.snapshot.CreatedAt, Documents: []string{}}
+	for _, doc := range c.snapshot.Documents {
+		summary.Documents = append(summary.Documents, doc.Name)
+	}
+	return summary
+}
+
+func (c *materializedCollection) TermPostings(node *engine.QueryNode) engine.Postings {
+	if node.Field == "name" {
+		return c.names[node.Term]
+	}
+	return c.snapshot.Index[node.Term]
+}
+
+func (c *materializedCollection) Documents() int {
+	return len(c.snapshot.Documents)
+}
+
+// copies the documents at the given positions into a new collection (caller holds the lock)
+func materializeCollection(source string, positions engine.Postings) *materializedCollection {
+	c := &materializedCollection{source: source, snapshot: snapshotOf(positions), names: engine.Index{}}
+	for i, doc := range c.snapshot.Documents {
+		c.names.Add(i, engine.NameTokens(doc.Name))
+	}
+	return c
+}
+
+// the collection named by the path, answering 404 when there is none (caller holds the lock)
+func pathCollection(w http.ResponseWriter, r *http.Request) (*materializedCollection, bool) {
+	c, ok := state.Collections[r.PathValue("name")]
+	if !ok {
+		apierror.Error(w, "Error: Collection not found.", http.StatusNotFound)
+	}
+	return c, ok
+}
+
+// GET /api/collections lists the materialized collections
+func collectionsHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	summaries := make([]CollectionSummary, 0, len(state.Collections))
+	for name, c := range state.Collections {
+		summaries = append(summaries, c.summary(name))
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Name < summaries[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summaries)
+}
+
+func deleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	if _, ok := pathCollection(w, r); !ok {
+		return
+	}
+	delete(state.Collections, r.PathValue("name"))
+	w.WriteHeader(http.StatusOK)
+}
+
+// POST /api/collections/{name}/search runs a boolean query against the collection
+func collectionSearchHandler(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
+	var requestData CollectionSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		apierror.InvalidJSON(w)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	c, ok := pathCollection(w, r)
+	if !ok {
+		return
+	}
+	ast, err := engine.ParseQuery(strings.ToLower(normalizeQuery(requestData.Query)))
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_query", "Invalid query: "+err.Error())
+		return
+	}
+
+	response := BooleanSearchResponse{Results: []string{}}
+	if ast != nil {
+		plan := engine.Plan(ast, c)
+		for _, i := range engine.Evaluate(plan, c) {
+			response.Results = append(response.Results, c.snapshot.Documents[i].Name)
+		}
+		if requestData.Plan {
+			response.Plan = plan
+		}
+	}
+	response.TotalHits = len(response.Results)
+	response.TookMs = float64(time.Since(started).Microseconds()) / 1000
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GET /api/collections/{name}/export downloads the collection as a snapshot,
+// which POST /api/import restores as the working collection of an instance
+func collectionExportHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	c, ok := pathCollection(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+r.PathValue("name")+`.json.gz"`)
+	gz := gzip.NewWriter(w)
+	json.NewEncoder(gz).Encode(c.snapshot)
+	gz.Close()
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"ir/internal/apierror"
+)
+
+const (
+	defaultCollocations  = 20
+	maxCollocations      = 1000
+	defaultCooccurWindow = 5
+	maxCooccurWindow     = 50
+	defaultCooccurTerms  = 20
+	maxCooccurTerms      = 200
+)
+
+// Collocation is a pair of adjacent terms scored by how much more often they
+// occur together than their frequencies predict
+type Collocation struct {
+	First  string  `json:"first"`
+	Second string  `json:"second"`
+	Count  int     `json:"count"`
+	Score  float64 `json:"score"`
+}
+
+type Collocations struct {
+	Measure      string        `json:"measure"`
+	Bigrams      int           `json:"bigrams"` // adjacent pairs in the corpus
+	Collocations []Collocation `json:"collocations"`
+}
+
+// CooccurrenceMatrix counts how often two terms occur within the window of
+// each other; the matrix is symmetric and aligned with the terms
+type CooccurrenceMatrix struct {
+	Window int      `json:"window"`
+	Terms  []string `json:"terms"`
+	Counts [][]int  `json:"counts"`
+}
+
+// normalized tokens of every document whose text is available (caller holds the lock)
+func corpusTokens() [][]string {
+	tokens := make([][]string, 0, len(state.Documents))
+	for _, doc := range state.Documents {
+		if content := doc.content(); content != "" {
+			tokens = append(tokens, strings.Fields(content))
+		}
+	}
+	return tokens
+}
+
+// G² log-likelihood ratio of a 2x2 contingency table (Dunning, 1993)
+func logLikelihoodRatio(k11, k12, k21, k22 float64) float64 {
+	entropy := func(counts ...float64) float64 {
+		total, sum := 0.0, 0.0
+		for _, k := range counts {
+			total += k
+			if k > 0 {
+				sum += k * math.Log(k)
+			}
+		}
+		if total > 0 {
+			sum -= total * math.Log(total)
+		}
+		return sum
+	}
+	return 2 * (entropy(k11, k12, k21, k22) - entropy(k11+k12, k21+k22) - entropy(k11+k21, k12+k22))
+}
+
+// GET /api/collocations?top=20&measure=pmi|llr&minCount=2 lists the adjacent
+// term pairs by pointwise mutual information or log-likelihood ratio; pairs
+// seen fewer than minCount times are skipped, PMI overrates rare ones
+func collocationsHandler(w http.ResponseWriter, r *http.Request) {
+	top, ok := intParam(r, "top", defaultCollocations)
+	if !ok || top == 0 {
+		apierror.Error(w, "Error: 'top' must be a positive integer.", http.StatusBadRequest)
+		return
+	}
+	top = min(top, maxCollocations)
+	minCount, ok := intParam(r, "minCount", 2)
+	if !ok {
+		apierror.Error(w, "Error: 'minCount' must be a non-negative integer.", http.StatusBadRequest)
+		return
+	}
+	measure := r.URL.Query().Get("measure")
+	if measure == "" {
+		measure = "pmi"
+	}
+	if measure != "pmi" && measure != "llr" {
+		apierror.Error(w, "Error: 'measure' must be pmi or llr.", http.StatusBadRequest)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	// bigrams do not span documents; first and second count the terms by position
+	pairs := map[[2]string]int{}
+	first, second := map[string]int{}, map[string]int{}
+	total := 0
+	for _, tokens := range corpusTokens() {
+		for i := 0; i+1 < len(tokens); i++ {
+			pairs[[2]string{tokens[i], tokens[i+1]}]++
+			first[tokens[i]]++
+			second[tokens[i+1]]++
+			total++
+		}
+	}
+
+	result := Collocations{Measure: measure, Bigrams: total, Collocations: []Collocation{}}
+	n := float64(total)
+	for pair, count := range pairs {
+		if count < minCount {
+			continue
+		}
+		k11 := float64(count)
+		k12 := float64(first[pair[0]]) - k11
+		k21 := float64(second[pair[1]]) - k11
+		score := math.Log2(k11 * n / (float64(first[pair[0]]) * float64(second[pair[1]])))
+		if measure == "llr" {
+			score = logLikelihoodRatio(k11, k12, k21, n-k11-k12-k21)
+		}
+		result.Collocations = append(result.Collocations, Collocation{First: pair[0], Second: pair[1], Count: count, Score: score})
+	}
+	sort.Slice(result.Collocations, func(i, j int) bool {
+		a, b := result.Collocations[i], result.Collocations[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.First != b.First {
+			return a.First < b.First
+		}
+		return a.Second < b.Second
+	})
+	if len(result.Collocations) > top {
+		result.Collocations = result.Collocations[:top]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GET /api/cooccurrence?window=5&terms=a&terms=b counts the terms occurring at
+// most window-1 positions apart; without terms the most frequent ones are used
+func cooccurrenceHandler(w http.ResponseWriter, r *http.Request) {
+	window, ok := intParam(r, "window", defaultCooccurWindow)
+	if !ok || window < 2 || window > maxCooccurWindow {
+		apierror.Error(w, "Error: 'window' must be between 2 and 50.", http.StatusBadRequest)
+		return
+	}
+	top, ok := intParam(r, "top", defaultCooccurTerms)
+	if !ok || top == 0 {
+		apierror.Error(w, "Error: 'top' must be a positive integer.", http.StatusBadRequest)
+		return
+	}
+
+	var terms []string
+	for _, raw := range r.URL.Query()["terms"] {
+		for _, t := range sentenceTerms(raw) {
+			if !contains(terms, t) {
+				terms = append(terms, t)
+			}
+		}
+	}
+	if len(terms) > maxCooccurTerms {
+		apierror.Error(w, "Error: At most 200 terms.", http.StatusBadRequest)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	tokens := corpusTokens()
+	if len(terms) == 0 {
+		frequency := map[string]int{}
+		for _, doc := range tokens {
+			for _, t := range doc {
+				frequency[t]++
+			}
+		}
+		for t := range frequency {
+			terms = append(terms, t)
+		}
+		sort.Slice(terms, func(i, j int) bool {
+			if frequency[terms[i]] != frequency[terms[j]] {
+				return frequency[terms[i]] > frequency[terms[j]]
+			}
+			return terms[i] < terms[j]
+		})
+		terms = terms[:min(len(terms), top, maxCooccurTerms)]
+	}
+
+	ids := make(map[string]int, len(terms))
+	matrix := CooccurrenceMatrix{Window: window, Terms: terms, Counts: make([][]int, len(terms))}
+	for i, t := range terms {
+		ids[t] = i
+		matrix.Counts[i] = make([]int, len(terms))
+	}
+	for _, doc := range tokens {
+		for i, t := range doc {
+			a, ok := ids[t]
+			if !ok {
+				continue
+			}
+			for j := i + 1; j < len(doc) && j < i+window; j++ {
+				if b, ok := ids[doc[j]]; ok && a != b {
+					matrix.Counts[a][b]++
+					matrix.Counts[b][a]++
+				}
+			}
+		}
+	}
+	if matrix.Terms == nil {
+		matrix.Terms = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(matrix)
+}
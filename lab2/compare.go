@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"ir/internal/apierror"
+)
+
+// RankerSpec selects a ranker and its options
+type RankerSpec struct {
+	Ranker string         `json:"ranker"`
+	Hybrid *HybridOptions `json:"hybrid,omitempty"`
+}
+
+// ComparisonRow holds the results at the same rank of both rankings
+type ComparisonRow struct {
+	Rank int           `json:"rank"`
+	A    *SearchResult `json:"a"`
+	B    *SearchResult `json:"b"`
+}
+
+// ScoreDifference compares a document retrieved by either ranker; ranks are 1-based, 0 when not retrieved
+type ScoreDifference struct {
+	Document   string  `json:"document"`
+	RankA      int     `json:"rankA"`
+	RankB      int     `json:"rankB"`
+	ScoreA     float64 `json:"scoreA"`
+	ScoreB     float64 `json:"scoreB"`
+	Difference float64 `json:"difference"` // scoreB - scoreA, scales differ between rankers
+}
+
+type QueryComparison struct {
+	QueryID     string            `json:"queryId,omitempty"`
+	Query       string            `json:"query"`
+	Rows        []ComparisonRow   `json:"rows"`
+	Correlation RankCorrelation   `json:"correlation"`
+	Differences []ScoreDifference `json:"differences"`
+
+	// effectiveness of both rankings when the query has judgments
+	MetricsA *EvalMetrics `json:"metricsA,omitempty"`
+	MetricsB *EvalMetrics `json:"metricsB,omitempty"`
+}
+
+type ComparisonReport struct {
+	A       RankerSpec        `json:"a"`
+	B       RankerSpec        `json:"b"`
+	Queries []QueryComparison `json:"queries"`
+
+	// averages over the queries; tau only over queries with two or more common results
+	MeanKendallTau *float64 `json:"meanKendallTau"`
+	MeanRBO        float64  `json:"meanRbo"`
+}
+
+// runs the query through both rankers over the same view, truncated to k
+// results when k > 0; judgments are those of the query, if any
+func compareRankers(view *corpusView, query EvalQuery, judgments map[string]int, a, b RankerSpec, k int) (QueryComparison, error) {
+	text := normalizeQuery(query.Query)
+	resultsA, err := view.rank(a.Ranker, text, a.Hybrid)
+	if err != nil {
+		return QueryComparison{}, err
+	}
+	resultsB, err := view.rank(b.Ranker, text, b.Hybrid)
+	if err != nil {
+		return QueryComparison{}, err
+	}
+	if k > 0 {
+		resultsA, resultsB = resultsA[:min(k, len(resultsA))], resultsB[:min(k, len(resultsB))]
+	}
+
+	comparison := QueryComparison{QueryID: query.ID, Query: query.Query, Rows: []ComparisonRow{}, Differences: []ScoreDifference{}}
+	for i := range max(len(resultsA), len(resultsB)) {
+		row := ComparisonRow{Rank: i + 1}
+		if i < len(resultsA) {
+			row.A = &resultsA[i]
+		}
+		if i < len(resultsB) {
+			row.B = &resultsB[i]
+		}
+		comparison.Rows = append(comparison.Rows, row)
+	}
+
+	differences := make(map[string]*ScoreDifference)
+	difference := func(name string) *ScoreDifference {
+		if differences[name] == nil {
+			differences[name] = &ScoreDifference{Document: name}
+		}
+		return differences[name]
+	}
+	rankingA, rankingB := make([]string, len(resultsA)), make([]string, len(resultsB))
+	for i, result := range resultsA {
+		rankingA[i] = result.FileName
+		d := difference(result.FileName)
+		d.RankA, d.ScoreA = i+1, result.Score
+	}
+	for i, result := range resultsB {
+		rankingB[i] = result.FileName
+		d := difference(result.FileName)
+		d.RankB, d.ScoreB = i+1, result.Score
+	}
+
+	// documents in the order of ranking A, then those only retrieved by B
+	for _, name := range append(rankingA, rankingB...) {
+		if d := differences[name]; d != nil {
+			d.Difference = d.ScoreB - d.ScoreA
+			comparison.Differences = append(comparison.Differences, *d)
+			delete(differences, name)
+		}
+	}
+
+	comparison.Correlation = rankCorrelation(rankingA, rankingB, defaultRBOPersistence)
+	if query.ID != "" && len(judgments) > 0 {
+		depth := max(k, 10)
+		metricsA, metricsB := evaluateRanking(rankingA, judgments, depth), evaluateRanking(rankingB, judgments, depth)
+		comparison.MetricsA, comparison.MetricsB = &metricsA, &metricsB
+	}
+	return comparison, nil
+}
+
+type CompareRequest struct {
+	Query    string     `json:"query"`
+	QuerySet bool       `json:"querySet"`
+	A        RankerSpec `json:"a"`
+	B        RankerSpec `json:"b"`
+	K        int        `json:"k" minimum:"0"`
+}
+
+// POST /api/compare {"query": "...", "a": {"ranker": "cosine"}, "b": {"ranker": "bm25"}, "k": 10};
+// {"querySet": true} compares on every evaluation query instead
+func compareHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	requestData := CompareRequest{A: RankerSpec{Ranker: "cosine"}, B: RankerSpec{Ranker: "bm25"}, K: 10}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		apierror.InvalidJSON(w)
+		return
+	}
+	if requestData.K < 0 {
+		apierror.Error(w, "Error: k must not be negative.", http.StatusBadRequest)
+		return
+	}
+
+	if !requestData.QuerySet && strings.TrimSpace(requestData.Query) == "" {
+		apierror.Error(w, "Error: Provide a query or set querySet.", http.StatusBadRequest)
+		return
+	}
+
+	// the queries, their judgments and the collection are taken together, the
+	// rankings then run without the lock
+	state.Lock()
+	queries := []EvalQuery{{Query: requestData.Query}}
+	if requestData.QuerySet {
+		queries = slices.Clone(state.EvalQueries)
+	}
+	qrels := queryJudgments(queries)
+	view, err := snapshotCorpus(requestData.A.Ranker, requestData.B.Ranker)
+	state.Unlock()
+	if len(queries) == 0 {
+		apierror.Error(w, "Error: No evaluation queries. Please add queries first.", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		apierror.Error(w, "Error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report := ComparisonReport{A: requestData.A, B: requestData.B, Queries: []QueryComparison{}}
+	tauSum, tauCount := 0.0, 0
+	for _, query := range queries {
+		comparison, err := compareRankers(view, query, qrels[query.ID], requestData.A, requestData.B, requestData.K)
+		if err != nil {
+			apierror.Error(w, "Error: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		report.Queries = append(report.Queries, comparison)
+		report.MeanRBO += comparison.Correlation.RBO / float64(len(queries))
+		if tau := comparison.Correlation.KendallTau; tau != nil {
+			tauSum += *tau
+			tauCount++
+		}
+	}
+	if tauCount > 0 {
+		mean := tauSum / float64(tauCount)
+		report.MeanKendallTau = &mean
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"ir/internal/apierror"
+)
+
+const maxCSVRows = 100000
+
+// CSVMapping tells which columns of a CSV or TSV upload make a document: the
+// ID names it, the text columns are indexed, the metadata columns become fields
+type CSVMapping struct {
+	IDColumn        string   // the row number when empty
+	TextColumns     []string // joined by blank lines
+	MetadataColumns []string // values split at ";" for multi-valued fields
+	Delimiter       rune     // ',' or '\t' for .tsv files, unless set
+}
+
+// form values of a list: repeated or comma-separated
+func formList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// reads the rows of a CSV file as documents named after the file and their ID
+// column, e.g. "reviews/r123"; rows with an empty ID or text are skipped, a
+// repeated ID keeps the first row
+func splitCSV(name string, r io.Reader, mapping CSVMapping) ([]archivedDocument, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = mapping.Delimiter
+	if reader.Comma == 0 {
+		reader.Comma = ','
+		if strings.HasSuffix(strings.ToLower(name), ".tsv") {
+			reader.Comma = '\t'
+		}
+	}
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: no header row: %v", name, err)
+	}
+	columns := map[string]int{}
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if _, ok := columns[column]; !ok {
+			columns[column] = i
+		}
+	}
+	index := func(column string) (int, error) {
+		i, ok := columns[strings.ToLower(column)]
+		if !ok {
+			return 0, fmt.Errorf("%s has no column '%s'", name, column)
+		}
+		return i, nil
+	}
+
+	idColumn := -1
+	if mapping.IDColumn != "" {
+		if idColumn, err = index(mapping.IDColumn); err != nil {
+			return nil, err
+		}
+	}
+	var textColumns []int
+	for _, column := range mapping.TextColumns {
+		i, err := index(column)
+		if err != nil {
+			return nil, err
+		}
+		textColumns = append(textColumns, i)
+	}
+	metadataColumns := map[string]int{}
+	for _, column := range mapping.MetadataColumns {
+		i, err := index(column)
+		if err != nil {
+			return nil, err
+		}
+		metadataColumns[strings.ToLower(column)] = i
+	}
+
+	cell := func(row []string, i int) string {
+		if i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	folder := strings.TrimSuffix(path.Base(name), path.Ext(name))
+	var docs []archivedDocument
+	seen := map[string]bool{}
+	for number := 1; number <= maxCSVRows; number++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		id := strconv.Itoa(number)
+		if idColumn >= 0 {
+			id = cell(row, idColumn)
+		}
+		var parts []string
+		for _, i := range textColumns {
+			if text := cell(row, i); text != "" {
+				parts = append(parts, text)
+			}
+		}
+		if id == "" || len(parts) == 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		var fields DocumentMetadata
+		for field, i := range metadataColumns {
+			for _, value := range strings.Split(cell(row, i), ";") {
+				if value = strings.TrimSpace(value); value != "" {
+					if fields == nil {
+						fields = DocumentMetadata{}
+					}
+					fields[field] = append(fields[field], value)
+				}
+			}
+		}
+		docs = append(docs, archivedDocument{name: folder + "/" + id, text: strings.Join(parts, "\n\n"), metadata: fields})
+	}
+	return docs, nil
+}
+
+// POST /api/upload-csv indexes every row of the uploaded CSV or TSV files as a
+// document; the form names the columns: idColumn, textColumns, metadataColumns
+// and optionally the delimiter
+func uploadCSVHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	config, limits := currentIndexConfig(), state.Uploads
+	state.Unlock()
+
+	// the form is needed before the rows, it is spooled to disk past 10 MB
+	r.Body = http.MaxBytesReader(w, r.Body, int64(limits.MaxTotalMBytes)<<20)
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apierror.Write(w, http.StatusRequestEntityTooLarge, "too_large", fmt.Sprintf("The upload is larger than %d MB.", limits.MaxTotalMBytes))
+			return
+		}
+	}
+	if r.MultipartForm == nil {
+		apierror.Error(w, "Error: Expected a multipart form with the CSV files as 'documents'.", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	form := r.MultipartForm.Value
+
+	mapping := CSVMapping{
+		IDColumn:        strings.TrimSpace(r.FormValue("idColumn")),
+		TextColumns:     formList(form["textColumns"]),
+		MetadataColumns: formList(form["metadataColumns"]),
+	}
+	if len(mapping.TextColumns) == 0 {
+		apierror.Error(w, "Error: 'textColumns' must name at least one column.", http.StatusBadRequest)
+		return
+	}
+	switch delimiter := r.FormValue("delimiter"); delimiter {
+	case "":
+	case `\t`, "\t", "tab":
+		mapping.Delimiter = '\t'
+	case ",", ";", "|":
+		mapping.Delimiter = rune(delimiter[0])
+	default:
+		apierror.Error(w, "Error: 'delimiter' must be ',', ';', '|' or tab.", http.StatusBadRequest)
+		return
+	}
+
+	var analyzed []analyzedUpload
+	for _, fileHeader := range r.MultipartForm.File["documents"] {
+		file, err := fileHeader.Open()
+		if err != nil {
+			analyzed = append(analyzed, analyzedUpload{name: fileHeader.Filename, err: fmt.Errorf("Error opening %s", fileHeader.Filename)})
+			continue
+		}
+		if fileHeader.Size > int64(limits.MaxFileMBytes)<<20 {
+			file.Close()
+			analyzed = append(analyzed, analyzedUpload{name: fileHeader.Filename, err: &tooLargeError{name: fileHeader.Filename, limit: limits.MaxFileMBytes}})
+			continue
+		}
+		rows, err := splitCSV(fileHeader.Filename, file, mapping)
+		file.Close()
+		if err == nil && len(rows) == 0 {
+			err = fmt.Errorf("%s holds no rows with an ID and text", fileHeader.Filename)
+		}
+		if err != nil {
+			analyzed = append(analyzed, analyzedUpload{name: fileHeader.Filename, err: err})
+			continue
+		}
+		analyzed = append(analyzed, analyzeArchived(rows, config)...)
+	}
+	storeUploads(w, analyzed)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"ir/internal/apierror"
+	"ir/internal/engine"
+)
+
+// DedupConfig screens incoming documents for near-duplicates of the indexed
+// ones by the Hamming distance of their SimHash fingerprints
+type DedupConfig struct {
+	Mode        string `json:"mode" enum:"|off|reject|flag"`         // "reject" ignores near-duplicates, "flag" indexes them marked; off by default
+	MaxDistance int    `json:"maxDistance" minimum:"0" maximum:"64"` // differing bits up to which documents are near-duplicates
+}
+
+var defaultDedupConfig = DedupConfig{Mode: "off", MaxDistance: 3}
+
+// nearDuplicateError rejects a document too close to an indexed one
+type nearDuplicateError struct {
+	name, original string
+	distance       int
+}
+
+func (e *nearDuplicateError) Error() string {
+	return fmt.Sprintf("File '%s' ignored: near-duplicate of '%s' (distance %d).", e.name, e.original, e.distance)
+}
+func (e *nearDuplicateError) ErrorCode() string { return "near_duplicate" }
+
+func (c DedupConfig) validate() error {
+	if c.Mode != "" && c.Mode != "off" && c.Mode != "reject" && c.Mode != "flag" {
+		return fmt.Errorf("mode must be 'off', 'reject' or 'flag'")
+	}
+	if c.MaxDistance < 0 || c.MaxDistance > 64 {
+		return fmt.Errorf("maxDistance must be between 0 and 64")
+	}
+	return nil
+}
+
+// GET /api/dedup returns the near-duplicate screening, POST changes it; it
+// applies to documents added afterwards
+func dedupHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		config := state.Dedup
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+		if err := config.validate(); err != nil {
+			apierror.Error(w, "Error: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		state.Dedup = config
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state.Dedup)
+}
+
+// checks a new document against the indexed ones and those accepted before it
+// in the same batch: an error when near-duplicates are rejected, otherwise the
+// document marked with the closest one when they are flagged (caller holds the lock)
+func screenDuplicate(doc Document, batch []Document) (Document, error) {
+	if state.Dedup.Mode != "reject" && state.Dedup.Mode != "flag" {
+		return doc, nil
+	}
+	fingerprint := engine.SimHash(doc.TermFreq)
+	doc.Fingerprint = fingerprint // compared with the later documents of the batch
+	original, best := "", state.Dedup.MaxDistance+1
+	for _, docs := range [][]Document{state.Documents, batch} {
+		for _, other := range docs {
+			if distance := engine.HammingDistance(fingerprint, other.Fingerprint); distance < best && other.Name != doc.Name {
+				original, best = other.Name, distance
+			}
+		}
+	}
+	if original == "" {
+		return doc, nil
+	}
+	if state.Dedup.Mode == "reject" {
+		return doc, &nearDuplicateError{name: doc.Name, original: original, distance: best}
+	}
+	doc.DuplicateOf = original
+	return doc, nil
+}
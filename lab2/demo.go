@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"ir/internal/apierror"
+)
+
+// sample corpus bundled into the binary
+//
+//go:embed test/*.txt
+var demoCorpus embed.FS
+
+// DemoQuery is an example query with the documents it is expected to return
+type DemoQuery struct {
+	Query    string   `json:"query"`
+	Expected []string `json:"expected"`
+}
+
+const demoQueriesFile = "Search query.txt"
+
+// query and expected documents are separated by a tab or a run of spaces
+var demoColumnsRegex = regexp.MustCompile(`\t+| {2,}`)
+
+// indexes the bundled corpus (caller holds the lock when serving requests)
+func loadDemoCorpus() ([]string, []DemoQuery) {
+	var errorMessages []string
+
+	entries, _ := demoCorpus.ReadDir("test")
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == demoQueriesFile {
+			continue
+		}
+		contentBytes, err := demoCorpus.ReadFile(path.Join("test", name))
+		if err != nil {
+			errorMessages = append(errorMessages, fmt.Sprintf("Error reading %s", name))
+			continue
+		}
+		if err := addDocument(name, bytes.NewReader(contentBytes)); err != nil {
+			errorMessages = append(errorMessages, err.Error())
+		}
+	}
+
+	fmt.Printf("Demo corpus loaded. Documents: %d\n", len(state.Documents))
+	return errorMessages, demoQueries()
+}
+
+// parses "query    doc1.txt, doc2.txt" lines from the bundled query file
+func demoQueries() []DemoQuery {
+	queries := []DemoQuery{}
+
+	raw, err := demoCorpus.ReadFile(path.Join("test", demoQueriesFile))
+	if err != nil {
+		return queries
+	}
+
+	for _, line := range strings.Split(string(raw), "\n") {
+		columns := demoColumnsRegex.Split(strings.TrimSpace(line), 2)
+		if len(columns) != 2 {
+			continue // only lines with an expected-result column
+		}
+		demoQuery := DemoQuery{Query: columns[0], Expected: []string{}}
+		for _, name := range strings.Split(columns[1], ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				demoQuery.Expected = append(demoQuery.Expected, name)
+			}
+		}
+		queries = append(queries, demoQuery)
+	}
+	return queries
+}
+
+// one-click loading of the demo corpus
+func demoLoadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	errorMessages, queries := loadDemoCorpus()
+
+	response := map[string]interface{}{
+		"documents": documentNames(),
+		"queries":   queries,
+		"errors":    errorMessages,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"strings"
+
+	"ir/internal/engine"
+)
+
+// TermCoverage describes how a single query term relates to the corpus
+type TermCoverage struct {
+	Term              string `json:"term"`
+	Original          string `json:"original"` // the word as typed, Term as it was searched
+	DocumentFrequency int    `json:"documentFrequency"`
+	InVocabulary      bool   `json:"inVocabulary"`
+	Rewritten         bool   `json:"rewritten"`
+}
+
+// QueryCoverage summarizes how much of the query the corpus can answer
+type QueryCoverage struct {
+	Coverage     float64        `json:"coverage"` // fraction of query terms found in the vocabulary
+	MatchedTerms int            `json:"matchedTerms"`
+	TotalTerms   int            `json:"totalTerms"`
+	Rewritten    bool           `json:"rewritten"` // any term stemmed, corrected, dropped or added
+	Dropped      []string       `json:"dropped"`   // stop words the analyzer left out
+	Added        []string       `json:"added"`     // synonyms and sound-alikes the query was expanded with
+	Terms        []TermCoverage `json:"terms"`
+}
+
+// SearchDiagnostics tells how much work the ranker did, to compare rankers by their responses
+type SearchDiagnostics struct {
+	CandidatesScored int `json:"candidatesScored"` // documents the ranker computed a score for
+	TermsMatched     int `json:"termsMatched"`     // distinct terms of the searched query found in the collection
+}
+
+// the lexical rankers only score documents that share a term with the query,
+// the vector rankers (lsi, dense, hybrid) score every document (caller holds the lock)
+func searchDiagnostics(ranker, query string) SearchDiagnostics {
+	terms := map[string]bool{}
+	for _, term := range strings.Fields(strings.ToLower(query)) {
+		terms[term] = true
+	}
+
+	var diagnostics SearchDiagnostics
+	matched := map[string]bool{}
+	for _, doc := range state.Documents {
+		candidate := false
+		for term := range terms {
+			if doc.TermFreq[term] > 0 {
+				candidate = true
+				matched[term] = true
+			}
+		}
+		if candidate {
+			diagnostics.CandidatesScored++
+		}
+	}
+	switch ranker {
+	case "lsi", "dense", "hybrid":
+		diagnostics.CandidatesScored = len(state.Documents)
+	}
+	diagnostics.TermsMatched = len(matched)
+	return diagnostics
+}
+
+// the stages a ranked query went through on its way to the ranker
+type queryRewriting struct {
+	typed     string           // as sent, without operators and boosts
+	analyzer  *engine.Analyzer // stemming and stop words, nil when the query is not analyzed
+	corrected string           // after the analyzer and the spelling correction
+	searched  string           // after the phonetic and synonym expansion
+}
+
+// the query searched as typed
+func unrewritten(query string) queryRewriting {
+	return queryRewriting{typed: query, corrected: query, searched: query}
+}
+
+// builds coverage diagnostics for the query against the uploaded documents:
+// each typed word with the term it was searched as, the stop words the analyzer
+// dropped and the terms the expansions added (caller holds the lock)
+func queryCoverage(rewriting queryRewriting) QueryCoverage {
+	coverage := QueryCoverage{
+		Dropped: []string{},
+		Added:   []string{},
+		Terms:   []TermCoverage{},
+	}
+
+	words := strings.Fields(rewriting.typed)
+	terms := make([]string, 0, len(words))
+	kept := make([]string, 0, len(words)) // the words the terms come from
+	for _, word := range words {
+		term := strings.ToLower(word)
+		if rewriting.analyzer != nil {
+			var ok bool
+			if term, ok = rewriting.analyzer.Filter(term); !ok {
+				coverage.Dropped = append(coverage.Dropped, word)
+				continue
+			}
+		}
+		terms, kept = append(terms, term), append(kept, word)
+	}
+	if len(terms) == 0 { // a query of stop words only is searched as typed
+		coverage.Dropped = []string{}
+		for _, word := range words {
+			terms, kept = append(terms, strings.ToLower(word)), append(kept, word)
+		}
+	}
+	// the spelling correction replaces terms in place
+	if corrected := strings.Fields(strings.ToLower(rewriting.corrected)); len(corrected) == len(terms) {
+		terms = corrected
+	}
+
+	seen := make(map[string]bool)
+	for i, original := range kept {
+		term := terms[i]
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		df := documentFrequency(term)
+		termCoverage := TermCoverage{
+			Term:              term,
+			Original:          original,
+			DocumentFrequency: df,
+			InVocabulary:      df > 0,
+			Rewritten:         term != original,
+		}
+		if termCoverage.InVocabulary {
+			coverage.MatchedTerms++
+		}
+		if termCoverage.Rewritten {
+			coverage.Rewritten = true
+		}
+		coverage.Terms = append(coverage.Terms, termCoverage)
+	}
+	for _, term := range strings.Fields(strings.ToLower(rewriting.searched)) {
+		if !seen[term] {
+			seen[term] = true
+			coverage.Added = append(coverage.Added, term)
+		}
+	}
+
+	coverage.Rewritten = coverage.Rewritten || len(coverage.Dropped) > 0 || len(coverage.Added) > 0
+	coverage.TotalTerms = len(coverage.Terms)
+	if coverage.TotalTerms > 0 {
+		coverage.Coverage = float64(coverage.MatchedTerms) / float64(coverage.TotalTerms)
+	}
+	return coverage
+}
+
+// number of documents containing the term
+func documentFrequency(term string) int {
+	df := 0
+	for _, doc := range state.Documents {
+		if doc.TermFreq[term] > 0 {
+			df++
+		}
+	}
+	return df
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"ir/internal/apierror"
+	"ir/internal/segment"
+)
+
+// OptimizeResponse is returned by POST /api/optimize
+type OptimizeResponse struct {
+	Segments       segment.OptimizeStats `json:"segments"`
+	StoreCompacted bool                  `json:"storeCompacted"`
+}
+
+// DocumentEntry is one document of GET /api/documents
+type DocumentEntry struct {
+	Name        string    `json:"name"`
+	Length      int       `json:"length"`
+	UniqueTerms int       `json:"uniqueTerms"`
+	Label       string    `json:"label"`
+	Language    string    `json:"language"`
+	DuplicateOf string    `json:"duplicateOf,omitempty"` // flagged as a near-duplicate of this document
+	Version     int       `json:"version"`
+	ETag        string    `json:"etag"`
+	Uploaded    time.Time `json:"uploadedAt,omitzero"`
+}
+
+// strong validator over the document text, for optimistic concurrency on updates
+func documentETag(doc Document) string {
+	content, raw := doc.text()
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\x00%s\x00%s", doc.Length, content, raw)
+	return `"` + hex.EncodeToString(h.Sum(nil)[:12]) + `"`
+}
+
+// reports whether an If-Match header lists the ETag; "*" matches any document
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		if candidate = strings.TrimSpace(candidate); candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checks the If-Match header of a change to the document at position i, -1 for
+// a new document; answers 428 or 412 and returns false when it fails (caller holds the lock)
+func checkIfMatch(w http.ResponseWriter, r *http.Request, i int) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if i < 0 {
+			return true // creating a document needs no precondition
+		}
+		apierror.Error(w, "Error: If-Match header required, send the document's ETag.", http.StatusPreconditionRequired)
+		return false
+	}
+	if i >= 0 && etagMatches(header, documentETag(state.Documents[i])) {
+		return true
+	}
+	apierror.Error(w, "Error: Document was modified meanwhile, its ETag no longer matches.", http.StatusPreconditionFailed)
+	return false
+}
+
+// removes the document at position i from the working set; its postings are
+// tombstoned instead of rebuilding the index (caller holds the lock)
+func deleteDocument(i int) {
+	doc := state.Documents[i]
+	state.segments.Delete(doc.id)
+	state.Documents = append(state.Documents[:i:i], state.Documents[i+1:]...)
+	delete(state.Embeddings, doc.Name)
+	delete(state.Labels, doc.Name)
+	delete(state.Metadata, doc.Name)
+	delete(state.Versions, doc.Name)
+	invalidateCaches()
+}
+
+// replaces the document at position i by a new version under the same name and
+// position; the old postings are tombstoned, the new ones indexed under a new ID
+// (caller holds the lock)
+func replaceDocument(i int, doc Document) (int, error) {
+	old := state.Documents[i]
+	raw := old.raw() // read before the store overwrites it
+	doc.id = state.nextID
+	// one write replaces the stored version, a failed one leaves it in place
+	if err := state.store.SaveDocuments([]Document{doc}); err != nil {
+		return 0, err
+	}
+	version := recordVersion(old, raw)
+	_, doc.stored = state.store.(textLoader)
+
+	state.segments.Delete(old.id)
+	// a new slice, rankers may still be reading the old one without the lock
+	state.Documents = slices.Clone(state.Documents)
+	state.Documents[i] = prepareDocument(doc)
+	delete(state.Embeddings, old.Name)
+	invalidateCaches()
+	return version, nil
+}
+
+// PUT /api/documents/{name} creates the document or replaces its content with the
+// request body, keeping the previous version; replacing requires If-Match with
+// the current ETag
+func putDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	state.Lock()
+	config := currentIndexConfig()
+	state.Unlock()
+
+	// analyze outside the lock, the swap below is a single step for searches
+	doc, err := analyzeDocument(name, r.Body, config)
+	if err != nil {
+		apierror.Error(w, "Error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	i := documentIndex(name)
+	if !checkIfMatch(w, r, i) {
+		return
+	}
+	status, version := http.StatusOK, 1
+	if i < 0 {
+		if doc, err = screenDuplicate(doc, nil); err != nil {
+			apierror.Write(w, http.StatusConflict, "near_duplicate", err.Error())
+			return
+		}
+		if _, err := insertDocument(doc); err != nil {
+			apierror.Error(w, "Error: Could not store the document: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		status = http.StatusCreated
+		i = len(state.Documents) - 1
+	} else if version, err = replaceDocument(i, doc); err != nil {
+		apierror.Error(w, "Error: Could not replace the stored document: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	etag := documentETag(state.Documents[i])
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":    name,
+		"version": version,
+		"etag":    etag,
+	})
+}
+
+// DELETE /api/documents/{name} soft-deletes a document, If-Match must carry its
+// ETag; /api/optimize reclaims its space
+func deleteDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	state.Lock()
+	defer state.Unlock()
+
+	i := documentIndex(name)
+	if i < 0 {
+		apierror.Error(w, "Error: Document not found.", http.StatusNotFound)
+		return
+	}
+	if !checkIfMatch(w, r, i) {
+		return
+	}
+	if err := state.store.Delete(name); err != nil {
+		apierror.Error(w, "Error: Could not delete the document from the store: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	deleteDocument(i)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deleted":   name,
+		"documents": documentNames(),
+	})
+}
+
+// GET /api/documents/{name}/content returns the normalized text, ?original=true the
+// text as uploaded with a Content-Type from the file name; supports If-None-Match and ranges
+func documentContentHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	original := r.URL.Query().Get("original") == "true"
+
+	state.Lock()
+	defer state.Unlock()
+
+	i := documentIndex(name)
+	if i < 0 {
+		apierror.Error(w, "Error: Document not found.", http.StatusNotFound)
+		return
+	}
+	doc := state.Documents[i]
+	content, raw := doc.text()
+	text := content
+	if original {
+		text = raw
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	if text == "" {
+		apierror.Error(w, "Error: The text of this document is not stored, it exceeds the size limit.", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("ETag", documentETag(doc))
+	http.ServeContent(w, r, name, time.Time{}, strings.NewReader(text))
+}
+
+// GET /api/documents lists the documents in upload order, as JSON, CSV or XML
+func listDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	entries := []DocumentEntry{}
+	for _, doc := range state.Documents {
+		entries = append(entries, DocumentEntry{
+			Name:        doc.Name,
+			Length:      doc.Length,
+			UniqueTerms: len(doc.TermFreq),
+			Label:       state.Labels[doc.Name],
+			Language:    doc.Language,
+			DuplicateOf: doc.DuplicateOf,
+			Version:     documentHistory(doc.Name).Current,
+			ETag:        documentETag(doc),
+			Uploaded:    doc.Uploaded,
+		})
+	}
+
+	if format := negotiateFormat(w, r); format != "json" {
+		t := table{Root: "documents", Row: "document", Columns: []string{"name", "length", "uniqueTerms", "label", "language", "duplicateOf", "version", "etag", "uploadedAt"}}
+		for _, e := range entries {
+			t.Rows = append(t.Rows, []string{
+				e.Name, strconv.Itoa(e.Length), strconv.Itoa(e.UniqueTerms), e.Label, e.Language, e.DuplicateOf, strconv.Itoa(e.Version), e.ETag, uploadedAt(e.Uploaded),
+			})
+		}
+		writeTable(w, format, t)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// GET /api/documents/lookup?glob=reports/*.txt matches the glob case-insensitively
+// against the document names
+func documentLookupHandler(w http.ResponseWriter, r *http.Request) {
+	glob := strings.ToLower(r.URL.Query().Get("glob"))
+	if glob == "" {
+		glob = "*"
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		apierror.Error(w, "Error: Invalid glob pattern.", http.StatusBadRequest)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	matches := []string{}
+	for _, doc := range state.Documents {
+		if matched, _ := path.Match(glob, strings.ToLower(doc.Name)); matched {
+			matches = append(matches, doc.Name)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(matches)
+}
+
+func uploadedAt(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// POST /api/optimize merges the index segments, dropping tombstoned documents,
+// and compacts the store
+func optimizeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// the segments lock themselves, searches go on during the merge
+	stats, err := state.segments.Optimize()
+	if err != nil {
+		apierror.Error(w, "Error: Could not optimize the index: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := OptimizeResponse{Segments: stats}
+
+	state.Lock()
+	defer state.Unlock()
+	if store, ok := state.store.(compactor); ok {
+		if err := store.Compact(); err != nil {
+			apierror.Error(w, "Error: Could not compact the store: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response.StoreCompacted = true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"ir/internal/apierror"
+)
+
+// longest document text sent to an external model (embedder, reranker)
+const maxModelInput = 8000
+
+// Embedder turns texts into dense vectors of a fixed dimension
+type Embedder interface {
+	Embed(texts []string) ([][]float32, error)
+}
+
+// EmbedderConfig selects the embedding provider of the collection
+type EmbedderConfig struct {
+	Provider   string `json:"provider" enum:"hashing|http"` // "hashing" is local and the default
+	Dimensions int    `json:"dimensions,omitempty" minimum:"0"`
+	URL        string `json:"url,omitempty"` // OpenAI-compatible /v1/embeddings endpoint
+	Model      string `json:"model,omitempty"`
+	APIKey     string `json:"apiKey,omitempty"`
+}
+
+var defaultEmbedderConfig = EmbedderConfig{Provider: "hashing", Dimensions: 256}
+
+func (c EmbedderConfig) validate() error {
+	switch c.Provider {
+	case "hashing":
+		if c.Dimensions <= 0 {
+			return fmt.Errorf("dimensions must be positive")
+		}
+	case "http":
+		if c.URL == "" {
+			return fmt.Errorf("url is required for the http provider")
+		}
+	default:
+		return fmt.Errorf("provider must be 'hashing' or 'http'")
+	}
+	return nil
+}
+
+func (c EmbedderConfig) embedder() Embedder {
+	if c.Provider == "http" {
+		return &httpEmbedder{url: c.URL, model: c.Model, apiKey: c.APIKey, client: &http.Client{Timeout: 30 * time.Second}}
+	}
+	return hashingEmbedder{dimensions: c.Dimensions}
+}
+
+// hashingEmbedder is a local, dependency-free embedder: character trigrams are
+// hashed into a fixed number of signed buckets. It captures surface similarity
+// only, a model-backed provider is needed for semantic matching.
+type hashingEmbedder struct {
+	dimensions int
+}
+
+func (e hashingEmbedder) Embed(texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector := make([]float32, e.dimensions)
+		for _, term := range sentenceTerms(text) {
+			padded := " " + term + " "
+			for j := 0; j+3 <= len(padded); j++ {
+				h := fnv.New32a()
+				h.Write([]byte(padded[j : j+3]))
+				sum := h.Sum32()
+				sign := float32(1)
+				if sum&1 == 1 {
+					sign = -1
+				}
+				vector[(sum>>1)%uint32(e.dimensions)] += sign
+			}
+		}
+		embeddings[i] = normalizeEmbedding(vector)
+	}
+	return embeddings, nil
+}
+
+// httpEmbedder calls an OpenAI-compatible embeddings API
+type httpEmbedder struct {
+	url    string
+	model  string
+	apiKey string
+	client *http.Client
+}
+
+func (e *httpEmbedder) Embed(texts []string) ([][]float32, error) {
+	body, _ := json.Marshal(map[string]interface{}{"input": texts, "model": e.model})
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding API returned %s", resp.Status)
+	}
+
+	var result struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid embedding response: %v", err)
+	}
+	if len(result.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding API returned %d vectors for %d texts", len(result.Data), len(texts))
+	}
+
+	embeddings := make([][]float32, len(texts))
+	for _, item := range result.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding API returned an invalid index")
+		}
+		embeddings[item.Index] = normalizeEmbedding(item.Embedding)
+	}
+	return embeddings, nil
+}
+
+// scales the embedding to unit length so cosine similarity is a dot product
+func normalizeEmbedding(vector []float32) []float32 {
+	norm := 0.0
+	for _, x := range vector {
+		norm += float64(x) * float64(x)
+	}
+	if norm == 0 {
+		return vector
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range vector {
+		vector[i] *= scale
+	}
+	return vector
+}
+
+func documentText(doc Document) string {
+	content, text := doc.text()
+	if text == "" {
+		text = content
+	}
+	if len(text) > maxModelInput {
+		text = text[:maxModelInput]
+	}
+	return text
+}
+
+// embeds the documents that have no stored embedding yet (caller holds the lock)
+func ensureEmbeddings() error {
+	var pending []Document
+	for _, doc := range state.Documents {
+		if _, ok := state.Embeddings[doc.Name]; !ok {
+			pending = append(pending, doc)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	texts := make([]string, len(pending))
+	for i, doc := range pending {
+		texts[i] = documentText(doc)
+	}
+	embeddings, err := state.Embedder.embedder().Embed(texts)
+	if err != nil {
+		return err
+	}
+	for i, doc := range pending {
+		state.Embeddings[doc.Name] = embeddings[i]
+	}
+	fmt.Println("Embedded", len(pending), "documents")
+	return nil
+}
+
+// ranks the documents by cosine similarity of their embeddings to the query embedding
+func (v *corpusView) denseSearch(query string) ([]SearchResult, error) {
+	if v.embeddings == nil {
+		return nil, fmt.Errorf("the dense ranker needs a view with the embeddings")
+	}
+	embedded, err := v.embedder.embedder().Embed([]string{query})
+	if err != nil {
+		return nil, err
+	}
+	queryEmbedding := embedded[0]
+
+	results := make([]SearchResult, 0)
+	for j, doc := range v.docs {
+		embedding := v.embeddings[j]
+		if len(embedding) != len(queryEmbedding) {
+			continue
+		}
+		score := 0.0
+		for i := range embedding {
+			score += float64(embedding[i]) * float64(queryEmbedding[i])
+		}
+		if score > 0.0 {
+			results = append(results, SearchResult{FileName: doc.Name, Score: score})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results, nil
+}
+
+// reads or replaces the embedding provider; stored embeddings are dropped on change
+func embedderConfigHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		config := defaultEmbedderConfig
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+		if err := config.validate(); err != nil {
+			apierror.Error(w, "Error: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		state.Embedder = config
+		state.Embeddings = map[string][]float32{}
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	config := state.Embedder
+	if config.APIKey != "" {
+		config.APIKey = "***"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(config)
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"ir/internal/apierror"
+	"ir/internal/engine"
+)
+
+// Entity is a name found in the text of a document at ingest
+type Entity struct {
+	Type  string `json:"type"` // person, organization or location
+	Text  string `json:"text"` // as first written in the document
+	Count int    `json:"count"`
+}
+
+type DocumentEntities struct {
+	Document string   `json:"document"`
+	Entities []Entity `json:"entities"`
+}
+
+var entityTypes = []string{"person", "organization", "location"}
+
+// entity:type:"some name" or entity:type:name in a query
+var entityFilterPattern = regexp.MustCompile(`(?i)entity:([a-z]+):(?:"([^"]*)"|(\S+))`)
+
+var entityWordPattern = regexp.MustCompile(`\p{L}[\p{L}\p{N}'’-]*`)
+
+// words that precede a person's name and are not part of it
+var personTitles = wordSet("mr mrs ms miss dr prof professor sir dame lord lady president king queen")
+
+// lowercase words allowed inside a name, e.g. "University of Oxford"
+var nameConnectors = wordSet("of de da del van von der la le du")
+
+var organizationWords = wordSet(`inc corp corporation ltd llc plc gmbh ag co company university
+institute college school academy bank group foundation association society agency ministry
+department council committee commission laboratory labs lab union party league federation`)
+
+var firstNames = wordSet(`aaron adam ada alan albert alexander alice amelia andrew ann anna anne
+anthony barbara ben benjamin bill bob brian carl carlos caroline charles charlotte chris
+christopher claude daniel david donald dorothy edgar edward elizabeth emily emma eric ernest
+frank fred frederick george grace hannah harry helen henry isaac jack jacob james jane jean
+jennifer jessica john jonathan joseph julia karen kate katherine kevin larry laura linda lisa
+louis margaret maria marie mark martin mary matthew michael nancy nicholas oliver patricia paul
+peter rachel richard robert ruth sarah scott sophie stephen steven susan thomas tim timothy tom
+victoria walter william`)
+
+var locations = wordSet(`africa america asia australia austria belgium berlin boston brazil
+britain california cambridge canada chicago china dublin edinburgh egypt england europe france
+germany greece hamburg india ireland italy japan kyiv kharkiv lisbon london lviv madrid mexico
+milan moscow munich netherlands norway oxford paris poland portugal prague rome russia scotland
+spain stockholm sweden switzerland texas tokyo ukraine vienna wales warsaw washington`)
+
+// locations of several words, matched before the single-word gazetteer
+var locationNames = wordSet(`new_york los_angeles san_francisco united_states united_kingdom
+hong_kong new_zealand south_africa north_america south_america`)
+
+func wordSet(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.Fields(words) {
+		set[strings.ReplaceAll(word, "_", " ")] = true
+	}
+	return set
+}
+
+func capitalized(word string) bool {
+	r, _ := utf8.DecodeRuneInString(word)
+	return unicode.IsUpper(r)
+}
+
+// acronyms like "IBM" or "NASA" are taken for organizations
+func acronym(word string) bool {
+	if n := utf8.RuneCountInString(word); n < 2 || n > 5 {
+		return false
+	}
+	for _, r := range word {
+		if !unicode.IsUpper(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// the type of a capitalized name of lowercased words, "" when the rules and
+// gazetteers do not recognize it
+func classifyEntity(words []string, titled bool) string {
+	name := strings.Join(words, " ")
+	switch {
+	case titled:
+		return "person"
+	case organizationWords[words[len(words)-1]] || organizationWords[words[0]] && len(words) > 1:
+		return "organization"
+	case locationNames[name] || len(words) == 1 && locations[name]:
+		return "location"
+	case firstNames[words[0]] && len(words) > 1:
+		return "person"
+	}
+	return ""
+}
+
+// finds the person, organization and location names of a text as runs of
+// capitalized words, classified by titles, organization suffixes and small
+// gazetteers of first names and places; a lone surname counts toward the person
+// named in full elsewhere in the text
+func extractEntities(text string) []Entity {
+	stopwords, _ := engine.LookupAnalyzer("en")
+	locs := entityWordPattern.FindAllStringIndex(text, -1)
+	words := make([]string, len(locs))
+	for i, loc := range locs {
+		words[i] = text[loc[0]:loc[1]]
+	}
+	// only spaces between the words, a name does not span punctuation
+	adjacent := func(i int) bool {
+		return strings.TrimSpace(text[locs[i-1][1]:locs[i][0]]) == ""
+	}
+	sentenceStart := func(i int) bool {
+		before := strings.TrimRightFunc(text[:locs[i][0]], unicode.IsSpace)
+		return before == "" || strings.ContainsAny(before[len(before)-1:], ".!?\n")
+	}
+
+	type key struct{ kind, name string }
+	var order []key
+	counts := map[key]int{}
+	written := map[key]string{}
+	var surnames []string // single capitalized words left unclassified
+
+	for i := 0; i < len(words); {
+		if !capitalized(words[i]) {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(words) && adjacent(j) {
+			if capitalized(words[j]) {
+				j++
+			} else if nameConnectors[words[j]] && j+1 < len(words) && capitalized(words[j+1]) && adjacent(j+1) {
+				j += 2
+			} else {
+				break
+			}
+		}
+
+		start := i
+		titled := false
+		for start < j && (personTitles[strings.ToLower(words[start])] || start == i && isStopword(stopwords, words[start])) {
+			titled = titled || personTitles[strings.ToLower(words[start])]
+			start++
+		}
+		if start == j {
+			i = j
+			continue
+		}
+		// "Dr. Smith": the period keeps the title out of the run of the name
+		titled = titled || start == i && i > 0 && personTitles[strings.ToLower(words[i-1])] &&
+			strings.TrimSpace(text[locs[i-1][1]:locs[i][0]]) == "."
+
+		lower := make([]string, j-start)
+		for k, word := range words[start:j] {
+			lower[k] = strings.ToLower(word)
+		}
+		kind := classifyEntity(lower, titled)
+		if kind == "" && j-start == 1 && acronym(words[start]) {
+			kind = "organization"
+		}
+		original := strings.Join(strings.Fields(text[locs[start][0]:locs[j-1][1]]), " ")
+		if kind == "" {
+			if j-start == 1 && !sentenceStart(start) {
+				surnames = append(surnames, lower[0])
+			}
+			i = j
+			continue
+		}
+
+		k := key{kind, strings.Join(lower, " ")}
+		if counts[k] == 0 {
+			order = append(order, k)
+			written[k] = original
+		}
+		counts[k]++
+		i = j
+	}
+
+	for _, surname := range surnames {
+		for _, k := range order {
+			if k.kind == "person" && strings.HasSuffix(k.name, " "+surname) {
+				counts[k]++
+				break
+			}
+		}
+	}
+
+	entities := make([]Entity, len(order))
+	for i, k := range order {
+		entities[i] = Entity{Type: k.kind, Text: written[k], Count: counts[k]}
+	}
+	sort.SliceStable(entities, func(i, j int) bool {
+		return entities[i].Count > entities[j].Count
+	})
+	return entities
+}
+
+func isStopword(analyzer engine.Analyzer, word string) bool {
+	_, kept := analyzer.Filter(strings.ToLower(word))
+	return !kept
+}
+
+// metadata values of the entities of the document, "type:name" lowercased, so
+// that the "entity" field can be faceted and filtered on (caller holds the lock)
+func entityValues(doc Document) []string {
+	values := make([]string, len(doc.Entities))
+	for i, entity := range doc.Entities {
+		values[i] = entity.Type + ":" + strings.ToLower(entity.Text)
+	}
+	return values
+}
+
+// splits the entity:type:"name" filters off a query; the remaining query keeps
+// the other words, or the names when there are none, so that the entity alone
+// can be searched for
+func parseEntityFilters(query string) (string, []string) {
+	var filters, names []string
+	for _, m := range entityFilterPattern.FindAllStringSubmatch(query, -1) {
+		name := strings.Join(strings.Fields(m[2]+m[3]), " ")
+		filters = append(filters, strings.ToLower(m[1])+":"+strings.ToLower(name))
+		names = append(names, name)
+	}
+	if len(filters) == 0 {
+		return query, nil
+	}
+	rest := strings.TrimSpace(entityFilterPattern.ReplaceAllString(query, " "))
+	if rest == "" {
+		rest = strings.Join(names, " ")
+	}
+	return rest, filters
+}
+
+// reports whether the document mentions every filtered entity (caller holds the lock)
+func hasEntities(name string, filters []string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	i := documentIndex(name)
+	if i < 0 {
+		return false
+	}
+	values := entityValues(state.Documents[i])
+	for _, filter := range filters {
+		if !contains(values, filter) {
+			return false
+		}
+	}
+	return true
+}
+
+// GET /api/entities lists the entities found in each document, ?document=name
+// for one of them and ?type=person for one kind
+func entitiesHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("document")
+	kind := r.URL.Query().Get("type")
+	if kind != "" && !contains(entityTypes, kind) {
+		apierror.Error(w, "Error: 'type' must be person, organization or location.", http.StatusBadRequest)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	if name != "" && documentIndex(name) < 0 {
+		apierror.Error(w, "Error: Document not found.", http.StatusNotFound)
+		return
+	}
+	response := []DocumentEntities{}
+	for _, doc := range state.Documents {
+		if name != "" && doc.Name != name {
+			continue
+		}
+		entities := []Entity{}
+		for _, entity := range doc.Entities {
+			if kind == "" || entity.Type == kind {
+				entities = append(entities, entity)
+			}
+		}
+		response = append(response, DocumentEntities{Document: doc.Name, Entities: entities})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
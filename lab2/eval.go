@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+
+	"ir/internal/apierror"
+)
+
+// EvalQuery is a query of the evaluation set
+type EvalQuery struct {
+	ID    string `json:"id"`
+	Query string `json:"query"`
+}
+
+// Qrel is a relevance judgment, grades above 0 count as relevant
+type Qrel struct {
+	QueryID   string `json:"queryId"`
+	Document  string `json:"document"`
+	Relevance int    `json:"relevance"`
+}
+
+// EvalMetrics are the effectiveness measures of one ranking, or their macro average
+type EvalMetrics struct {
+	PrecisionAtK     float64 `json:"precisionAtK"`
+	Precision        float64 `json:"precision"` // over the whole result list
+	Recall           float64 `json:"recall"`
+	F1               float64 `json:"f1"`
+	AveragePrecision float64 `json:"averagePrecision"` // MAP when averaged
+	ReciprocalRank   float64 `json:"reciprocalRank"`   // of the first relevant document, MRR when averaged
+	NDCGAtK          float64 `json:"ndcgAtK"`
+}
+
+type QueryEvaluation struct {
+	QueryID   string   `json:"queryId"`
+	Query     string   `json:"query"`
+	Retrieved int      `json:"retrieved"`
+	Relevant  int      `json:"relevant"`
+	Ranking   []string `json:"ranking"` // top k
+	EvalMetrics
+}
+
+type EvalReport struct {
+	Ranker   string            `json:"ranker"`
+	K        int               `json:"k"`
+	Queries  []QueryEvaluation `json:"queries"`
+	Mean     EvalMetrics       `json:"mean"`     // macro average over the judged queries
+	Unjudged []string          `json:"unjudged"` // queries without relevant documents, left out of the mean
+}
+
+// measures a ranking against the graded judgments of its query
+func evaluateRanking(ranking []string, judgments map[string]int, k int) EvalMetrics {
+	relevant := 0
+	var grades []int
+	for _, grade := range judgments {
+		if grade > 0 {
+			relevant++
+			grades = append(grades, grade)
+		}
+	}
+
+	var m EvalMetrics
+	hits, dcg := 0, 0.0
+	for i, name := range ranking {
+		grade := judgments[name]
+		if grade <= 0 {
+			continue
+		}
+		hits++
+		if hits == 1 {
+			m.ReciprocalRank = 1 / float64(i+1)
+		}
+		m.AveragePrecision += float64(hits) / float64(i+1)
+		if i < k {
+			m.PrecisionAtK++
+			dcg += (math.Pow(2, float64(grade)) - 1) / math.Log2(float64(i+2))
+		}
+	}
+	m.PrecisionAtK /= float64(k)
+	if relevant > 0 {
+		m.Recall = float64(hits) / float64(relevant)
+		m.AveragePrecision /= float64(relevant)
+	}
+	if len(ranking) > 0 {
+		m.Precision = float64(hits) / float64(len(ranking))
+	}
+	if m.Precision+m.Recall > 0 {
+		m.F1 = 2 * m.Precision * m.Recall / (m.Precision + m.Recall)
+	}
+
+	// ideal ordering puts the highest grades first
+	sort.Sort(sort.Reverse(sort.IntSlice(grades)))
+	idcg := 0.0
+	for i, grade := range grades[:min(k, len(grades))] {
+		idcg += (math.Pow(2, float64(grade)) - 1) / math.Log2(float64(i+2))
+	}
+	if idcg > 0 {
+		m.NDCGAtK = dcg / idcg
+	}
+	return m
+}
+
+// copies the judgments of the queries, so they are evaluated without the lock (caller holds the lock)
+func queryJudgments(queries []EvalQuery) map[string]map[string]int {
+	qrels := make(map[string]map[string]int, len(queries))
+	for _, query := range queries {
+		qrels[query.ID] = maps.Clone(state.Qrels[query.ID])
+	}
+	return qrels
+}
+
+// runs every query through the ranker over the same view
+func evaluateRanker(view *corpusView, queries []EvalQuery, qrels map[string]map[string]int, ranker string, hybrid *HybridOptions, k int) (EvalReport, error) {
+	report := EvalReport{Ranker: ranker, K: k, Queries: []QueryEvaluation{}, Unjudged: []string{}}
+	if report.Ranker == "" {
+		report.Ranker = "cosine"
+	}
+
+	for _, query := range queries {
+		results, err := view.rank(ranker, normalizeQuery(query.Query), hybrid)
+		if err != nil {
+			return EvalReport{}, err
+		}
+		ranking := make([]string, len(results))
+		for i, result := range results {
+			ranking[i] = result.FileName
+		}
+
+		judgments := qrels[query.ID]
+		evaluation := QueryEvaluation{
+			QueryID:     query.ID,
+			Query:       query.Query,
+			Retrieved:   len(ranking),
+			Ranking:     ranking[:min(k, len(ranking))],
+			EvalMetrics: evaluateRanking(ranking, judgments, k),
+		}
+		for _, grade := range judgments {
+			if grade > 0 {
+				evaluation.Relevant++
+			}
+		}
+		if evaluation.Relevant == 0 {
+			report.Unjudged = append(report.Unjudged, query.ID)
+			continue
+		}
+		report.Queries = append(report.Queries, evaluation)
+	}
+
+	report.Mean = meanMetrics(report.Queries)
+	return report, nil
+}
+
+// macro average of the measures over the queries
+func meanMetrics(queries []QueryEvaluation) EvalMetrics {
+	var mean EvalMetrics
+	n := float64(len(queries))
+	for _, q := range queries {
+		mean.PrecisionAtK += q.PrecisionAtK / n
+		mean.Precision += q.Precision / n
+		mean.Recall += q.Recall / n
+		mean.F1 += q.F1 / n
+		mean.AveragePrecision += q.AveragePrecision / n
+		mean.ReciprocalRank += q.ReciprocalRank / n
+		mean.NDCGAtK += q.NDCGAtK / n
+	}
+	return mean
+}
+
+type EvalQueriesRequest struct {
+	Queries []EvalQuery `json:"queries"`
+}
+
+// GET lists the query set, POST {"queries": [{"id", "query"}]} adds or replaces queries by id, DELETE clears it
+func evalQueriesHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var requestData EvalQueriesRequest
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+		for _, query := range requestData.Queries {
+			if query.ID == "" {
+				apierror.Error(w, "Error: Every query needs an id.", http.StatusBadRequest)
+				return
+			}
+		}
+		for _, query := range requestData.Queries {
+			addEvalQuery(query)
+		}
+	case http.MethodDelete:
+		state.EvalQueries = []EvalQuery{}
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state.EvalQueries)
+}
+
+// adds the query or replaces the one with the same id (caller holds the lock)
+func addEvalQuery(query EvalQuery) {
+	for i, existing := range state.EvalQueries {
+		if existing.ID == query.ID {
+			state.EvalQueries[i] = query
+			return
+		}
+	}
+	state.EvalQueries = append(state.EvalQueries, query)
+}
+
+type QrelsRequest struct {
+	Qrels []Qrel `json:"qrels"`
+}
+
+// GET lists the judgments, POST {"qrels": [{"queryId", "document", "relevance"}]} adds them, DELETE clears them
+func qrelsHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var requestData QrelsRequest
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+		for _, qrel := range requestData.Qrels {
+			addQrel(qrel)
+		}
+	case http.MethodDelete:
+		state.Qrels = map[string]map[string]int{}
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(qrelList())
+}
+
+// records the judgment, replacing an earlier one for the same pair (caller holds the lock)
+func addQrel(qrel Qrel) {
+	if state.Qrels[qrel.QueryID] == nil {
+		state.Qrels[qrel.QueryID] = map[string]int{}
+	}
+	state.Qrels[qrel.QueryID][qrel.Document] = qrel.Relevance
+}
+
+// judgments ordered by query id and document
+func qrelList() []Qrel {
+	qrels := []Qrel{}
+	for queryID, judgments := range state.Qrels {
+		for document, relevance := range judgments {
+			qrels = append(qrels, Qrel{QueryID: queryID, Document: document, Relevance: relevance})
+		}
+	}
+	sort.Slice(qrels, func(i, j int) bool {
+		if qrels[i].QueryID != qrels[j].QueryID {
+			return qrels[i].QueryID < qrels[j].QueryID
+		}
+		return qrels[i].Document < qrels[j].Document
+	})
+	return qrels
+}
+
+type EvalRunRequest struct {
+	Ranker string         `json:"ranker"`
+	K      int            `json:"k" minimum:"1"`
+	Hybrid *HybridOptions `json:"hybrid"`
+}
+
+// POST /api/eval/run {"ranker": "bm25", "k": 10, "hybrid": {...}}
+func evalRunHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	requestData := EvalRunRequest{K: 10}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		apierror.InvalidJSON(w)
+		return
+	}
+	if requestData.K <= 0 {
+		apierror.Error(w, "Error: k must be positive.", http.StatusBadRequest)
+		return
+	}
+
+	// the query set and its judgments are taken with the collection, the
+	// rankings then run without the lock
+	state.Lock()
+	queries := slices.Clone(state.EvalQueries)
+	qrels := queryJudgments(queries)
+	view, err := snapshotCorpus(requestData.Ranker)
+	state.Unlock()
+	if len(queries) == 0 {
+		apierror.Error(w, "Error: No evaluation queries. Please add queries first.", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		apierror.Error(w, "Error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := evaluateRanker(view, queries, qrels, requestData.Ranker, requestData.Hybrid, requestData.K)
+	if err != nil {
+		apierror.Error(w, "Error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	fmt.Printf("Evaluated %s on %d queries: MAP %.4f\n", report.Ranker, len(report.Queries), report.Mean.AveragePrecision)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
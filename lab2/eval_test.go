@@ -0,0 +1,118 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEvaluateRanking(t *testing.T) {
+	tests := []struct {
+		name      string
+		ranking   []string
+		judgments map[string]int
+		k         int
+		want      EvalMetrics
+	}{
+		{
+			// hits at ranks 1 and 3 of 5, f relevant but not retrieved
+			name:      "binary",
+			ranking:   []string{"a", "b", "c", "d", "e"},
+			judgments: map[string]int{"a": 1, "c": 1, "f": 1},
+			k:         3,
+			want: EvalMetrics{
+				PrecisionAtK:     2.0 / 3,
+				Precision:        2.0 / 5,
+				Recall:           2.0 / 3,
+				F1:               0.5,
+				AveragePrecision: (1.0/1 + 2.0/3) / 3,
+				ReciprocalRank:   1,
+				NDCGAtK:          (1 + 1/math.Log2(4)) / (1 + 1/math.Log2(3) + 1/math.Log2(4)),
+			},
+		},
+		{
+			// gains 2^grade-1: 3 for a, 1 for b; ideally a then b
+			name:      "graded",
+			ranking:   []string{"x", "a", "b"},
+			judgments: map[string]int{"a": 2, "b": 1},
+			k:         3,
+			want: EvalMetrics{
+				PrecisionAtK:     2.0 / 3,
+				Precision:        2.0 / 3,
+				Recall:           1,
+				F1:               0.8,
+				AveragePrecision: (1.0/2 + 2.0/3) / 2,
+				ReciprocalRank:   0.5,
+				NDCGAtK:          (3/math.Log2(3) + 1/math.Log2(4)) / (3 + 1/math.Log2(3)),
+			},
+		},
+		{
+			// grade 0 is not relevant; the hit below k counts for all but P@k and nDCG@k
+			name:      "hit below k",
+			ranking:   []string{"a", "b"},
+			judgments: map[string]int{"a": 0, "b": 1},
+			k:         1,
+			want: EvalMetrics{
+				Precision:        0.5,
+				Recall:           1,
+				F1:               2.0 / 3,
+				AveragePrecision: 0.5,
+				ReciprocalRank:   0.5,
+			},
+		},
+		{
+			// P@k divides by k, even past the end of the ranking
+			name:      "short ranking",
+			ranking:   []string{"a"},
+			judgments: map[string]int{"a": 1},
+			k:         5,
+			want:      EvalMetrics{PrecisionAtK: 0.2, Precision: 1, Recall: 1, F1: 1, AveragePrecision: 1, ReciprocalRank: 1, NDCGAtK: 1},
+		},
+		{"no hits", []string{"x", "y"}, map[string]int{"a": 1}, 2, EvalMetrics{}},
+		{"empty ranking", nil, map[string]int{"a": 1}, 10, EvalMetrics{}},
+		{"unjudged", []string{"a"}, nil, 10, EvalMetrics{}},
+	}
+	for _, test := range tests {
+		got := evaluateRanking(test.ranking, test.judgments, test.k)
+		checkMetrics(t, "evaluateRanking("+test.name+")", got, test.want)
+	}
+}
+
+func TestMeanMetrics(t *testing.T) {
+	queries := []QueryEvaluation{
+		{QueryID: "1", EvalMetrics: EvalMetrics{PrecisionAtK: 1, Precision: 0.5, Recall: 1, F1: 2.0 / 3, AveragePrecision: 1, ReciprocalRank: 1, NDCGAtK: 1}},
+		{QueryID: "2", EvalMetrics: EvalMetrics{AveragePrecision: 0.5, ReciprocalRank: 1.0 / 3}},
+		{QueryID: "3", EvalMetrics: EvalMetrics{Recall: 0.5, AveragePrecision: 0.25, ReciprocalRank: 0.5, NDCGAtK: 0.5}},
+	}
+	want := EvalMetrics{
+		PrecisionAtK:     1.0 / 3,
+		Precision:        0.5 / 3,
+		Recall:           0.5,
+		F1:               2.0 / 9,
+		AveragePrecision: 1.75 / 3,              // MAP
+		ReciprocalRank:   (1 + 1.0/3 + 0.5) / 3, // MRR
+		NDCGAtK:          0.5,
+	}
+	checkMetrics(t, "meanMetrics", meanMetrics(queries), want)
+	checkMetrics(t, "meanMetrics(none)", meanMetrics(nil), EvalMetrics{})
+}
+
+func checkMetrics(t *testing.T, name string, got, want EvalMetrics) {
+	t.Helper()
+	measures := []struct {
+		measure   string
+		got, want float64
+	}{
+		{"P@k", got.PrecisionAtK, want.PrecisionAtK},
+		{"precision", got.Precision, want.Precision},
+		{"recall", got.Recall, want.Recall},
+		{"F1", got.F1, want.F1},
+		{"AP", got.AveragePrecision, want.AveragePrecision},
+		{"RR", got.ReciprocalRank, want.ReciprocalRank},
+		{"nDCG@k", got.NDCGAtK, want.NDCGAtK},
+	}
+	for _, m := range measures {
+		if math.Abs(m.got-m.want) > 1e-9 {
+			t.Errorf("%s: %s = %g, want %g", name, m.measure, m.got, m.want)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"ir/internal/websocket"
+)
+
+const (
+	eventBuffer           = 64 // events queued per client before they are dropped
+	defaultSearchPageSize = 10
+)
+
+// Event is pushed to the /ws clients
+//
+//	indexing  {"file", "done", "total", "error"} per analyzed file of an upload
+//	stats     {"documents", "tokens", "segments", "bufferedDocuments", "deletedDocuments"} after changes
+//	results   {"offset", "results"} a page of a search started by the client
+//	done      {"total", "cancelled", "tookMs"} the search finished or was cancelled
+//	feed      {"id", "url", "lastAdded", ...} after a feed was refreshed
+//	error     {"message"}
+type Event struct {
+	Type string      `json:"type"`
+	ID   string      `json:"id,omitempty"` // search the event belongs to
+	Data interface{} `json:"data"`
+}
+
+type IndexingProgress struct {
+	File  string `json:"file"`
+	Done  int    `json:"done"`
+	Total int    `json:"total"` // 0 while the files of a streamed upload are still arriving
+	Error string `json:"error,omitempty"`
+}
+
+type StatsUpdate struct {
+	Documents         int `json:"documents"`
+	Tokens            int `json:"tokens"`
+	Segments          int `json:"segments"`
+	BufferedDocuments int `json:"bufferedDocuments"`
+	DeletedDocuments  int `json:"deletedDocuments"`
+}
+
+// eventHub fans events out to the connected clients; slow clients lose events
+// instead of blocking the indexer
+type eventHub struct {
+	mu      sync.Mutex
+	clients map[chan Event]bool
+}
+
+var events = &eventHub{clients: map[chan Event]bool{}}
+
+func (h *eventHub) subscribe() chan Event {
+	ch := make(chan Event, eventBuffer)
+	h.mu.Lock()
+	h.clients[ch] = true
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan Event) {
+	h.mu.Lock()
+	delete(h.clients, ch)
+	h.mu.Unlock()
+}
+
+func (h *eventHub) listening() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients) > 0
+}
+
+func (h *eventHub) publish(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.clients {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// announces the collection size after a change (caller holds the lock)
+func publishStats() {
+	if !events.listening() {
+		return
+	}
+	update := StatsUpdate{
+		Documents:         len(state.Documents),
+		Segments:          len(state.segments.Segments()),
+		BufferedDocuments: state.segments.Buffered(),
+		DeletedDocuments:  state.segments.Deleted(),
+	}
+	for _, doc := range state.Documents {
+		update.Tokens += doc.Length
+	}
+	events.publish(Event{Type: "stats", Data: update})
+}
+
+// a message sent by a /ws client
+type wsRequest struct {
+	Type     string         `json:"type"` // "search" or "cancel"
+	ID       string         `json:"id"`
+	Query    string         `json:"query"`
+	Ranker   string         `json:"ranker"`
+	Hybrid   *HybridOptions `json:"hybrid"`
+	PageSize int            `json:"pageSize"`
+}
+
+// GET /ws streams indexing progress and statistics; clients send
+// {"type": "search", "id": "q1", "query": "..."} to receive the results page
+// by page and {"type": "cancel", "id": "q1"} to stop them
+func wsHandler(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	updates := events.subscribe()
+	defer events.unsubscribe(updates)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case e := <-updates:
+				if conn.WriteJSON(e) != nil {
+					return
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	cancelled := map[string]bool{}
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if err != io.EOF {
+				fmt.Println("WebSocket closed:", err)
+			}
+			return
+		}
+		var request wsRequest
+		if err := json.Unmarshal(message, &request); err != nil {
+			conn.WriteJSON(Event{Type: "error", Data: map[string]string{"message": "Invalid JSON"}})
+			continue
+		}
+		switch request.Type {
+		case "search":
+			mu.Lock()
+			delete(cancelled, request.ID)
+			mu.Unlock()
+			go streamSearch(conn, request, func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return cancelled[request.ID]
+			})
+		case "cancel":
+			mu.Lock()
+			cancelled[request.ID] = true
+			mu.Unlock()
+		default:
+			conn.WriteJSON(Event{Type: "error", ID: request.ID, Data: map[string]string{"message": "type must be 'search' or 'cancel'"}})
+		}
+	}
+}
+
+// ranks the collection and sends the results in pages as soon as their
+// snippets are ready, so the first page arrives before the whole list is done
+func streamSearch(conn *websocket.Conn, request wsRequest, cancelled func() bool) {
+	started := time.Now()
+	pageSize := request.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultSearchPageSize
+	}
+
+	state.Lock()
+	view, err := snapshotCorpus(request.Ranker)
+	state.Unlock()
+	var results []SearchResult
+	if err == nil {
+		results, err = view.rank(request.Ranker, normalizeQuery(request.Query), request.Hybrid)
+	}
+	if err == nil {
+		state.Lock()
+		results = liveResults(results)
+		logQuery(request.Query, request.Ranker, started, results)
+		state.Unlock()
+	}
+	if err != nil {
+		conn.WriteJSON(Event{Type: "error", ID: request.ID, Data: map[string]string{"message": err.Error()}})
+		return
+	}
+
+	queryTerms := strings.Fields(strings.ToLower(request.Query))
+	for offset := 0; offset < len(results) && !cancelled(); offset += pageSize {
+		page := []ShapedSearchResult{}
+		state.Lock()
+		for _, result := range results[offset:min(offset+pageSize, len(results))] {
+			shaped := ShapedSearchResult{FileName: result.FileName, Score: result.Score}
+			if i := documentIndex(result.FileName); i >= 0 {
+				shaped.Snippet = documentSnippet(state.Documents[i], queryTerms)
+			}
+			page = append(page, shaped)
+		}
+		state.Unlock()
+		if conn.WriteJSON(Event{Type: "results", ID: request.ID, Data: map[string]interface{}{
+			"offset":  offset,
+			"results": page,
+		}}) != nil {
+			return
+		}
+	}
+	conn.WriteJSON(Event{Type: "done", ID: request.ID, Data: map[string]interface{}{
+		"total":     len(results),
+		"cancelled": cancelled(),
+		"tookMs":    time.Since(started).Milliseconds(),
+	}})
+}
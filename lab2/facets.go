@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"ir/internal/apierror"
+)
+
+// documents carry metadata as named fields with one or more values, e.g.
+// {"tags": ["lecture", "week3"], "author": ["Smith"], "year": ["2024"]}; the
+// class label is the "label" field, the language found at ingest "language" and
+// the named entities "entity", as "person:alan turing"; queries filter on any
+// stored field with field:word
+type DocumentMetadata map[string][]string
+
+type MetadataRequest struct {
+	Metadata map[string]DocumentMetadata `json:"metadata"` // document name -> fields, an empty object clears them
+}
+
+// GET /api/metadata lists the metadata, POST sets the fields of documents
+func metadataHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var requestData MetadataRequest
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+
+		for name, fields := range requestData.Metadata {
+			if documentIndex(name) < 0 {
+				apierror.Error(w, fmt.Sprintf("Error: Document '%s' not found.", name), http.StatusNotFound)
+				return
+			}
+			if err := checkMetadataTypes(fields); err != nil {
+				apierror.Write(w, http.StatusBadRequest, "invalid_value", err.Error())
+				return
+			}
+		}
+		for name, fields := range requestData.Metadata {
+			cleaned := DocumentMetadata{}
+			for field, values := range fields {
+				for _, value := range values {
+					if value = strings.TrimSpace(value); value != "" {
+						cleaned[field] = append(cleaned[field], value)
+					}
+				}
+			}
+			if len(cleaned) == 0 {
+				delete(state.Metadata, name)
+			} else {
+				state.Metadata[name] = cleaned
+			}
+		}
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state.Metadata)
+}
+
+// values of a metadata field of the document (caller holds the lock)
+func metadataValues(name, field string) []string {
+	if field == "label" {
+		if label, ok := state.Labels[name]; ok {
+			return []string{label}
+		}
+	}
+	if field == "language" {
+		if i := documentIndex(name); i >= 0 && state.Documents[i].Language != "" {
+			return []string{state.Documents[i].Language}
+		}
+	}
+	if field == "entity" {
+		if i := documentIndex(name); i >= 0 {
+			return entityValues(state.Documents[i])
+		}
+	}
+	return state.Metadata[name][field]
+}
+
+// field:word and field:"some words" in a query, e.g. from:alice subject:exam
+var fieldFilterPattern = regexp.MustCompile(`(?i)\b([a-z][a-z0-9_]*):(?:"([^"]*)"|([^\s"]+))`)
+
+// lowercased words of a metadata value or field filter
+func fieldWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+}
+
+// splits the filters on stored metadata fields off a query, as
+// parseEntityFilters does for entities; a colon after any other word is left in
+// the query (caller holds the lock)
+func parseFieldFilters(query string) (string, map[string][]string) {
+	if !strings.Contains(query, ":") {
+		return query, nil
+	}
+	stored := map[string]bool{}
+	for _, fields := range state.Metadata {
+		for field := range fields {
+			stored[strings.ToLower(field)] = true
+		}
+	}
+
+	filters := map[string][]string{}
+	var words []string
+	rest := fieldFilterPattern.ReplaceAllStringFunc(query, func(m string) string {
+		parts := fieldFilterPattern.FindStringSubmatch(m)
+		field := strings.ToLower(parts[1])
+		if !stored[field] {
+			return m
+		}
+		value := strings.Join(fieldWords(parts[2]+parts[3]), " ")
+		filters[field] = append(filters[field], value)
+		words = append(words, value)
+		return " "
+	})
+	if len(filters) == 0 {
+		return query, nil
+	}
+	if rest = strings.TrimSpace(rest); rest == "" {
+		rest = strings.Join(words, " ")
+	}
+	return rest, filters
+}
+
+// reports whether, for every filtered field, a value of the document holds the
+// words of each filter in order (caller holds the lock)
+func matchesFieldFilters(name string, filters map[string][]string) bool {
+	for field, wanted := range filters {
+		values := metadataValues(name, field)
+		for _, filter := range wanted {
+			found := false
+			for _, value := range values {
+				if strings.Contains(" "+strings.Join(fieldWords(value), " ")+" ", " "+filter+" ") {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parses "field:value" facet filters of a GET search into fields and their values
+func parseFacetFilters(filters []string) map[string][]string {
+	parsed := map[string][]string{}
+	for _, filter := range filters {
+		if field, value, ok := strings.Cut(filter, ":"); ok {
+			parsed[field] = append(parsed[field], value)
+		}
+	}
+	return parsed
+}
+
+// reports whether the document has, for every filtered field, one of its values
+// (caller holds the lock)
+func matchesFacetFilters(name string, filters map[string][]string) bool {
+	for field, wanted := range filters {
+		found := false
+		for _, value := range metadataValues(name, field) {
+			if contains(wanted, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// counts the values of each requested field over the results (caller holds the lock)
+func facetCounts(results []SearchResult, fields []string) map[string]map[string]int {
+	facets := make(map[string]map[string]int, len(fields))
+	for _, field := range fields {
+		counts := map[string]int{}
+		for _, result := range results {
+			seen := map[string]bool{}
+			for _, value := range metadataValues(result.FileName, field) {
+				if !seen[value] {
+					seen[value] = true
+					counts[value]++
+				}
+			}
+		}
+		facets[field] = counts
+	}
+	return facets
+}
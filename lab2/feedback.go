@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"ir/internal/apierror"
+)
+
+// Rocchio weights from Manning et al., Introduction to Information Retrieval
+const (
+	defaultRocchioAlpha = 1.0
+	defaultRocchioBeta  = 0.75
+	defaultRocchioGamma = 0.15
+
+	feedbackQueryTerms = 20
+)
+
+type FeedbackResponse struct {
+	Results       []SearchResult `json:"results"`
+	QueryVector   []TermWeight   `json:"queryVector"`   // heaviest terms of the modified query
+	ExpandedTerms []TermWeight   `json:"expandedTerms"` // terms added by the feedback
+}
+
+// TF-IDF vector of a query in the space of the cached document vectors
+func queryVector(query string, cache *vectorCache) SparseVector {
+	return tfidfVector(newTermsDocument("query", strings.Fields(strings.ToLower(query))), cache.idf)
+}
+
+// adds weight * the centroid of the named documents to the vector
+func addCentroid(vector SparseVector, names []string, weight float64, cache *vectorCache) {
+	if len(names) == 0 || weight == 0 {
+		return
+	}
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+	scale := weight / float64(len(wanted))
+	for i, doc := range state.Documents {
+		if !wanted[doc.Name] {
+			continue
+		}
+		for t, w := range cache.vectors[i] {
+			vector[t] += scale * w
+		}
+	}
+}
+
+// q' = alpha*q + beta*centroid(relevant) - gamma*centroid(non-relevant), negative weights dropped
+func rocchio(query string, relevant, nonRelevant []string, alpha, beta, gamma float64) (SparseVector, SparseVector) {
+	cache := documentVectors()
+	original := queryVector(query, cache)
+
+	modified := make(SparseVector, len(original))
+	for t, w := range original {
+		modified[t] = alpha * w
+	}
+	addCentroid(modified, relevant, beta, cache)
+	addCentroid(modified, nonRelevant, -gamma, cache)
+	for t, w := range modified {
+		if w <= 0 {
+			delete(modified, t)
+		}
+	}
+	return original, modified
+}
+
+// ranks all documents by cosine similarity to the vector (caller holds the lock)
+func rankByVector(vector SparseVector) []SearchResult {
+	cache := documentVectors()
+	norm := vector.norm()
+	results := make([]SearchResult, 0)
+	for i, doc := range state.Documents {
+		if score := sparseCosine(vector, norm, cache.vectors[i], cache.norms[i]); score > 0.0 {
+			results = append(results, SearchResult{FileName: doc.Name, Score: score})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results
+}
+
+// terms of the modified query that the original did not contain
+func expansionTerms(original, modified SparseVector) SparseVector {
+	added := SparseVector{}
+	for t, w := range modified {
+		if _, ok := original[t]; !ok {
+			added[t] = w
+		}
+	}
+	return added
+}
+
+type FeedbackRequest struct {
+	Query       string   `json:"query"`
+	Relevant    []string `json:"relevant"`
+	NonRelevant []string `json:"nonRelevant"`
+	Alpha       float64  `json:"alpha" minimum:"0"`
+	Beta        float64  `json:"beta" minimum:"0"`
+	Gamma       float64  `json:"gamma" minimum:"0"`
+}
+
+// POST /api/feedback {"query": "...", "relevant": [...], "nonRelevant": [...], "alpha": 1, "beta": 0.75, "gamma": 0.15}
+func feedbackHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	requestData := FeedbackRequest{Alpha: defaultRocchioAlpha, Beta: defaultRocchioBeta, Gamma: defaultRocchioGamma}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		apierror.InvalidJSON(w)
+		return
+	}
+	if requestData.Alpha < 0 || requestData.Beta < 0 || requestData.Gamma < 0 {
+		apierror.Error(w, "Error: alpha, beta and gamma must not be negative.", http.StatusBadRequest)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	if len(state.Documents) == 0 {
+		apierror.Write(w, http.StatusBadRequest, "no_documents", "No documents uploaded. Please add documents first.")
+		return
+	}
+	known := make(map[string]bool, len(state.Documents))
+	for _, doc := range state.Documents {
+		known[doc.Name] = true
+	}
+	for _, name := range append(append([]string{}, requestData.Relevant...), requestData.NonRelevant...) {
+		if !known[name] {
+			apierror.Error(w, fmt.Sprintf("Error: Document '%s' not found.", name), http.StatusNotFound)
+			return
+		}
+	}
+
+	original, modified := rocchio(requestData.Query, requestData.Relevant, requestData.NonRelevant,
+		requestData.Alpha, requestData.Beta, requestData.Gamma)
+
+	response := FeedbackResponse{
+		Results:       rankByVector(modified),
+		QueryVector:   topWeights(modified, feedbackQueryTerms),
+		ExpandedTerms: topWeights(expansionTerms(original, modified), feedbackQueryTerms),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// PseudoRelevanceFeedback configures blind feedback: the top documents are assumed relevant
+type PseudoRelevanceFeedback struct {
+	Documents int `json:"documents"` // k top-ranked documents to mine, default 3
+	Terms     int `json:"terms"`     // m expansion terms, default 5
+}
+
+type QueryExpansion struct {
+	Terms         []TermWeight   `json:"terms"`
+	ExpandedQuery string         `json:"expandedQuery"`
+	Results       []SearchResult `json:"results"`
+}
+
+// expands the query with the m highest TF-IDF terms of its top k results and
+// searches again (caller holds the lock)
+func expandQuery(query string, initial []SearchResult, prf PseudoRelevanceFeedback) QueryExpansion {
+	if prf.Documents <= 0 {
+		prf.Documents = 3
+	}
+	if prf.Terms <= 0 {
+		prf.Terms = 5
+	}
+
+	top := make([]string, 0, prf.Documents)
+	for _, result := range initial[:min(prf.Documents, len(initial))] {
+		top = append(top, result.FileName)
+	}
+
+	cache := documentVectors()
+	centroid := SparseVector{}
+	addCentroid(centroid, top, 1.0, cache)
+
+	terms := topWeights(expansionTerms(queryVector(query, cache), centroid), prf.Terms)
+	expanded := strings.Fields(strings.ToLower(query))
+	for _, t := range terms {
+		expanded = append(expanded, t.Term)
+	}
+
+	expansion := QueryExpansion{
+		Terms:         terms,
+		ExpandedQuery: strings.Join(expanded, " "),
+	}
+	expansion.Results = search(expansion.ExpandedQuery)
+	return expansion
+}
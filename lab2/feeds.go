@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"ir/internal/apierror"
+)
+
+const (
+	defaultFeedInterval = 60 // minutes
+	maxFeedItems        = 200
+	// items with less text are completed from their linked page when requested
+	minItemText = 200
+)
+
+var feedDateLayouts = []string{time.RFC1123Z, time.RFC1123, time.RFC3339, "Mon, 2 Jan 2006 15:04:05 -0700", "2 Jan 2006 15:04:05 -0700"}
+
+type FeedRequest struct {
+	URL             string `json:"url" maxLength:"2000"`
+	IntervalMinutes int    `json:"intervalMinutes" minimum:"0" maximum:"10080"` // between refreshes, 60 when 0
+	FetchArticles   bool   `json:"fetchArticles"`                               // fetch the linked page of items with little text
+}
+
+// FeedStatus reports a registered feed and its last refresh
+type FeedStatus struct {
+	ID              string    `json:"id"`
+	URL             string    `json:"url"`
+	Title           string    `json:"title"`
+	IntervalMinutes int       `json:"intervalMinutes"`
+	FetchArticles   bool      `json:"fetchArticles"`
+	LastFetched     time.Time `json:"lastFetched,omitzero"`
+	NextFetch       time.Time `json:"nextFetch,omitzero"`
+	LastError       string    `json:"lastError,omitempty"`
+	Items           int       `json:"items"`     // indexed from the feed
+	LastAdded       int       `json:"lastAdded"` // by the last refresh
+	Skipped         int       `json:"skipped"`   // items that could not be indexed
+}
+
+// a registered feed, refreshed by its own goroutine until it is removed
+type feed struct {
+	FeedStatus
+	seen    map[string]bool // document names of the items indexed or skipped
+	refresh chan struct{}
+	cancel  context.CancelFunc
+}
+
+// a feed item reduced to what is indexed
+type feedItem struct {
+	id, title, link, text string
+	published             time.Time
+}
+
+type rssDocument struct {
+	Channel struct {
+		Title string    `xml:"title"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Description string `xml:"description"`
+	Content     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+}
+
+type atomFeed struct {
+	Title   string      `xml:"title"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+type atomEntry struct {
+	Title     string   `xml:"title"`
+	ID        string   `xml:"id"`
+	Published string   `xml:"published"`
+	Updated   string   `xml:"updated"`
+	Summary   atomText `xml:"summary"`
+	Content   atomText `xml:"content"`
+	Links     []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+}
+
+// the text of an Atom text construct, whose markup is escaped for "html" and
+// inline for "xhtml"
+func (t atomText) plain() string {
+	if t.Type == "xhtml" {
+		_, text := htmlToText(t.Inner)
+		return text
+	}
+	_, text := htmlToText(t.Text)
+	return text
+}
+
+func parseFeedDate(value string) time.Time {
+	for _, layout := range feedDateLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// parses an RSS 2.0 or Atom feed into its title and items
+func parseFeed(data []byte) (string, []feedItem, error) {
+	var root struct {
+		XMLName xml.Name
+	}
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return "", nil, fmt.Errorf("not an XML feed: %v", err)
+	}
+
+	var items []feedItem
+	switch root.XMLName.Local {
+	case "rss":
+		var doc rssDocument
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return "", nil, err
+		}
+		for _, item := range doc.Channel.Items {
+			body := item.Content
+			if body == "" {
+				body = item.Description
+			}
+			_, text := htmlToText(body)
+			id := item.GUID
+			if id == "" {
+				id = item.Link + item.Title
+			}
+			items = append(items, feedItem{id: id, title: strings.TrimSpace(item.Title), link: strings.TrimSpace(item.Link), text: text, published: parseFeedDate(item.PubDate)})
+		}
+		return strings.TrimSpace(doc.Channel.Title), items, nil
+	case "feed":
+		var doc atomFeed
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return "", nil, err
+		}
+		for _, entry := range doc.Entries {
+			text := entry.Content.plain()
+			if text == "" {
+				text = entry.Summary.plain()
+			}
+			item := feedItem{id: entry.ID, title: strings.TrimSpace(entry.Title), text: text, published: parseFeedDate(entry.Published)}
+			if item.published.IsZero() {
+				item.published = parseFeedDate(entry.Updated)
+			}
+			for _, link := range entry.Links {
+				if link.Rel == "" || link.Rel == "alternate" {
+					item.link = link.Href
+					break
+				}
+			}
+			if item.id == "" {
+				item.id = item.link + item.title
+			}
+			items = append(items, item)
+		}
+		return strings.TrimSpace(doc.Title), items, nil
+	}
+	return "", nil, fmt.Errorf("<%s> is neither an RSS nor an Atom feed", root.XMLName.Local)
+}
+
+// lowercased ASCII letters and digits of the text joined by dashes, at most
+// n bytes long; fallback when nothing is left
+func slugify(text string, n int, fallback string) string {
+	var slug strings.Builder
+	dash := false
+	for _, c := range asciiLower(text) {
+		if 'a' <= c && c <= 'z' || '0' <= c && c <= '9' {
+			slug.WriteRune(c)
+			dash = false
+		} else if !dash && slug.Len() > 0 {
+			slug.WriteByte('-')
+			dash = true
+		}
+		if slug.Len() >= n {
+			break
+		}
+	}
+	if s := strings.TrimSuffix(slug.String(), "-"); s != "" {
+		return s
+	}
+	return fallback
+}
+
+// document name of a feed item: the feed's ID as folder, a slug of the title
+// and a hash of the item ID, stable across refreshes
+func feedItemName(feedID string, item feedItem) string {
+	sum := sha256.Sum256([]byte(item.id))
+	return feedID + "/" + slugify(item.title, 40, "item") + "-" + hex.EncodeToString(sum[:4]) + ".txt"
+}
+
+func feedID(feedURL string) string {
+	sum := sha256.Sum256([]byte(feedURL))
+	return "feed-" + hex.EncodeToString(sum[:6])
+}
+
+// the text of the item's linked page, "" when it cannot be fetched
+func fetchArticle(ctx context.Context, link string, config FetcherConfig) string {
+	resp, err := fetcher.fetch(ctx, link, config)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		return ""
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ""
+	}
+	_, text := htmlToText(string(body))
+	return text
+}
+
+// fetches the feed and indexes its new items; the fetching and analysis run
+// without the lock
+func (f *feed) update(ctx context.Context) {
+	state.Lock()
+	fetchConfig, analysis := state.Fetcher, currentIndexConfig()
+	feedURL, fetchArticles := f.URL, f.FetchArticles
+	state.Unlock()
+
+	title, items, err := func() (string, []feedItem, error) {
+		resp, err := fetcher.fetch(ctx, feedURL, fetchConfig)
+		if err != nil {
+			return "", nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", nil, fmt.Errorf("feed answered %s", resp.Status)
+		}
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return "", nil, err
+		}
+		return parseFeed(bytes.TrimSpace(data))
+	}()
+	if ctx.Err() != nil {
+		return // removed meanwhile
+	}
+
+	state.Lock()
+	var fresh []feedItem
+	var names []string
+	for _, item := range items[:min(len(items), maxFeedItems)] {
+		name := feedItemName(f.ID, item)
+		if !f.seen[name] && documentIndex(name) < 0 {
+			fresh = append(fresh, item)
+			names = append(names, name)
+		}
+	}
+	state.Unlock()
+
+	var docs []Document
+	var skipped []string
+	for i, item := range fresh {
+		if fetchArticles && len(item.text) < minItemText && item.link != "" {
+			if article := fetchArticle(ctx, item.link, fetchConfig); len(article) > len(item.text) {
+				item.text = article
+			}
+		}
+		doc, err := analyzeDocument(names[i], strings.NewReader(item.title+"\n\n"+item.text), analysis)
+		if err != nil {
+			skipped = append(skipped, names[i])
+			continue
+		}
+		if !item.published.IsZero() {
+			doc.Uploaded = item.published
+		}
+		docs = append(docs, doc)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+	f.LastFetched, f.LastError = time.Now(), ""
+	if err != nil {
+		f.LastError = err.Error()
+	}
+	if title != "" {
+		f.Title = title
+	}
+	var accepted []Document
+	for _, doc := range docs {
+		if screened, err := screenDuplicate(doc, accepted); err != nil {
+			skipped = append(skipped, doc.Name)
+		} else {
+			accepted = append(accepted, screened)
+		}
+	}
+	added, err := insertDocuments(accepted)
+	if err != nil {
+		f.LastError = "storing the items: " + err.Error()
+		events.publish(Event{Type: "feed", Data: f.FeedStatus})
+		return
+	}
+	for _, doc := range added {
+		item := fresh[indexOf(names, doc.Name)]
+		fields := DocumentMetadata{"feed": {f.URL}}
+		if item.link != "" {
+			fields["url"] = []string{item.link}
+		}
+		if !item.published.IsZero() {
+			fields["published"] = []string{item.published.UTC().Format(time.RFC3339)}
+		}
+		if checkMetadataTypes(fields) == nil {
+			state.Metadata[doc.Name] = fields
+		}
+		f.seen[doc.Name] = true
+	}
+	for _, name := range skipped {
+		f.seen[name] = true
+	}
+	f.Items += len(added)
+	f.LastAdded = len(added)
+	f.Skipped += len(skipped)
+	if len(added) > 0 {
+		fmt.Println("Feed", f.URL, "added", len(added), "items")
+	}
+	events.publish(Event{Type: "feed", Data: f.FeedStatus})
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// refreshes the feed now and after every interval until it is removed
+func (f *feed) run(ctx context.Context) {
+	for {
+		f.update(ctx)
+
+		state.Lock()
+		interval := time.Duration(f.IntervalMinutes) * time.Minute
+		f.NextFetch = time.Now().Add(interval)
+		state.Unlock()
+
+		select {
+		case <-time.After(interval):
+		case <-f.refresh:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// GET /api/feeds lists the registered feeds with their status, POST registers
+// a feed or changes its settings and refreshes it
+func feedsHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		feeds := make([]FeedStatus, 0, len(state.feeds))
+		for _, f := range state.feeds {
+			feeds = append(feeds, f.FeedStatus)
+		}
+		sort.Slice(feeds, func(i, j int) bool { return feeds[i].URL < feeds[j].URL })
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(feeds)
+	case http.MethodPost:
+		var requestData FeedRequest
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+		target, err := url.Parse(requestData.URL)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			apierror.Error(w, "Error: 'url' must be an http(s) URL.", http.StatusBadRequest)
+			return
+		}
+		if requestData.IntervalMinutes < 0 {
+			apierror.Error(w, "Error: intervalMinutes must not be negative.", http.StatusBadRequest)
+			return
+		}
+		if requestData.IntervalMinutes == 0 {
+			requestData.IntervalMinutes = defaultFeedInterval
+		}
+
+		id := feedID(requestData.URL)
+		status := http.StatusOK
+		f, ok := state.feeds[id]
+		if !ok {
+			f = &feed{
+				FeedStatus: FeedStatus{ID: id, URL: requestData.URL},
+				seen:       map[string]bool{},
+				refresh:    make(chan struct{}, 1),
+			}
+			state.feeds[id] = f
+			status = http.StatusCreated
+		}
+		f.IntervalMinutes, f.FetchArticles = requestData.IntervalMinutes, requestData.FetchArticles
+		if ok {
+			f.requestRefresh()
+		} else {
+			ctx, cancel := context.WithCancel(context.Background())
+			f.cancel = cancel
+			go f.run(ctx)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(f.FeedStatus)
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// wakes the feed's goroutine unless a refresh is already pending
+func (f *feed) requestRefresh() {
+	select {
+	case f.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// DELETE /api/feeds/{id} stops refreshing the feed; its items stay indexed
+func deleteFeedHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	f, ok := state.feeds[r.PathValue("id")]
+	if !ok {
+		apierror.Error(w, "Error: Feed not found.", http.StatusNotFound)
+		return
+	}
+	f.cancel()
+	delete(state.feeds, f.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /api/feeds/{id}/refresh fetches the feed now instead of at its next turn
+func refreshFeedHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	f, ok := state.feeds[r.PathValue("id")]
+	if !ok {
+		apierror.Error(w, "Error: Feed not found.", http.StatusNotFound)
+		return
+	}
+	f.requestRefresh()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(f.FeedStatus)
+}
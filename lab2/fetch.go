@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"ir/internal/apierror"
+	"ir/internal/robots"
+)
+
+// how long a host's robots.txt is trusted before it is fetched again
+const robotsTTL = time.Hour
+
+// FetcherConfig sets how documents are fetched from other sites, as feeds and
+// crawls do: who the server says it is and how hard it may hit a host
+type FetcherConfig struct {
+	UserAgent     string `json:"userAgent" maxLength:"200"`
+	DelayMs       int    `json:"delayMs" minimum:"0" maximum:"60000"` // between requests to a host; a longer Crawl-delay of its robots.txt wins
+	MaxPerHost    int    `json:"maxPerHost" minimum:"1" maximum:"16"` // concurrent requests to a host
+	TimeoutMs     int    `json:"timeoutMs" minimum:"100" maximum:"120000"`
+	IgnoreRobots  bool   `json:"ignoreRobots"` // skip robots.txt, for sites of your own
+	MaxBodyMBytes int    `json:"maxBodyMBytes" minimum:"1" maximum:"100"`
+}
+
+var defaultFetcherConfig = FetcherConfig{
+	UserAgent:     "IRLabBot/1.0",
+	DelayMs:       1000,
+	MaxPerHost:    2,
+	TimeoutMs:     10000,
+	MaxBodyMBytes: 10,
+}
+
+func (c FetcherConfig) validate() error {
+	if c.UserAgent == "" {
+		return fmt.Errorf("userAgent must not be empty")
+	}
+	if c.DelayMs < 0 || c.MaxPerHost < 1 || c.TimeoutMs < 100 || c.MaxBodyMBytes < 1 {
+		return fmt.Errorf("delayMs must not be negative, maxPerHost and maxBodyMBytes must be positive, timeoutMs at least 100")
+	}
+	return nil
+}
+
+// RobotsCheck is returned by GET /api/fetcher/robots
+type RobotsCheck struct {
+	URL          string   `json:"url"`
+	UserAgent    string   `json:"userAgent"`
+	Allowed      bool     `json:"allowed"`
+	CrawlDelayMs int64    `json:"crawlDelayMs"`
+	Sitemaps     []string `json:"sitemaps"`
+}
+
+// politeness state of one host, shared by every fetch from it
+type hostState struct {
+	mu       sync.Mutex
+	robots   *robots.Rules
+	expires  time.Time
+	next     time.Time     // earliest start of the next request
+	slots    chan struct{} // one per request in flight
+	capacity int
+}
+
+// politeFetcher fetches URLs obeying robots.txt, a delay between the requests
+// to a host and a limit of concurrent ones; it has its own lock, fetches run
+// without the state lock
+type politeFetcher struct {
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+var fetcher = &politeFetcher{hosts: map[string]*hostState{}}
+
+func (f *politeFetcher) host(name string, capacity int) *hostState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	h, ok := f.hosts[name]
+	if !ok {
+		h = &hostState{}
+		f.hosts[name] = h
+	}
+	h.mu.Lock()
+	if h.capacity != capacity {
+		// requests in flight release their slot of the old channel
+		h.slots, h.capacity = make(chan struct{}, capacity), capacity
+	}
+	h.mu.Unlock()
+	return h
+}
+
+// the robots.txt rules of the host, fetched again after robotsTTL: a missing
+// file allows everything, an unreachable one disallows everything (RFC 9309)
+func (f *politeFetcher) rules(ctx context.Context, h *hostState, site *url.URL, config FetcherConfig) *robots.Rules {
+	h.mu.Lock()
+	if h.robots != nil && time.Now().Before(h.expires) {
+		defer h.mu.Unlock()
+		return h.robots
+	}
+	h.mu.Unlock()
+
+	rules := robots.DisallowAll
+	robotsURL := &url.URL{Scheme: site.Scheme, Host: site.Host, Path: "/robots.txt"}
+	resp, err := f.do(ctx, h, robotsURL.String(), config, 0)
+	if err != nil && ctx.Err() != nil {
+		return rules // cancelled, the site is asked again next time
+	}
+	if err == nil {
+		switch {
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			rules = robots.Parse(resp.Body)
+		case resp.StatusCode >= 400 && resp.StatusCode < 500:
+			rules = robots.AllowAll
+		}
+		resp.Body.Close()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.robots, h.expires = rules, time.Now().Add(robotsTTL)
+	return rules
+}
+
+// waits for a slot and the host's delay, then sends the request
+func (f *politeFetcher) do(ctx context.Context, h *hostState, rawURL string, config FetcherConfig, delay time.Duration) (*http.Response, error) {
+	h.mu.Lock()
+	slots := h.slots
+	h.mu.Unlock()
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-slots }()
+
+	h.mu.Lock()
+	start := time.Now()
+	if h.next.After(start) {
+		start = h.next
+	}
+	h.next = start.Add(max(delay, time.Duration(config.DelayMs)*time.Millisecond))
+	h.mu.Unlock()
+	select {
+	case <-time.After(time.Until(start)):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", config.UserAgent)
+	client := &http.Client{Timeout: time.Duration(config.TimeoutMs) * time.Millisecond}
+	return client.Do(req)
+}
+
+// fetch GETs the URL politely; the body is limited to the configured size and
+// must be closed by the caller
+func (f *politeFetcher) fetch(ctx context.Context, rawURL string, config FetcherConfig) (*http.Response, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("'%s' is not an http(s) URL", rawURL)
+	}
+	h := f.host(target.Host, config.MaxPerHost)
+
+	var delay time.Duration
+	if !config.IgnoreRobots {
+		rules := f.rules(ctx, h, target, config)
+		if !rules.Allowed(config.UserAgent, target.RequestURI()) {
+			return nil, fmt.Errorf("robots.txt of %s disallows %s", target.Host, target.RequestURI())
+		}
+		delay = rules.CrawlDelay(config.UserAgent)
+	}
+	resp, err := f.do(ctx, h, rawURL, config, delay)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = http.MaxBytesReader(nil, resp.Body, int64(config.MaxBodyMBytes)<<20)
+	return resp, nil
+}
+
+// GET /api/fetcher returns the fetch settings, POST changes them
+func fetcherConfigHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		config := state.Fetcher
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+		if err := config.validate(); err != nil {
+			apierror.Error(w, "Error: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		state.Fetcher = config
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state.Fetcher)
+}
+
+// GET /api/fetcher/robots?url=https://example.com/page tells whether the
+// fetcher may get the URL under the host's robots.txt
+func robotsCheckHandler(w http.ResponseWriter, r *http.Request) {
+	rawURL := r.URL.Query().Get("url")
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		apierror.Error(w, "Error: 'url' must be an http(s) URL.", http.StatusBadRequest)
+		return
+	}
+
+	state.Lock()
+	config := state.Fetcher
+	state.Unlock()
+
+	h := fetcher.host(target.Host, config.MaxPerHost)
+	rules := fetcher.rules(r.Context(), h, target, config)
+	check := RobotsCheck{
+		URL:          rawURL,
+		UserAgent:    config.UserAgent,
+		Allowed:      rules.Allowed(config.UserAgent, target.RequestURI()),
+		CrawlDelayMs: rules.CrawlDelay(config.UserAgent).Milliseconds(),
+		Sitemaps:     append([]string{}, rules.Sitemaps...),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(check)
+}
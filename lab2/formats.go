@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// media types of the result formats besides JSON
+var formatTypes = map[string]string{
+	"application/json": "json",
+	"text/csv":         "csv",
+	"application/xml":  "xml",
+	"text/xml":         "xml",
+}
+
+var formatParam = param{Name: "format", Type: "string", Enum: []string{"json", "csv", "xml"},
+	Description: "overrides the Accept header"}
+
+// table is the part of a response that CSV and XML carry: named columns and one row per item
+type table struct {
+	Root, Row string // XML element names, e.g. "results" and "result"
+	Columns   []string
+	Rows      [][]string
+}
+
+// picks "json", "csv" or "xml" from ?format= or else the Accept header, JSON
+// when nothing else is asked for
+func negotiateFormat(w http.ResponseWriter, r *http.Request) string {
+	w.Header().Add("Vary", "Accept")
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+	best, bestQ := "json", 0.0
+	for _, mediaRange := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, _ := strings.Cut(mediaRange, ";")
+		format, ok := formatTypes[strings.ToLower(strings.TrimSpace(mediaType))]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			if value, found := strings.CutPrefix(strings.TrimSpace(p), "q="); found {
+				q, _ = strconv.ParseFloat(value, 64)
+			}
+		}
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	return best
+}
+
+// writes the table as CSV with a header row, or as XML with one element per cell
+func writeTable(w http.ResponseWriter, format string, t table) {
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		writer := csv.NewWriter(w)
+		writer.Write(t.Columns)
+		writer.WriteAll(t.Rows)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	root := xml.StartElement{Name: xml.Name{Local: t.Root}}
+	encoder.EncodeToken(root)
+	for _, row := range t.Rows {
+		item := xml.StartElement{Name: xml.Name{Local: t.Row}}
+		encoder.EncodeToken(item)
+		for i, value := range row {
+			encoder.EncodeElement(value, xml.StartElement{Name: xml.Name{Local: t.Columns[i]}})
+		}
+		encoder.EncodeToken(item.End())
+	}
+	encoder.EncodeToken(root.End())
+	encoder.Flush()
+	w.Write([]byte("\n"))
+}
+
+func resultsTable(results []SearchResult) table {
+	t := table{Root: "results", Row: "result", Columns: []string{"rank", "fileName", "score"}}
+	for i, result := range results {
+		t.Rows = append(t.Rows, []string{
+			strconv.Itoa(i + 1), result.FileName, strconv.FormatFloat(result.Score, 'f', -1, 64),
+		})
+	}
+	return t
+}
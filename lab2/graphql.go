@@ -0,0 +1,460 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"ir/internal/apierror"
+)
+
+// Supported GraphQL subset: one query operation with variables, aliases, arguments
+// and nested selections. Fragments, directives and mutations are rejected.
+
+type gqlField struct {
+	Alias      string
+	Name       string
+	Args       map[string]interface{}
+	Selections []*gqlField
+}
+
+// key of the field in the response
+func (f *gqlField) key() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// sub-field by name, nil when not selected
+func (f *gqlField) selected(name string) *gqlField {
+	for _, s := range f.Selections {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+type gqlToken struct {
+	kind  string // "name", "string", "number", "variable", "punct", "eof"
+	value string
+	pos   int
+}
+
+func tokenizeGraphQL(source string) ([]gqlToken, error) {
+	var tokens []gqlToken
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r) || r == ',':
+			i++
+		case r == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case strings.ContainsRune("{}():[]!=", r):
+			tokens = append(tokens, gqlToken{kind: "punct", value: string(r), pos: i})
+			i++
+		case r == '.' || r == '@':
+			return nil, fmt.Errorf("fragments and directives are not supported (position %d)", i+1)
+		case r == '$':
+			start := i
+			i++
+			for i < len(runes) && isNameRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, gqlToken{kind: "variable", value: string(runes[start+1 : i]), pos: start})
+		case r == '"':
+			start := i
+			var value strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+					switch runes[i] {
+					case 'n':
+						value.WriteRune('\n')
+					case 't':
+						value.WriteRune('\t')
+					default:
+						value.WriteRune(runes[i])
+					}
+					continue
+				}
+				value.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", start+1)
+			}
+			i++
+			tokens = append(tokens, gqlToken{kind: "string", value: value.String(), pos: start})
+		case r == '-' || unicode.IsDigit(r):
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || strings.ContainsRune(".eE+-", runes[i])) {
+				i++
+			}
+			tokens = append(tokens, gqlToken{kind: "number", value: string(runes[start:i]), pos: start})
+		case isNameRune(r):
+			start := i
+			for i < len(runes) && isNameRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, gqlToken{kind: "name", value: string(runes[start:i]), pos: start})
+		default:
+			return nil, fmt.Errorf("unexpected character '%c' at position %d", r, i+1)
+		}
+	}
+	return append(tokens, gqlToken{kind: "eof", pos: len(runes)}), nil
+}
+
+func isNameRune(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+type gqlParser struct {
+	tokens    []gqlToken
+	pos       int
+	variables map[string]interface{}
+}
+
+func (p *gqlParser) peek() gqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *gqlParser) next() gqlToken {
+	token := p.tokens[p.pos]
+	if token.kind != "eof" {
+		p.pos++
+	}
+	return token
+}
+
+func (p *gqlParser) expect(value string) error {
+	if token := p.next(); token.value != value || (token.kind != "punct" && token.kind != "name") {
+		return fmt.Errorf("expected '%s' at position %d", value, token.pos+1)
+	}
+	return nil
+}
+
+// parses the document into the root selections of its query operation
+func parseGraphQL(source string, variables map[string]interface{}) ([]*gqlField, error) {
+	tokens, err := tokenizeGraphQL(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &gqlParser{tokens: tokens, variables: variables}
+
+	if token := p.peek(); token.kind == "name" {
+		if token.value != "query" {
+			return nil, fmt.Errorf("only query operations are supported")
+		}
+		p.next()
+		if p.peek().kind == "name" {
+			p.next() // operation name
+		}
+		if p.peek().value == "(" {
+			if err := p.skipVariableDefinitions(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	selections, err := p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+	if token := p.peek(); token.kind != "eof" {
+		return nil, fmt.Errorf("unexpected '%s' at position %d", token.value, token.pos+1)
+	}
+	return selections, nil
+}
+
+// variable types are not checked, only the values passed in "variables" are used
+func (p *gqlParser) skipVariableDefinitions() error {
+	p.next()
+	for p.peek().value != ")" {
+		if p.peek().kind == "eof" {
+			return fmt.Errorf("missing ')' after variable definitions")
+		}
+		p.next()
+	}
+	p.next()
+	return nil
+}
+
+func (p *gqlParser) parseSelectionSet() ([]*gqlField, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var selections []*gqlField
+	for p.peek().value != "}" {
+		field, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, field)
+	}
+	p.next()
+	if len(selections) == 0 {
+		return nil, fmt.Errorf("empty selection set")
+	}
+	return selections, nil
+}
+
+func (p *gqlParser) parseField() (*gqlField, error) {
+	token := p.next()
+	if token.kind != "name" {
+		return nil, fmt.Errorf("expected field name at position %d", token.pos+1)
+	}
+	field := &gqlField{Name: token.value, Args: map[string]interface{}{}}
+
+	if p.peek().value == ":" && p.peek().kind == "punct" {
+		p.next()
+		name := p.next()
+		if name.kind != "name" {
+			return nil, fmt.Errorf("expected field name after alias at position %d", name.pos+1)
+		}
+		field.Alias, field.Name = field.Name, name.value
+	}
+
+	if p.peek().value == "(" && p.peek().kind == "punct" {
+		p.next()
+		for p.peek().value != ")" {
+			name := p.next()
+			if name.kind != "name" {
+				return nil, fmt.Errorf("expected argument name at position %d", name.pos+1)
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			field.Args[name.value] = value
+		}
+		p.next()
+	}
+
+	if p.peek().value == "{" && p.peek().kind == "punct" {
+		selections, err := p.parseSelectionSet()
+		if err != nil {
+			return nil, err
+		}
+		field.Selections = selections
+	}
+	return field, nil
+}
+
+func (p *gqlParser) parseValue() (interface{}, error) {
+	token := p.next()
+	switch token.kind {
+	case "string":
+		return token.value, nil
+	case "number":
+		if n, err := strconv.Atoi(token.value); err == nil {
+			return n, nil
+		}
+		f, err := strconv.ParseFloat(token.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s' at position %d", token.value, token.pos+1)
+		}
+		return f, nil
+	case "variable":
+		return p.variables[token.value], nil
+	case "name":
+		switch token.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return token.value, nil // enum value
+	}
+	if token.value == "[" {
+		list := []interface{}{}
+		for p.peek().value != "]" {
+			if p.peek().kind == "eof" {
+				return nil, fmt.Errorf("unterminated list")
+			}
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		p.next()
+		return list, nil
+	}
+	return nil, fmt.Errorf("unexpected '%s' at position %d", token.value, token.pos+1)
+}
+
+// string argument, also accepting variables
+func stringArg(field *gqlField, name string) (string, bool) {
+	value, ok := field.Args[name].(string)
+	return value, ok
+}
+
+// integer argument; JSON variables arrive as float64
+func intArg(field *gqlField, name string, fallback int) int {
+	switch value := field.Args[name].(type) {
+	case int:
+		return value
+	case float64:
+		return int(value)
+	}
+	return fallback
+}
+
+// reduces a resolved value to the selected fields; the value is first turned into
+// its JSON form so the field names match the REST API
+func projectSelection(value interface{}, field *gqlField) (interface{}, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return nil, err
+	}
+	return project(generic, field)
+}
+
+func project(value interface{}, field *gqlField) (interface{}, error) {
+	switch typed := value.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		items := make([]interface{}, len(typed))
+		for i, item := range typed {
+			projected, err := project(item, field)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = projected
+		}
+		return items, nil
+	case map[string]interface{}:
+		if len(field.Selections) == 0 {
+			return nil, fmt.Errorf("field '%s' of object type must have a selection of subfields", field.Name)
+		}
+		result := &gqlObject{values: make(map[string]interface{}, len(field.Selections))}
+		for _, sub := range field.Selections {
+			// fields omitted from the JSON form (omitempty) resolve to null
+			projected, err := project(typed[sub.Name], sub)
+			if err != nil {
+				return nil, err
+			}
+			result.set(sub.key(), projected)
+		}
+		return result, nil
+	default:
+		if len(field.Selections) > 0 {
+			return nil, fmt.Errorf("field '%s' is a scalar and cannot have subfields", field.Name)
+		}
+		return value, nil
+	}
+}
+
+// response object that keeps the fields in selection order
+type gqlObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (o *gqlObject) set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *gqlObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		value, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type gqlError struct {
+	Message string   `json:"message"`
+	Path    []string `json:"path,omitempty"`
+}
+
+type GraphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// POST /graphql {"query": "...", "variables": {...}}
+func graphQLHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData GraphQLRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		apierror.InvalidJSON(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	selections, err := parseGraphQL(requestData.Query, requestData.Variables)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": []gqlError{{Message: "Syntax error: " + err.Error()}},
+		})
+		return
+	}
+
+	// the searches rank over one view of the collection first, the document is
+	// then resolved under the lock
+	rankings := rankSearchFields(selections)
+	state.Lock()
+	defer state.Unlock()
+
+	data := &gqlObject{values: make(map[string]interface{}, len(selections))}
+	errs := []gqlError{}
+	for _, field := range selections {
+		value, err := resolveQueryField(field, rankings)
+		if err == nil {
+			value, err = projectSelection(value, field)
+		}
+		if err != nil {
+			errs = append(errs, gqlError{Message: err.Error(), Path: []string{field.key()}})
+			value = nil
+		}
+		data.set(field.key(), value)
+	}
+
+	response := map[string]interface{}{"data": data}
+	if len(errs) > 0 {
+		response["errors"] = errs
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"ir/internal/grpcwire"
+)
+
+// gRPC services of proto/ir.proto, sharing the state of the HTTP handlers
+func newGRPCServer() *grpcwire.Server {
+	server := grpcwire.NewServer()
+	server.Handle("ir.v1.IndexService/UploadDocument", grpcUploadDocument)
+	server.Handle("ir.v1.IndexService/DeleteDocument", grpcwire.Unary(grpcDeleteDocument))
+	server.Handle("ir.v1.IndexService/GetStats", grpcwire.Unary(grpcGetStats))
+	server.Handle("ir.v1.SearchService/Search", grpcwire.Unary(grpcSearch))
+	return server
+}
+
+// streams the chunks into the analyzer, so large documents are never held in one
+// message; documents over the upload file limit are refused
+func grpcUploadDocument(stream *grpcwire.Stream) error {
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return grpcwire.Errorf(grpcwire.InvalidArgument, "no chunks sent")
+	}
+	if err != nil {
+		return err
+	}
+	name, data, err := decodeUploadChunk(first)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return grpcwire.Errorf(grpcwire.InvalidArgument, "the first chunk must carry the document name")
+	}
+
+	state.Lock()
+	config, limits := currentIndexConfig(), state.Uploads
+	exists := documentIndex(name) >= 0
+	state.Unlock()
+	if exists {
+		return grpcwire.Errorf(grpcwire.AlreadyExists, "document %s already exists", name)
+	}
+
+	pr, pw := io.Pipe()
+	file := &sizeLimiter{r: pr, n: int64(limits.MaxFileMBytes) << 20}
+	type analyzed struct {
+		doc Document
+		err error
+	}
+	done := make(chan analyzed, 1)
+	go func() {
+		doc, err := analyzeDocument(name, file, config)
+		pr.CloseWithError(err) // unblocks the writer below when the analyzer stops early
+		done <- analyzed{doc, err}
+	}()
+
+	var streamErr error
+	for {
+		if _, err := pw.Write(data); err != nil {
+			break // the analyzer stopped, its error is reported
+		}
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			streamErr = err
+			break
+		}
+		if _, data, streamErr = decodeUploadChunk(msg); streamErr != nil {
+			break
+		}
+	}
+	pw.CloseWithError(streamErr)
+	result := <-done
+	if streamErr != nil {
+		return streamErr
+	}
+	if file.exceeded {
+		return grpcwire.Errorf(grpcwire.ResourceExhausted, "document %s is larger than %d MB", name, limits.MaxFileMBytes)
+	}
+	if result.err != nil {
+		return grpcwire.Errorf(grpcwire.InvalidArgument, "%v", result.err)
+	}
+
+	state.Lock()
+	defer state.Unlock()
+	doc, err := screenDuplicate(result.doc, nil)
+	if err != nil {
+		return grpcwire.Errorf(grpcwire.AlreadyExists, "%v", err)
+	}
+	added, err := insertDocument(doc)
+	if err != nil {
+		return grpcwire.Errorf(grpcwire.Internal, "could not store the document: %v", err)
+	}
+	if !added {
+		return grpcwire.Errorf(grpcwire.AlreadyExists, "document %s already exists", name)
+	}
+	doc = state.Documents[len(state.Documents)-1]
+	fmt.Println("Document uploaded over gRPC:", name)
+
+	var resp grpcwire.Encoder
+	resp.String(1, name)
+	resp.Int(2, int64(doc.Length))
+	resp.String(3, documentETag(doc))
+	return stream.Send(resp.Bytes())
+}
+
+func decodeUploadChunk(msg []byte) (name string, data []byte, err error) {
+	err = grpcwire.Decode(msg, func(f grpcwire.Field) error {
+		switch f.Number {
+		case 1:
+			name = f.String()
+		case 2:
+			data = f.Data
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, grpcwire.Errorf(grpcwire.InvalidArgument, "%v", err)
+	}
+	return name, data, nil
+}
+
+func grpcDeleteDocument(_ context.Context, req []byte) ([]byte, error) {
+	var name, etag string
+	err := grpcwire.Decode(req, func(f grpcwire.Field) error {
+		switch f.Number {
+		case 1:
+			name = f.String()
+		case 2:
+			etag = f.String()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, grpcwire.Errorf(grpcwire.InvalidArgument, "%v", err)
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	i := documentIndex(name)
+	if i < 0 {
+		return nil, grpcwire.Errorf(grpcwire.NotFound, "document not found")
+	}
+	if etag == "" {
+		return nil, grpcwire.Errorf(grpcwire.FailedPrecondition, "etag is required to delete a document")
+	}
+	if current := documentETag(state.Documents[i]); !etagMatches(etag, current) {
+		return nil, grpcwire.Errorf(grpcwire.FailedPrecondition, "document was modified, current etag is %s", current)
+	}
+	if err := state.store.Delete(name); err != nil {
+		return nil, grpcwire.Errorf(grpcwire.Internal, "could not delete the document from the store: %v", err)
+	}
+	deleteDocument(i)
+
+	var resp grpcwire.Encoder
+	resp.String(1, name)
+	resp.Int(2, int64(len(state.Documents)))
+	return resp.Bytes(), nil
+}
+
+func grpcGetStats(context.Context, []byte) ([]byte, error) {
+	state.Lock()
+	defer state.Unlock()
+
+	stats := collectionStats(0)
+	var resp grpcwire.Encoder
+	resp.Int(1, int64(stats.Documents))
+	resp.Int(2, int64(stats.Tokens))
+	resp.Int(3, int64(stats.VocabularySize))
+	resp.Double(4, stats.AverageDocumentLength)
+	resp.Int(5, int64(len(stats.Segments)))
+	resp.Int(6, int64(stats.BufferedDocuments))
+	resp.Int(7, int64(stats.DeletedDocuments))
+	return resp.Bytes(), nil
+}
+
+func grpcSearch(_ context.Context, req []byte) ([]byte, error) {
+	started := time.Now()
+	var query, ranker string
+	var boolean bool
+	var limit int64
+	err := grpcwire.Decode(req, func(f grpcwire.Field) error {
+		switch f.Number {
+		case 1:
+			query = f.String()
+		case 2:
+			ranker = f.String()
+		case 3:
+			boolean = f.Bool()
+		case 4:
+			limit = f.Int()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, grpcwire.Errorf(grpcwire.InvalidArgument, "%v", err)
+	}
+	if limit < 0 {
+		return nil, grpcwire.Errorf(grpcwire.InvalidArgument, "limit must not be negative")
+	}
+
+	results, err := rankGRPCQuery(normalizeQuery(query), ranker, boolean)
+	if err != nil {
+		return nil, err
+	}
+	if boolean {
+		ranker = "boolean"
+	}
+	state.Lock()
+	logQuery(query, ranker, started, results)
+	state.Unlock()
+
+	var resp grpcwire.Encoder
+	for i, result := range results {
+		if limit > 0 && int64(i) == limit {
+			break
+		}
+		var item grpcwire.Encoder
+		item.String(1, result.FileName)
+		item.Double(2, result.Score)
+		resp.Message(1, item.Bytes())
+	}
+	resp.Int(2, int64(len(results)))
+	return resp.Bytes(), nil
+}
+
+// matches the query as a boolean expression under the lock, or ranks it over a
+// view of the collection without the lock
+func rankGRPCQuery(query, ranker string, boolean bool) ([]SearchResult, error) {
+	state.Lock()
+	if len(state.Documents) == 0 {
+		state.Unlock()
+		return nil, grpcwire.Errorf(grpcwire.FailedPrecondition, "no documents uploaded")
+	}
+	if boolean {
+		defer state.Unlock()
+		names, _, err := booleanSearch(query)
+		if err != nil {
+			return nil, grpcwire.Errorf(grpcwire.InvalidArgument, "invalid query: %v", err)
+		}
+		var results []SearchResult
+		for _, name := range names {
+			results = append(results, SearchResult{FileName: name, Score: 1})
+		}
+		return results, nil
+	}
+	view, err := snapshotCorpus(ranker)
+	state.Unlock()
+	if err != nil {
+		return nil, grpcwire.Errorf(grpcwire.InvalidArgument, "%v", err)
+	}
+	results, err := view.rank(ranker, query, nil)
+	if err != nil {
+		return nil, grpcwire.Errorf(grpcwire.InvalidArgument, "%v", err)
+	}
+	state.Lock()
+	defer state.Unlock()
+	return liveResults(results), nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"ir/internal/apierror"
+)
+
+// DendrogramNode is a leaf (one document) or the merge of two subtrees
+type DendrogramNode struct {
+	Document   string            `json:"document,omitempty"`
+	Similarity float64           `json:"similarity"` // cosine similarity at which the children were merged, 1 for leaves
+	Size       int               `json:"size"`
+	Children   []*DendrogramNode `json:"children,omitempty"`
+}
+
+type HierarchicalClustering struct {
+	Linkage string          `json:"linkage"`
+	Tree    *DendrogramNode `json:"tree"`
+
+	// flat clusters when the tree is cut at the requested similarity
+	Cut      *float64   `json:"cut,omitempty"`
+	Clusters [][]string `json:"clusters,omitempty"`
+}
+
+// similarity between a merged cluster (a+b) and another cluster, by linkage
+func linkageSimilarity(linkage string, simA, simB float64, sizeA, sizeB int) float64 {
+	switch linkage {
+	case "single":
+		return max(simA, simB)
+	case "complete":
+		return min(simA, simB)
+	default: // "average"
+		return (float64(sizeA)*simA + float64(sizeB)*simB) / float64(sizeA+sizeB)
+	}
+}
+
+// agglomerative clustering over the TF-IDF vectors, always merging the most
+// similar pair of clusters (caller holds the lock)
+func agglomerativeClustering(linkage string) *DendrogramNode {
+	cache := documentVectors()
+	n := len(cache.vectors)
+
+	nodes := make([]*DendrogramNode, n)
+	similarity := make([][]float64, n)
+	for i := range n {
+		nodes[i] = &DendrogramNode{Document: state.Documents[i].Name, Similarity: 1.0, Size: 1}
+		similarity[i] = make([]float64, n)
+		for j := range i {
+			s := sparseCosine(cache.vectors[i], cache.norms[i], cache.vectors[j], cache.norms[j])
+			similarity[i][j], similarity[j][i] = s, s
+		}
+	}
+
+	active := make([]bool, n)
+	for i := range active {
+		active[i] = true
+	}
+
+	for remaining := n; remaining > 1; remaining-- {
+		bestA, bestB, best := -1, -1, -1.0
+		for i := range n {
+			if !active[i] {
+				continue
+			}
+			for j := i + 1; j < n; j++ {
+				if active[j] && similarity[i][j] > best {
+					bestA, bestB, best = i, j, similarity[i][j]
+				}
+			}
+		}
+
+		// the merged cluster takes the slot of a
+		for k := range n {
+			if active[k] && k != bestA && k != bestB {
+				s := linkageSimilarity(linkage, similarity[bestA][k], similarity[bestB][k], nodes[bestA].Size, nodes[bestB].Size)
+				similarity[bestA][k], similarity[k][bestA] = s, s
+			}
+		}
+		nodes[bestA] = &DendrogramNode{
+			Similarity: best,
+			Size:       nodes[bestA].Size + nodes[bestB].Size,
+			Children:   []*DendrogramNode{nodes[bestA], nodes[bestB]},
+		}
+		active[bestB] = false
+	}
+	return nodes[0]
+}
+
+// splits the tree into the subtrees that were merged at or above the similarity
+func cutDendrogram(node *DendrogramNode, cut float64) [][]string {
+	if node.Similarity >= cut || len(node.Children) == 0 {
+		return [][]string{dendrogramLeaves(node)}
+	}
+	var clusters [][]string
+	for _, child := range node.Children {
+		clusters = append(clusters, cutDendrogram(child, cut)...)
+	}
+	return clusters
+}
+
+func dendrogramLeaves(node *DendrogramNode) []string {
+	if len(node.Children) == 0 {
+		return []string{node.Document}
+	}
+	var leaves []string
+	for _, child := range node.Children {
+		leaves = append(leaves, dendrogramLeaves(child)...)
+	}
+	return leaves
+}
+
+type HierarchicalClusterRequest struct {
+	Linkage string   `json:"linkage" enum:"|single|complete|average"` // "average" by default
+	Cut     *float64 `json:"cut"`
+}
+
+// POST /api/cluster/hierarchical {"linkage": "average", "cut": 0.2}
+func hierarchicalClusterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData HierarchicalClusterRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		apierror.InvalidJSON(w)
+		return
+	}
+	if requestData.Linkage == "" {
+		requestData.Linkage = "average"
+	}
+	if requestData.Linkage != "single" && requestData.Linkage != "complete" && requestData.Linkage != "average" {
+		apierror.Error(w, "Error: linkage must be 'single', 'complete' or 'average'.", http.StatusBadRequest)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	if len(state.Documents) == 0 {
+		apierror.Write(w, http.StatusBadRequest, "no_documents", "No documents uploaded. Please add documents first.")
+		return
+	}
+
+	result := HierarchicalClustering{
+		Linkage: requestData.Linkage,
+		Tree:    agglomerativeClustering(requestData.Linkage),
+	}
+	if requestData.Cut != nil {
+		result.Cut = requestData.Cut
+		result.Clusters = cutDendrogram(result.Tree, *requestData.Cut)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
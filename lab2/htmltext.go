@@ -0,0 +1,91 @@
+package main
+
+import (
+	"html"
+	"strings"
+)
+
+// elements whose content is no text of the page
+var skippedElements = map[string]bool{"script": true, "style": true, "noscript": true, "template": true, "svg": true}
+
+// elements that end a line of text
+var blockElements = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "ul": true, "ol": true, "tr": true, "table": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "hr": true, "pre": true,
+	"article": true, "section": true, "header": true, "footer": true, "blockquote": true, "title": true,
+}
+
+func asciiLower(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+// htmlToText reduces an HTML page or fragment to its title and plain text: tags
+// are dropped, block elements end lines, scripts, styles and comments are
+// skipped and entities decoded
+func htmlToText(page string) (string, string) {
+	lower := asciiLower(page)
+	var text strings.Builder
+	title := ""
+	for i := 0; i < len(page); {
+		open := strings.IndexByte(page[i:], '<')
+		if open < 0 {
+			text.WriteString(page[i:])
+			break
+		}
+		text.WriteString(page[i : i+open])
+		i += open
+
+		if strings.HasPrefix(page[i:], "<!--") {
+			end := strings.Index(page[i:], "-->")
+			if end < 0 {
+				break
+			}
+			i += end + len("-->")
+			continue
+		}
+		end := strings.IndexByte(page[i:], '>')
+		if end < 0 {
+			break
+		}
+		tag := lower[i+1 : i+end]
+		i += end + 1
+
+		closing := strings.HasPrefix(tag, "/")
+		name := strings.TrimPrefix(tag, "/")
+		if cut := strings.IndexAny(name, " \t\r\n/"); cut >= 0 {
+			name = name[:cut]
+		}
+		switch {
+		case !closing && (skippedElements[name] || name == "title"):
+			stop := strings.Index(lower[i:], "</"+name)
+			if stop < 0 {
+				stop = len(lower) - i
+			}
+			if name == "title" && title == "" {
+				title = strings.Join(strings.Fields(html.UnescapeString(page[i:i+stop])), " ")
+			}
+			i += stop
+			if gt := strings.IndexByte(page[i:], '>'); gt >= 0 {
+				i += gt + 1
+			}
+		case blockElements[name]:
+			text.WriteByte('\n')
+		default:
+			text.WriteByte(' ')
+		}
+	}
+
+	var lines []string
+	for _, line := range strings.Split(html.UnescapeString(text.String()), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return title, strings.Join(lines, "\n")
+}
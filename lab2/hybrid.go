@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// rank constant of reciprocal rank fusion (Cormack et al., 2009)
+const defaultRRFConstant = 60
+
+// HybridOptions configures the "hybrid" ranker
+type HybridOptions struct {
+	Lexical string  `json:"lexical"` // "bm25" (default) or "cosine"
+	Fusion  string  `json:"fusion"`  // "rrf" (default) or "weighted"
+	K       int     `json:"k"`       // RRF rank constant
+	Weight  float64 `json:"weight"`  // share of the dense ranker in the weighted combination, default 0.5
+}
+
+// RankerContribution explains how one ranker contributed to a fused score
+type RankerContribution struct {
+	Ranker       string  `json:"ranker"`
+	Rank         int     `json:"rank"` // 1-based, 0 when the ranker did not return the document
+	Score        float64 `json:"score"`
+	Contribution float64 `json:"contribution"`
+}
+
+// fuses a lexical and a dense ranking of the same view, keeping each ranker's contribution
+func (v *corpusView) hybridSearch(query string, options HybridOptions) ([]SearchResult, error) {
+	if options.Lexical == "" {
+		options.Lexical = "bm25"
+	}
+	if options.Fusion == "" {
+		options.Fusion = "rrf"
+	}
+	if options.K <= 0 {
+		options.K = defaultRRFConstant
+	}
+	if options.Weight == 0 {
+		options.Weight = 0.5
+	}
+	if options.Lexical != "bm25" && options.Lexical != "cosine" {
+		return nil, fmt.Errorf("hybrid lexical ranker must be 'bm25' or 'cosine'")
+	}
+	if options.Fusion != "rrf" && options.Fusion != "weighted" {
+		return nil, fmt.Errorf("hybrid fusion must be 'rrf' or 'weighted'")
+	}
+	if options.Weight < 0 || options.Weight > 1 {
+		return nil, fmt.Errorf("hybrid weight must be between 0 and 1")
+	}
+
+	lexical, err := v.rank(options.Lexical, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	dense, err := v.denseSearch(query)
+	if err != nil {
+		return nil, err
+	}
+
+	rankings := []struct {
+		name    string
+		results []SearchResult
+		weight  float64
+	}{
+		{options.Lexical, lexical, 1 - options.Weight},
+		{"dense", dense, options.Weight},
+	}
+
+	fused := make(map[string]*SearchResult)
+	var order []string
+	for r, ranking := range rankings {
+		// weighted fusion compares min-max normalized scores
+		top, bottom := 0.0, 0.0
+		if len(ranking.results) > 0 {
+			top, bottom = ranking.results[0].Score, ranking.results[len(ranking.results)-1].Score
+		}
+
+		for i, result := range ranking.results {
+			contribution := 1.0 / float64(options.K+i+1)
+			if options.Fusion == "weighted" {
+				normalized := 1.0
+				if top > bottom {
+					normalized = (result.Score - bottom) / (top - bottom)
+				}
+				contribution = ranking.weight * normalized
+			}
+
+			entry, ok := fused[result.FileName]
+			if !ok {
+				entry = &SearchResult{FileName: result.FileName, Contributions: make([]RankerContribution, len(rankings))}
+				for j := range rankings {
+					entry.Contributions[j].Ranker = rankings[j].name
+				}
+				fused[result.FileName] = entry
+				order = append(order, result.FileName)
+			}
+			entry.Score += contribution
+			entry.Contributions[r] = RankerContribution{Ranker: ranking.name, Rank: i + 1, Score: result.Score, Contribution: contribution}
+		}
+	}
+
+	results := make([]SearchResult, 0, len(order))
+	for _, name := range order {
+		results = append(results, *fused[name])
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results, nil
+}
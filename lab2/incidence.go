@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"ir/internal/apierror"
+)
+
+// IncidenceMatrix is the binary terms x documents matrix
+type IncidenceMatrix struct {
+	Terms     []string `json:"terms"`
+	Documents []string `json:"documents"`
+	Matrix    [][]int  `json:"matrix"` // Matrix[term][document] is 1 if the term occurs in the document
+}
+
+// builds the incidence matrix over the given terms, the whole vocabulary in
+// alphabetical order when there are none (caller holds the lock)
+func buildIncidenceMatrix(terms []string) IncidenceMatrix {
+	index := positionalIndex()
+	if len(terms) == 0 {
+		terms = make([]string, 0, len(index))
+		for term := range index {
+			terms = append(terms, term)
+		}
+		sort.Strings(terms)
+	}
+
+	matrix := IncidenceMatrix{
+		Terms:     terms,
+		Documents: documentNames(),
+		Matrix:    make([][]int, len(terms)),
+	}
+	for i, term := range terms {
+		row := make([]int, len(state.Documents))
+		for _, position := range index[term] {
+			row[position] = 1
+		}
+		matrix.Matrix[i] = row
+	}
+	return matrix
+}
+
+// the terms of a "terms" parameter, lowercased and split at whitespace or
+// commas, without duplicates in the order they were given
+func incidenceTerms(values []string) []string {
+	terms := []string{}
+	seen := make(map[string]bool)
+	for _, value := range values {
+		for _, term := range strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+			return unicode.IsSpace(r) || r == ','
+		}) {
+			if !seen[term] {
+				seen[term] = true
+				terms = append(terms, term)
+			}
+		}
+	}
+	return terms
+}
+
+// GET /api/incidence-matrix?format=json|csv&terms=a,b restricts the rows to the
+// given terms, the whole vocabulary otherwise
+func incidenceMatrixHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	format := params.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		apierror.Error(w, "Error: Unsupported format. Use json or csv.", http.StatusBadRequest)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	matrix := buildIncidenceMatrix(incidenceTerms(params["terms"]))
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="incidence-matrix.csv"`)
+
+		writer := csv.NewWriter(w)
+		writer.Write(append([]string{"term"}, matrix.Documents...))
+		for i, term := range matrix.Terms {
+			record := []string{term}
+			for _, v := range matrix.Matrix[i] {
+				record = append(record, strconv.Itoa(v))
+			}
+			writer.Write(record)
+		}
+		writer.Flush()
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(matrix)
+}
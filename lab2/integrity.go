@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"ir/internal/engine"
+)
+
+// damaged terms logged by name, the rest only counted
+const maxLoggedTerms = 20
+
+// IntegrityReport is what the startup check found in a persisted index
+type IntegrityReport struct {
+	Documents    int
+	Terms        int
+	Postings     int      // sum of document frequencies
+	DamagedTerms []string // terms whose postings disagree with the document store
+	Reindexed    bool     // the segments were rebuilt from the document store
+}
+
+// the postings the documents' term frequencies imply, by document ID
+func expectedIndex(docs []Document) engine.Index {
+	expected := engine.Index{}
+	for _, doc := range docs {
+		for term := range doc.TermFreq {
+			expected[term] = append(expected[term], doc.id)
+		}
+	}
+	for _, postings := range expected {
+		slices.Sort(postings)
+	}
+	return expected
+}
+
+// terms whose postings differ between the indexes, an empty list counting as
+// none, in alphabetical order
+func damagedTerms(index, expected engine.Index) []string {
+	var damaged []string
+	for term, postings := range index {
+		if !slices.Equal(postings, expected[term]) && (len(postings) > 0 || len(expected[term]) > 0) {
+			damaged = append(damaged, term)
+		}
+	}
+	for term, postings := range expected {
+		if _, ok := index[term]; !ok && len(postings) > 0 {
+			damaged = append(damaged, term)
+		}
+	}
+	sort.Strings(damaged)
+	return damaged
+}
+
+func logDamagedTerms(where string, damaged []string) {
+	shown := damaged[:min(len(damaged), maxLoggedTerms)]
+	more := ""
+	if len(damaged) > len(shown) {
+		more = fmt.Sprintf(" and %d more", len(damaged)-len(shown))
+	}
+	fmt.Printf("Integrity: %d postings lists in %s disagree with the document store: %s%s\n", len(damaged), where, strings.Join(shown, ", "), more)
+}
+
+// checks the postings a store persists against the term frequencies of its
+// documents and rewrites the damaged ones, so the index loaded from it is sound
+func repairStoredPostings(loader indexLoader, docs []Document) error {
+	stored, err := loader.LoadIndex()
+	if err != nil {
+		return err
+	}
+	damaged := damagedTerms(stored, expectedIndex(docs))
+	if len(damaged) == 0 {
+		return nil
+	}
+	logDamagedTerms("the store", damaged)
+	if err := loader.ReplacePostings(expectedIndex(docs), damaged); err != nil {
+		return fmt.Errorf("repairing the stored postings: %v", err)
+	}
+	fmt.Printf("Integrity: rewrote %d stored postings lists\n", len(damaged))
+	return nil
+}
+
+// checks the boolean index, segments loaded from disk included, against the
+// documents restored from the store; the segments cannot be patched in
+// place, so any damage rebuilds them from the term frequencies (caller holds the lock)
+func checkIndexIntegrity() IntegrityReport {
+	expected := expectedIndex(state.Documents)
+	index := state.segments.Decode()
+	report := IntegrityReport{Documents: len(state.Documents), DamagedTerms: damagedTerms(index, expected)}
+
+	indexed := map[int]bool{}
+	for _, postings := range index {
+		for _, docID := range postings {
+			indexed[docID] = true
+		}
+	}
+	total, stored := 0, 0
+	for _, postings := range index {
+		total += len(postings)
+	}
+	for _, postings := range expected {
+		stored += len(postings)
+	}
+	if total != stored || len(indexed) > len(state.Documents) {
+		fmt.Printf("Integrity: the index holds %d postings of %d documents, the document store implies %d of %d\n", total, len(indexed), stored, len(state.Documents))
+	}
+
+	if len(report.DamagedTerms) > 0 {
+		logDamagedTerms("the index segments", report.DamagedTerms)
+		state.boolean = newBooleanIndex(expected)
+		report.Reindexed = true
+		fmt.Printf("Integrity: rebuilt the index segments from %d documents\n", len(state.Documents))
+	}
+
+	report.Terms, report.Postings = len(expected), stored
+	if !report.Reindexed {
+		fmt.Printf("Integrity: OK (%d documents, %d terms, %d postings)\n", report.Documents, report.Terms, report.Postings)
+	}
+	return report
+}
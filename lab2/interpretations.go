@@ -0,0 +1,167 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"ir/internal/engine"
+)
+
+// QueryInterpretation is one possible reading of an ambiguous query
+type QueryInterpretation struct {
+	Query    string   `json:"query"`
+	Rewrites []string `json:"rewrites"` // e.g. "informationretrieval -> information retrieval"
+	Hits     int      `json:"hits"`
+}
+
+const (
+	maxInterpretations          = 5
+	maxGeneratedInterpretations = 32
+	maxSpellingReadings         = 2 // closest corrections read for a term missing from the vocabulary
+)
+
+// a reading of one or more query terms
+type termReading struct {
+	text    string
+	rewrite string
+	span    int // number of query terms consumed
+}
+
+// all terms of the uploaded documents
+func vocabularySet() map[string]bool {
+	vocabulary := make(map[string]bool)
+	for _, doc := range state.Documents {
+		for t := range doc.TermFreq {
+			vocabulary[t] = true
+		}
+	}
+	return vocabulary
+}
+
+// readings starting at position i: the term itself, its segmentations into
+// two vocabulary words, its closest spelling corrections, its synonyms found in
+// the collection and its join with the next term (caller holds the lock)
+func readingsAt(terms []string, i int, vocabulary map[string]int) []termReading {
+	term := terms[i]
+	readings := []termReading{{text: term, span: 1}}
+
+	if vocabulary[term] == 0 {
+		for k := 1; k < len(term); k++ {
+			left, right := term[:k], term[k:]
+			if vocabulary[left] > 0 && vocabulary[right] > 0 {
+				segmented := left + " " + right
+				readings = append(readings, termReading{text: segmented, rewrite: term + " -> " + segmented, span: 1})
+			}
+		}
+		candidates := spellingCandidates(term)
+		for _, candidate := range candidates[:min(len(candidates), maxSpellingReadings)] {
+			readings = append(readings, termReading{text: candidate.Term, rewrite: term + " -> " + candidate.Term, span: 1})
+		}
+	}
+	for _, synonym := range state.Synonyms.lookup[term] {
+		if inVocabulary(synonym, vocabulary) {
+			readings = append(readings, termReading{text: synonym, rewrite: term + " -> " + synonym, span: 1})
+		}
+	}
+
+	if i+1 < len(terms) {
+		joined := term + terms[i+1]
+		if vocabulary[joined] > 0 {
+			readings = append(readings, termReading{text: joined, rewrite: term + " " + terms[i+1] + " -> " + joined, span: 2})
+		}
+	}
+	return readings
+}
+
+// every word of a term or multi-word synonym is indexed
+func inVocabulary(text string, vocabulary map[string]int) bool {
+	words := strings.Fields(text)
+	for _, word := range words {
+		if vocabulary[word] == 0 {
+			return false
+		}
+	}
+	return len(words) > 0
+}
+
+// documents having any term of the reading, the candidates the ranked search
+// scores, counted from the postings (caller holds the lock)
+func interpretationHits(query string) int {
+	index := booleanIndexes()
+	var matched engine.Postings
+	for _, term := range strings.Fields(query) {
+		matched = engine.Union(matched, index.terms.Postings(term).Decode())
+	}
+	hits := 0
+	for _, docID := range matched {
+		if _, ok := index.positions[docID]; ok {
+			hits++
+		}
+	}
+	return hits
+}
+
+// generates the alternative readings of the query ranked by result count;
+// returns nil when the query can only be read one way (caller holds the lock)
+func queryInterpretations(query string) []QueryInterpretation {
+	terms := strings.Fields(strings.ToLower(query))
+	vocabulary := vocabularyKgrams().df
+
+	var generated []QueryInterpretation
+	seen := make(map[string]bool)
+	var expand func(i int, parts []string, rewrites []string)
+	expand = func(i int, parts []string, rewrites []string) {
+		if len(generated) >= maxGeneratedInterpretations {
+			return
+		}
+		if i == len(terms) {
+			query := strings.Join(parts, " ")
+			if seen[query] { // e.g. a correction that is also a synonym
+				return
+			}
+			seen[query] = true
+			generated = append(generated, QueryInterpretation{
+				Query:    query,
+				Rewrites: append([]string{}, rewrites...),
+			})
+			return
+		}
+		for _, reading := range readingsAt(terms, i, vocabulary) {
+			nextRewrites := rewrites
+			if reading.rewrite != "" {
+				nextRewrites = append(rewrites[:len(rewrites):len(rewrites)], reading.rewrite)
+			}
+			expand(i+reading.span, append(parts[:len(parts):len(parts)], reading.text), nextRewrites)
+		}
+	}
+	expand(0, nil, nil)
+
+	if len(generated) < 2 {
+		return nil
+	}
+
+	for i := range generated {
+		generated[i].Hits = interpretationHits(generated[i].Query)
+	}
+	sort.SliceStable(generated, func(i, j int) bool {
+		if generated[i].Hits != generated[j].Hits {
+			return generated[i].Hits > generated[j].Hits
+		}
+		return len(generated[i].Rewrites) < len(generated[j].Rewrites)
+	})
+	if len(generated) > maxInterpretations {
+		generated = generated[:maxInterpretations]
+	}
+	return generated
+}
+
+// more than one reading finds documents, so the client should pick one
+func isAmbiguous(interpretations []QueryInterpretation) bool {
+	withHits := 0
+	for _, interpretation := range interpretations {
+		if interpretation.Hits > 0 {
+			withHits++
+		}
+	}
+	return withHits > 1
+}
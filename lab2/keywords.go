@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"ir/internal/apierror"
+)
+
+const defaultKeywords = 10
+
+type DocumentKeywords struct {
+	Document string       `json:"document"`
+	Method   string       `json:"method"`
+	Keywords []TermWeight `json:"keywords"`
+}
+
+// index of the document in the store, -1 when there is none with the name
+func documentIndex(name string) int {
+	for i, doc := range state.Documents {
+		if doc.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// GET /api/documents/{name}/keywords?top=10&method=tfidf|textrank
+func keywordsHandler(w http.ResponseWriter, r *http.Request) {
+	top, ok := intParam(r, "top", defaultKeywords)
+	if !ok || top == 0 {
+		apierror.Error(w, "Error: Invalid top.", http.StatusBadRequest)
+		return
+	}
+	method := r.URL.Query().Get("method")
+	if method == "" {
+		method = "tfidf"
+	}
+	if method != "tfidf" && method != "textrank" {
+		apierror.Error(w, "Error: method must be 'tfidf' or 'textrank'.", http.StatusBadRequest)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	i := documentIndex(r.PathValue("name"))
+	if i < 0 {
+		apierror.Error(w, "Error: Document not found.", http.StatusNotFound)
+		return
+	}
+	doc := state.Documents[i]
+	vector := documentVectors().vectors[i]
+
+	result := DocumentKeywords{Document: doc.Name, Method: method}
+	switch method {
+	case "tfidf":
+		result.Keywords = topWeights(vector, top)
+	case "textrank":
+		content := doc.content()
+		if content == "" {
+			apierror.Error(w, "Error: Document text is not stored, TextRank is unavailable.", http.StatusBadRequest)
+			return
+		}
+		// terms found in every document (idf 0) are treated as stop words
+		allowed := func(t string) bool { return vector[t] > 0 }
+		result.Keywords = topWeights(textRankKeywords(strings.Fields(content), allowed), top)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"ir/internal/engine"
+	"ir/internal/kv"
+)
+
+// key layout of the KV store
+const (
+	kvDocPrefix      = "doc/"      // doc/<sequence> -> metadata
+	kvTextPrefix     = "text/"     // text/<name> -> content and raw text
+	kvPostingsPrefix = "postings/" // postings/<term> -> compressed sequence list
+)
+
+// kvStore keeps document metadata and postings in an embedded key-value log;
+// document text stays on disk and is read when needed
+type kvStore struct {
+	db        *kv.DB
+	sequences map[string]int // document name -> sequence, the document ID
+}
+
+type kvMetadata struct {
+	Sequence int            `json:"sequence"`
+	Name     string         `json:"name"`
+	TermFreq map[string]int `json:"termFreq"`
+	Length   int            `json:"length"`
+	Uploaded time.Time      `json:"uploadedAt,omitzero"`
+	Language string         `json:"language,omitempty"`
+
+	DuplicateOf string `json:"duplicateOf,omitempty"`
+	Sections    []int  `json:"sections,omitempty"`
+}
+
+type kvText struct {
+	Content string `json:"content"`
+	Raw     string `json:"raw"`
+}
+
+func openKVStore(dir string) (*kvStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	db, err := kv.Open(filepath.Join(dir, "index.kv"))
+	if err != nil {
+		return nil, err
+	}
+	return &kvStore{db: db, sequences: make(map[string]int)}, nil
+}
+
+// sequence keys sort in upload order
+func kvDocKey(sequence int) string {
+	return fmt.Sprintf("%s%012d", kvDocPrefix, sequence)
+}
+
+func (s *kvStore) LoadDocuments() ([]Document, error) {
+	keys := s.db.Keys(kvDocPrefix)
+	docs := make([]Document, 0, len(keys))
+	for _, key := range keys {
+		data, _, err := s.db.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		var meta kvMetadata
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return nil, fmt.Errorf("%s: %v", key, err)
+		}
+		docs = append(docs, Document{Name: meta.Name, TermFreq: meta.TermFreq, Length: meta.Length, Uploaded: meta.Uploaded, Language: meta.Language, DuplicateOf: meta.DuplicateOf, Sections: meta.Sections, stored: true, id: meta.Sequence})
+		s.sequences[meta.Name] = meta.Sequence
+	}
+	return docs, nil
+}
+
+// writes the documents under their IDs and their postings updates as one
+// batch; a stored document of the same name is deleted in it, its postings
+// keep the old sequence until Compact
+func (s *kvStore) SaveDocuments(docs []Document) error {
+	var batch kv.Batch
+	for _, doc := range docs {
+		if old, ok := s.sequences[doc.Name]; ok {
+			batch.Delete(kvDocKey(old))
+		}
+	}
+	added, err := queueDocuments(&batch, docs)
+	if err != nil {
+		return err
+	}
+	for term, sequences := range added {
+		existing, _, err := s.db.Get(kvPostingsPrefix + term)
+		if err != nil {
+			return err
+		}
+		batch.Put(kvPostingsPrefix+term, engine.Compress(append(engine.CompressedPostings(existing).Decode(), sequences...)))
+	}
+
+	if err := s.db.Write(&batch); err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		s.sequences[doc.Name] = doc.id
+	}
+	return nil
+}
+
+// swaps the stored collection for the documents in one batch; the old records
+// stay in the log as garbage until Compact
+func (s *kvStore) Replace(docs []Document) error {
+	var batch kv.Batch
+	for _, key := range s.db.Keys("") {
+		batch.Delete(key)
+	}
+	added, err := queueDocuments(&batch, docs)
+	if err != nil {
+		return err
+	}
+	for term, sequences := range added {
+		batch.Put(kvPostingsPrefix+term, engine.Compress(sequences))
+	}
+
+	if err := s.db.Write(&batch); err != nil {
+		return err
+	}
+	s.sequences = make(map[string]int, len(docs))
+	for _, doc := range docs {
+		s.sequences[doc.Name] = doc.id
+	}
+	return nil
+}
+
+// queues the metadata and text of the documents under their IDs and returns
+// their sequences by term
+func queueDocuments(batch *kv.Batch, docs []Document) (map[string][]int, error) {
+	added := make(map[string][]int)
+	for _, doc := range docs {
+		sequence := doc.id
+		meta, err := json.Marshal(kvMetadata{Sequence: sequence, Name: doc.Name, TermFreq: doc.TermFreq, Length: doc.Length, Uploaded: doc.Uploaded, Language: doc.Language, DuplicateOf: doc.DuplicateOf, Sections: doc.Sections})
+		if err != nil {
+			return nil, err
+		}
+		text, err := json.Marshal(kvText{Content: doc.Content, Raw: doc.Raw})
+		if err != nil {
+			return nil, err
+		}
+		batch.Put(kvDocKey(sequence), meta)
+		batch.Put(kvTextPrefix+doc.Name, text)
+		for t := range doc.TermFreq {
+			added[t] = append(added[t], sequence)
+		}
+	}
+	return added, nil
+}
+
+func (s *kvStore) LoadText(name string) (string, string, error) {
+	data, ok, err := s.db.Get(kvTextPrefix + name)
+	if err != nil || !ok {
+		return "", "", err
+	}
+	var text kvText
+	if err := json.Unmarshal(data, &text); err != nil {
+		return "", "", err
+	}
+	return text.Content, text.Raw, nil
+}
+
+// stored postings of the documents not deleted since the last Compact
+func (s *kvStore) LoadIndex() (engine.Index, error) {
+	live := make(map[int]bool)
+	for _, key := range s.db.Keys(kvDocPrefix) {
+		sequence, err := strconv.Atoi(strings.TrimPrefix(key, kvDocPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid key", key)
+		}
+		live[sequence] = true
+	}
+
+	index := engine.Index{}
+	for _, key := range s.db.Keys(kvPostingsPrefix) {
+		data, _, err := s.db.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		postings := engine.Postings{}
+		for _, sequence := range engine.CompressedPostings(data).Decode() {
+			if live[sequence] {
+				postings = append(postings, sequence)
+			}
+		}
+		index[strings.TrimPrefix(key, kvPostingsPrefix)] = postings
+	}
+	return index, nil
+}
+
+// rewrites the postings of the terms as the index has them, deleting the terms
+// it lacks
+func (s *kvStore) ReplacePostings(index engine.Index, terms []string) error {
+	var batch kv.Batch
+	for _, term := range terms {
+		if postings := index[term]; len(postings) > 0 {
+			batch.Put(kvPostingsPrefix+term, engine.Compress(postings))
+		} else {
+			batch.Delete(kvPostingsPrefix + term)
+		}
+	}
+	return s.db.Write(&batch)
+}
+
+// removes the metadata and text; the postings keep the sequence until Compact,
+// LoadIndex skips it meanwhile
+func (s *kvStore) Delete(name string) error {
+	sequence, ok := s.sequences[name]
+	if !ok {
+		return nil
+	}
+	var batch kv.Batch
+	batch.Delete(kvDocKey(sequence))
+	batch.Delete(kvTextPrefix + name)
+	if err := s.db.Write(&batch); err != nil {
+		return err
+	}
+	delete(s.sequences, name)
+	return nil
+}
+
+// drops deleted sequences from the postings and rewrites the log without garbage
+func (s *kvStore) Compact() error {
+	live := make(map[int]bool, len(s.sequences))
+	for _, sequence := range s.sequences {
+		live[sequence] = true
+	}
+	var batch kv.Batch
+	for _, key := range s.db.Keys(kvPostingsPrefix) {
+		data, _, err := s.db.Get(key)
+		if err != nil {
+			return err
+		}
+		postings := engine.CompressedPostings(data).Decode()
+		kept := postings[:0]
+		for _, sequence := range postings {
+			if live[sequence] {
+				kept = append(kept, sequence)
+			}
+		}
+		switch {
+		case len(kept) == 0:
+			batch.Delete(key)
+		case len(kept) < len(postings):
+			batch.Put(key, engine.Compress(kept))
+		}
+	}
+	if err := s.db.Write(&batch); err != nil {
+		return err
+	}
+	return s.db.Compact()
+}
+
+func (s *kvStore) Clear() error {
+	var batch kv.Batch
+	for _, key := range s.db.Keys("") {
+		batch.Delete(key)
+	}
+	if err := s.db.Write(&batch); err != nil {
+		return err
+	}
+	s.sequences = make(map[string]int)
+	return s.db.Compact()
+}
+
+func (s *kvStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+
+	"ir/internal/engine"
+)
+
+// the analyzer of the query: the requested language, "auto" detecting it and
+// falling back to the most common document language for queries too short to
+// tell, "none"; by default the language of the analysis config (caller holds the lock)
+func queryAnalyzer(requested, query string) (engine.Analyzer, bool) {
+	language := requested
+	if language == "" {
+		language = state.Analysis.Language
+	}
+	if language == "auto" {
+		if language, _ = engine.DetectLanguage(query); language == "" {
+			language = mostCommonLanguage()
+		}
+	}
+	return engine.LookupAnalyzer(language) // none for "none" and ""
+}
+
+// the language most documents were analyzed in, "" when none was (caller holds the lock)
+func mostCommonLanguage() string {
+	counts := map[string]int{}
+	best := ""
+	for _, doc := range state.Documents {
+		if doc.Language == "" {
+			continue
+		}
+		counts[doc.Language]++
+		if counts[doc.Language] > counts[best] || counts[doc.Language] == counts[best] && doc.Language < best {
+			best = doc.Language
+		}
+	}
+	return best
+}
+
+// runs the query words, the boosted and the operator terms through the analyzer;
+// a query of stop words only is kept as typed
+func analyzeQuery(query string, boosts map[string]float64, operators TermOperators, analyzer engine.Analyzer) (string, map[string]float64, TermOperators) {
+	filter := func(words []string) []string {
+		kept := []string{}
+		for _, word := range words {
+			if term, ok := analyzer.Filter(strings.ToLower(word)); ok {
+				kept = append(kept, term)
+			}
+		}
+		return kept
+	}
+
+	words := filter(strings.Fields(query))
+	if len(words) == 0 {
+		return query, boosts, operators
+	}
+	stemmed := make(map[string]float64, len(boosts))
+	for term, boost := range boosts {
+		if t, ok := analyzer.Filter(term); ok {
+			stemmed[t] = boost
+		}
+	}
+	return strings.Join(words, " "), stemmed, TermOperators{Required: filter(operators.Required), Excluded: filter(operators.Excluded)}
+}
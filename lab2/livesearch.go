@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ir/internal/apierror"
+)
+
+const (
+	liveDebounce       = 150 * time.Millisecond // quiet time after a keystroke before searching
+	liveKeepAlive      = 15 * time.Second
+	liveCompletions    = 5 // vocabulary terms the partial last word expands to
+	defaultLiveResults = 10
+)
+
+type LivePrefixRequest struct {
+	Prefix string `json:"prefix" maxLength:"1000"`
+}
+
+type LiveResults struct {
+	Prefix      string         `json:"prefix"`
+	Completions []string       `json:"completions"` // terms the last word was expanded to
+	Results     []SearchResult `json:"results"`
+	TookMs      float64        `json:"tookMs"`
+}
+
+// liveSession is one open event stream; prefixes holds only the latest keystroke
+type liveSession struct {
+	prefixes chan string
+}
+
+var liveSessions = struct {
+	sync.Mutex
+	byID map[string]*liveSession
+}{byID: map[string]*liveSession{}}
+
+// GET /api/search/live?k=10 opens a Server-Sent Events stream: the first
+// "session" event carries the id that POST /api/search/live/{session} sends
+// prefixes to, every pause in typing is answered with a "results" event
+func liveSearchHandler(w http.ResponseWriter, r *http.Request) {
+	k, ok := intParam(r, "k", defaultLiveResults)
+	if !ok || k == 0 {
+		apierror.Error(w, "Error: 'k' must be a positive integer.", http.StatusBadRequest)
+		return
+	}
+
+	id := rand.Text()
+	session := &liveSession{prefixes: make(chan string, 1)}
+	liveSessions.Lock()
+	liveSessions.byID[id] = session
+	liveSessions.Unlock()
+	defer func() {
+		liveSessions.Lock()
+		delete(liveSessions.byID, id)
+		liveSessions.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher := http.NewResponseController(w)
+	send := func(event string, data interface{}) error {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, encoded); err != nil {
+			return err
+		}
+		return flusher.Flush()
+	}
+	if send("session", map[string]string{"id": id}) != nil {
+		return
+	}
+
+	debounce := time.NewTimer(liveDebounce)
+	debounce.Stop()
+	keepAlive := time.NewTicker(liveKeepAlive)
+	defer keepAlive.Stop()
+	var prefix string
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case prefix = <-session.prefixes:
+			debounce.Reset(liveDebounce)
+		case <-debounce.C:
+			state.Lock()
+			results := liveSearch(prefix, k)
+			state.Unlock()
+			if send("results", results) != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil || flusher.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// POST /api/search/live/{session} {"prefix": "informat"} queues the text typed so far
+func livePrefixHandler(w http.ResponseWriter, r *http.Request) {
+	var requestData LivePrefixRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		apierror.InvalidJSON(w)
+		return
+	}
+
+	liveSessions.Lock()
+	session, ok := liveSessions.byID[r.PathValue("session")]
+	liveSessions.Unlock()
+	if !ok {
+		apierror.Error(w, "Error: Live search session not found.", http.StatusNotFound)
+		return
+	}
+	// replace a prefix the stream has not picked up yet, only the latest matters
+	select {
+	case <-session.prefixes:
+	default:
+	}
+	select {
+	case session.prefixes <- requestData.Prefix:
+	default:
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// top k documents for the text typed so far, the unfinished last word expanded
+// to the most common vocabulary terms starting with it; scored against the
+// cached TF-IDF vectors, so keystrokes do not rebuild the vocabulary (caller holds the lock)
+func liveSearch(prefix string, k int) LiveResults {
+	started := time.Now()
+	response := LiveResults{Prefix: prefix, Completions: []string{}, Results: []SearchResult{}}
+
+	words := strings.Fields(strings.ToLower(prefix))
+	if len(words) == 0 || len(state.Documents) == 0 {
+		return response
+	}
+	cache := documentVectors()
+	if !strings.HasSuffix(prefix, " ") {
+		last := words[len(words)-1]
+		words = words[:len(words)-1]
+		response.Completions = completeTerm(cache, last)
+		words = append(words, response.Completions...)
+	}
+
+	qVector := tfidfVector(newTermsDocument("query", words), cache.idf)
+	qNorm := qVector.norm()
+	for i, doc := range state.Documents {
+		if score := sparseCosine(qVector, qNorm, cache.vectors[i], cache.norms[i]); score > 0 {
+			response.Results = append(response.Results, SearchResult{FileName: doc.Name, Score: score})
+		}
+	}
+	sort.SliceStable(response.Results, func(i, j int) bool {
+		return response.Results[i].Score > response.Results[j].Score
+	})
+	if len(response.Results) > k {
+		response.Results = response.Results[:k]
+	}
+	response.TookMs = float64(time.Since(started).Microseconds()) / 1000
+	return response
+}
+
+// vocabulary terms starting with the partial word: the word itself when it is
+// a term, then the most common (lowest idf) ones
+func completeTerm(cache *vectorCache, partial string) []string {
+	start := sort.SearchStrings(cache.terms, partial)
+	end := start
+	for end < len(cache.terms) && strings.HasPrefix(cache.terms[end], partial) {
+		end++
+	}
+	matches := append([]string{}, cache.terms[start:end]...)
+	sort.SliceStable(matches, func(i, j int) bool {
+		if (matches[i] == partial) != (matches[j] == partial) {
+			return matches[i] == partial
+		}
+		return cache.idf[matches[i]] < cache.idf[matches[j]]
+	})
+	return matches[:min(liveCompletions, len(matches))]
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+
+	"ir/internal/apierror"
+)
+
+const (
+	defaultLSIDimensions = 50
+	lsiIterations        = 50
+	lsiConceptTerms      = 5
+)
+
+// lsiModel is a truncated SVD A ~ U_k S_k V_k^T of the TF-IDF term-document matrix
+type lsiModel struct {
+	singular    []float64
+	termVectors map[string][]float64 // rows of U_k
+	docVectors  [][]float64          // rows of V_k, aligned with state.Documents
+}
+
+type LSIInfo struct {
+	K              int            `json:"k"`
+	Documents      int            `json:"documents"`
+	Terms          int            `json:"terms"`
+	SingularValues []float64      `json:"singularValues"`
+	Concepts       [][]TermWeight `json:"concepts"` // heaviest terms of each dimension
+}
+
+// y = A^T A x for the sparse document vectors (columns of A)
+func gramProduct(vectors []SparseVector, x []float64) []float64 {
+	termSpace := make(map[string]float64)
+	for j, v := range vectors {
+		if x[j] == 0 {
+			continue
+		}
+		for t, w := range v {
+			termSpace[t] += w * x[j]
+		}
+	}
+	y := make([]float64, len(vectors))
+	for j, v := range vectors {
+		for t, w := range v {
+			y[j] += w * termSpace[t]
+		}
+	}
+	return y
+}
+
+// orthonormalizes the columns in place (modified Gram-Schmidt)
+func orthonormalize(columns [][]float64) {
+	for i := range columns {
+		for j := range i {
+			dot := 0.0
+			for r := range columns[i] {
+				dot += columns[i][r] * columns[j][r]
+			}
+			for r := range columns[i] {
+				columns[i][r] -= dot * columns[j][r]
+			}
+		}
+		norm := 0.0
+		for _, x := range columns[i] {
+			norm += x * x
+		}
+		norm = math.Sqrt(norm)
+		if norm == 0 {
+			continue
+		}
+		for r := range columns[i] {
+			columns[i][r] /= norm
+		}
+	}
+}
+
+// eigenvalues and eigenvectors (as columns) of a small symmetric matrix,
+// cyclic Jacobi rotations
+func symmetricEigen(matrix [][]float64) ([]float64, [][]float64) {
+	n := len(matrix)
+	a := make([][]float64, n)
+	vectors := make([][]float64, n)
+	for i := range n {
+		a[i] = append([]float64{}, matrix[i]...)
+		vectors[i] = make([]float64, n)
+		vectors[i][i] = 1
+	}
+
+	for sweep := 0; sweep < 100; sweep++ {
+		offDiagonal := 0.0
+		for p := range n {
+			for q := p + 1; q < n; q++ {
+				offDiagonal += a[p][q] * a[p][q]
+			}
+		}
+		if offDiagonal < 1e-22 {
+			break
+		}
+
+		for p := range n {
+			for q := p + 1; q < n; q++ {
+				if math.Abs(a[p][q]) < 1e-300 {
+					continue
+				}
+				theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+				t := math.Copysign(1, theta) / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+
+				for k := range n {
+					akp, akq := a[k][p], a[k][q]
+					a[k][p], a[k][q] = c*akp-s*akq, s*akp+c*akq
+				}
+				for k := range n {
+					apk, aqk := a[p][k], a[q][k]
+					a[p][k], a[q][k] = c*apk-s*aqk, s*apk+c*aqk
+				}
+				for k := range n {
+					vkp, vkq := vectors[k][p], vectors[k][q]
+					vectors[k][p], vectors[k][q] = c*vkp-s*vkq, s*vkp+c*vkq
+				}
+			}
+		}
+	}
+
+	values := make([]float64, n)
+	for i := range n {
+		values[i] = a[i][i]
+	}
+	return values, vectors
+}
+
+// truncated SVD by subspace iteration on A^T A followed by a Rayleigh-Ritz step
+// (caller holds the lock)
+func buildLSI(k int) *lsiModel {
+	vectors := documentVectors().vectors
+	n := len(vectors)
+	k = min(k, n)
+
+	rng := rand.New(rand.NewPCG(1, 1))
+	basis := make([][]float64, k)
+	for i := range basis {
+		basis[i] = make([]float64, n)
+		for j := range basis[i] {
+			basis[i][j] = rng.NormFloat64()
+		}
+	}
+	orthonormalize(basis)
+
+	for range lsiIterations {
+		for i := range basis {
+			basis[i] = gramProduct(vectors, basis[i])
+		}
+		orthonormalize(basis)
+	}
+
+	// projected matrix B = Q^T A^T A Q
+	products := make([][]float64, k)
+	for i := range basis {
+		products[i] = gramProduct(vectors, basis[i])
+	}
+	projected := make([][]float64, k)
+	for i := range projected {
+		projected[i] = make([]float64, k)
+		for j := range projected[i] {
+			for r := range n {
+				projected[i][j] += basis[i][r] * products[j][r]
+			}
+		}
+	}
+	eigenvalues, eigenvectors := symmetricEigen(projected)
+
+	order := make([]int, k)
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return eigenvalues[order[a]] > eigenvalues[order[b]]
+	})
+
+	model := &lsiModel{
+		singular:    make([]float64, 0, k),
+		termVectors: make(map[string][]float64),
+		docVectors:  make([][]float64, n),
+	}
+	for j := range model.docVectors {
+		model.docVectors[j] = make([]float64, 0, k)
+	}
+	for _, e := range order {
+		if eigenvalues[e] <= 1e-12 {
+			break // rank of the matrix reached
+		}
+		model.singular = append(model.singular, math.Sqrt(eigenvalues[e]))
+		for j := range n {
+			v := 0.0
+			for i := range k {
+				v += basis[i][j] * eigenvectors[i][e]
+			}
+			model.docVectors[j] = append(model.docVectors[j], v)
+		}
+	}
+
+	// U_k = A V_k S_k^-1
+	dims := len(model.singular)
+	for j, v := range vectors {
+		for t, w := range v {
+			row, ok := model.termVectors[t]
+			if !ok {
+				row = make([]float64, dims)
+				model.termVectors[t] = row
+			}
+			for i := range dims {
+				row[i] += w * model.docVectors[j][i] / model.singular[i]
+			}
+		}
+	}
+	return model
+}
+
+// folds the query into the concept space: q_k = S_k^-1 U_k^T q
+func (m *lsiModel) foldIn(query SparseVector) []float64 {
+	folded := make([]float64, len(m.singular))
+	for t, w := range query {
+		row, ok := m.termVectors[t]
+		if !ok {
+			continue
+		}
+		for i := range folded {
+			folded[i] += w * row[i] / m.singular[i]
+		}
+	}
+	return folded
+}
+
+func denseCosine(a, b []float64) float64 {
+	dot, normA, normB := 0.0, 0.0, 0.0
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0.0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// ranks documents by cosine similarity in the LSI concept space
+func (v *corpusView) lsiSearch(query string) ([]SearchResult, error) {
+	if v.lsi == nil {
+		return nil, fmt.Errorf("LSI model is not built, POST /api/lsi first")
+	}
+	folded := v.lsi.foldIn(queryVector(query, v.vectors))
+
+	results := make([]SearchResult, 0)
+	for j, doc := range v.docs {
+		if score := denseCosine(folded, v.lsi.docVectors[j]); score > 0.0 {
+			results = append(results, SearchResult{FileName: doc.Name, Score: score})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results, nil
+}
+
+func (m *lsiModel) info() LSIInfo {
+	info := LSIInfo{
+		K:              len(m.singular),
+		Documents:      len(m.docVectors),
+		Terms:          len(m.termVectors),
+		SingularValues: m.singular,
+		Concepts:       make([][]TermWeight, len(m.singular)),
+	}
+	for i := range m.singular {
+		weights := SparseVector{}
+		for t, row := range m.termVectors {
+			weights[t] = math.Abs(row[i])
+		}
+		info.Concepts[i] = topWeights(weights, lsiConceptTerms)
+	}
+	return info
+}
+
+type LSIRequest struct {
+	K int `json:"k" minimum:"1"`
+}
+
+// GET describes the current LSI model, POST {"k": 50} (re)builds it from the collection;
+// the model is dropped whenever documents change
+func lsiHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		if state.lsi == nil {
+			apierror.Error(w, "Error: LSI model is not built.", http.StatusNotFound)
+			return
+		}
+	case http.MethodPost:
+		requestData := LSIRequest{K: defaultLSIDimensions}
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+		if requestData.K <= 0 {
+			apierror.Error(w, "Error: k must be positive.", http.StatusBadRequest)
+			return
+		}
+		if len(state.Documents) == 0 {
+			apierror.Write(w, http.StatusBadRequest, "no_documents", "No documents uploaded. Please add documents first.")
+			return
+		}
+		state.lsi = buildLSI(requestData.K)
+		fmt.Println("LSI model built with", len(state.lsi.singular), "dimensions")
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state.lsi.info())
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"ir/internal/apierror"
+)
+
+// features of a query-document pair, in this order
+var ltrFeatureNames = []string{"tfidf", "bm25", "length", "overlap"}
+
+// LTRExample is a logged query-document pair with its relevance label
+type LTRExample struct {
+	Query     string    `json:"query"`
+	Document  string    `json:"document"`
+	Relevance float64   `json:"relevance"` // > 0 counts as relevant
+	Features  []float64 `json:"features"`
+}
+
+// ltrModel is a pointwise logistic regression over standardized features
+type ltrModel struct {
+	Features []string  `json:"features"`
+	Weights  []float64 `json:"weights"`
+	Bias     float64   `json:"bias"`
+	Means    []float64 `json:"means"`
+	Scales   []float64 `json:"scales"`
+	Loss     float64   `json:"loss"`     // final mean log loss on the training examples
+	Accuracy float64   `json:"accuracy"` // at a 0.5 threshold
+	Examples int       `json:"examples"`
+}
+
+// feature vectors of every document of the view for the query
+func (v *corpusView) ltrFeatures(query string) map[string][]float64 {
+	tfidf := make(map[string]float64)
+	for _, result := range cosineSearch(v.docs, query) {
+		tfidf[result.FileName] = result.Score
+	}
+	bm25 := make(map[string]float64)
+	for _, result := range scoreDocuments(bm25Scorer, query, v.docs, v.collection) {
+		bm25[result.FileName] = result.Score
+	}
+
+	terms := make(map[string]bool)
+	for _, t := range strings.Fields(strings.ToLower(query)) {
+		terms[t] = true
+	}
+
+	features := make(map[string][]float64, len(v.docs))
+	for _, doc := range v.docs {
+		overlap := 0.0
+		for t := range terms {
+			if doc.TermFreq[t] > 0 {
+				overlap++
+			}
+		}
+		if len(terms) > 0 {
+			overlap /= float64(len(terms))
+		}
+		features[doc.Name] = []float64{tfidf[doc.Name], bm25[doc.Name], math.Log1p(float64(doc.Length)), overlap}
+	}
+	return features
+}
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+func (m *ltrModel) score(features []float64) float64 {
+	z := m.Bias
+	for i, x := range features {
+		z += m.Weights[i] * (x - m.Means[i]) / m.Scales[i]
+	}
+	return sigmoid(z)
+}
+
+// fits the model with batch gradient descent and L2 regularization
+func trainLTR(examples []LTRExample, epochs int, learningRate, l2 float64) *ltrModel {
+	n, d := float64(len(examples)), len(ltrFeatureNames)
+	model := &ltrModel{
+		Features: ltrFeatureNames,
+		Weights:  make([]float64, d),
+		Means:    make([]float64, d),
+		Scales:   make([]float64, d),
+		Examples: len(examples),
+	}
+
+	for _, example := range examples {
+		for i, x := range example.Features {
+			model.Means[i] += x / n
+		}
+	}
+	for _, example := range examples {
+		for i, x := range example.Features {
+			model.Scales[i] += (x - model.Means[i]) * (x - model.Means[i]) / n
+		}
+	}
+	for i := range model.Scales {
+		model.Scales[i] = math.Sqrt(model.Scales[i])
+		if model.Scales[i] == 0 {
+			model.Scales[i] = 1 // constant feature
+		}
+	}
+
+	labels := make([]float64, len(examples))
+	for j, example := range examples {
+		if example.Relevance > 0 {
+			labels[j] = 1
+		}
+	}
+
+	for range epochs {
+		gradient := make([]float64, d)
+		biasGradient := 0.0
+		for j, example := range examples {
+			err := model.score(example.Features) - labels[j]
+			for i, x := range example.Features {
+				gradient[i] += err * (x - model.Means[i]) / model.Scales[i] / n
+			}
+			biasGradient += err / n
+		}
+		for i := range model.Weights {
+			model.Weights[i] -= learningRate * (gradient[i] + l2*model.Weights[i])
+		}
+		model.Bias -= learningRate * biasGradient
+	}
+
+	correct := 0
+	for j, example := range examples {
+		p := min(max(model.score(example.Features), 1e-12), 1-1e-12)
+		model.Loss -= (labels[j]*math.Log(p) + (1-labels[j])*math.Log(1-p)) / n
+		if (p >= 0.5) == (labels[j] == 1) {
+			correct++
+		}
+	}
+	model.Accuracy = float64(correct) / n
+	return model
+}
+
+// ranks documents that share a term with the query by the learned relevance probability
+func (v *corpusView) ltrSearch(query string) ([]SearchResult, error) {
+	if v.ltr == nil {
+		return nil, fmt.Errorf("learning-to-rank model is not trained, POST /api/ltr/train first")
+	}
+
+	results := make([]SearchResult, 0)
+	for name, features := range v.ltrFeatures(query) {
+		if features[3] == 0 {
+			continue // no query term in the document
+		}
+		results = append(results, SearchResult{FileName: name, Score: v.ltr.score(features)})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].FileName < results[j].FileName
+	})
+	return results, nil
+}
+
+type JudgmentsRequest struct {
+	Judgments []LTRExample `json:"judgments"`
+}
+
+// GET lists the logged examples, POST {"judgments": [{"query", "document", "relevance"}]}
+// logs the features of each judged pair
+func ltrJudgmentsHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var requestData JudgmentsRequest
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+
+		view, err := snapshotCorpus()
+		if err != nil {
+			apierror.Error(w, "Error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		features := make(map[string]map[string][]float64)
+		for _, judgment := range requestData.Judgments {
+			if documentIndex(judgment.Document) < 0 {
+				apierror.Error(w, fmt.Sprintf("Error: Document '%s' not found.", judgment.Document), http.StatusNotFound)
+				return
+			}
+			if _, ok := features[judgment.Query]; !ok {
+				features[judgment.Query] = view.ltrFeatures(judgment.Query)
+			}
+		}
+
+		for _, judgment := range requestData.Judgments {
+			judgment.Features = features[judgment.Query][judgment.Document]
+			replaced := false
+			for i, example := range state.LTRExamples {
+				if example.Query == judgment.Query && example.Document == judgment.Document {
+					state.LTRExamples[i], replaced = judgment, true
+					break
+				}
+			}
+			if !replaced {
+				state.LTRExamples = append(state.LTRExamples, judgment)
+			}
+		}
+	case http.MethodDelete:
+		state.LTRExamples = []LTRExample{}
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"features": ltrFeatureNames,
+		"examples": state.LTRExamples,
+	})
+}
+
+type TrainRequest struct {
+	Epochs       int     `json:"epochs" minimum:"1"`
+	LearningRate float64 `json:"learningRate" exclusiveMinimum:"0"`
+	L2           float64 `json:"l2" minimum:"0"`
+}
+
+// POST /api/ltr/train {"epochs": 500, "learningRate": 0.1, "l2": 0.01}; GET returns the model
+func ltrTrainHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		if state.ltr == nil {
+			apierror.Error(w, "Error: Learning-to-rank model is not trained.", http.StatusNotFound)
+			return
+		}
+	case http.MethodPost:
+		requestData := TrainRequest{Epochs: 500, LearningRate: 0.1, L2: 0.01}
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+		if requestData.Epochs <= 0 || requestData.LearningRate <= 0 || requestData.L2 < 0 {
+			apierror.Error(w, "Error: epochs and learningRate must be positive, l2 must not be negative.", http.StatusBadRequest)
+			return
+		}
+
+		positives := 0
+		for _, example := range state.LTRExamples {
+			if example.Relevance > 0 {
+				positives++
+			}
+		}
+		if positives == 0 || positives == len(state.LTRExamples) {
+			apierror.Error(w, "Error: Training needs both relevant and non-relevant judgments.", http.StatusBadRequest)
+			return
+		}
+
+		state.ltr = trainLTR(state.LTRExamples, requestData.Epochs, requestData.LearningRate, requestData.L2)
+		fmt.Println("LTR model trained on", state.ltr.Examples, "examples")
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state.ltr)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const maxMailMessages = 10000
+
+// splitEML reads a single message, indexed under the name of the file
+func splitEML(name string, r io.Reader) ([]archivedDocument, error) {
+	doc, err := parseMail(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	doc.name = name
+	return []archivedDocument{doc}, nil
+}
+
+// splitMbox reads the messages of an mbox file, each starting at a "From "
+// line; they are named after the file, their position and their subject
+func splitMbox(name string, r io.Reader) ([]archivedDocument, error) {
+	folder := strings.TrimSuffix(path.Base(name), path.Ext(name))
+	var docs []archivedDocument
+	var message bytes.Buffer
+	var number int
+	var failed error
+
+	flush := func() {
+		if message.Len() == 0 {
+			return
+		}
+		number++
+		doc, err := parseMail(bytes.NewReader(message.Bytes()))
+		message.Reset()
+		if err != nil {
+			failed = fmt.Errorf("%s: message %d: %v", name, number, err)
+			return
+		}
+		doc.name = fmt.Sprintf("%s/%04d-%s", folder, number, slugify(strings.Join(doc.metadata["subject"], " "), 40, "message"))
+		docs = append(docs, doc)
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 10<<20)
+	started := false
+	for scanner.Scan() && len(docs) < maxMailMessages {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "From ") {
+			flush()
+			started = true
+			continue
+		}
+		if !started {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			return nil, fmt.Errorf("%s is not an mbox file", name)
+		}
+		if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+			line = line[1:] // quoted by the mboxrd format
+		}
+		message.WriteString(line)
+		message.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	flush()
+	if len(docs) == 0 && failed != nil {
+		return nil, failed
+	}
+	return docs, nil
+}
+
+// the text and header fields of a message: subject, sender and recipients,
+// then the decoded text parts of the body, HTML parts only when there is no
+// plain text
+func parseMail(r io.Reader) (archivedDocument, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return archivedDocument{}, err
+	}
+	decoder := mime.WordDecoder{CharsetReader: charsetReader}
+	header := func(key string) string {
+		value := msg.Header.Get(key)
+		if decoded, err := decoder.DecodeHeader(value); err == nil {
+			value = decoded
+		}
+		return strings.Join(strings.Fields(value), " ")
+	}
+
+	fields := DocumentMetadata{}
+	for _, key := range []string{"subject", "from", "to"} {
+		if value := header(key); value != "" {
+			fields[key] = []string{value}
+		}
+	}
+	if date, err := msg.Header.Date(); err == nil {
+		fields["date"] = []string{date.UTC().Format(time.RFC3339)}
+	}
+
+	plain, html := mailText(msg.Header, msg.Body, 0)
+	body := plain
+	if strings.TrimSpace(body) == "" {
+		body = html
+	}
+	// the addresses are part of the text so that from:alice alone finds the
+	// messages by searching for alice among them
+	var text strings.Builder
+	for _, key := range []string{"subject", "from", "to"} {
+		if values := fields[key]; len(values) > 0 {
+			text.WriteString(values[0] + "\n")
+		}
+	}
+	text.WriteString("\n" + strings.TrimSpace(body))
+	return archivedDocument{text: text.String(), metadata: fields}, nil
+}
+
+// the headers of a message or MIME part that mailText needs
+type partHeader interface {
+	Get(key string) string
+}
+
+// the decoded plain text and HTML text of a part, walking multiparts up to a
+// few levels deep; attachments are skipped
+func mailText(header partHeader, body io.Reader, depth int) (string, string) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	if disposition, _, _ := mime.ParseMediaType(header.Get("Content-Disposition")); disposition == "attachment" {
+		return "", ""
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= 5 || params["boundary"] == "" {
+			return "", ""
+		}
+		var plain, html []string
+		parts := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := parts.NextRawPart() // keeps the transfer encoding for decodeBody
+			if err != nil {
+				break
+			}
+			p, h := mailText(part.Header, part, depth+1)
+			if p != "" {
+				plain = append(plain, p)
+			}
+			if h != "" {
+				html = append(html, h)
+			}
+			if mediaType == "multipart/alternative" && p != "" {
+				break // the first plain alternative is the message
+			}
+		}
+		return strings.Join(plain, "\n\n"), strings.Join(html, "\n\n")
+	}
+	if mediaType != "text/plain" && mediaType != "text/html" {
+		return "", ""
+	}
+
+	data, err := io.ReadAll(decodeBody(header.Get("Content-Transfer-Encoding"), body))
+	if err != nil && len(data) == 0 {
+		return "", ""
+	}
+	text := decodeCharset(params["charset"], data)
+	if mediaType == "text/html" {
+		_, text = htmlToText(text)
+		return "", text
+	}
+	return text, ""
+}
+
+var base64Junk = regexp.MustCompile(`[^A-Za-z0-9+/=]`)
+
+func decodeBody(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	case "base64":
+		data, _ := io.ReadAll(body)
+		return base64.NewDecoder(base64.StdEncoding, bytes.NewReader(base64Junk.ReplaceAll(data, nil)))
+	}
+	return body
+}
+
+// text in UTF-8 of the charsets the standard library knows no reader for:
+// Latin-1 and Windows-1252 map byte by byte, anything else is kept if valid
+func decodeCharset(charset string, data []byte) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "windows-1252", "cp1252":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+	return strings.ToValidUTF8(string(data), string(unicode.ReplacementChar))
+}
+
+// decodes encoded words of other charsets than UTF-8 in the headers
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(decodeCharset(charset, data)), nil
+}
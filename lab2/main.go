@@ -1,46 +1,346 @@
 package main
 
 import (
+	"cmp"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"html/template"
 	"io"
 	"math"
 	"net/http"
-	"regexp"
+	"path"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"ir/internal/apierror"
+	"ir/internal/engine"
+	"ir/internal/segment"
 )
 
 type SystemState struct {
 	sync.Mutex
-	Documents []Document
+	Documents     []Document // never changed in place, so the rankers can read a copy of the slice without the lock
+	Snapshots     []IndexSnapshot
+	Analysis      engine.AnalysisConfig
+	Labels        map[string]string           // document name -> class label, used by the kNN classifier
+	Metadata      map[string]DocumentMetadata // document name -> metadata fields, for facets
+	MetadataTypes map[string]string           // metadata field -> "number" or "date", for range filters
+	Synonyms      SynonymConfig
+	Templates     map[string]QueryTemplate           // saved boolean queries, not persisted
+	ResultSets    map[string]ResultSet               // saved query results, not persisted
+	Collections   map[string]*materializedCollection // result sets copied into collections of their own, not persisted
+
+	PassageConfig PassageConfig
+	Priors        PriorConfig // query-independent document priors of ranked searches
+	Dedup         DedupConfig // near-duplicate screening of new documents
+	Fetcher       FetcherConfig
+	Uploads       UploadConfig
+	feeds         map[string]*feed // feed ID -> registered feed, not persisted
+
+	Embedder   EmbedderConfig
+	Embeddings map[string][]float32 // document name -> embedding, filled lazily by the dense ranker
+	Reranker   RerankerConfig
+
+	LTRExamples []LTRExample
+
+	EvalQueries []EvalQuery
+	Qrels       map[string]map[string]int // query id -> document name -> relevance grade
+
+	Clicks      []ClickEvent
+	Impressions map[string]int // document name -> times shown in the top results
+
+	Versions map[string]*versionHistory // document name -> previous versions, for replaced documents
+
+	vectors  *vectorCache
+	kgrams   *kgramIndex
+	trigrams *trigramIndex
+	biwords  *biwordIndex // nil unless started with -biwords
+	trie     *trieNode
+	lsi      *lsiModel
+	topics   *ldaModel
+	ltr      *ltrModel
+	boolean  *booleanIndex
+
+	segments *segment.Set // content postings of the boolean index
+	nextID   int          // ID of the next document in the boolean index
+
+	collection *engine.CollectionStats // replaced, never updated in place: rankers read it without the lock
+	unscored   []Document              // indexed since the collection statistics were built
+
+	queryLog *queryLogStore
+	store    Store
 }
 
 type Document struct {
-	Name    string
-	Content string
+	Name     string
+	Content  string // normalized text, empty for documents over engine.MaxStoredContentSize
+	Raw      string // text as uploaded, before the character filters; same size limit
+	TermFreq map[string]int
+	Length   int       // number of tokens
+	Uploaded time.Time // when the current version was uploaded, zero for documents stored before it was recorded
+	Language string    // of the analyzer applied at ingest, empty without one
+	Passages []Passage
+
+	Fingerprint uint64 // SimHash of the terms, computed as the document is indexed
+	DuplicateOf string // the indexed document this one was flagged a near-duplicate of
+	Sections    []int  // token offsets where the sections of a structured document start, e.g. Markdown headings
+
+	// spans of the sentences in the searchable text, split as the document is indexed
+	Sentences []sentenceSpan
+	Entities  []Entity
+
+	stored  bool           // Content and Raw are kept in the store only, see content()
+	id      int            // ID in the boolean index and the store; positions shift when documents are deleted
+	biwords map[string]int // adjacent term pairs counted by the analysis, until they join the biword index
 }
 
 type SearchResult struct {
 	FileName string  `json:"fileName"`
 	Score    float64 `json:"score"`
+
+	// per-ranker breakdown of fused scores
+	Contributions []RankerContribution `json:"contributions,omitempty"`
+
+	// per-term breakdown of a cosine score, on request
+	Explanation []TermExplanation `json:"explanation,omitempty"`
+	Prior       *PriorExplanation `json:"prior,omitempty"`
 }
 
-var state = SystemState{
-	Documents: []Document{},
+type SearchRequest struct {
+	Query           string                   `json:"query" maxLength:"10000"`
+	PRF             *PseudoRelevanceFeedback `json:"prf"`
+	Synonyms        *bool                    `json:"synonyms"` // false disables synonym expansion
+	AutoCorrect     bool                     `json:"autoCorrect"`
+	Phonetic        string                   `json:"phonetic" enum:"|soundex|metaphone"` // matches terms that sound alike
+	Passages        bool                     `json:"passages"`
+	Ranker          string                   `json:"ranker"` // "cosine" (default), "lsi", "dense", "hybrid", "ltr" or a scorer: "tfidf", "bm25", "jaccard", "dice", "lm" (Dirichlet), "lm-jm" (Jelinek-Mercer), tuned like "lm:mu=500"
+	Hybrid          *HybridOptions           `json:"hybrid"`
+	Rerank          bool                     `json:"rerank"`
+	ClickBoost      float64                  `json:"clickBoost" minimum:"0"`                 // weight of the click-through rate as a static boost
+	Language        string                   `json:"language" enum:"|auto|none|de|en|es|fr"` // query analyzer, by default that of the analysis config
+	Priors          *bool                    `json:"priors"`                                 // false ignores the document priors of /api/priors
+	Diversify       *float64                 `json:"diversify" minimum:"0" maximum:"1"`      // MMR lambda: reorders the top results, lower values favour novelty
+	Plan            bool                     `json:"plan"`                                   // boolean mode: include the evaluation plan
+	Explain         bool                     `json:"explain"`                                // cosine ranker: break the scores down by query term
+	Interpretations bool                     `json:"interpretations"`                        // include the alternative readings of the query
+	Limit           int                      `json:"limit" minimum:"0"`                      // at most this many results, 0 returns all
+
+	// restricts the search to these documents: exact names or globs like "notes/*.txt"
+	Docs []string `json:"docs" maxItems:"1000"`
+
+	// counts the values of these metadata fields over the results; filters keep
+	// the documents having one of the values of every filtered field
+	Facets  []string               `json:"facets" maxItems:"20"`
+	Filters map[string][]string    `json:"filters"`
+	Ranges  map[string]RangeFilter `json:"ranges"`            // on number and date fields, e.g. {"year": {"gte": 2019, "lte": 2023}}
+	Topic   *int                   `json:"topic" minimum:"0"` // documents whose dominant topic of /api/topics is this one
+
+	// groups the results by the part of the file name before the last delimiter
+	// ("/" by default), e.g. the folder or dataset the file came from
+	GroupBy        string `json:"groupBy" enum:"|prefix"`
+	GroupDelimiter string `json:"groupDelimiter" maxLength:"10"`
+
+	// drop weak matches: results scoring below minScore, or containing fewer
+	// than minimumShouldMatch distinct terms of the typed query, analyzed as documents are
+	MinScore           *float64 `json:"minScore"`
+	MinimumShouldMatch int      `json:"minimumShouldMatch" minimum:"0"`
+
+	// reorders the retrieved results, equal keys keep their relevance order;
+	// descending by default except for names
+	Sort  string `json:"sort" enum:"|score|name|length|uploadedAt"`
+	Order string `json:"order" enum:"|asc|desc"`
 }
 
-// Regex to validate document content
-var validationRegex = regexp.MustCompile(`^[a-z0-9\s\n\r]+$`)
+// the search options that GET /api/search takes as URL parameters, the query as q
+func searchRequestFromURL(r *http.Request) SearchRequest {
+	params := r.URL.Query()
+	boolParam := func(name string) bool {
+		value, _ := strconv.ParseBool(params.Get(name))
+		return value
+	}
+	requestData := SearchRequest{
+		Query:           params.Get("q"),
+		AutoCorrect:     boolParam("autoCorrect"),
+		Phonetic:        params.Get("phonetic"),
+		Language:        params.Get("language"),
+		Passages:        boolParam("passages"),
+		Ranker:          params.Get("ranker"),
+		Rerank:          boolParam("rerank"),
+		Plan:            boolParam("plan"),
+		Explain:         boolParam("explain"),
+		Interpretations: boolParam("interpretations"),
+		Docs:            params["docs"],
+		GroupBy:         params.Get("groupBy"),
+		GroupDelimiter:  params.Get("groupDelimiter"),
+		Facets:          params["facets"],
+		Filters:         parseFacetFilters(params["filter"]),
+		Ranges:          parseRangeParams(params["range"]),
+		Sort:            params.Get("sort"),
+		Order:           params.Get("order"),
+	}
+	requestData.Limit, _ = intParam(r, "limit", 0)
+	requestData.MinimumShouldMatch, _ = intParam(r, "minimumShouldMatch", 0)
+	if minScore, err := strconv.ParseFloat(params.Get("minScore"), 64); err == nil {
+		requestData.MinScore = &minScore
+	}
+	if params.Has("synonyms") {
+		synonyms := boolParam("synonyms")
+		requestData.Synonyms = &synonyms
+	}
+	if diversify, err := strconv.ParseFloat(params.Get("diversify"), 64); err == nil {
+		requestData.Diversify = &diversify
+	}
+	if topic, err := strconv.Atoi(params.Get("topic")); err == nil {
+		requestData.Topic = &topic
+	}
+	if params.Has("priors") {
+		priors := boolParam("priors")
+		requestData.Priors = &priors
+	}
+	return requestData
+}
+
+type SearchResponse struct {
+	TookMs    float64 `json:"tookMs"`
+	TotalHits int     `json:"totalHits"` // results before the limit
+	MaxScore  float64 `json:"maxScore"`
+	Language  string  `json:"language,omitempty"` // of the query analyzer
+	SearchDiagnostics
+
+	Results  []SearchResult `json:"results"`
+	Coverage QueryCoverage  `json:"coverage"`
+
+	// alternative readings of the query, results above are always for the query as typed
+	Ambiguous       bool                  `json:"ambiguous"`
+	Interpretations []QueryInterpretation `json:"interpretations,omitempty"`
+
+	// spelling suggestions for query terms that are not in the vocabulary
+	DidYouMean    string               `json:"didYouMean,omitempty"`
+	Suggestions   []SpellingSuggestion `json:"suggestions,omitempty"`
+	AutoCorrected bool                 `json:"autoCorrected,omitempty"` // results are for didYouMean
+
+	// metadata field -> value -> number of results having it, on request
+	Facets map[string]map[string]int `json:"facets,omitempty"`
+
+	// all results grouped by file name prefix, best group first, on request
+	Groups []ResultGroup `json:"groups,omitempty"`
+
+	// +required and -excluded terms of the query, when it has any
+	Operators *TermOperators `json:"operators,omitempty"`
+
+	// query actually searched after phonetic and synonym expansion, when they added terms
+	ExpandedQuery string `json:"expandedQuery,omitempty"`
+
+	// reranking outcome, on request; the original ranking is kept when it failed
+	Reranked    bool   `json:"reranked,omitempty"`
+	RerankError string `json:"rerankError,omitempty"`
+
+	// best matching passages, on request
+	Passages []PassageResult `json:"passages,omitempty"`
+
+	// results of the query expanded by pseudo-relevance feedback, on request
+	Expansion *QueryExpansion `json:"expansion,omitempty"`
+}
+
+var state = SystemState{
+	Documents:     []Document{},
+	Analysis:      engine.DefaultAnalysisConfig,
+	Labels:        map[string]string{},
+	Metadata:      map[string]DocumentMetadata{},
+	MetadataTypes: map[string]string{},
+	Synonyms:      newSynonymConfig([][]string{}, false),
+	Templates:     map[string]QueryTemplate{},
+	ResultSets:    map[string]ResultSet{},
+	Collections:   map[string]*materializedCollection{},
+
+	PassageConfig: defaultPassageConfig,
+	Dedup:         defaultDedupConfig,
+	Fetcher:       defaultFetcherConfig,
+	Uploads:       defaultUploadConfig,
+	feeds:         map[string]*feed{},
+
+	Embedder:   defaultEmbedderConfig,
+	Embeddings: map[string][]float32{},
+	Reranker:   defaultRerankerConfig,
+
+	LTRExamples: []LTRExample{},
+
+	EvalQueries: []EvalQuery{},
+	Qrels:       map[string]map[string]int{},
+
+	Clicks:      []ClickEvent{},
+	Impressions: map[string]int{},
+
+	Versions: map[string]*versionHistory{},
+
+	store:    memoryStore{},
+	segments: segment.NewSet(),
+}
 
 func main() {
-	http.HandleFunc("/", indexHandler)
-	http.HandleFunc("/api/upload-doc", uploadDocHandler)
-	http.HandleFunc("/api/clear-docs", clearDocsHandler)
-	http.HandleFunc("/api/search", searchHandler)
+	demo := flag.Bool("demo", false, "index the bundled demo corpus on startup")
+	queryLogPath := flag.String("query-log", "query_log.jsonl", "file the searches are appended to, empty to keep them in memory")
+	storage := flag.String("storage", "memory", "document store: memory, or sqlite or kv to keep the corpus across restarts with the text out of memory")
+	dataDir := flag.String("data-dir", "data", "directory of the sqlite and kv stores")
+	segmentDir := flag.String("segments", "", "directory for memory-mapped boolean index segments, empty to keep them in memory")
+	flushInterval := flag.Duration("flush-interval", 5*time.Second, "how often newly indexed documents are flushed into an index segment")
+	grpcAddr := flag.String("grpc-addr", ":9090", "address of the gRPC services, empty to disable them")
+	biwords := flag.Bool("biwords", false, "index adjacent term pairs so two-word phrase searches need no scan")
+	flag.Parse()
+
+	if *biwords {
+		state.biwords = newBiwordIndex()
+	}
+
+	store, err := openStore(*storage, *dataDir)
+	if err != nil {
+		fmt.Println("Error opening store:", err)
+		return
+	}
+	defer store.Close()
+	state.store = store
+	segments, err := openSegments(*segmentDir)
+	if err != nil {
+		fmt.Println("Error opening index segments:", err)
+		return
+	}
+	defer segments.Close()
+	state.segments = segments
+	if err := restoreDocuments(); err != nil {
+		fmt.Println("Error loading stored documents:", err)
+		return
+	}
+	segments.Start(*flushInterval)
+
+	queryLog, err := openQueryLog(*queryLogPath)
+	if err != nil {
+		fmt.Println("Error opening query log:", err)
+		return
+	}
+	state.queryLog = queryLog
+
+	if *demo {
+		if errorMessages, _ := loadDemoCorpus(); len(errorMessages) > 0 {
+			fmt.Println("Demo corpus skipped files:", strings.Join(errorMessages, "; "))
+		}
+	}
+
+	registerRoutes(http.DefaultServeMux, apiRoutes())
+
+	if *grpcAddr != "" {
+		go func() {
+			fmt.Println("gRPC services listening on", *grpcAddr)
+			if err := newGRPCServer().ListenAndServe(*grpcAddr); err != nil {
+				fmt.Println("Error starting gRPC server:", err)
+			}
+		}()
+	}
 
 	fmt.Println("Server started at http://localhost:8080")
 	if err := http.ListenAndServe(":8080", nil); err != nil {
@@ -52,7 +352,7 @@ func main() {
 func indexHandler(w http.ResponseWriter, r *http.Request) {
 	tmpl, err := template.ParseFiles("index.html")
 	if err != nil {
-		http.Error(w, "Could not load index.html", http.StatusInternalServerError)
+		apierror.Error(w, "Could not load index.html", http.StatusInternalServerError)
 		return
 	}
 	tmpl.Execute(w, nil)
@@ -61,108 +361,735 @@ func indexHandler(w http.ResponseWriter, r *http.Request) {
 // saves the document content from uploaded files
 func uploadDocHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	r.ParseMultipartForm(10 << 20)
-	files := r.MultipartForm.File["documents"]
+	state.Lock()
+	config, limits := currentIndexConfig(), state.Uploads
+	state.Unlock()
+
+	// read and analyze the files as they stream in, outside the lock, and
+	// store each batch as it is done
+	var uploadErrors []apierror.Detail
+	var uploaded int
+	var storeErr error
+	err := streamUploads(r, config, limits, func(batch []analyzedUpload) {
+		if storeErr != nil {
+			return
+		}
+		var batchErrors []apierror.Detail
+		batchErrors, storeErr = storeBatch(batch)
+		uploaded += len(batch)
+		uploadErrors = append(uploadErrors, batchErrors...)
+	})
+	var tooLarge *tooLargeError
+	if errors.As(err, &tooLarge) {
+		apierror.Write(w, http.StatusRequestEntityTooLarge, "too_large", fmt.Sprintf("The upload is larger than %d MB.", tooLarge.limit))
+		return
+	}
+	if err != nil {
+		apierror.Error(w, "Error: Expected a multipart form with the files as 'documents'.", http.StatusBadRequest)
+		return
+	}
+	writeUploadResult(w, uploaded, uploadErrors, storeErr)
+}
 
+// screens and stores the analyzed uploads with the metadata they carried and
+// answers with the document names and the errors per file or row
+func storeUploads(w http.ResponseWriter, analyzed []analyzedUpload) {
+	uploadErrors, err := storeBatch(analyzed)
+	writeUploadResult(w, len(analyzed), uploadErrors, err)
+}
+
+// screens and stores a batch of analyzed uploads with the metadata they
+// carried; returns the errors per file or row, and the error of the store
+func storeBatch(analyzed []analyzedUpload) ([]apierror.Detail, error) {
 	state.Lock()
 	defer state.Unlock()
 
-	var errorMessages []string
+	var uploadErrors []apierror.Detail
+	var docs []Document
+	metadata := map[string]DocumentMetadata{}
+	for _, upload := range analyzed {
+		doc, err := upload.doc, upload.err
+		if err == nil {
+			doc, err = screenDuplicate(doc, docs)
+		}
+		if err == nil && upload.metadata != nil {
+			err = checkMetadataTypes(upload.metadata)
+		}
+		if err != nil {
+			uploadErrors = append(uploadErrors, apierror.DetailOf(upload.name, err, "read_error"))
+			continue
+		}
+		docs = append(docs, doc)
+		if upload.metadata != nil {
+			metadata[doc.Name] = upload.metadata
+		}
+	}
+	added, err := insertDocuments(docs)
+	if err != nil {
+		return uploadErrors, err
+	}
+	for _, doc := range added {
+		if fields, ok := metadata[doc.Name]; ok {
+			state.Metadata[doc.Name] = fields
+		}
+	}
+	return uploadErrors, nil
+}
 
-	for _, fileHeader := range files {
-		func() {
-			file, err := fileHeader.Open()
-			if err != nil {
-				errorMessages = append(errorMessages, fmt.Sprintf("Error opening %s", fileHeader.Filename))
-				return
-			}
-			defer file.Close()
+// answers an upload of the given number of files or rows with the document
+// names and the errors per file or row
+func writeUploadResult(w http.ResponseWriter, uploaded int, uploadErrors []apierror.Detail, storeErr error) {
+	if storeErr != nil {
+		apierror.Error(w, "Error: Could not store the documents: "+storeErr.Error(), http.StatusInternalServerError)
+		return
+	}
+	if uploaded > 0 && len(uploadErrors) == uploaded {
+		apierror.Write(w, http.StatusBadRequest, "upload_failed", "None of the files could be indexed.", uploadErrors...)
+		return
+	}
 
-			contentBytes, err := io.ReadAll(file)
-			if err != nil {
-				errorMessages = append(errorMessages, fmt.Sprintf("Error reading %s", fileHeader.Filename))
-				return
-			}
+	state.Lock()
+	defer state.Unlock()
+	response := map[string]interface{}{
+		"documents": documentNames(),
+		"errors":    uploadErrors,
+	}
 
-			content := strings.ToLower(string(contentBytes))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
 
-			if len(strings.TrimSpace(content)) == 0 {
-				errorMessages = append(errorMessages, fmt.Sprintf("File '%s' is empty", fileHeader.Filename))
-				return
-			}
+// tokenizes the stream and stores it as a new document (caller holds the lock)
+func addDocument(name string, r io.Reader) error {
+	doc, err := analyzeDocument(name, r, currentIndexConfig())
+	if err != nil {
+		return err
+	}
+	_, err = insertDocument(doc)
+	return err
+}
 
-			// validation characters: a-z, 0-9, whitespace, newlines
-			if !validationRegex.MatchString(content) {
-				errorMessages = append(errorMessages, fmt.Sprintf("File '%s' ignored: invalid characters.", fileHeader.Filename))
-				return // continue
-			}
+// indexConfig is the configuration documents are analyzed with, copied under
+// the lock so the analysis runs without it
+type indexConfig struct {
+	analysis engine.AnalysisConfig
+	passages PassageConfig
+	biwords  bool // the biword index is enabled
+}
 
-			// check for duplicates by name
-			for _, doc := range state.Documents {
-				if doc.Name == fileHeader.Filename {
-					return
-				}
-			}
-			state.Documents = append(state.Documents, Document{
-				Name:    fileHeader.Filename,
-				Content: content,
-			})
-		}()
+// the configuration new documents are analyzed with (caller holds the lock)
+func currentIndexConfig() indexConfig {
+	return indexConfig{analysis: state.Analysis, passages: state.PassageConfig, biwords: state.biwords != nil}
+}
+
+// tokenizes the stream into a document with everything the index derives from
+// its text; safe to call without the lock
+func analyzeDocument(name string, r io.Reader, config indexConfig) (Document, error) {
+	doc, err := analyzeTerms(name, r, config.analysis)
+	if err != nil {
+		return Document{}, err
 	}
+	enrichDocument(&doc, config)
+	return doc, nil
+}
 
-	docNames := []string{}
-	for _, d := range state.Documents {
-		docNames = append(docNames, d.Name)
+// tokenizes the stream into a document of terms only, for text that is not indexed
+func analyzeTerms(name string, r io.Reader, config engine.AnalysisConfig) (Document, error) {
+	analyzed, err := engine.Analyze(name, r, config)
+	if err != nil {
+		return Document{}, err
 	}
+	return Document{
+		Name:     name,
+		Content:  analyzed.Content,
+		Raw:      analyzed.Raw,
+		TermFreq: analyzed.TermFreq,
+		Length:   analyzed.Length,
+		Uploaded: time.Now(),
+		Language: analyzed.Language,
+	}, nil
+}
 
-	response := map[string]interface{}{
-		"documents": docNames,
-		"errors":    errorMessages,
+// splits the document into passages and sentences, fingerprints it, extracts
+// its entities and counts its biwords; safe to call without the lock
+func enrichDocument(doc *Document, config indexConfig) {
+	doc.Passages = splitPassages(*doc, config.passages)
+	doc.Fingerprint = engine.SimHash(doc.TermFreq)
+	text := searchableText(*doc)
+	doc.Sentences = sentenceSpans(text)
+	doc.Entities = extractEntities(text)
+	if config.biwords {
+		doc.biwords = biwordCounts(doc.content())
+	}
+}
+
+// stores an analyzed document unless one with the same name exists (caller holds the lock)
+func insertDocument(doc Document) (bool, error) {
+	added, err := insertDocuments([]Document{doc})
+	return len(added) == 1, err
+}
+
+// stores the analyzed documents as one batch, skipping names that already exist;
+// returns the documents added; when the store fails none of them is indexed
+// (caller holds the lock)
+func insertDocuments(docs []Document) ([]Document, error) {
+	added := []Document{}
+	seen := make(map[string]bool)
+	for _, doc := range docs {
+		if documentIndex(doc.Name) < 0 && !seen[doc.Name] {
+			seen[doc.Name] = true
+			added = append(added, doc)
+		}
+	}
+	if len(added) == 0 {
+		return added, nil
+	}
+
+	// the IDs are given before the save, the store keeps them as the documents'
+	// sequence; nextID only moves on once the batch is stored
+	for i := range added {
+		added[i].id = state.nextID + i
+	}
+	if err := state.store.SaveDocuments(added); err != nil {
+		return nil, err
+	}
+	_, offloads := state.store.(textLoader)
+	for _, doc := range added {
+		doc.stored = offloads
+		indexStoredDocument(doc)
+	}
+	return added, nil
+}
+
+// adds a document to the working set without persisting it (caller holds the lock)
+func indexStoredDocument(doc Document) {
+	state.Documents = append(state.Documents, prepareDocument(doc))
+	documentAdded(len(state.Documents) - 1)
+}
+
+// expands and indexes an analyzed and persisted document for the working set;
+// the text was split and counted by enrichDocument beforehand (caller holds the lock)
+func prepareDocument(doc Document) Document {
+	if state.Synonyms.ExpandIndex {
+		expandDocumentSynonyms(&doc, state.Synonyms)
+	}
+	// restored documents keep their stored ID
+	doc.id = max(doc.id, state.nextID)
+	state.nextID = doc.id + 1
+	if state.biwords != nil {
+		state.biwords.add(doc.id, doc.biwords)
+	}
+	doc.biwords = nil
+	if doc.stored {
+		doc.Content, doc.Raw = "", ""
+	}
+	state.segments.Buffer(doc.id, doc.TermFreq)
+	return doc
+}
+
+// normalized text of the document, read from the store when it is not kept in memory
+func (doc Document) content() string {
+	content, _ := doc.text()
+	return content
+}
+
+// text as uploaded, read from the store when it is not kept in memory
+func (doc Document) raw() string {
+	_, raw := doc.text()
+	return raw
+}
+
+func (doc Document) text() (string, string) {
+	if !doc.stored || doc.Content != "" || doc.Raw != "" {
+		return doc.Content, doc.Raw
+	}
+	loader, ok := state.store.(textLoader)
+	if !ok {
+		return "", ""
 	}
+	content, raw, err := loader.LoadText(doc.Name)
+	if err != nil {
+		fmt.Println("Error reading stored text:", doc.Name, err)
+	}
+	return content, raw
+}
 
+// answers /api/search?mode=boolean with the matching document names (caller holds the lock)
+func booleanSearchHandler(w http.ResponseWriter, r *http.Request, requestData SearchRequest, inSubset func(string) bool, started time.Time) {
+	names, plan, err := booleanSearch(requestData.Query)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_query", "Invalid query: "+err.Error())
+		return
+	}
+
+	results := []SearchResult{}
+	for _, name := range names {
+		if inSubset(name) {
+			results = append(results, SearchResult{FileName: name, Score: 1})
+		}
+	}
+	sortResults(results, requestData.Sort, requestData.Order)
+	totalHits := len(results)
+	if requestData.Limit > 0 && len(results) > requestData.Limit {
+		results = results[:requestData.Limit]
+	}
+	logQuery(requestData.Query, "boolean", started, results)
+	if format := negotiateFormat(w, r); format != "json" {
+		writeTable(w, format, resultsTable(results))
+		return
+	}
+
+	response := BooleanSearchResponse{TotalHits: totalHits, Results: []string{}}
+	for _, result := range results {
+		response.Results = append(response.Results, result.FileName)
+	}
+	if requestData.Plan {
+		response.Plan = plan
+	}
+	response.TookMs = float64(time.Since(started).Microseconds()) / 1000
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// matches document names against the "docs" of a search, exact names or
+// path.Match globs; every name matches when there are none
+func documentSubset(patterns []string) (func(string) bool, error) {
+	names := map[string]bool{}
+	globs := []string{}
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, `*?[\`) {
+			names[pattern] = true
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("Invalid document pattern '%s'.", pattern)
+		}
+		globs = append(globs, pattern)
+	}
+	return func(name string) bool {
+		if len(patterns) == 0 || names[name] {
+			return true
+		}
+		for _, glob := range globs {
+			if matched, _ := path.Match(glob, name); matched {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// ResultGroup aggregates the results sharing a file name prefix
+type ResultGroup struct {
+	Key        string       `json:"key"` // the prefix, "" for names without the delimiter
+	Hits       int          `json:"hits"`
+	MaxScore   float64      `json:"maxScore"`
+	TotalScore float64      `json:"totalScore"`
+	MeanScore  float64      `json:"meanScore"`
+	Top        SearchResult `json:"top"` // best hit of the group
+}
+
+// groups results by the name up to the last delimiter, the group with the best
+// hit first
+func groupResults(results []SearchResult, delimiter string) []ResultGroup {
+	if delimiter == "" {
+		delimiter = "/"
+	}
+	groups := []ResultGroup{}
+	byKey := map[string]int{}
+	for _, result := range results {
+		key := ""
+		if i := strings.LastIndex(result.FileName, delimiter); i >= 0 {
+			key = result.FileName[:i]
+		}
+		g, ok := byKey[key]
+		if !ok {
+			g = len(groups)
+			byKey[key] = g
+			groups = append(groups, ResultGroup{Key: key, MaxScore: result.Score, Top: result})
+		}
+		group := &groups[g]
+		group.Hits++
+		group.TotalScore += result.Score
+		if result.Score > group.MaxScore {
+			group.MaxScore, group.Top = result.Score, result
+		}
+	}
+	for i := range groups {
+		groups[i].MeanScore = groups[i].TotalScore / float64(groups[i].Hits)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].MaxScore > groups[j].MaxScore })
+	return groups
+}
+
+// the distinct terms of the query as the index holds them, each word run
+// through the analysis pipeline of the documents; stop words and the words
+// the character policy rejects give none (caller holds the lock)
+func indexTerms(query string) map[string]bool {
+	terms := map[string]bool{}
+	for _, word := range strings.Fields(query) {
+		analyzed, err := engine.Analyze("query", strings.NewReader(word), state.Analysis)
+		if err != nil {
+			continue
+		}
+		for term := range analyzed.TermFreq {
+			terms[term] = true
+		}
+	}
+	return terms
+}
+
+// keeps the results scoring at least minScore (when set) whose documents contain
+// at least minimumShouldMatch of the query terms (caller holds the lock)
+func filterResults(results []SearchResult, terms map[string]bool, minScore *float64, minimumShouldMatch int) []SearchResult {
+	if minScore == nil && minimumShouldMatch == 0 {
+		return results
+	}
+	docs := make(map[string]Document, len(state.Documents))
+	for _, doc := range state.Documents {
+		docs[doc.Name] = doc
+	}
+
+	kept := results[:0]
+	for _, result := range results {
+		if minScore != nil && result.Score < *minScore {
+			continue
+		}
+		matched := 0
+		for term := range terms {
+			if docs[result.FileName].TermFreq[term] > 0 {
+				matched++
+			}
+		}
+		if matched >= minimumShouldMatch {
+			kept = append(kept, result)
+		}
+	}
+	return kept
+}
+
+// reorders results by "score", "name", "length" or "uploadedAt"; the sort is
+// stable, so ties stay in relevance order (caller holds the lock)
+func sortResults(results []SearchResult, by, order string) {
+	if by == "" {
+		return
+	}
+	docs := make(map[string]Document, len(state.Documents))
+	for _, doc := range state.Documents {
+		docs[doc.Name] = doc
+	}
+	ascending := order == "asc" || order == "" && by == "name"
+	compare := func(a, b SearchResult) int {
+		switch by {
+		case "name":
+			return strings.Compare(a.FileName, b.FileName)
+		case "length":
+			return docs[a.FileName].Length - docs[b.FileName].Length
+		case "uploadedAt":
+			return docs[a.FileName].Uploaded.Compare(docs[b.FileName].Uploaded)
+		}
+		return cmp.Compare(a.Score, b.Score)
+	}
+	slices.SortStableFunc(results, func(a, b SearchResult) int {
+		if ascending {
+			return compare(a, b)
+		}
+		return compare(b, a)
+	})
+}
+
+// builds a document from already normalized terms, e.g. for the query
+func newTermsDocument(name string, terms []string) Document {
+	doc := Document{
+		Name:     name,
+		Content:  strings.Join(terms, " "),
+		TermFreq: make(map[string]int),
+		Length:   len(terms),
+	}
+	for _, t := range terms {
+		doc.TermFreq[t]++
+	}
+	return doc
+}
+
+// names of all uploaded documents in upload order
+func documentNames() []string {
+	docNames := []string{}
+	for _, d := range state.Documents {
+		docNames = append(docNames, d.Name)
+	}
+	return docNames
+}
+
 func clearDocsHandler(w http.ResponseWriter, r *http.Request) {
 	state.Lock()
 	defer state.Unlock()
 
+	if err := state.store.Clear(); err != nil {
+		apierror.Error(w, "Error: Could not clear the store: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := state.segments.Reset(); err != nil {
+		apierror.Error(w, "Error: Could not clear the index segments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 	state.Documents = []Document{}
+	state.nextID = 0
+	resetBiwords()
+	state.Versions = map[string]*versionHistory{}
+	state.Labels = map[string]string{}
+	state.Metadata = map[string]DocumentMetadata{}
+	state.Embeddings = map[string][]float32{}
+	invalidateCaches()
 	w.WriteHeader(http.StatusOK)
 }
 
-// searchHandler processes the search query
+// searchHandler processes the search query, sent as JSON in a POST or as
+// GET /api/search?q=...&limit=10&mode=boolean so searches can be linked
 func searchHandler(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
 	state.Lock()
 	defer state.Unlock()
 
 	if len(state.Documents) == 0 {
-		http.Error(w, "Error: No documents uploaded. Please add documents first.", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "no_documents", "No documents uploaded. Please add documents first.")
 		return
 	}
 
-	var requestData struct {
-		Query string `json:"query"`
+	var requestData SearchRequest
+	switch r.Method {
+	case http.MethodGet:
+		requestData = searchRequestFromURL(r)
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	inDocs, err := documentSubset(requestData.Docs)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_value", err.Error())
+		return
+	}
+	ranges, err := compileRanges(requestData.Ranges)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_value", err.Error())
+		return
+	}
+	inTopic, err := topicSubset(requestData.Topic)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_value", err.Error())
+		return
+	}
+	mode := r.URL.Query().Get("mode")
+	// regex and substring searches run on the text as uploaded, the others on
+	// terms, where entity: and field: filters are taken out of the query
+	var entities []string
+	var fields map[string][]string
+	if mode != "regex" && mode != "substring" {
+		requestData.Query, entities = parseEntityFilters(requestData.Query)
+		requestData.Query, fields = parseFieldFilters(requestData.Query)
+		requestData.Query = normalizeQuery(requestData.Query)
+	}
+	inSubset := func(name string) bool {
+		return inDocs(name) && matchesFacetFilters(name, requestData.Filters) && matchesRanges(name, ranges) &&
+			hasEntities(name, entities) && matchesFieldFilters(name, fields) && inTopic(name)
 	}
-	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	switch mode {
+	case "", "ranked":
+	case "boolean":
+		booleanSearchHandler(w, r, requestData, inSubset, started)
+		return
+	case "regex":
+		regexSearchHandler(w, r, requestData, inSubset, started)
+		return
+	case "substring":
+		substringSearchHandler(w, r, requestData, inSubset, started)
+		return
+	case "phrase":
+		phraseSearchHandler(w, r, requestData, inSubset, started)
+		return
+	case "sentence":
+		sentenceSearchHandler(w, r, requestData, inSubset, started)
+		return
+	default:
+		apierror.Error(w, "Error: mode must be 'boolean', 'regex', 'substring', 'phrase', 'sentence' or 'ranked'.", http.StatusBadRequest)
+		return
+	}
+	if requestData.Phonetic != "" && requestData.Phonetic != "soundex" && requestData.Phonetic != "metaphone" {
+		apierror.Error(w, "Error: phonetic must be 'soundex' or 'metaphone'.", http.StatusBadRequest)
+		return
+	}
+	if requestData.ClickBoost < 0 {
+		apierror.Error(w, "Error: clickBoost must not be negative.", http.StatusBadRequest)
+		return
+	}
+	if requestData.Diversify != nil && (*requestData.Diversify < 0 || *requestData.Diversify > 1) {
+		apierror.Error(w, "Error: diversify must be between 0 and 1.", http.StatusBadRequest)
 		return
 	}
 
-	response := search(requestData.Query)
+	typed, operators := parseTermOperators(requestData.Query)
+	typed, boosts := parseBoosts(typed)
+	rewriting := queryRewriting{typed: typed}
+	analyzer, analyzed := queryAnalyzer(requestData.Language, typed)
+	if analyzed {
+		rewriting.analyzer = &analyzer
+		typed, boosts, operators = analyzeQuery(typed, boosts, operators, analyzer)
+	}
+	query := typed
+	suggestions, didYouMean := spellingSuggestions(query)
+	if requestData.AutoCorrect && didYouMean != "" {
+		query = didYouMean
+	}
+	corrected := query
+	if requestData.Phonetic != "" {
+		query, _ = expandPhonetic(query, requestData.Phonetic)
+	}
+	if requestData.Synonyms == nil || *requestData.Synonyms {
+		query, _ = expandSynonyms(query, state.Synonyms)
+	}
+	rewriting.corrected, rewriting.searched = corrected, query
+
+	// the ranking and the reranking run over a view of the collection with the
+	// lock released; the results are then filtered and decorated with the state
+	// as it is when the lock is taken back
+	view, err := snapshotCorpus(requestData.Ranker)
+	var results []SearchResult
+	var rerankErr error
+	if err == nil {
+		state.Unlock()
+		results, err = view.rank(requestData.Ranker, withBoosts(query, boosts), requestData.Hybrid)
+		if err == nil && requestData.Rerank {
+			results, rerankErr = view.rerank(query, results)
+		}
+		state.Lock()
+	}
+	if err != nil {
+		apierror.Error(w, "Error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	results = liveResults(results)
+	if requestData.ClickBoost > 0 {
+		results = applyClickBoost(results, requestData.ClickBoost)
+	}
+	if state.Priors.enabled() && (requestData.Priors == nil || *requestData.Priors) {
+		results = applyPriors(results, state.Priors, requestData.Explain)
+	}
+	allowed := operators.allowed()
+	results = slices.DeleteFunc(results, func(result SearchResult) bool {
+		return allowed != nil && !allowed[result.FileName] || !inSubset(result.FileName)
+	})
+	// the terms to match are the typed ones, or the corrections, which are
+	// terms of the index already, but never the expansions
+	var shouldMatch map[string]bool
+	switch {
+	case requestData.MinimumShouldMatch == 0:
+	case requestData.AutoCorrect && didYouMean != "":
+		shouldMatch = map[string]bool{}
+		for _, term := range strings.Fields(corrected) {
+			shouldMatch[term] = true
+		}
+	default:
+		shouldMatch = indexTerms(rewriting.typed)
+	}
+	results = filterResults(results, shouldMatch, requestData.MinScore, requestData.MinimumShouldMatch)
+	if requestData.Diversify != nil {
+		results = diversifyResults(results, *requestData.Diversify)
+	}
+	sortResults(results, requestData.Sort, requestData.Order)
+	totalHits, maxScore := len(results), 0.0
+	for i, result := range results {
+		if i == 0 || result.Score > maxScore { // language model scores are negative
+			maxScore = result.Score
+		}
+	}
+	var facets map[string]map[string]int
+	if len(requestData.Facets) > 0 {
+		facets = facetCounts(results, requestData.Facets)
+	}
+	var groups []ResultGroup
+	if requestData.GroupBy == "prefix" {
+		groups = groupResults(results, requestData.GroupDelimiter)
+	}
+	if requestData.Limit > 0 && len(results) > requestData.Limit {
+		results = results[:requestData.Limit]
+	}
+	recordImpressions(results)
+	if requestData.Explain && (requestData.Ranker == "" || requestData.Ranker == "cosine") {
+		for i, result := range results {
+			if j := documentIndex(result.FileName); j >= 0 {
+				results[i].Explanation = explainCosine(withBoosts(query, boosts), state.Documents[j])
+			}
+		}
+	}
+
+	response := SearchResponse{
+		TotalHits:         totalHits,
+		MaxScore:          maxScore,
+		Language:          analyzer.Language,
+		SearchDiagnostics: searchDiagnostics(requestData.Ranker, query),
+		Results:           results,
+		Groups:            groups,
+		Facets:            facets,
+		Coverage:          queryCoverage(rewriting),
+	}
+	if requestData.Interpretations {
+		response.Interpretations = queryInterpretations(typed)
+		response.Ambiguous = isAmbiguous(response.Interpretations)
+	}
+	if len(operators.Required)+len(operators.Excluded) > 0 {
+		response.Operators = &operators
+	}
+	response.DidYouMean, response.Suggestions = didYouMean, suggestions
+	response.AutoCorrected = requestData.AutoCorrect && didYouMean != ""
+	if query != corrected {
+		response.ExpandedQuery = query
+	}
+	if requestData.Rerank {
+		response.Reranked = rerankErr == nil
+		if rerankErr != nil {
+			response.RerankError = rerankErr.Error()
+			fmt.Println("Reranking failed, keeping the original ranking:", rerankErr)
+		}
+	}
+	if requestData.Passages {
+		response.Passages = searchPassages(query)
+	}
+	if requestData.PRF != nil {
+		expansion := expandQuery(query, response.Results, *requestData.PRF)
+		response.Expansion = &expansion
+	}
+	logQuery(requestData.Query, requestData.Ranker, started, response.Results)
+	response.TookMs = float64(time.Since(started).Microseconds()) / 1000
+
+	if format := negotiateFormat(w, r); format != "json" {
+		writeTable(w, format, resultsTable(response.Results))
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
 func search(query string) []SearchResult {
+	return cosineSearch(state.Documents, query)
+}
+
+// the cosine ranking over the given documents; reads no other state, so it
+// runs on a view of the collection without the lock
+func cosineSearch(docs []Document, query string) []SearchResult {
 	fmt.Println("Start searching...")
 	results := make([]SearchResult, 0)
 
+	query, boosts := parseBoosts(query)
 	queryTerms := strings.Fields(strings.ToLower(query))
 	if len(queryTerms) == 0 {
 		return results
@@ -171,8 +1098,8 @@ func search(query string) []SearchResult {
 	vocabularyMap := make(map[string]bool)
 
 	// add terms from all documents
-	for _, doc := range state.Documents {
-		for t := range strings.FieldsSeq(doc.Content) {
+	for _, doc := range docs {
+		for t := range doc.TermFreq {
 			vocabularyMap[t] = true
 		}
 	}
@@ -189,26 +1116,23 @@ func search(query string) []SearchResult {
 	}
 
 	// create a dummy document for the query to reuse calculateTF
-	queryDoc := Document{
-		Name:    "query" + fmt.Sprint(time.Now().Unix()),
-		Content: strings.Join(queryTerms, " "),
-	}
+	queryDoc := newTermsDocument("query"+fmt.Sprint(time.Now().Unix()), queryTerms)
 
 	// calculate query vector
 	queryVector := make([]float64, len(vocabularyList))
 	for i, term := range vocabularyList {
 		tf := calculateTF(term, queryDoc)
-		idf := calculateIDF(term, state.Documents) // always 1.0
-		queryVector[i] = tf * idf
+		idf := calculateIDF(term, docs) // always 1.0
+		queryVector[i] = tf * idf * boostOf(boosts, term)
 	}
 
 	fmt.Println("Start calculate document vectors and cosine similarity...")
 	// calculate document vectors and cosine similarity
-	for _, doc := range state.Documents {
+	for _, doc := range docs {
 		docVector := make([]float64, len(vocabularyList))
 		for i, term := range vocabularyList {
 			tf := calculateTF(term, doc)
-			idf := calculateIDF(term, state.Documents) // always 1.0
+			idf := calculateIDF(term, docs) // always 1.0
 			docVector[i] = tf * idf
 		}
 
@@ -232,22 +1156,13 @@ func search(query string) []SearchResult {
 }
 
 func calculateTF(term string, doc Document) float64 {
-	terms := strings.Fields(doc.Content)
-	totalTerms := len(terms)
+	totalTerms := doc.Length
 	if totalTerms == 0 {
 		return 0.0 // prevent division by zero
 	}
 
-	termCount := 0
-	// count occurrences of the specific term
-	for _, t := range terms {
-		if t == term {
-			termCount++
-		}
-	}
-
 	//  term occurrences in doc / total terms in doc
-	return float64(termCount) / float64(totalTerms)
+	return float64(doc.TermFreq[term]) / float64(totalTerms)
 }
 
 // unary inverse document frequency
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var (
+	atxHeading     = regexp.MustCompile(`^ {0,3}(#{1,6})(?:\s+(.*?))?(?:\s+#+)?\s*$`)
+	setextUnder    = regexp.MustCompile(`^ {0,3}(=+|-+)\s*$`)
+	thematicBreak  = regexp.MustCompile(`^ {0,3}([-*_])(?:\s*([-*_]))(?:\s*([-*_]))+\s*$`)
+	fenceLine      = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+	listMarker     = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+(?:\[[ xX]\]\s+)?`)
+	tableDivider   = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(?:\|\s*:?-+:?\s*)*\|?\s*$`)
+	referenceLink  = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:\s*\S+`)
+	imageOrLink    = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)|!?\[([^\]]*)\]\[[^\]]*\]`)
+	autolink       = regexp.MustCompile(`<((?:https?|mailto):[^>\s]+)>`)
+	inlineHTML     = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	starEmphasis   = regexp.MustCompile(`(?:\*\*|~~|\*)(\S(?:.*?\S)?)(?:\*\*|~~|\*)`)
+	underEmphasis  = regexp.MustCompile(`(^|\W)_{1,2}(\S(?:.*?\S)?)_{1,2}(\W|$)`) // not inside snake_case words
+	inlineCode     = regexp.MustCompile("`+([^`]*)`+")
+	frontMatterKey = regexp.MustCompile(`^title:\s*["']?(.*?)["']?\s*$`)
+)
+
+// A Markdown section: a heading and the text up to the next heading
+type markdownSection struct {
+	heading string
+	lines   []string
+}
+
+// splitMarkdown strips the formatting of a Markdown file, keeping the text of
+// links, emphasis and code; the headings become the "sections" field, the
+// first top-level one (or a front matter title) the "title" field, and the
+// document remembers where each section starts for section passages
+func splitMarkdown(name string, r io.Reader) ([]archivedDocument, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 10<<20)
+
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	title := ""
+	start := 0
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) == "---" {
+		for i := 1; i < len(lines); i++ {
+			if t := strings.TrimSpace(lines[i]); t == "---" || t == "..." {
+				start = i + 1
+				break
+			}
+			if m := frontMatterKey.FindStringSubmatch(lines[i]); m != nil {
+				title = m[1]
+			}
+		}
+	}
+
+	sections := []markdownSection{{}}
+	fence := ""
+	for i := start; i < len(lines); i++ {
+		line := lines[i]
+		current := &sections[len(sections)-1]
+		if fence != "" {
+			if strings.HasPrefix(strings.TrimSpace(line), fence) {
+				fence = ""
+			} else {
+				current.lines = append(current.lines, line)
+			}
+			continue
+		}
+		if m := fenceLine.FindStringSubmatch(line); m != nil {
+			fence = m[1][:3]
+			continue
+		}
+
+		level, heading := 0, ""
+		if m := atxHeading.FindStringSubmatch(line); m != nil {
+			level, heading = len(m[1]), m[2]
+		} else if i+1 < len(lines) && strings.TrimSpace(line) != "" && !listMarker.MatchString(line) && setextUnder.MatchString(lines[i+1]) {
+			level, heading = 2, line
+			if strings.HasPrefix(strings.TrimSpace(lines[i+1]), "=") {
+				level = 1
+			}
+			i++
+		}
+		if level > 0 {
+			heading = inlineText(heading)
+			if title == "" && level == 1 {
+				title = heading
+			}
+			sections = append(sections, markdownSection{heading: heading})
+			continue
+		}
+
+		switch {
+		case thematicBreak.MatchString(line), tableDivider.MatchString(line) && strings.Contains(line, "-"), referenceLink.MatchString(line):
+			continue
+		}
+		line = strings.TrimLeft(line, " \t")
+		for strings.HasPrefix(line, ">") {
+			line = strings.TrimLeft(line[1:], " ")
+		}
+		line = listMarker.ReplaceAllString(line, "")
+		line = strings.ReplaceAll(strings.Trim(line, "|"), "|", " ")
+		current.lines = append(current.lines, inlineText(line))
+	}
+
+	fields := DocumentMetadata{}
+	var parts []string
+	var text strings.Builder
+	for _, section := range sections {
+		var part strings.Builder
+		if section.heading != "" {
+			part.WriteString(section.heading + "\n")
+			fields["sections"] = append(fields["sections"], section.heading)
+		}
+		for _, line := range section.lines {
+			if line = strings.TrimSpace(line); line != "" {
+				part.WriteString(line + "\n")
+			}
+		}
+		if part.Len() == 0 {
+			continue
+		}
+		parts = append(parts, part.String())
+		text.WriteString(part.String())
+	}
+	if title == "" && len(fields["sections"]) > 0 {
+		title = fields["sections"][0]
+	}
+	if title != "" {
+		fields["title"] = []string{title}
+	}
+	if len(fields) == 0 {
+		fields = nil
+	}
+	return []archivedDocument{{name: name, text: text.String(), metadata: fields, sections: parts}}, nil
+}
+
+// the text of a line's inline formatting: links and images by their text,
+// emphasis and code without their markers, HTML tags dropped
+func inlineText(line string) string {
+	line = imageOrLink.ReplaceAllString(line, "$1$2")
+	line = autolink.ReplaceAllString(line, "$1")
+	line = inlineCode.ReplaceAllString(line, "$1")
+	line = inlineHTML.ReplaceAllString(line, " ")
+	for range 3 { // nested emphasis as in ***bold italic***
+		line = starEmphasis.ReplaceAllString(line, "$1")
+		line = underEmphasis.ReplaceAllString(line, "$1$2$3")
+	}
+	line = strings.NewReplacer(`\*`, "*", `\_`, "_", `\#`, "#", `\[`, "[", `\]`, "]", `\`+"`", "`").Replace(line)
+	return strings.Join(strings.Fields(line), " ")
+}
@@ -0,0 +1,61 @@
+package main
+
+// results reordered by Maximal Marginal Relevance; the ones after are appended
+// in their relevance order
+const maxMMRCandidates = 100
+
+// reorders the results by Maximal Marginal Relevance: each next result
+// maximizes lambda * relevance - (1 - lambda) * the highest cosine similarity of
+// its TF-IDF vector to the results already selected, relevance scaled to [0, 1]
+// between the lowest and the top score; lambda 1 keeps the relevance order
+// (caller holds the lock)
+func diversifyResults(results []SearchResult, lambda float64) []SearchResult {
+	n := min(len(results), maxMMRCandidates)
+	if n < 2 {
+		return results
+	}
+
+	cache := documentVectors()
+	positions := make([]int, n)
+	lowest, highest := results[0].Score, results[0].Score
+	for i, result := range results[:n] {
+		positions[i] = documentIndex(result.FileName)
+		lowest, highest = min(lowest, result.Score), max(highest, result.Score)
+	}
+	similarity := func(a, b int) float64 {
+		if positions[a] < 0 || positions[b] < 0 {
+			return 0
+		}
+		i, j := positions[a], positions[b]
+		return sparseCosine(cache.vectors[i], cache.norms[i], cache.vectors[j], cache.norms[j])
+	}
+
+	// redundancy[i] is the highest similarity of candidate i to a selected result
+	redundancy := make([]float64, n)
+	selected := make([]bool, n)
+	order := make([]SearchResult, 0, len(results))
+	for range n {
+		best, bestValue := -1, 0.0
+		for i := range n {
+			if selected[i] {
+				continue
+			}
+			relevance := 1.0
+			if highest > lowest {
+				relevance = (results[i].Score - lowest) / (highest - lowest)
+			}
+			value := lambda*relevance - (1-lambda)*redundancy[i]
+			if best < 0 || value > bestValue {
+				best, bestValue = i, value
+			}
+		}
+		selected[best] = true
+		order = append(order, results[best])
+		for i := range n {
+			if !selected[i] {
+				redundancy[i] = max(redundancy[i], similarity(i, best))
+			}
+		}
+	}
+	return append(order, results[n:]...)
+}
@@ -0,0 +1,892 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ir/internal/apierror"
+	"ir/internal/engine"
+)
+
+const (
+	maxJSONBodySize      = 10 << 20
+	maxValidationDetails = 20
+)
+
+// route is one registered handler; its operations document the methods it
+// accepts and are what GET /api/openapi.json is generated from
+type route struct {
+	Pattern    string // ServeMux pattern, with a method for handlers of a single one
+	Handler    http.HandlerFunc
+	Operations []operation
+}
+
+type operation struct {
+	Method   string
+	Summary  string
+	Body     any    // JSON request body, validated before the handler runs
+	Upload   string // multipart field of uploaded files
+	Text     bool   // the body is plain text
+	Lines    any    // the body is JSON Lines of this type, read by the handler as a stream
+	Params   []param
+	Response any // JSON response body
+}
+
+// param is a query parameter, validated when present
+type param struct {
+	Name        string
+	Type        string // "string", "integer" or "boolean"
+	Description string
+	Minimum     *float64
+	Enum        []string
+}
+
+// schema is the JSON Schema subset the specification and the validation use
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"` // *schema, or false for structs
+	Items                *schema            `json:"items,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+}
+
+// apiSpec holds the generated document and the schemas the requests are checked against
+type apiSpec struct {
+	document   map[string]any
+	components map[string]*schema
+	bodies     map[string]*schema // "METHOD pattern" -> request body schema
+}
+
+var api *apiSpec
+
+// every route of the server; the request and response types are reflected into the specification
+func apiRoutes() []route {
+	return []route{
+		{"/", indexHandler, []operation{{Method: http.MethodGet, Summary: "HTML interface"}}},
+		{"GET /api/openapi.json", openAPIHandler, []operation{{Method: http.MethodGet, Summary: "This specification"}}},
+		{"/api/upload-doc", uploadDocHandler, []operation{
+			{Method: http.MethodPost, Summary: "Upload and index documents; .warc and .warc.gz archives add one document per archived page, .mbox files one per message; .md files are indexed without their formatting, headings kept as sections", Upload: "documents"},
+		}},
+		{"POST /api/bulk", bulkHandler, []operation{
+			{Method: http.MethodPost, Summary: "Index one document per line of a JSON Lines body, reporting the lines that failed", Lines: BulkDocument{}, Response: BulkResponse{}},
+		}},
+		{"POST /api/upload-csv", uploadCSVHandler, []operation{
+			{Method: http.MethodPost, Summary: "Index each row of CSV or TSV files as a document; the form fields idColumn, textColumns, metadataColumns and delimiter map the columns", Upload: "documents"},
+		}},
+		{"/api/clear-docs", clearDocsHandler, []operation{{Method: http.MethodPost, Summary: "Remove all documents"}}},
+		{"GET /api/documents", listDocumentsHandler, []operation{
+			{Method: http.MethodGet, Summary: "The indexed documents", Response: []DocumentEntry{}, Params: []param{formatParam}},
+		}},
+		{"GET /api/documents/lookup", documentLookupHandler, []operation{
+			{Method: http.MethodGet, Summary: "Names of the documents matching a glob", Response: []string{}, Params: []param{
+				{Name: "glob", Type: "string", Description: "matched case-insensitively, e.g. reports/*.txt"},
+			}},
+		}},
+		{"PUT /api/documents/{name}", putDocumentHandler, []operation{
+			{Method: http.MethodPut, Summary: "Create or replace a document, If-Match required to replace", Text: true},
+		}},
+		{"DELETE /api/documents/{name}", deleteDocumentHandler, []operation{
+			{Method: http.MethodDelete, Summary: "Delete a document, If-Match required"},
+		}},
+		{"GET /api/documents/{name}/content", documentContentHandler, []operation{
+			{Method: http.MethodGet, Summary: "Document text", Params: []param{
+				{Name: "original", Type: "boolean", Description: "text as uploaded, before the character filters"},
+			}},
+		}},
+		{"GET /api/documents/{name}/versions", versionsHandler, []operation{
+			{Method: http.MethodGet, Summary: "Version history of a document", Response: []DocumentVersion{}},
+		}},
+		{"GET /api/documents/{name}/versions/{version}", versionTextHandler, []operation{
+			{Method: http.MethodGet, Summary: "Text of a document version"},
+		}},
+		{"GET /api/documents/{name}/diff", versionDiffHandler, []operation{
+			{Method: http.MethodGet, Summary: "Line diff between two versions", Response: DiffResponse{}, Params: []param{
+				{Name: "from", Type: "integer", Minimum: ptr(0.0)},
+				{Name: "to", Type: "integer", Minimum: ptr(0.0)},
+			}},
+		}},
+		{"/api/optimize", optimizeHandler, []operation{
+			{Method: http.MethodPost, Summary: "Merge index segments and purge deleted documents", Response: OptimizeResponse{}},
+		}},
+		{"/api/search", searchHandler, []operation{
+			{Method: http.MethodGet, Summary: "Search the collection with the options as URL parameters", Response: SearchResponse{}, Params: []param{
+				{Name: "q", Type: "string", Description: "the query; field:word and field:\"some words\" filter on stored metadata fields"},
+				{Name: "limit", Type: "integer", Minimum: ptr(0.0), Description: "at most this many results, 0 returns all"},
+				{Name: "mode", Type: "string", Enum: []string{"ranked", "boolean", "regex", "substring", "phrase", "sentence"}},
+				{Name: "ranker", Type: "string"},
+				{Name: "phonetic", Type: "string", Enum: []string{"soundex", "metaphone"}},
+				{Name: "autoCorrect", Type: "boolean"},
+				{Name: "synonyms", Type: "boolean"},
+				{Name: "language", Type: "string", Enum: []string{"auto", "none", "de", "en", "es", "fr"}},
+				{Name: "priors", Type: "boolean", Description: "false ignores the document priors"},
+				{Name: "diversify", Type: "number", Minimum: ptr(0.0), Description: "MMR lambda between 0 and 1"},
+				{Name: "passages", Type: "boolean"},
+				{Name: "rerank", Type: "boolean"},
+				{Name: "plan", Type: "boolean"},
+				{Name: "explain", Type: "boolean"},
+				{Name: "interpretations", Type: "boolean", Description: "include the alternative readings of the query"},
+				{Name: "facets", Type: "string", Description: "metadata field to count values of; repeatable"},
+				{Name: "filter", Type: "string", Description: "field:value the documents must have; repeatable"},
+				{Name: "range", Type: "string", Description: "field:low..high on a number or date field, either bound may be empty; repeatable"},
+				{Name: "topic", Type: "integer", Minimum: ptr(0.0), Description: "dominant topic of the topic model"},
+				{Name: "groupBy", Type: "string", Enum: []string{"prefix"}},
+				{Name: "groupDelimiter", Type: "string", Description: `"/" by default`},
+				{Name: "docs", Type: "string", Description: "restricts the search to a document, a name or a glob; repeatable"},
+				{Name: "minScore", Type: "number"},
+				{Name: "minimumShouldMatch", Type: "integer", Minimum: ptr(0.0)},
+				{Name: "sort", Type: "string", Enum: []string{"score", "name", "length", "uploadedAt"}},
+				{Name: "order", Type: "string", Enum: []string{"asc", "desc"}},
+				formatParam,
+			}},
+			{Method: http.MethodPost, Summary: "Search the collection", Body: SearchRequest{}, Response: SearchResponse{}, Params: []param{
+				{Name: "mode", Type: "string", Enum: []string{"ranked", "boolean", "regex", "substring", "phrase", "sentence"}},
+				formatParam,
+			}},
+		}},
+		{"GET /api/search/live", liveSearchHandler, []operation{
+			{Method: http.MethodGet, Summary: "Server-Sent Events stream of search-as-you-type results", Params: []param{
+				{Name: "k", Type: "integer", Minimum: ptr(1.0)},
+			}},
+		}},
+		{"POST /api/search/live/{session}", livePrefixHandler, []operation{
+			{Method: http.MethodPost, Summary: "Send the text typed so far to a live search stream", Body: LivePrefixRequest{}},
+		}},
+		{"/api/templates", templatesHandler, []operation{
+			{Method: http.MethodGet, Summary: "Saved query templates", Response: []QueryTemplate{}},
+			{Method: http.MethodPost, Summary: "Save a boolean query template with {{param}} placeholders", Body: TemplateRequest{}, Response: QueryTemplate{}},
+			{Method: http.MethodDelete, Summary: "Delete a query template", Params: []param{{Name: "name", Type: "string"}}},
+		}},
+		{"POST /api/templates/run", runTemplateHandler, []operation{
+			{Method: http.MethodPost, Summary: "Run a template as a boolean search", Body: RunTemplateRequest{}, Response: BooleanSearchResponse{}},
+		}},
+		{"/api/result-sets", resultSetsHandler, []operation{
+			{Method: http.MethodGet, Summary: "Saved result sets", Response: []ResultSet{}},
+			{Method: http.MethodPost, Summary: "Save the results of a boolean query", Body: ResultSetRequest{}, Response: ResultSet{}},
+			{Method: http.MethodDelete, Summary: "Delete a result set", Params: []param{{Name: "name", Type: "string"}}},
+		}},
+		{"POST /api/result-sets/combine", combineResultSetsHandler, []operation{
+			{Method: http.MethodPost, Summary: "Union, intersection or difference of result sets", Body: CombineRequest{}, Response: ResultSet{}},
+		}},
+		{"POST /api/result-sets/materialize", materializeResultSetHandler, []operation{
+			{Method: http.MethodPost, Summary: "Copy the documents of a result set into a new collection", Body: MaterializeRequest{}, Response: CollectionSummary{}},
+		}},
+		{"GET /api/collections", collectionsHandler, []operation{
+			{Method: http.MethodGet, Summary: "Collections materialized from result sets", Response: []CollectionSummary{}},
+		}},
+		{"DELETE /api/collections/{name}", deleteCollectionHandler, []operation{
+			{Method: http.MethodDelete, Summary: "Delete a materialized collection"},
+		}},
+		{"POST /api/collections/{name}/search", collectionSearchHandler, []operation{
+			{Method: http.MethodPost, Summary: "Boolean search in a materialized collection", Body: CollectionSearchRequest{}, Response: BooleanSearchResponse{}},
+		}},
+		{"GET /api/collections/{name}/export", collectionExportHandler, []operation{
+			{Method: http.MethodGet, Summary: "Gzipped snapshot of a materialized collection, for /api/import"},
+		}},
+		{"GET /api/incidence-matrix", incidenceMatrixHandler, []operation{
+			{Method: http.MethodGet, Summary: "Term-document incidence matrix", Response: IncidenceMatrix{}, Params: []param{
+				{Name: "format", Type: "string", Enum: []string{"json", "csv"}},
+				{Name: "terms", Type: "string", Description: "rows to include, separated by commas; the whole vocabulary by default"},
+			}},
+		}},
+		{"/api/demo/load", demoLoadHandler, []operation{{Method: http.MethodPost, Summary: "Load the bundled demo corpus"}}},
+		{"/api/stats", statsHandler, []operation{
+			{Method: http.MethodGet, Summary: "Collection statistics", Response: CollectionStats{}, Params: []param{
+				{Name: "top", Type: "integer", Minimum: ptr(0.0)},
+			}},
+		}},
+		{"/api/stats/snapshots", snapshotsHandler, []operation{
+			{Method: http.MethodGet, Summary: "Index snapshots", Response: []IndexSnapshot{}},
+			{Method: http.MethodPost, Summary: "Take an index snapshot", Body: SnapshotRequest{}, Response: IndexSnapshot{}},
+		}},
+		{"/api/stats/diff", statsDiffHandler, []operation{
+			{Method: http.MethodGet, Summary: "Compare two snapshots", Response: StatsDiff{}, Params: []param{
+				{Name: "from", Type: "string"},
+				{Name: "to", Type: "string"},
+				{Name: "top", Type: "integer", Minimum: ptr(1.0)},
+			}},
+		}},
+		{"/api/analysis-config", analysisConfigHandler, []operation{
+			{Method: http.MethodGet, Summary: "Character filter configuration", Response: engine.AnalysisConfig{}},
+			{Method: http.MethodPost, Summary: "Replace the character filter configuration", Body: engine.AnalysisConfig{}, Response: engine.AnalysisConfig{}},
+		}},
+		{"/api/vocabulary", vocabularyHandler, []operation{
+			{Method: http.MethodGet, Summary: "Page through the vocabulary", Response: VocabularyPage{}, Params: []param{
+				{Name: "prefix", Type: "string"},
+				{Name: "offset", Type: "integer", Minimum: ptr(0.0)},
+				{Name: "limit", Type: "integer", Minimum: ptr(1.0)},
+				{Name: "sort", Type: "string", Enum: []string{"term", "df", "cf"}},
+			}},
+		}},
+		{"GET /api/terms/{term}/postings", termPostingsHandler, []operation{
+			{Method: http.MethodGet, Summary: "Postings of a term", Response: TermPostings{}},
+		}},
+		{"/api/similar", similarHandler, []operation{
+			{Method: http.MethodPost, Summary: "Documents similar to a document or text", Body: SimilarRequest{}},
+		}},
+		{"/api/cluster", clusterHandler, []operation{
+			{Method: http.MethodPost, Summary: "k-means clustering", Body: ClusterRequest{}, Response: ClusteringResult{}},
+		}},
+		{"/api/cluster/hierarchical", hierarchicalClusterHandler, []operation{
+			{Method: http.MethodPost, Summary: "Agglomerative clustering", Body: HierarchicalClusterRequest{}, Response: HierarchicalClustering{}},
+		}},
+		{"/api/labels", labelsHandler, []operation{
+			{Method: http.MethodGet, Summary: "Document labels", Response: map[string]string{}},
+			{Method: http.MethodPost, Summary: "Set document labels", Body: LabelsRequest{}, Response: map[string]string{}},
+		}},
+		{"/api/metadata", metadataHandler, []operation{
+			{Method: http.MethodGet, Summary: "Document metadata", Response: map[string]DocumentMetadata{}},
+			{Method: http.MethodPost, Summary: "Set document metadata fields", Body: MetadataRequest{}, Response: map[string]DocumentMetadata{}},
+		}},
+		{"/api/metadata/schema", metadataSchemaHandler, []operation{
+			{Method: http.MethodGet, Summary: "Declared metadata field types", Response: map[string]string{}},
+			{Method: http.MethodPost, Summary: "Declare number and date metadata fields", Body: MetadataSchemaRequest{}, Response: map[string]string{}},
+		}},
+		{"/api/priors", priorsHandler, []operation{
+			{Method: http.MethodGet, Summary: "Document priors", Response: PriorConfig{}},
+			{Method: http.MethodPost, Summary: "Set the recency decay and boost field", Body: PriorConfig{}, Response: PriorConfig{}},
+		}},
+		{"/api/classify", classifyHandler, []operation{
+			{Method: http.MethodPost, Summary: "kNN classification", Body: ClassifyRequest{}, Response: Classification{}},
+		}},
+		{"/api/feedback", feedbackHandler, []operation{
+			{Method: http.MethodPost, Summary: "Rocchio relevance feedback", Body: FeedbackRequest{}, Response: FeedbackResponse{}},
+		}},
+		{"/api/feedback/click", clickHandler, []operation{
+			{Method: http.MethodPost, Summary: "Log a result click", Body: ClickEvent{}, Response: ClickEvent{}},
+		}},
+		{"/api/feedback/clicks", clickStatsHandler, []operation{
+			{Method: http.MethodGet, Summary: "Click-through statistics", Response: []ClickStats{}},
+		}},
+		{"/api/synonyms", synonymsHandler, []operation{
+			{Method: http.MethodGet, Summary: "Synonym groups", Response: SynonymConfig{}},
+			{Method: http.MethodPost, Summary: "Load a synonym file", Upload: "file", Response: SynonymConfig{}},
+			{Method: http.MethodDelete, Summary: "Remove the synonyms"},
+		}},
+		{"/api/suggest", suggestHandler, []operation{
+			{Method: http.MethodGet, Summary: "Query completions", Response: []Completion{}, Params: []param{
+				{Name: "prefix", Type: "string"},
+				{Name: "limit", Type: "integer", Minimum: ptr(1.0)},
+			}},
+		}},
+		{"GET /api/documents/{name}/keywords", keywordsHandler, []operation{
+			{Method: http.MethodGet, Summary: "Keywords of a document", Response: DocumentKeywords{}, Params: []param{
+				{Name: "top", Type: "integer", Minimum: ptr(1.0)},
+				{Name: "method", Type: "string"},
+			}},
+		}},
+		{"/api/entities", entitiesHandler, []operation{
+			{Method: http.MethodGet, Summary: "Named entities per document", Response: []DocumentEntities{}, Params: []param{
+				{Name: "document", Type: "string"},
+				{Name: "type", Type: "string", Enum: entityTypes},
+			}},
+		}},
+		{"/api/trends", trendsHandler, []operation{
+			{Method: http.MethodGet, Summary: "Term frequency over time", Response: TermTrends{}, Params: []param{
+				{Name: "terms", Type: "string", Description: "term to count; repeatable"},
+				{Name: "field", Type: "string", Description: `a date metadata field or "uploaded"`},
+				{Name: "interval", Type: "string", Enum: []string{"month", "year"}},
+			}},
+		}},
+		{"/api/collocations", collocationsHandler, []operation{
+			{Method: http.MethodGet, Summary: "Top collocations", Response: Collocations{}, Params: []param{
+				{Name: "top", Type: "integer", Minimum: ptr(1.0)},
+				{Name: "measure", Type: "string", Enum: []string{"pmi", "llr"}},
+				{Name: "minCount", Type: "integer", Minimum: ptr(0.0)},
+			}},
+		}},
+		{"/api/cooccurrence", cooccurrenceHandler, []operation{
+			{Method: http.MethodGet, Summary: "Term co-occurrence matrix", Response: CooccurrenceMatrix{}, Params: []param{
+				{Name: "window", Type: "integer", Minimum: ptr(2.0)},
+				{Name: "terms", Type: "string", Description: "repeatable, the most frequent terms by default"},
+				{Name: "top", Type: "integer", Minimum: ptr(1.0)},
+			}},
+		}},
+		{"/api/summarize", summarizeHandler, []operation{
+			{Method: http.MethodPost, Summary: "Extractive summary", Body: SummarizeRequest{}, Response: Summary{}},
+		}},
+		{"/api/passages/config", passageConfigHandler, []operation{
+			{Method: http.MethodGet, Summary: "Passage window", Response: PassageConfig{}},
+			{Method: http.MethodPost, Summary: "Replace the passage window", Body: PassageConfig{}, Response: PassageConfig{}},
+		}},
+		{"/api/lsi", lsiHandler, []operation{
+			{Method: http.MethodGet, Summary: "LSI model", Response: LSIInfo{}},
+			{Method: http.MethodPost, Summary: "Build the LSI model", Body: LSIRequest{}, Response: LSIInfo{}},
+		}},
+		{"/api/topics", topicsHandler, []operation{
+			{Method: http.MethodGet, Summary: "LDA topic model", Response: TopicModel{}},
+			{Method: http.MethodPost, Summary: "Fit the LDA topic model", Body: TopicsRequest{}, Response: TopicModel{}},
+		}},
+		{"/api/dedup", dedupHandler, []operation{
+			{Method: http.MethodGet, Summary: "Near-duplicate screening", Response: DedupConfig{}},
+			{Method: http.MethodPost, Summary: "Replace the near-duplicate screening", Body: DedupConfig{}, Response: DedupConfig{}},
+		}},
+		{"/api/upload-config", uploadConfigHandler, []operation{
+			{Method: http.MethodGet, Summary: "Upload size limits", Response: UploadConfig{}},
+			{Method: http.MethodPost, Summary: "Replace the upload size limits", Body: UploadConfig{}, Response: UploadConfig{}},
+		}},
+		{"/api/fetcher", fetcherConfigHandler, []operation{
+			{Method: http.MethodGet, Summary: "Fetch settings: user agent and politeness", Response: FetcherConfig{}},
+			{Method: http.MethodPost, Summary: "Replace the fetch settings", Body: FetcherConfig{}, Response: FetcherConfig{}},
+		}},
+		{"GET /api/fetcher/robots", robotsCheckHandler, []operation{
+			{Method: http.MethodGet, Summary: "Check a URL against its host's robots.txt", Response: RobotsCheck{}, Params: []param{
+				{Name: "url", Type: "string"},
+			}},
+		}},
+		{"/api/feeds", feedsHandler, []operation{
+			{Method: http.MethodGet, Summary: "Registered RSS/Atom feeds and their status", Response: []FeedStatus{}},
+			{Method: http.MethodPost, Summary: "Register a feed, or change its settings and refresh it", Body: FeedRequest{}, Response: FeedStatus{}},
+		}},
+		{"DELETE /api/feeds/{id}", deleteFeedHandler, []operation{
+			{Method: http.MethodDelete, Summary: "Stop refreshing a feed, its items stay indexed"},
+		}},
+		{"POST /api/feeds/{id}/refresh", refreshFeedHandler, []operation{
+			{Method: http.MethodPost, Summary: "Refresh a feed now", Response: FeedStatus{}},
+		}},
+		{"/api/embedder", embedderConfigHandler, []operation{
+			{Method: http.MethodGet, Summary: "Embedding provider", Response: EmbedderConfig{}},
+			{Method: http.MethodPost, Summary: "Replace the embedding provider", Body: EmbedderConfig{}, Response: EmbedderConfig{}},
+		}},
+		{"/api/reranker", rerankerConfigHandler, []operation{
+			{Method: http.MethodGet, Summary: "Reranker configuration", Response: RerankerConfig{}},
+			{Method: http.MethodPost, Summary: "Replace the reranker configuration", Body: RerankerConfig{}, Response: RerankerConfig{}},
+		}},
+		{"/api/ltr/judgments", ltrJudgmentsHandler, []operation{
+			{Method: http.MethodGet, Summary: "Logged learning-to-rank examples", Response: []LTRExample{}},
+			{Method: http.MethodPost, Summary: "Log judged query-document pairs", Body: JudgmentsRequest{}},
+		}},
+		{"/api/ltr/train", ltrTrainHandler, []operation{
+			{Method: http.MethodGet, Summary: "Learning-to-rank model"},
+			{Method: http.MethodPost, Summary: "Train the learning-to-rank model", Body: TrainRequest{}},
+		}},
+		{"/api/eval/queries", evalQueriesHandler, []operation{
+			{Method: http.MethodGet, Summary: "Evaluation queries", Response: []EvalQuery{}},
+			{Method: http.MethodPost, Summary: "Add or replace evaluation queries", Body: EvalQueriesRequest{}, Response: []EvalQuery{}},
+			{Method: http.MethodDelete, Summary: "Remove the evaluation queries"},
+		}},
+		{"/api/eval/qrels", qrelsHandler, []operation{
+			{Method: http.MethodGet, Summary: "Relevance judgments", Response: []Qrel{}},
+			{Method: http.MethodPost, Summary: "Add relevance judgments", Body: QrelsRequest{}, Response: []Qrel{}},
+			{Method: http.MethodDelete, Summary: "Remove the relevance judgments"},
+		}},
+		{"/api/eval/run", evalRunHandler, []operation{
+			{Method: http.MethodPost, Summary: "Evaluate a ranker on the query set", Body: EvalRunRequest{}, Response: EvalReport{}},
+		}},
+		{"/api/eval/qrels/trec", trecQrelsHandler, []operation{
+			{Method: http.MethodPost, Summary: "Load TREC qrels", Upload: "file", Response: []Qrel{}},
+		}},
+		{"/api/eval/run/trec", trecRunHandler, []operation{
+			{Method: http.MethodPost, Summary: "TREC run of the query set", Body: TRECRunRequest{}},
+		}},
+		{"/api/compare", compareHandler, []operation{
+			{Method: http.MethodPost, Summary: "Compare two rankers", Body: CompareRequest{}, Response: ComparisonReport{}},
+		}},
+		{"/api/analytics/queries", topQueriesHandler, []operation{
+			{Method: http.MethodGet, Summary: "Most frequent queries", Response: []QueryCount{}, Params: analyticsQueryParams},
+		}},
+		{"/api/analytics/zero-results", zeroResultQueriesHandler, []operation{
+			{Method: http.MethodGet, Summary: "Queries without results", Response: []QueryCount{}, Params: analyticsQueryParams},
+		}},
+		{"/api/analytics/latency", latencyHandler, []operation{
+			{Method: http.MethodGet, Summary: "Search latency", Response: LatencyStats{}, Params: analyticsQueryParams},
+		}},
+		{"/api/rank-correlation", rankCorrelationHandler, []operation{
+			{Method: http.MethodPost, Summary: "Correlation of two rankings", Body: RankCorrelationRequest{}, Response: RankCorrelation{}},
+		}},
+		{"/api/export", exportHandler, []operation{{Method: http.MethodGet, Summary: "Gzipped snapshot of the collection"}}},
+		{"/api/import", importHandler, []operation{
+			{Method: http.MethodPost, Summary: "Restore a gzipped snapshot", Params: []param{
+				{Name: "endpoints", Type: "boolean", Description: "also apply the reranker and embedder URLs of the snapshot, which are otherwise reported and left out"},
+			}},
+		}},
+		{"/api/export/anonymized", anonymizedExportHandler, []operation{
+			{Method: http.MethodGet, Summary: "Anonymized corpus", Response: AnonymizedCorpus{}, Params: []param{
+				{Name: "seed", Type: "integer", Minimum: ptr(0.0)},
+			}},
+		}},
+		{"GET /ws", wsHandler, []operation{
+			{Method: http.MethodGet, Summary: "WebSocket of indexing progress, statistics and paged search results"},
+		}},
+		{"/graphql", graphQLHandler, []operation{
+			{Method: http.MethodPost, Summary: "GraphQL query", Body: GraphQLRequest{}},
+		}},
+	}
+}
+
+var analyticsQueryParams = []param{
+	{Name: "window", Type: "string", Description: "duration like 24h, empty for the whole log"},
+	{Name: "limit", Type: "integer", Minimum: ptr(1.0)},
+}
+
+func ptr[T any](v T) *T { return &v }
+
+// registers the routes with request validation and generates the specification
+func registerRoutes(mux *http.ServeMux, routes []route) {
+	api = newAPISpec(routes)
+	for _, rt := range routes {
+		mux.HandleFunc(rt.Pattern, api.validated(rt))
+	}
+}
+
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+func newAPISpec(routes []route) *apiSpec {
+	spec := &apiSpec{components: map[string]*schema{}, bodies: map[string]*schema{}}
+	spec.components["Error"] = spec.schemaOf(reflect.TypeOf(apierror.Envelope{}))
+
+	paths := map[string]map[string]any{}
+	for _, rt := range routes {
+		_, path, _ := strings.Cut(rt.Pattern, " ")
+		if path == "" {
+			path = rt.Pattern
+		}
+		item := paths[path]
+		if item == nil {
+			item = map[string]any{}
+			paths[path] = item
+		}
+
+		var pathParams []any
+		for _, match := range pathParam.FindAllStringSubmatch(path, -1) {
+			pathParams = append(pathParams, map[string]any{
+				"name": match[1], "in": "path", "required": true, "schema": &schema{Type: "string"},
+			})
+		}
+		for _, op := range rt.Operations {
+			item[strings.ToLower(op.Method)] = spec.operation(rt.Pattern, op, pathParams)
+		}
+	}
+
+	spec.document = map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":   "Information Retrieval Lab 2",
+			"version": "1.0.0",
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": spec.components},
+	}
+	return spec
+}
+
+func (s *apiSpec) operation(pattern string, op operation, pathParams []any) map[string]any {
+	parameters := append([]any{}, pathParams...)
+	for _, p := range op.Params {
+		parameters = append(parameters, map[string]any{
+			"name": p.Name, "in": "query", "description": p.Description, "schema": p.schema(),
+		})
+	}
+
+	responses := map[string]any{
+		"default": map[string]any{
+			"description": "Error",
+			"content":     map[string]any{"application/json": map[string]any{"schema": &schema{Ref: "#/components/schemas/Error"}}},
+		},
+	}
+	ok := map[string]any{"description": "OK"}
+	if op.Response != nil {
+		ok["content"] = map[string]any{"application/json": map[string]any{"schema": s.schemaOf(reflect.TypeOf(op.Response))}}
+	}
+	responses["200"] = ok
+
+	result := map[string]any{"summary": op.Summary, "responses": responses}
+	if len(parameters) > 0 {
+		result["parameters"] = parameters
+	}
+
+	var content map[string]any
+	switch {
+	case op.Body != nil:
+		body := s.schemaOf(reflect.TypeOf(op.Body))
+		s.bodies[op.Method+" "+pattern] = body
+		content = map[string]any{"application/json": map[string]any{"schema": body}}
+	case op.Upload != "":
+		files := &schema{Type: "array", Items: &schema{Type: "string", Format: "binary"}}
+		content = map[string]any{"multipart/form-data": map[string]any{
+			"schema": &schema{Type: "object", Properties: map[string]*schema{op.Upload: files}},
+		}}
+	case op.Text:
+		content = map[string]any{"text/plain": map[string]any{"schema": &schema{Type: "string"}}}
+	case op.Lines != nil:
+		content = map[string]any{"application/x-ndjson": map[string]any{"schema": s.schemaOf(reflect.TypeOf(op.Lines))}}
+	}
+	if content != nil {
+		result["requestBody"] = map[string]any{"required": true, "content": content}
+	}
+	return result
+}
+
+func (p param) schema() *schema {
+	return &schema{Type: p.Type, Minimum: p.Minimum, Enum: p.Enum}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// reflects a Go type into a schema; named structs become components so that
+// recursive types such as the dendrogram terminate
+func (s *apiSpec) schemaOf(t reflect.Type) *schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		ref := &schema{Ref: "#/components/schemas/" + t.Name()}
+		if _, ok := s.components[t.Name()]; !ok {
+			s.components[t.Name()] = &schema{} // placeholder while the fields are reflected
+			*s.components[t.Name()] = *s.structSchema(t)
+		}
+		return ref
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return s.structSchema(t)
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &schema{Type: "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &schema{Type: "integer", Minimum: ptr(0.0)}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &schema{Type: "array", Items: s.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: s.schemaOf(t.Elem())}
+	}
+	return &schema{} // interface values accept anything
+}
+
+// exported fields by their JSON names, with the fields of embedded structs
+// without a JSON name promoted as encoding/json does; the limits come from the
+// struct tags
+func (s *apiSpec) structSchema(t reflect.Type) *schema {
+	result := &schema{Type: "object", Properties: map[string]*schema{}, AdditionalProperties: false}
+	s.addFields(result.Properties, t)
+	return result
+}
+
+// adds the fields of the struct type the properties lack; those of embedded
+// structs come after the struct's own, which take precedence
+func (s *apiSpec) addFields(properties map[string]*schema, t reflect.Type) {
+	var embedded []reflect.Type
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			inner := field.Type
+			if inner.Kind() == reflect.Pointer {
+				inner = inner.Elem()
+			}
+			if inner.Kind() == reflect.Struct {
+				embedded = append(embedded, inner)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if _, ok := properties[name]; ok {
+			continue
+		}
+		property := s.schemaOf(field.Type)
+		if limited := fieldLimits(field.Tag); limited != nil && property.Ref == "" {
+			limited.Type, limited.Format, limited.Items = property.Type, property.Format, property.Items
+			if limited.Minimum == nil {
+				limited.Minimum = property.Minimum
+			}
+			property = limited
+		}
+		properties[name] = property
+	}
+	for _, inner := range embedded {
+		s.addFields(properties, inner)
+	}
+}
+
+// the limit tags of a field: minimum, maximum, exclusiveMinimum, exclusiveMaximum,
+// maxLength, maxItems and enum (values separated by "|"), nil without any
+func fieldLimits(tag reflect.StructTag) *schema {
+	limits := &schema{}
+	found := false
+	number := func(key string) *float64 {
+		raw, ok := tag.Lookup(key)
+		if !ok {
+			return nil
+		}
+		found = true
+		v, _ := strconv.ParseFloat(raw, 64)
+		return &v
+	}
+	count := func(key string) *int {
+		raw, ok := tag.Lookup(key)
+		if !ok {
+			return nil
+		}
+		found = true
+		v, _ := strconv.Atoi(raw)
+		return &v
+	}
+	limits.Minimum = number("minimum")
+	limits.Maximum = number("maximum")
+	limits.ExclusiveMinimum = number("exclusiveMinimum")
+	limits.ExclusiveMaximum = number("exclusiveMaximum")
+	limits.MaxLength = count("maxLength")
+	limits.MaxItems = count("maxItems")
+	if raw, ok := tag.Lookup("enum"); ok {
+		found = true
+		limits.Enum = strings.Split(raw, "|")
+	}
+	if !found {
+		return nil
+	}
+	return limits
+}
+
+// resolves a component reference
+func (s *apiSpec) resolve(sch *schema) *schema {
+	if sch.Ref == "" {
+		return sch
+	}
+	return s.components[strings.TrimPrefix(sch.Ref, "#/components/schemas/")]
+}
+
+// checks a decoded JSON value against the schema, adding a detail per violation
+func (s *apiSpec) validate(sch *schema, value any, path string, details *[]apierror.Detail) {
+	if len(*details) >= maxValidationDetails || value == nil {
+		return // null leaves the field at its default
+	}
+	sch = s.resolve(sch)
+	fail := func(code, format string, args ...any) {
+		*details = append(*details, apierror.Detail{Code: code, Message: fmt.Sprintf(format, args...), Field: path})
+	}
+	display := path
+	if display == "" {
+		display = "body"
+	}
+
+	switch sch.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			fail("invalid_type", "%s must be an object", display)
+			return
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := sch.Properties[name]
+			if !ok {
+				if additional, ok := sch.AdditionalProperties.(*schema); ok {
+					property = additional
+				} else {
+					*details = append(*details, apierror.Detail{
+						Code: "unknown_field", Message: "unknown field " + joinPath(path, name), Field: joinPath(path, name),
+					})
+					continue
+				}
+			}
+			s.validate(property, object[name], joinPath(path, name), details)
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			fail("invalid_type", "%s must be an array", display)
+			return
+		}
+		if sch.MaxItems != nil && len(array) > *sch.MaxItems {
+			fail("too_long", "%s must have at most %d items", display, *sch.MaxItems)
+		}
+		for i, item := range array {
+			s.validate(sch.Items, item, fmt.Sprintf("%s[%d]", path, i), details)
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			fail("invalid_type", "%s must be a string", display)
+			return
+		}
+		if sch.MaxLength != nil && len([]rune(text)) > *sch.MaxLength {
+			fail("too_long", "%s must be at most %d characters", display, *sch.MaxLength)
+		}
+		if sch.Enum != nil && !contains(sch.Enum, text) {
+			fail("invalid_value", "%s must be one of %s", display, quoteAll(sch.Enum))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("invalid_type", "%s must be a boolean", display)
+		}
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if !ok && sch.Type == "integer" {
+			fail("invalid_type", "%s must be an integer", display)
+			return
+		}
+		if !ok {
+			fail("invalid_type", "%s must be a number", display)
+			return
+		}
+		if sch.Type == "integer" {
+			if _, err := strconv.ParseInt(n.String(), 10, 64); err != nil {
+				if _, err := strconv.ParseUint(n.String(), 10, 64); err != nil {
+					fail("invalid_type", "%s must be an integer", display)
+					return
+				}
+			}
+		}
+		v, _ := n.Float64()
+		switch {
+		case sch.Minimum != nil && v < *sch.Minimum:
+			fail("out_of_range", "%s must be at least %g", display, *sch.Minimum)
+		case sch.Maximum != nil && v > *sch.Maximum:
+			fail("out_of_range", "%s must be at most %g", display, *sch.Maximum)
+		case sch.ExclusiveMinimum != nil && v <= *sch.ExclusiveMinimum:
+			fail("out_of_range", "%s must be greater than %g", display, *sch.ExclusiveMinimum)
+		case sch.ExclusiveMaximum != nil && v >= *sch.ExclusiveMaximum:
+			fail("out_of_range", "%s must be less than %g", display, *sch.ExclusiveMaximum)
+		}
+	}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func quoteAll(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = "'" + v + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// checks the query parameters and the JSON body of a request before the handler sees it
+func (s *apiSpec) validated(rt route) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var details []apierror.Detail
+		for _, op := range rt.Operations {
+			if op.Method == r.Method {
+				details = append(details, validateParams(r, op.Params)...)
+			}
+		}
+
+		if body, ok := s.bodies[r.Method+" "+rt.Pattern]; ok && r.ContentLength != 0 {
+			data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxJSONBodySize))
+			if err != nil {
+				apierror.Error(w, "Error: Request body is too large.", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(data))
+			if len(bytes.TrimSpace(data)) > 0 {
+				decoder := json.NewDecoder(bytes.NewReader(data))
+				decoder.UseNumber()
+				var value any
+				if err := decoder.Decode(&value); err != nil {
+					apierror.InvalidJSON(w)
+					return
+				}
+				s.validate(body, value, "", &details)
+			}
+		}
+
+		if len(details) > 0 {
+			apierror.Write(w, http.StatusBadRequest, "validation_failed", "Request does not match the API schema.", details...)
+			return
+		}
+		rt.Handler(w, r)
+	}
+}
+
+// checks every value of the query parameters, repeated ones included
+func validateParams(r *http.Request, params []param) []apierror.Detail {
+	var details []apierror.Detail
+	query := r.URL.Query()
+	for _, p := range params {
+		fail := func(code, message string) {
+			details = append(details, apierror.Detail{Code: code, Message: p.Name + " " + message, Field: p.Name})
+		}
+		for _, raw := range query[p.Name] {
+			if raw == "" {
+				continue
+			}
+			switch p.Type {
+			case "integer":
+				n, err := strconv.ParseInt(raw, 10, 64)
+				if err != nil {
+					if _, err := strconv.ParseUint(raw, 10, 64); err != nil {
+						fail("invalid_type", "must be an integer")
+					}
+					continue
+				}
+				if p.Minimum != nil && float64(n) < *p.Minimum {
+					fail("out_of_range", fmt.Sprintf("must be at least %g", *p.Minimum))
+				}
+			case "number":
+				n, err := strconv.ParseFloat(raw, 64)
+				if err != nil {
+					fail("invalid_type", "must be a number")
+					continue
+				}
+				if p.Minimum != nil && n < *p.Minimum {
+					fail("out_of_range", fmt.Sprintf("must be at least %g", *p.Minimum))
+				}
+			case "boolean":
+				if _, err := strconv.ParseBool(raw); err != nil {
+					fail("invalid_type", "must be true or false")
+				}
+			}
+			if p.Enum != nil && !contains(p.Enum, raw) {
+				fail("invalid_value", "must be one of "+quoteAll(p.Enum))
+			}
+		}
+	}
+	return details
+}
+
+// GET /api/openapi.json
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.document)
+}
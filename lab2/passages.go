@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"ir/internal/apierror"
+)
+
+const maxPassageResults = 10
+
+// PassageConfig sets how documents are split into overlapping passages;
+// changes apply to documents uploaded afterwards
+type PassageConfig struct {
+	Window int `json:"window" minimum:"1"` // passage length in tokens
+	Stride int `json:"stride" minimum:"1"` // tokens between passage starts
+
+	// documents with sections, as the headings of Markdown files make them, get
+	// one passage per section instead of the windows
+	Sections bool `json:"sections"`
+}
+
+var defaultPassageConfig = PassageConfig{Window: 50, Stride: 25}
+
+// Passage is a window of a document, located by token offsets
+type Passage struct {
+	Start    int // first token
+	End      int // one past the last token
+	TermFreq map[string]int
+}
+
+type PassageResult struct {
+	FileName string  `json:"fileName"`
+	Start    int     `json:"start"`
+	End      int     `json:"end"`
+	Score    float64 `json:"score"`
+	Text     string  `json:"text"`
+}
+
+func (c PassageConfig) validate() error {
+	if c.Window <= 0 || c.Stride <= 0 {
+		return fmt.Errorf("window and stride must be positive")
+	}
+	if c.Stride > c.Window {
+		return fmt.Errorf("stride must not exceed the window, passages would leave gaps")
+	}
+	return nil
+}
+
+// splits the stored document text into passages; documents without stored text have none
+func splitPassages(doc Document, config PassageConfig) []Passage {
+	content := doc.content()
+	if content == "" {
+		return nil
+	}
+	tokens := strings.Fields(content)
+	if config.Sections && len(doc.Sections) > 0 {
+		return sectionPassages(tokens, doc.Sections)
+	}
+
+	var passages []Passage
+	for start := 0; start < len(tokens); start += config.Stride {
+		end := min(start+config.Window, len(tokens))
+		passage := Passage{Start: start, End: end, TermFreq: make(map[string]int)}
+		for _, t := range tokens[start:end] {
+			passage.TermFreq[t]++
+		}
+		passages = append(passages, passage)
+		if end == len(tokens) {
+			break
+		}
+	}
+	return passages
+}
+
+// one passage from each section start to the next
+func sectionPassages(tokens []string, starts []int) []Passage {
+	var passages []Passage
+	for i, start := range starts {
+		end := len(tokens)
+		if i+1 < len(starts) {
+			end = min(starts[i+1], end)
+		}
+		if start >= end {
+			continue
+		}
+		passage := Passage{Start: start, End: end, TermFreq: make(map[string]int)}
+		for _, t := range tokens[start:end] {
+			passage.TermFreq[t]++
+		}
+		passages = append(passages, passage)
+	}
+	return passages
+}
+
+// best matching passages across the collection by cosine similarity of
+// TF-IDF vectors (caller holds the lock)
+func searchPassages(query string) []PassageResult {
+	cache := documentVectors()
+	qVector := queryVector(query, cache)
+	qNorm := qVector.norm()
+
+	results := []PassageResult{}
+	for _, doc := range state.Documents {
+		var tokens []string
+		for _, passage := range doc.Passages {
+			length := passage.End - passage.Start
+			vector := SparseVector{}
+			for t, tf := range passage.TermFreq {
+				if weight := float64(tf) / float64(length) * cache.idf[t]; weight > 0 {
+					vector[t] = weight
+				}
+			}
+			score := sparseCosine(qVector, qNorm, vector, vector.norm())
+			if score <= 0 {
+				continue
+			}
+			if tokens == nil {
+				content, raw := doc.text()
+				tokens = displayTokens(strings.Fields(content), raw)
+			}
+			results = append(results, PassageResult{
+				FileName: doc.Name,
+				Start:    passage.Start,
+				End:      passage.End,
+				Score:    score,
+				Text:     strings.Join(tokens[passage.Start:passage.End], " "),
+			})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > maxPassageResults {
+		results = results[:maxPassageResults]
+	}
+	return results
+}
+
+// reads or replaces the passage window and stride
+func passageConfigHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		config := state.PassageConfig
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+		if err := config.validate(); err != nil {
+			apierror.Error(w, "Error: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		state.PassageConfig = config
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state.PassageConfig)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// soundex letter codes; vowels, h, w and y have none
+var soundexCodes = map[byte]byte{
+	'b': '1', 'f': '1', 'p': '1', 'v': '1',
+	'c': '2', 'g': '2', 'j': '2', 'k': '2', 'q': '2', 's': '2', 'x': '2', 'z': '2',
+	'd': '3', 't': '3',
+	'l': '4',
+	'm': '5', 'n': '5',
+	'r': '6',
+}
+
+// keeps the letters of a normalized token, phonetic codes ignore digits
+func phoneticLetters(token string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r
+		}
+		return -1
+	}, token)
+}
+
+// American Soundex, e.g. robert -> R163
+func soundex(token string) string {
+	word := phoneticLetters(token)
+	if word == "" {
+		return ""
+	}
+
+	code := []byte{word[0] - 'a' + 'A'}
+	last := soundexCodes[word[0]]
+	for i := 1; i < len(word) && len(code) < 4; i++ {
+		c := word[i]
+		digit, ok := soundexCodes[c]
+		switch {
+		case ok && digit != last:
+			code = append(code, digit)
+			last = digit
+		case !ok && c != 'h' && c != 'w':
+			// vowels separate letters with the same code, h and w do not
+			last = 0
+		}
+	}
+	for len(code) < 4 {
+		code = append(code, '0')
+	}
+	return string(code)
+}
+
+func isVowel(c byte) bool {
+	return c == 'a' || c == 'e' || c == 'i' || c == 'o' || c == 'u'
+}
+
+// original Metaphone (Philips, 1990), e.g. knight -> NT; "0" stands for "th"
+func metaphone(token string) string {
+	word := phoneticLetters(token)
+	if word == "" {
+		return ""
+	}
+
+	switch {
+	case strings.HasPrefix(word, "ae"), strings.HasPrefix(word, "gn"), strings.HasPrefix(word, "kn"),
+		strings.HasPrefix(word, "pn"), strings.HasPrefix(word, "wr"):
+		word = word[1:]
+	case word[0] == 'x':
+		word = "s" + word[1:]
+	case strings.HasPrefix(word, "wh"):
+		word = "w" + word[2:]
+	}
+
+	at := func(i int) byte {
+		if i < 0 || i >= len(word) {
+			return 0
+		}
+		return word[i]
+	}
+	frontVowel := func(c byte) bool { return c == 'e' || c == 'i' || c == 'y' }
+
+	var code strings.Builder
+	for i := 0; i < len(word); i++ {
+		c := word[i]
+		if c == at(i-1) && c != 'c' {
+			continue
+		}
+
+		switch c {
+		case 'a', 'e', 'i', 'o', 'u':
+			if i == 0 {
+				code.WriteByte(c - 'a' + 'A')
+			}
+		case 'b':
+			if !(i == len(word)-1 && at(i-1) == 'm') {
+				code.WriteByte('B')
+			}
+		case 'c':
+			switch {
+			case at(i+1) == 'i' && at(i+2) == 'a', at(i+1) == 'h' && at(i-1) != 's':
+				code.WriteByte('X')
+			case frontVowel(at(i + 1)):
+				if at(i-1) != 's' {
+					code.WriteByte('S')
+				}
+			default:
+				code.WriteByte('K')
+			}
+		case 'd':
+			if at(i+1) == 'g' && frontVowel(at(i+2)) {
+				code.WriteByte('J')
+				i++
+			} else {
+				code.WriteByte('T')
+			}
+		case 'g':
+			switch {
+			case at(i+1) == 'h' && i+2 < len(word) && !isVowel(at(i+2)):
+				// silent as in "night"
+			case at(i+1) == 'n' && (i+2 == len(word) || word[i+2:] == "ed"):
+				// silent as in "sign", "signed"
+			case frontVowel(at(i+1)) && at(i-1) != 'g':
+				code.WriteByte('J')
+			default:
+				code.WriteByte('K')
+			}
+		case 'h':
+			afterVowel := isVowel(at(i - 1))
+			if strings.IndexByte("cgpst", at(i-1)) >= 0 && i > 0 {
+				// part of ch, gh, ph, sh, th
+			} else if !(afterVowel && !isVowel(at(i+1))) {
+				code.WriteByte('H')
+			}
+		case 'k':
+			if at(i-1) != 'c' {
+				code.WriteByte('K')
+			}
+		case 'p':
+			if at(i+1) == 'h' {
+				code.WriteByte('F')
+			} else {
+				code.WriteByte('P')
+			}
+		case 'q':
+			code.WriteByte('K')
+		case 's':
+			switch {
+			case at(i+1) == 'h':
+				code.WriteByte('X')
+			case at(i+1) == 'i' && (at(i+2) == 'o' || at(i+2) == 'a'):
+				code.WriteByte('X')
+			default:
+				code.WriteByte('S')
+			}
+		case 't':
+			switch {
+			case at(i+1) == 'i' && (at(i+2) == 'o' || at(i+2) == 'a'):
+				code.WriteByte('X')
+			case at(i+1) == 'h':
+				code.WriteByte('0')
+			case at(i+1) == 'c' && at(i+2) == 'h':
+				// silent in "tch"
+			default:
+				code.WriteByte('T')
+			}
+		case 'v':
+			code.WriteByte('F')
+		case 'w', 'y':
+			if isVowel(at(i + 1)) {
+				code.WriteByte(c - 'a' + 'A')
+			}
+		case 'x':
+			code.WriteString("KS")
+		case 'z':
+			code.WriteByte('S')
+		default: // f, j, l, m, n, r
+			code.WriteByte(c - 'a' + 'A')
+		}
+	}
+	return code.String()
+}
+
+// phonetic token filter: maps a token to its code under the algorithm
+func phoneticCode(algorithm, token string) string {
+	if algorithm == "metaphone" {
+		return metaphone(token)
+	}
+	return soundex(token)
+}
+
+// replaces every query term by the vocabulary terms that sound alike; terms
+// without a phonetic code (numbers) are kept as they are
+func expandPhonetic(query, algorithm string) (string, bool) {
+	byCode := make(map[string][]string)
+	for t := range vocabularySet() {
+		if code := phoneticCode(algorithm, t); code != "" {
+			byCode[code] = append(byCode[code], t)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var expanded []string
+	for _, term := range strings.Fields(strings.ToLower(query)) {
+		matches := append([]string{term}, byCode[phoneticCode(algorithm, term)]...)
+		sort.Strings(matches[1:])
+		for _, t := range matches {
+			if !seen[t] {
+				seen[t] = true
+				expanded = append(expanded, t)
+			}
+		}
+	}
+
+	result := strings.Join(expanded, " ")
+	return result, result != strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ir/internal/apierror"
+	"ir/internal/engine"
+)
+
+// biword index of adjacent term pairs, filled as documents are indexed when the
+// server runs with -biwords; a two-word phrase is then a single lookup. Like the
+// segments, the pairs of deleted documents stay behind under their unused IDs
+type biwordIndex struct {
+	counts map[string]map[int]int // "first second" -> document ID -> occurrences
+}
+
+// PhraseSearchResponse is returned by /api/search?mode=phrase
+type PhraseSearchResponse struct {
+	TookMs    float64 `json:"tookMs"`
+	TotalHits int     `json:"totalHits"` // matching documents before the limit
+	// how the phrase was answered: "terms" for a single word, "biword" from the
+	// biword index alone, "biword+scan" when longer phrases are verified on the
+	// documents containing all their biwords, "terms+scan" on those containing
+	// all their terms without a biword index
+	Strategy string        `json:"strategy"`
+	Results  []PhraseMatch `json:"results"`
+}
+
+type PhraseMatch struct {
+	FileName string `json:"fileName"`
+	Matches  int    `json:"matches"`
+}
+
+func newBiwordIndex() *biwordIndex {
+	return &biwordIndex{counts: map[string]map[int]int{}}
+}
+
+// empties the biword index, if enabled, before document IDs are reused (caller holds the lock)
+func resetBiwords() {
+	if state.biwords != nil {
+		state.biwords = newBiwordIndex()
+	}
+}
+
+// occurrences of the adjacent term pairs in the normalized text
+func biwordCounts(content string) map[string]int {
+	counts := make(map[string]int)
+	tokens := strings.Fields(content)
+	for i := 0; i+1 < len(tokens); i++ {
+		counts[tokens[i]+" "+tokens[i+1]]++
+	}
+	return counts
+}
+
+// adds the biword counts of the document
+func (index *biwordIndex) add(id int, counts map[string]int) {
+	for biword, n := range counts {
+		if index.counts[biword] == nil {
+			index.counts[biword] = map[int]int{}
+		}
+		index.counts[biword][id] = n
+	}
+}
+
+// occurrences of phrase in the normalized tokens
+func countPhrase(tokens, phrase []string) int {
+	count := 0
+	for i := 0; i+len(phrase) <= len(tokens); i++ {
+		matched := true
+		for j, t := range phrase {
+			if tokens[i+j] != t {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			count++
+		}
+	}
+	return count
+}
+
+// answers /api/search?mode=phrase with the documents containing the query terms
+// in order, most occurrences first (caller holds the lock)
+func phraseSearchHandler(w http.ResponseWriter, r *http.Request, requestData SearchRequest, inSubset func(string) bool, started time.Time) {
+	phrase := sentenceTerms(requestData.Query)
+	if len(phrase) == 0 {
+		apierror.Write(w, http.StatusBadRequest, "invalid_query", "The phrase to search for is empty.")
+		return
+	}
+
+	positions := make(map[int]int, len(state.Documents)) // document ID -> position
+	for i, doc := range state.Documents {
+		positions[doc.id] = i
+	}
+	counts := map[int]int{} // position -> occurrences
+	response := PhraseSearchResponse{Results: []PhraseMatch{}}
+	switch {
+	case len(phrase) == 1:
+		response.Strategy = "terms"
+		for i, doc := range state.Documents {
+			if tf := doc.TermFreq[phrase[0]]; tf > 0 {
+				counts[i] = tf
+			}
+		}
+	case state.biwords != nil && len(phrase) == 2:
+		response.Strategy = "biword"
+		for id, n := range state.biwords.counts[phrase[0]+" "+phrase[1]] {
+			if i, ok := positions[id]; ok {
+				counts[i] = n
+			}
+		}
+	default:
+		var candidates engine.Postings
+		if state.biwords != nil {
+			response.Strategy = "biword+scan"
+			for j := 0; j+1 < len(phrase); j++ {
+				var postings engine.Postings
+				for id := range state.biwords.counts[phrase[j]+" "+phrase[j+1]] {
+					if i, ok := positions[id]; ok {
+						postings = append(postings, i)
+					}
+				}
+				sort.Ints(postings)
+				if j == 0 {
+					candidates = postings
+				} else {
+					candidates = engine.Intersect(candidates, postings)
+				}
+			}
+		} else {
+			response.Strategy = "terms+scan"
+			candidates = engine.AllDocuments(len(state.Documents))
+			for _, t := range phrase {
+				var postings engine.Postings
+				for _, i := range candidates {
+					if state.Documents[i].TermFreq[t] > 0 {
+						postings = append(postings, i)
+					}
+				}
+				candidates = postings
+			}
+		}
+		for _, i := range candidates {
+			if n := countPhrase(strings.Fields(state.Documents[i].content()), phrase); n > 0 {
+				counts[i] = n
+			}
+		}
+	}
+
+	for i, n := range counts {
+		if name := state.Documents[i].Name; inSubset(name) {
+			response.Results = append(response.Results, PhraseMatch{FileName: name, Matches: n})
+		}
+	}
+	sort.Slice(response.Results, func(i, j int) bool {
+		a, b := response.Results[i], response.Results[j]
+		if a.Matches != b.Matches {
+			return a.Matches > b.Matches
+		}
+		return a.FileName < b.FileName
+	})
+	response.TotalHits = len(response.Results)
+	if requestData.Limit > 0 && len(response.Results) > requestData.Limit {
+		response.Results = response.Results[:requestData.Limit]
+	}
+
+	results := make([]SearchResult, len(response.Results))
+	for i, match := range response.Results {
+		results[i] = SearchResult{FileName: match.FileName, Score: float64(match.Matches)}
+	}
+	logQuery(requestData.Query, "phrase", started, results)
+
+	if format := negotiateFormat(w, r); format != "json" {
+		t := table{Root: "results", Row: "result", Columns: []string{"fileName", "matches"}}
+		for _, match := range response.Results {
+			t.Rows = append(t.Rows, []string{match.FileName, strconv.Itoa(match.Matches)})
+		}
+		writeTable(w, format, t)
+		return
+	}
+	response.TookMs = float64(time.Since(started).Microseconds()) / 1000
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
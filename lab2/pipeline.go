@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"ir/internal/apierror"
+	"ir/internal/engine"
+)
+
+// number of uploaded files analyzed in parallel
+var uploadWorkers = runtime.NumCPU()
+
+type analyzedUpload struct {
+	name     string // of the file, or of the document an archive held
+	doc      Document
+	metadata DocumentMetadata // fields the file carried, e.g. the URL of an archived page
+	err      error
+}
+
+// a document read out of an archive file or converted from another format
+type archivedDocument struct {
+	name     string
+	text     string
+	metadata DocumentMetadata
+	sections []string // consecutive parts of the text, for structured formats
+}
+
+// upload formats converted before they are analyzed, most holding several
+// documents, recognized by the file name suffix
+var archiveFormats = []struct {
+	suffix string
+	split  func(name string, r io.Reader) ([]archivedDocument, error)
+}{
+	{".warc", splitWARC},
+	{".warc.gz", splitWARC},
+	{".mbox", splitMbox},
+	{".eml", splitEML},
+	{".md", splitMarkdown},
+	{".markdown", splitMarkdown},
+}
+
+// files up to this size are read ahead and analyzed by the pool of workers,
+// larger ones are tokenized while they stream in
+const smallUpload = 1 << 20
+
+// UploadConfig limits the multipart uploads, which are read as a stream
+type UploadConfig struct {
+	MaxFileMBytes  int `json:"maxFileMBytes" minimum:"1" maximum:"10240"`
+	MaxTotalMBytes int `json:"maxTotalMBytes" minimum:"1" maximum:"102400"` // of a whole request
+}
+
+var defaultUploadConfig = UploadConfig{MaxFileMBytes: 100, MaxTotalMBytes: 1024}
+
+func (c UploadConfig) validate() error {
+	if c.MaxFileMBytes < 1 || c.MaxTotalMBytes < 1 {
+		return fmt.Errorf("maxFileMBytes and maxTotalMBytes must be positive")
+	}
+	if c.MaxFileMBytes > c.MaxTotalMBytes {
+		return fmt.Errorf("maxFileMBytes must not exceed maxTotalMBytes")
+	}
+	return nil
+}
+
+// an upload over its size limit
+type tooLargeError struct {
+	name  string
+	limit int // MB
+}
+
+func (e *tooLargeError) Error() string {
+	return fmt.Sprintf("File '%s' ignored: larger than %d MB.", e.name, e.limit)
+}
+func (e *tooLargeError) ErrorCode() string { return "too_large" }
+
+// reads at most n bytes, then fails
+type sizeLimiter struct {
+	r        io.Reader
+	n        int64
+	exceeded bool
+}
+
+var errSizeLimit = errors.New("size limit exceeded")
+
+func (l *sizeLimiter) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		// a byte more tells a file of exactly the limit from a larger one
+		if n, _ := l.r.Read(make([]byte, 1)); n > 0 {
+			l.exceeded = true
+			return 0, errSizeLimit
+		}
+		return 0, io.EOF
+	}
+	p = p[:min(int64(len(p)), l.n)]
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// uploads analyzed ahead of one still in progress before the reading waits
+var pendingUploads = 4 * uploadWorkers
+
+// analyzes the "documents" files of a multipart request as they arrive: small
+// files are read ahead and analyzed on a pool of workers, larger ones are
+// tokenized while they are read. The results are handed to flush in upload
+// order, the documents of an archive in its place, as soon as the files before
+// them are done; flush is called for one batch at a time. Only a bounded
+// number of analyzed files waits for an earlier one, so memory stays bounded
+// whatever the upload size. Each file is reported to the /ws clients. The
+// error is a tooLargeError when the request exceeds the total limit; the files
+// flushed before stay indexed
+func streamUploads(r *http.Request, config indexConfig, limits UploadConfig, flush func([]analyzedUpload)) error {
+	total := &sizeLimiter{r: r.Body, n: int64(limits.MaxTotalMBytes) << 20}
+	r.Body = io.NopCloser(total)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	analyzed := sync.NewCond(&mu)
+	var pending [][]analyzedUpload // from the first file not flushed, nil while in progress
+	flushed := 0
+	var done atomic.Int64
+	finish := func(i int, name string, uploads []analyzedUpload) {
+		mu.Lock()
+		pending[i-flushed] = uploads
+		var ready []analyzedUpload
+		for len(pending) > 0 && pending[0] != nil { // every file has at least one result
+			ready = append(ready, pending[0]...)
+			pending = pending[1:]
+			flushed++
+		}
+		if len(ready) > 0 {
+			flush(ready)
+			analyzed.Broadcast()
+		}
+		mu.Unlock()
+		progress := IndexingProgress{File: name, Done: int(done.Add(1))}
+		if len(uploads) == 1 && uploads[0].err != nil {
+			progress.Error = uploads[0].err.Error()
+		}
+		events.publish(Event{Type: "indexing", Data: progress})
+	}
+
+	type job struct {
+		i    int
+		name string
+		data []byte
+	}
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	for range uploadWorkers {
+		wg.Go(func() {
+			for j := range jobs {
+				finish(j.i, j.name, analyzeUpload(j.name, bytes.NewReader(j.data), config))
+			}
+		})
+	}
+
+	var readErr error
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+		name := part.FileName()
+		if part.FormName() != "documents" || name == "" {
+			continue
+		}
+
+		mu.Lock()
+		for len(pending) >= pendingUploads {
+			analyzed.Wait()
+		}
+		i := flushed + len(pending)
+		pending = append(pending, nil)
+		mu.Unlock()
+
+		// the smallest file limit is above smallUpload, files read ahead are within it
+		file := &sizeLimiter{r: part, n: int64(limits.MaxFileMBytes) << 20}
+		head, err := io.ReadAll(io.LimitReader(file, smallUpload+1))
+		if err == nil && len(head) <= smallUpload {
+			jobs <- job{i, name, head}
+			continue
+		}
+		uploads := analyzeUpload(name, io.MultiReader(bytes.NewReader(head), file), config)
+		if file.exceeded {
+			uploads = []analyzedUpload{{name: name, err: &tooLargeError{name: name, limit: limits.MaxFileMBytes}}}
+		}
+		finish(i, name, uploads)
+	}
+	close(jobs)
+	wg.Wait()
+
+	if total.exceeded {
+		return &tooLargeError{name: "upload", limit: limits.MaxTotalMBytes}
+	}
+	return readErr
+}
+
+func analyzeUpload(name string, file io.Reader, config indexConfig) []analyzedUpload {
+	for _, format := range archiveFormats {
+		if !strings.HasSuffix(strings.ToLower(name), format.suffix) {
+			continue
+		}
+		archived, err := format.split(name, file)
+		if err == nil && len(archived) == 0 {
+			err = fmt.Errorf("%s holds no documents", name)
+		}
+		if err != nil {
+			return []analyzedUpload{{name: name, err: err}}
+		}
+		return analyzeArchived(archived, config)
+	}
+
+	doc, err := analyzeDocument(name, file, config)
+	return []analyzedUpload{{name: name, doc: doc, err: err}}
+}
+
+// GET /api/upload-config returns the upload size limits, POST changes them
+func uploadConfigHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		config := state.Uploads
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+		if err := config.validate(); err != nil {
+			apierror.Error(w, "Error: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		state.Uploads = config
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state.Uploads)
+}
+
+// analyzes the documents read out of an archive on a pool of workers; results
+// keep their order
+func analyzeArchived(archived []archivedDocument, config indexConfig) []analyzedUpload {
+	uploads := make([]analyzedUpload, len(archived))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(uploadWorkers, len(archived)) {
+		wg.Go(func() {
+			for i := range jobs {
+				a := archived[i]
+				doc, err := analyzeDocument(a.name, strings.NewReader(a.text), config)
+				if err == nil && a.sections != nil {
+					doc.Sections = engine.SectionOffsets(a.sections, config.analysis)
+					if config.passages.Sections {
+						doc.Passages = splitPassages(doc, config.passages) // along the sections
+					}
+				}
+				uploads[i] = analyzedUpload{name: a.name, doc: doc, metadata: a.metadata, err: err}
+			}
+		})
+	}
+	for i := range archived {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return uploads
+}
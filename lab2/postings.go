@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+
+	"ir/internal/apierror"
+)
+
+type Posting struct {
+	FileName      string `json:"fileName"`
+	TermFrequency int    `json:"termFrequency"`
+	Positions     []int  `json:"positions,omitempty"` // token offsets, only when the document text is stored
+}
+
+type TermPostings struct {
+	Term                string    `json:"term"`
+	DocumentFrequency   int       `json:"documentFrequency"`
+	CollectionFrequency int       `json:"collectionFrequency"`
+	IDF                 float64   `json:"idf"`       // log(N / df)
+	RankedIDF           float64   `json:"rankedIdf"` // weight applied by ranked search
+	Postings            []Posting `json:"postings"`
+}
+
+// standard inverse document frequency: log(N / df)
+func inverseDocumentFrequency(df, totalDocs int) float64 {
+	if df == 0 || totalDocs == 0 {
+		return 0.0
+	}
+	return math.Log(float64(totalDocs) / float64(df))
+}
+
+// token offsets of the term in the stored document text
+func termPositions(term string, doc Document) []int {
+	content := doc.content()
+	if content == "" {
+		return nil
+	}
+	var positions []int
+	i := 0
+	for t := range strings.FieldsSeq(content) {
+		if t == term {
+			positions = append(positions, i)
+		}
+		i++
+	}
+	return positions
+}
+
+// collects the postings of a term; false when it is not in the vocabulary (caller holds the lock)
+func lookupTermPostings(term string) (TermPostings, bool) {
+	result := TermPostings{
+		Term:     term,
+		Postings: []Posting{},
+	}
+	for _, doc := range state.Documents {
+		tf := doc.TermFreq[term]
+		if tf == 0 {
+			continue
+		}
+		result.DocumentFrequency++
+		result.CollectionFrequency += tf
+		result.Postings = append(result.Postings, Posting{
+			FileName:      doc.Name,
+			TermFrequency: tf,
+			Positions:     termPositions(term, doc),
+		})
+	}
+
+	if result.DocumentFrequency == 0 {
+		return result, false
+	}
+	result.IDF = inverseDocumentFrequency(result.DocumentFrequency, len(state.Documents))
+	result.RankedIDF = calculateIDF(term, state.Documents)
+	return result, true
+}
+
+// GET /api/terms/{term}/postings
+func termPostingsHandler(w http.ResponseWriter, r *http.Request) {
+	term := strings.ToLower(r.PathValue("term"))
+
+	state.Lock()
+	defer state.Unlock()
+
+	result, ok := lookupTermPostings(term)
+	if !ok {
+		apierror.Error(w, "Error: Term not found in the vocabulary.", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
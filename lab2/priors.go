@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"ir/internal/apierror"
+)
+
+// PriorConfig sets a query-independent prior per document that ranked searches
+// combine with the relevance score; no prior applies while both parts are unset
+type PriorConfig struct {
+	HalfLifeDays float64 `json:"halfLifeDays" minimum:"0"`     // recency: the prior halves every this many days since the upload, 0 disables
+	BoostField   string  `json:"boostField"`                   // number metadata field that multiplies the prior, missing values count as 1
+	Combine      string  `json:"combine" enum:"|multiply|add"` // "multiply" (default) scales the score, "add" adds weight * prior
+	Weight       float64 `json:"weight" minimum:"0"`           // of the added prior
+}
+
+// PriorExplanation shows how the prior changed a score
+type PriorExplanation struct {
+	Recency    float64 `json:"recency"`
+	FieldBoost float64 `json:"fieldBoost"`
+	Prior      float64 `json:"prior"` // recency * field boost
+	Relevance  float64 `json:"relevance"`
+	Score      float64 `json:"score"`
+}
+
+func (c PriorConfig) enabled() bool {
+	return c.HalfLifeDays > 0 || c.BoostField != ""
+}
+
+// checks the config against the declared metadata types (caller holds the lock)
+func (c PriorConfig) validate() error {
+	if c.HalfLifeDays < 0 || c.Weight < 0 {
+		return fmt.Errorf("halfLifeDays and weight must not be negative")
+	}
+	if c.Combine != "" && c.Combine != "multiply" && c.Combine != "add" {
+		return fmt.Errorf("combine must be 'multiply' or 'add'")
+	}
+	if c.BoostField != "" && state.MetadataTypes[c.BoostField] != "number" {
+		return fmt.Errorf("boostField '%s' must be declared as a number field", c.BoostField)
+	}
+	return nil
+}
+
+// GET /api/priors returns the prior configuration, POST changes it
+func priorsHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		config := state.Priors
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+		if err := config.validate(); err != nil {
+			apierror.Error(w, "Error: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		state.Priors = config
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state.Priors)
+}
+
+// the prior of the document: exponential decay on its upload time, documents
+// without one are not decayed, times the boost field (caller holds the lock)
+func documentPrior(doc Document, config PriorConfig, now time.Time) PriorExplanation {
+	prior := PriorExplanation{Recency: 1, FieldBoost: 1}
+	if config.HalfLifeDays > 0 && !doc.Uploaded.IsZero() {
+		ageDays := max(now.Sub(doc.Uploaded).Hours()/24, 0)
+		prior.Recency = math.Pow(0.5, ageDays/config.HalfLifeDays)
+	}
+	if config.BoostField != "" {
+		if values := state.Metadata[doc.Name][config.BoostField]; len(values) > 0 {
+			if boost, err := parseMetadataValue("number", values[0]); err == nil {
+				prior.FieldBoost = boost
+			}
+		}
+	}
+	prior.Prior = prior.Recency * prior.FieldBoost
+	return prior
+}
+
+// combines each score with the document prior and re-sorts; with explain the
+// results keep the breakdown (caller holds the lock)
+func applyPriors(results []SearchResult, config PriorConfig, explain bool) []SearchResult {
+	now := time.Now()
+	for i := range results {
+		j := documentIndex(results[i].FileName)
+		if j < 0 {
+			continue
+		}
+		prior := documentPrior(state.Documents[j], config, now)
+		prior.Relevance = results[i].Score
+		if config.Combine == "add" {
+			results[i].Score += config.Weight * prior.Prior
+		} else {
+			results[i].Score *= prior.Prior
+		}
+		if explain {
+			prior.Score = results[i].Score
+			results[i].Prior = &prior
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results
+}
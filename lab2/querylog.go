@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"ir/internal/apierror"
+)
+
+// QueryLogEntry records one search
+type QueryLogEntry struct {
+	Query     string    `json:"query"`
+	Time      time.Time `json:"time"`
+	LatencyMs float64   `json:"latencyMs"`
+	Hits      int       `json:"hits"`
+	TopResult string    `json:"topResult,omitempty"`
+	Ranker    string    `json:"ranker,omitempty"`
+}
+
+// queryLogStore keeps the log in memory and appends every entry to a JSON lines file
+type queryLogStore struct {
+	entries []QueryLogEntry
+	file    *os.File // nil keeps the log in memory only
+}
+
+type QueryCount struct {
+	Query    string    `json:"query"`
+	Count    int       `json:"count"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+type LatencyStats struct {
+	Searches int     `json:"searches"`
+	MeanMs   float64 `json:"meanMs"`
+	P50Ms    float64 `json:"p50Ms"`
+	P90Ms    float64 `json:"p90Ms"`
+	P95Ms    float64 `json:"p95Ms"`
+	P99Ms    float64 `json:"p99Ms"`
+	MaxMs    float64 `json:"maxMs"`
+}
+
+// loads earlier entries from the file and keeps it open for appending; an empty path disables persistence
+func openQueryLog(path string) (*queryLogStore, error) {
+	store := &queryLogStore{entries: []QueryLogEntry{}}
+	if path == "" {
+		return store, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry QueryLogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue // skip a torn last line
+		}
+		store.entries = append(store.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	store.file = file
+	return store, nil
+}
+
+func (s *queryLogStore) append(entry QueryLogEntry) {
+	s.entries = append(s.entries, entry)
+	if s.file == nil {
+		return
+	}
+	line, _ := json.Marshal(entry)
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		fmt.Println("Error writing query log:", err)
+	}
+}
+
+// entries newer than the window; a zero window covers the whole log
+func (s *queryLogStore) since(window time.Duration) []QueryLogEntry {
+	if window == 0 {
+		return s.entries
+	}
+	cutoff := time.Now().Add(-window)
+	i := sort.Search(len(s.entries), func(i int) bool {
+		return !s.entries[i].Time.Before(cutoff)
+	})
+	return s.entries[i:]
+}
+
+// records a finished search (caller holds the lock)
+func logQuery(query, ranker string, started time.Time, results []SearchResult) {
+	entry := QueryLogEntry{
+		Query:     strings.Join(strings.Fields(strings.ToLower(query)), " "),
+		Time:      started,
+		LatencyMs: float64(time.Since(started).Microseconds()) / 1000,
+		Hits:      len(results),
+		Ranker:    ranker,
+	}
+	if entry.Query == "" {
+		return
+	}
+	if len(results) > 0 {
+		entry.TopResult = results[0].FileName
+	}
+	state.queryLog.append(entry)
+}
+
+// queries by frequency, most recent first on ties
+func countQueries(entries []QueryLogEntry, keep func(QueryLogEntry) bool) []QueryCount {
+	counts := make(map[string]*QueryCount)
+	for _, entry := range entries {
+		if !keep(entry) {
+			continue
+		}
+		c := counts[entry.Query]
+		if c == nil {
+			c = &QueryCount{Query: entry.Query}
+			counts[entry.Query] = c
+		}
+		c.Count++
+		if entry.Time.After(c.LastSeen) {
+			c.LastSeen = entry.Time
+		}
+	}
+
+	result := make([]QueryCount, 0, len(counts))
+	for _, c := range counts {
+		result = append(result, *c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].LastSeen.After(result[j].LastSeen)
+	})
+	return result
+}
+
+// nearest-rank percentile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank-1, 0)]
+}
+
+func latencyStats(entries []QueryLogEntry) LatencyStats {
+	latencies := make([]float64, len(entries))
+	stats := LatencyStats{Searches: len(entries)}
+	for i, entry := range entries {
+		latencies[i] = entry.LatencyMs
+		stats.MeanMs += entry.LatencyMs / float64(len(entries))
+	}
+	sort.Float64s(latencies)
+	stats.P50Ms = percentile(latencies, 50)
+	stats.P90Ms = percentile(latencies, 90)
+	stats.P95Ms = percentile(latencies, 95)
+	stats.P99Ms = percentile(latencies, 99)
+	if len(latencies) > 0 {
+		stats.MaxMs = latencies[len(latencies)-1]
+	}
+	return stats
+}
+
+// reads the window (e.g. "24h", empty for the whole log) and limit parameters
+func analyticsParams(w http.ResponseWriter, r *http.Request) (time.Duration, int, bool) {
+	if r.Method != http.MethodGet {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return 0, 0, false
+	}
+
+	var window time.Duration
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		var err error
+		if window, err = time.ParseDuration(raw); err != nil || window <= 0 {
+			apierror.Error(w, "Error: Invalid window, use a duration like 24h.", http.StatusBadRequest)
+			return 0, 0, false
+		}
+	}
+	limit, ok := intParam(r, "limit", 10)
+	if !ok || limit <= 0 {
+		apierror.Error(w, "Error: Invalid limit.", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return window, limit, true
+}
+
+// GET /api/analytics/queries?window=24h&limit=10
+func topQueriesHandler(w http.ResponseWriter, r *http.Request) {
+	window, limit, ok := analyticsParams(w, r)
+	if !ok {
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	counts := countQueries(state.queryLog.since(window), func(QueryLogEntry) bool { return true })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(counts[:min(limit, len(counts))])
+}
+
+// GET /api/analytics/zero-results?window=24h&limit=10
+func zeroResultQueriesHandler(w http.ResponseWriter, r *http.Request) {
+	window, limit, ok := analyticsParams(w, r)
+	if !ok {
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	counts := countQueries(state.queryLog.since(window), func(entry QueryLogEntry) bool { return entry.Hits == 0 })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(counts[:min(limit, len(counts))])
+}
+
+// GET /api/analytics/latency?window=1h
+func latencyHandler(w http.ResponseWriter, r *http.Request) {
+	window, _, ok := analyticsParams(w, r)
+	if !ok {
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(latencyStats(state.queryLog.since(window)))
+}
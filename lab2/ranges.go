@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ir/internal/apierror"
+)
+
+// metadata field types; undeclared fields are keywords, matched only as facets
+var metadataTypes = []string{"keyword", "number", "date"}
+
+// dates are accepted in these layouts, compared as points in time
+var dateLayouts = []string{time.RFC3339, "2006-01-02", "2006-01", "2006"}
+
+type MetadataSchemaRequest struct {
+	Types map[string]string `json:"types"` // field -> "keyword", "number" or "date"
+}
+
+// RangeFilter keeps the documents with a value of the field within the bounds;
+// numbers for number fields, dates like "2023-05-01" for date fields
+type RangeFilter struct {
+	Gt  any `json:"gt"`
+	Gte any `json:"gte"`
+	Lt  any `json:"lt"`
+	Lte any `json:"lte"`
+}
+
+// a range filter with its bounds converted for comparison
+type compiledRange struct {
+	fieldType string
+	low, high float64
+	lowOpen   bool // exclusive bounds
+	highOpen  bool
+}
+
+// GET /api/metadata/schema lists the declared field types, POST declares them;
+// the values already set must parse as the new type
+func metadataSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var requestData MetadataSchemaRequest
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+		for field, fieldType := range requestData.Types {
+			if !contains(metadataTypes, fieldType) {
+				apierror.Write(w, http.StatusBadRequest, "invalid_value", fmt.Sprintf("Type of '%s' must be one of %s.", field, quoteAll(metadataTypes)))
+				return
+			}
+			for name, fields := range state.Metadata {
+				for _, value := range fields[field] {
+					if _, err := parseMetadataValue(fieldType, value); err != nil {
+						apierror.Write(w, http.StatusConflict, "conflict", fmt.Sprintf("Value '%s' of '%s' in document '%s' is not a %s.", value, field, name, fieldType))
+						return
+					}
+				}
+			}
+		}
+		for field, fieldType := range requestData.Types {
+			if fieldType == "keyword" {
+				delete(state.MetadataTypes, field)
+			} else {
+				state.MetadataTypes[field] = fieldType
+			}
+		}
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state.MetadataTypes)
+}
+
+// converts a number or date to the number it is compared as
+func parseMetadataValue(fieldType, value string) (float64, error) {
+	if fieldType == "date" {
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				return float64(t.Unix()), nil
+			}
+		}
+		return 0, fmt.Errorf("'%s' is not a date", value)
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a number", value)
+	}
+	return n, nil
+}
+
+// checks the values of typed fields before they are stored (caller holds the lock)
+func checkMetadataTypes(fields DocumentMetadata) error {
+	for field, values := range fields {
+		fieldType, ok := state.MetadataTypes[field]
+		if !ok {
+			continue
+		}
+		for _, value := range values {
+			if _, err := parseMetadataValue(fieldType, value); err != nil {
+				return fmt.Errorf("Field '%s': %v.", field, err)
+			}
+		}
+	}
+	return nil
+}
+
+// parses "field:low..high" ranges of a GET search, either bound may be empty
+func parseRangeParams(ranges []string) map[string]RangeFilter {
+	parsed := map[string]RangeFilter{}
+	for _, raw := range ranges {
+		field, bounds, ok := strings.Cut(raw, ":")
+		if !ok {
+			continue
+		}
+		low, high, _ := strings.Cut(bounds, "..")
+		filter := RangeFilter{}
+		if low != "" {
+			filter.Gte = low
+		}
+		if high != "" {
+			filter.Lte = high
+		}
+		parsed[field] = filter
+	}
+	return parsed
+}
+
+// converts the bounds of the filters by the declared field types (caller holds the lock)
+func compileRanges(filters map[string]RangeFilter) (map[string]compiledRange, error) {
+	compiled := make(map[string]compiledRange, len(filters))
+	for field, filter := range filters {
+		fieldType, ok := state.MetadataTypes[field]
+		if !ok {
+			return nil, fmt.Errorf("Field '%s' is not declared as a number or date, see /api/metadata/schema.", field)
+		}
+		c := compiledRange{fieldType: fieldType, low: math.Inf(-1), high: math.Inf(1)}
+		bound := func(raw any, target *float64, open *bool, exclusive bool) error {
+			if raw == nil {
+				return nil
+			}
+			value := fmt.Sprint(raw)
+			if n, isNumber := raw.(float64); isNumber {
+				value = strconv.FormatFloat(n, 'f', -1, 64) // years stay "2019", not "2.019e+03"
+			}
+			n, err := parseMetadataValue(fieldType, value)
+			if err != nil {
+				return fmt.Errorf("Range of '%s': %v.", field, err)
+			}
+			*target, *open = n, exclusive
+			return nil
+		}
+		for _, err := range []error{
+			bound(filter.Gte, &c.low, &c.lowOpen, false),
+			bound(filter.Gt, &c.low, &c.lowOpen, true),
+			bound(filter.Lte, &c.high, &c.highOpen, false),
+			bound(filter.Lt, &c.high, &c.highOpen, true),
+		} {
+			if err != nil {
+				return nil, err
+			}
+		}
+		compiled[field] = c
+	}
+	return compiled, nil
+}
+
+// reports whether the document has a value within every range (caller holds the lock)
+func matchesRanges(name string, ranges map[string]compiledRange) bool {
+	for field, c := range ranges {
+		found := false
+		for _, value := range state.Metadata[name][field] {
+			n, err := parseMetadataValue(c.fieldType, value)
+			if err != nil {
+				continue
+			}
+			aboveLow := n > c.low || !c.lowOpen && n == c.low
+			belowHigh := n < c.high || !c.highOpen && n == c.high
+			if aboveLow && belowHigh {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"ir/internal/apierror"
+)
+
+// default persistence of rank-biased overlap: the top 10 carry ~86% of the weight
+const defaultRBOPersistence = 0.9
+
+type RankCorrelation struct {
+	RankingA    []string `json:"rankingA"`
+	RankingB    []string `json:"rankingB"`
+	CommonItems int      `json:"commonItems"`
+
+	// computed over the common items, null when fewer than two are shared
+	KendallTau *float64 `json:"kendallTau"`
+	Spearman   *float64 `json:"spearman"`
+
+	RBO            float64 `json:"rbo"` // extrapolated rank-biased overlap
+	RBOPersistence float64 `json:"rboPersistence"`
+}
+
+// removes repeated items, keeping the first occurrence
+func dedupeRanking(ranking []string) []string {
+	seen := make(map[string]bool, len(ranking))
+	result := make([]string, 0, len(ranking))
+	for _, item := range ranking {
+		if !seen[item] {
+			seen[item] = true
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// ranks of the items present in both rankings, in the order of the first one
+func commonRanks(a, b []string) ([]int, []int) {
+	positionB := make(map[string]int, len(b))
+	for i, item := range b {
+		positionB[item] = i
+	}
+
+	var ranksA, ranksB []int
+	for i, item := range a {
+		if j, ok := positionB[item]; ok {
+			ranksA = append(ranksA, i)
+			ranksB = append(ranksB, j)
+		}
+	}
+	return ranksA, ranksB
+}
+
+// Kendall tau over paired ranks without ties
+func kendallTau(ranksA, ranksB []int) float64 {
+	n := len(ranksA)
+	concordant, discordant := 0, 0
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			if (ranksA[i]-ranksA[j])*(ranksB[i]-ranksB[j]) > 0 {
+				concordant++
+			} else {
+				discordant++
+			}
+		}
+	}
+	return float64(concordant-discordant) / float64(n*(n-1)/2)
+}
+
+// Spearman rho over paired ranks, re-ranked within the common items
+func spearman(ranksA, ranksB []int) float64 {
+	n := len(ranksA)
+	denseA, denseB := denseRanks(ranksA), denseRanks(ranksB)
+	sumSq := 0.0
+	for i := range n {
+		d := float64(denseA[i] - denseB[i])
+		sumSq += d * d
+	}
+	return 1 - 6*sumSq/(float64(n)*(float64(n)*float64(n)-1))
+}
+
+// replaces sparse positions by their order 0..n-1
+func denseRanks(ranks []int) []int {
+	dense := make([]int, len(ranks))
+	for i, r := range ranks {
+		for _, other := range ranks {
+			if other < r {
+				dense[i]++
+			}
+		}
+	}
+	return dense
+}
+
+// extrapolated rank-biased overlap (Webber et al., 2010) of two rankings of possibly
+// different lengths
+func rankBiasedOverlap(a, b []string, p float64) float64 {
+	short, long := a, b
+	if len(short) > len(long) {
+		short, long = long, short
+	}
+	s, l := len(short), len(long)
+	if s == 0 {
+		if l == 0 {
+			return 1.0
+		}
+		return 0.0
+	}
+
+	inShort := make(map[string]bool, s)
+	inLong := make(map[string]bool, l)
+	overlap := make([]float64, l+1) // overlap[d] = |short[:min(d,s)] ∩ long[:d]|
+	seen := 0.0
+	for d := 1; d <= l; d++ {
+		x := long[d-1]
+		inLong[x] = true
+		if inShort[x] {
+			seen++
+		}
+		if d <= s {
+			y := short[d-1]
+			inShort[y] = true
+			if inLong[y] { // also covers x == y, which was not yet in short above
+				seen++
+			}
+		}
+		overlap[d] = seen
+	}
+
+	sum := 0.0
+	weight := 1.0
+	for d := 1; d <= l; d++ {
+		weight *= p
+		sum += overlap[d] / float64(d) * weight
+		if d > s {
+			sum += overlap[s] * float64(d-s) / float64(s*d) * weight
+		}
+	}
+	xs, xl := overlap[s], overlap[l]
+	return (1-p)/p*sum + ((xl-xs)/float64(l)+xs/float64(s))*weight
+}
+
+func rankCorrelation(a, b []string, p float64) RankCorrelation {
+	a, b = dedupeRanking(a), dedupeRanking(b)
+	ranksA, ranksB := commonRanks(a, b)
+
+	result := RankCorrelation{
+		RankingA:       a,
+		RankingB:       b,
+		CommonItems:    len(ranksA),
+		RBO:            rankBiasedOverlap(a, b, p),
+		RBOPersistence: p,
+	}
+	if len(ranksA) >= 2 {
+		tau, rho := kendallTau(ranksA, ranksB), spearman(ranksA, ranksB)
+		result.KendallTau, result.Spearman = &tau, &rho
+	}
+	return result
+}
+
+// names of the ranked results of a query, normalized as searches are (caller holds the lock)
+func queryRanking(query string) []string {
+	ranking := []string{}
+	for _, result := range search(normalizeQuery(query)) {
+		ranking = append(ranking, result.FileName)
+	}
+	return ranking
+}
+
+type RankCorrelationRequest struct {
+	RankingA    []string `json:"rankingA"`
+	RankingB    []string `json:"rankingB"`
+	QueryA      string   `json:"queryA"`
+	QueryB      string   `json:"queryB"`
+	Persistence float64  `json:"persistence" maximum:"1"`
+}
+
+// POST /api/rank-correlation {"rankingA": [...], "rankingB": [...]} or {"queryA": "...", "queryB": "..."}
+func rankCorrelationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData RankCorrelationRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		apierror.InvalidJSON(w)
+		return
+	}
+	if requestData.Persistence == 0 {
+		requestData.Persistence = defaultRBOPersistence
+	}
+	if requestData.Persistence <= 0 || requestData.Persistence >= 1 {
+		apierror.Error(w, "Error: persistence must be between 0 and 1.", http.StatusBadRequest)
+		return
+	}
+
+	rankingA, rankingB := requestData.RankingA, requestData.RankingB
+	if strings.TrimSpace(requestData.QueryA) != "" || strings.TrimSpace(requestData.QueryB) != "" {
+		state.Lock()
+		rankingA, rankingB = queryRanking(requestData.QueryA), queryRanking(requestData.QueryB)
+		state.Unlock()
+	}
+	if len(rankingA) == 0 && len(rankingB) == 0 {
+		apierror.Error(w, "Error: Provide two rankings or two queries.", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rankCorrelation(rankingA, rankingB, requestData.Persistence))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestKendallTauAndSpearman(t *testing.T) {
+	tests := []struct {
+		name           string
+		ranksA, ranksB []int
+		tau, rho       float64
+	}{
+		{"identical", []int{0, 1, 2, 3}, []int{0, 1, 2, 3}, 1, 1},
+		{"reversed", []int{0, 1, 2, 3}, []int{3, 2, 1, 0}, -1, -1},
+		// one discordant pair of three; squared rank differences 1+1+0
+		{"one swap", []int{0, 1, 2}, []int{1, 0, 2}, 1.0 / 3, 0.5},
+		// positions in longer rankings count only by their order
+		{"sparse positions", []int{0, 2, 5}, []int{1, 4, 9}, 1, 1},
+	}
+	for _, test := range tests {
+		if got := kendallTau(test.ranksA, test.ranksB); math.Abs(got-test.tau) > 1e-9 {
+			t.Errorf("kendallTau(%s) = %g, want %g", test.name, got, test.tau)
+		}
+		if got := spearman(test.ranksA, test.ranksB); math.Abs(got-test.rho) > 1e-9 {
+			t.Errorf("spearman(%s) = %g, want %g", test.name, got, test.rho)
+		}
+	}
+}
+
+func TestRankBiasedOverlap(t *testing.T) {
+	const p = 0.9
+	tests := []struct {
+		name string
+		a, b []string
+		want float64
+	}{
+		{"identical", []string{"a", "b", "c"}, []string{"a", "b", "c"}, 1},
+		{"reversed", []string{"a", "b"}, []string{"b", "a"}, p}, // agreement only from depth 2
+		{"disjoint", []string{"a", "b"}, []string{"c", "d"}, 0},
+		{"both empty", nil, nil, 1},
+		{"one empty", []string{"a"}, nil, 0},
+		// the shorter ranking is extrapolated to agree beyond its end
+		{"uneven prefix", []string{"a"}, []string{"a", "b"}, 1},
+		{"uneven", []string{"a", "b"}, []string{"b"}, p / 2},
+	}
+	for _, test := range tests {
+		if got := rankBiasedOverlap(test.a, test.b, p); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("rankBiasedOverlap(%s) = %g, want %g", test.name, got, test.want)
+		}
+		if got := rankBiasedOverlap(test.b, test.a, p); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("rankBiasedOverlap(%s, swapped) = %g, want %g", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRankCorrelation(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     []string
+		common   int
+		tau, rho *float64 // nil when fewer than two items are shared
+	}{
+		{"identical", []string{"a", "b", "c"}, []string{"a", "b", "c"}, 3, ptr(1.0), ptr(1.0)},
+		{"reversed", []string{"a", "b", "c"}, []string{"c", "b", "a"}, 3, ptr(-1.0), ptr(-1.0)},
+		{"disjoint", []string{"a", "b"}, []string{"c", "d"}, 0, nil, nil},
+		{"uneven", []string{"a", "b", "c", "d"}, []string{"b", "a"}, 2, ptr(-1.0), ptr(-1.0)},
+		{"repeated items", []string{"a", "a", "b"}, []string{"a", "b", "b"}, 2, ptr(1.0), ptr(1.0)},
+		{"one shared", []string{"a", "b"}, []string{"b", "c"}, 1, nil, nil},
+	}
+	equal := func(got, want *float64) bool {
+		if got == nil || want == nil {
+			return got == want
+		}
+		return math.Abs(*got-*want) < 1e-9
+	}
+	format := func(v *float64) any {
+		if v == nil {
+			return nil
+		}
+		return *v
+	}
+	for _, test := range tests {
+		got := rankCorrelation(test.a, test.b, defaultRBOPersistence)
+		if got.CommonItems != test.common {
+			t.Errorf("rankCorrelation(%s): %d common items, want %d", test.name, got.CommonItems, test.common)
+		}
+		if !equal(got.KendallTau, test.tau) || !equal(got.Spearman, test.rho) {
+			t.Errorf("rankCorrelation(%s): tau %v, rho %v, want %v, %v", test.name, format(got.KendallTau), format(got.Spearman), format(test.tau), format(test.rho))
+		}
+	}
+}
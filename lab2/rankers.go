@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"ir/internal/engine"
+)
+
+// corpusView is the collection as one request ranks it: the documents and what
+// the rankers derive from them, taken together under the lock. Inserts,
+// replacements and deletes swap state.Documents and the statistics for new
+// copies rather than changing them, so the view stays the same while the
+// request ranks without the lock, however many rankings it runs.
+type corpusView struct {
+	docs       []Document
+	collection engine.CollectionStats
+	vectors    *vectorCache // with the LSI model, for folding in the query
+	lsi        *lsiModel
+	ltr        *ltrModel
+	embedder   EmbedderConfig
+	embeddings [][]float32 // by document, only when a dense ranker was asked for
+	reranker   RerankerConfig
+}
+
+// takes the view for the given rankers; the documents without an embedding are
+// embedded first when one of them is dense (caller holds the lock)
+func snapshotCorpus(rankers ...string) (*corpusView, error) {
+	view := &corpusView{
+		docs:       state.Documents,
+		collection: scoringStats(),
+		lsi:        state.lsi,
+		ltr:        state.ltr,
+		embedder:   state.Embedder,
+		reranker:   state.Reranker,
+	}
+	if view.lsi != nil {
+		view.vectors = documentVectors()
+	}
+	if slices.Contains(rankers, "dense") || slices.Contains(rankers, "hybrid") {
+		if err := ensureEmbeddings(); err != nil {
+			return nil, err
+		}
+		view.embeddings = make([][]float32, len(view.docs))
+		for i, doc := range view.docs {
+			view.embeddings[i] = state.Embeddings[doc.Name]
+		}
+	}
+	return view, nil
+}
+
+// ranks the documents of the view for the query with the selected ranker;
+// hybrid options may be nil; "term^2" boosts are weighted by the cosine ranker
+// and ignored by the others
+func (v *corpusView) rank(ranker, query string, hybrid *HybridOptions) ([]SearchResult, error) {
+	if ranker != "" && ranker != "cosine" {
+		query = stripBoosts(query)
+	}
+	switch ranker {
+	case "", "cosine":
+		return cosineSearch(v.docs, query), nil
+	case "bm25":
+		return scoreDocuments(bm25Scorer, query, v.docs, v.collection), nil
+	case "lsi":
+		return v.lsiSearch(query)
+	case "dense":
+		return v.denseSearch(query)
+	case "ltr":
+		return v.ltrSearch(query)
+	case "hybrid":
+		if hybrid == nil {
+			hybrid = &HybridOptions{}
+		}
+		return v.hybridSearch(query, *hybrid)
+	}
+	scorer, ok, err := lookupScorer(ranker)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return scoreDocuments(scorer, query, v.docs, v.collection), nil
+	}
+	return nil, fmt.Errorf("unknown ranker '%s'", ranker)
+}
+
+// the document of the view with the name, nil when it has none
+func (v *corpusView) document(name string) *Document {
+	for i := range v.docs {
+		if v.docs[i].Name == name {
+			return &v.docs[i]
+		}
+	}
+	return nil
+}
+
+// drops the results for documents deleted since the view was taken (caller holds the lock)
+func liveResults(results []SearchResult) []SearchResult {
+	live := make(map[string]bool, len(state.Documents))
+	for _, doc := range state.Documents {
+		live[doc.Name] = true
+	}
+	return slices.DeleteFunc(results, func(result SearchResult) bool { return !live[result.FileName] })
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"time"
+
+	"ir/internal/apierror"
+)
+
+// limits of /api/search?mode=regex; Go regular expressions run in linear time,
+// the caps bound the size of the compiled program and the total work per request
+const (
+	maxRegexLength       = 1000
+	maxRegexInstructions = 10000
+	maxRegexMatches      = 10000 // matches counted per document
+	maxRegexMatchText    = 200   // bytes of the first match returned
+	regexTimeout         = 2 * time.Second
+)
+
+// RegexSearchResponse is returned by /api/search?mode=regex
+type RegexSearchResponse struct {
+	TookMs    float64     `json:"tookMs"`
+	TotalHits int         `json:"totalHits"` // matching documents before the limit
+	TimedOut  bool        `json:"timedOut"`  // the documents after the timeout were not searched
+	Results   []TextMatch `json:"results"`
+}
+
+// TextMatch is a document matched by a regular expression or a substring
+type TextMatch struct {
+	FileName    string `json:"fileName"`
+	Matches     int    `json:"matches"` // at most maxRegexMatches
+	FirstOffset int    `json:"firstOffset"`
+	FirstMatch  string `json:"firstMatch"`
+}
+
+// compiles the expression, rejecting those whose program exceeds the caps
+func compileRegex(expr string) (*regexp.Regexp, error) {
+	if len(expr) > maxRegexLength {
+		return nil, fmt.Errorf("regular expression is longer than %d characters", maxRegexLength)
+	}
+	parsed, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	prog, err := syntax.Compile(parsed.Simplify())
+	if err != nil {
+		return nil, err
+	}
+	if len(prog.Inst) > maxRegexInstructions {
+		return nil, fmt.Errorf("regular expression is too complex")
+	}
+	return regexp.Compile(expr)
+}
+
+// answers /api/search?mode=regex with the documents whose text as uploaded
+// matches the query, most matches first (caller holds the lock)
+func regexSearchHandler(w http.ResponseWriter, r *http.Request, requestData SearchRequest, inSubset func(string) bool, started time.Time) {
+	re, err := compileRegex(requestData.Query)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_query", "Invalid regular expression: "+err.Error())
+		return
+	}
+
+	response := RegexSearchResponse{Results: []TextMatch{}}
+	deadline := started.Add(regexTimeout)
+	for _, doc := range state.Documents {
+		if time.Now().After(deadline) {
+			response.TimedOut = true
+			break
+		}
+		if !inSubset(doc.Name) {
+			continue
+		}
+		text := searchableText(doc)
+		matches := re.FindAllStringIndex(text, maxRegexMatches)
+		if len(matches) == 0 {
+			continue
+		}
+		first := matches[0]
+		response.Results = append(response.Results, TextMatch{
+			FileName:    doc.Name,
+			Matches:     len(matches),
+			FirstOffset: first[0],
+			FirstMatch:  strings.ToValidUTF8(text[first[0]:min(first[1], first[0]+maxRegexMatchText)], ""),
+		})
+	}
+	sort.SliceStable(response.Results, func(i, j int) bool {
+		return response.Results[i].Matches > response.Results[j].Matches
+	})
+	response.TotalHits = len(response.Results)
+	if requestData.Limit > 0 && len(response.Results) > requestData.Limit {
+		response.Results = response.Results[:requestData.Limit]
+	}
+
+	results := make([]SearchResult, len(response.Results))
+	for i, match := range response.Results {
+		results[i] = SearchResult{FileName: match.FileName, Score: float64(match.Matches)}
+	}
+	logQuery(requestData.Query, "regex", started, results)
+
+	if format := negotiateFormat(w, r); format != "json" {
+		writeTable(w, format, matchesTable(response.Results))
+		return
+	}
+	response.TookMs = float64(time.Since(started).Microseconds()) / 1000
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
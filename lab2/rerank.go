@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"ir/internal/apierror"
+)
+
+// RerankerConfig points at an external cross-encoder service
+type RerankerConfig struct {
+	URL       string `json:"url"`                   // empty disables reranking
+	TopN      int    `json:"topN" minimum:"1"`      // candidates sent for reranking
+	TimeoutMs int    `json:"timeoutMs" minimum:"1"` // after this the original ranking is kept
+}
+
+var defaultRerankerConfig = RerankerConfig{TopN: 20, TimeoutMs: 2000}
+
+func (c RerankerConfig) validate() error {
+	if c.TopN <= 0 || c.TimeoutMs <= 0 {
+		return fmt.Errorf("topN and timeoutMs must be positive")
+	}
+	return nil
+}
+
+// asks the reranker to score the candidate texts for the query; the service
+// receives {"query", "documents": [...]} and returns {"results": [{"index", "score"}]}
+func callReranker(config RerankerConfig, query string, texts []string) ([]float64, error) {
+	body, _ := json.Marshal(map[string]interface{}{"query": query, "documents": texts})
+	client := &http.Client{Timeout: time.Duration(config.TimeoutMs) * time.Millisecond}
+
+	resp, err := client.Post(config.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("reranker request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("reranker returned %s", resp.Status)
+	}
+
+	var result struct {
+		Results []struct {
+			Index          int      `json:"index"`
+			Score          *float64 `json:"score"`
+			RelevanceScore *float64 `json:"relevance_score"` // Cohere/Jina naming
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid reranker response: %v", err)
+	}
+
+	scores := make([]float64, len(texts))
+	seen := make([]bool, len(texts))
+	for _, item := range result.Results {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("reranker returned an invalid index")
+		}
+		switch {
+		case item.Score != nil:
+			scores[item.Index] = *item.Score
+		case item.RelevanceScore != nil:
+			scores[item.Index] = *item.RelevanceScore
+		default:
+			return nil, fmt.Errorf("reranker returned no score for candidate %d", item.Index)
+		}
+		seen[item.Index] = true
+	}
+	for i, ok := range seen {
+		if !ok {
+			return nil, fmt.Errorf("reranker returned no score for candidate %d", i)
+		}
+	}
+	return scores, nil
+}
+
+// reorders the top-N results by the reranker scores, which replace their scores;
+// on failure the original ranking is returned with the error
+func (v *corpusView) rerank(query string, results []SearchResult) ([]SearchResult, error) {
+	config := v.reranker
+	if config.URL == "" {
+		return results, fmt.Errorf("no reranker configured")
+	}
+
+	n := min(config.TopN, len(results))
+	texts := make([]string, n)
+	for i, result := range results[:n] {
+		if doc := v.document(result.FileName); doc != nil {
+			texts[i] = documentText(*doc)
+		}
+	}
+
+	scores, err := callReranker(config, query, texts)
+	if err != nil {
+		return results, err
+	}
+
+	reranked := append([]SearchResult{}, results...)
+	for i := range n {
+		reranked[i].Score = scores[i]
+	}
+	sort.SliceStable(reranked[:n], func(i, j int) bool {
+		return reranked[i].Score > reranked[j].Score
+	})
+
+	return reranked, nil
+}
+
+// reads or replaces the reranker configuration
+func rerankerConfigHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		config := defaultRerankerConfig
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+		if err := config.validate(); err != nil {
+			apierror.Error(w, "Error: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		state.Reranker = config
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state.Reranker)
+}
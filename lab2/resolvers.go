@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// document as exposed over GraphQL
+type DocumentInfo struct {
+	Name        string `json:"name"`
+	Length      int    `json:"length"`
+	UniqueTerms int    `json:"uniqueTerms"`
+	Content     string `json:"content"`
+	Label       string `json:"label"`
+	ETag        string `json:"etag"`
+	Version     int    `json:"version"`
+}
+
+type ShapedSearchResult struct {
+	FileName string        `json:"fileName"`
+	Score    float64       `json:"score"`
+	Snippet  string        `json:"snippet"`
+	Document *DocumentInfo `json:"document"` // metadata of the matching document, when selected
+}
+
+// term statistics without the postings
+type TermStats struct {
+	Term                string  `json:"term"`
+	DocumentFrequency   int     `json:"documentFrequency"`
+	CollectionFrequency int     `json:"collectionFrequency"`
+	IDF                 float64 `json:"idf"`
+	RankedIDF           float64 `json:"rankedIdf"`
+}
+
+// Collection is the set of documents sharing a class label
+type Collection struct {
+	Name      string         `json:"name"`
+	Size      int            `json:"size"`
+	Documents []DocumentInfo `json:"documents"`
+}
+
+type ShapedSearchResponse struct {
+	Results         []ShapedSearchResult  `json:"results"`
+	Coverage        QueryCoverage         `json:"coverage"`
+	Ambiguous       bool                  `json:"ambiguous"`
+	Interpretations []QueryInterpretation `json:"interpretations"`
+}
+
+// the content, ETag and version are read only when selected, they need the stored text
+func documentInfo(doc Document, field *gqlField) DocumentInfo {
+	info := DocumentInfo{
+		Name:        doc.Name,
+		Length:      doc.Length,
+		UniqueTerms: len(doc.TermFreq),
+		Label:       state.Labels[doc.Name],
+	}
+	if field.selected("content") != nil {
+		info.Content = doc.content()
+	}
+	if field.selected("etag") != nil {
+		info.ETag = documentETag(doc)
+	}
+	if field.selected("version") != nil {
+		info.Version = documentHistory(doc.Name).Current
+	}
+	return info
+}
+
+// documents grouped by their class label, largest collection first
+func labelCollections(field *gqlField) []Collection {
+	byLabel := map[string]*Collection{}
+	collections := []Collection{}
+	documentsField := field.selected("documents")
+	for _, doc := range state.Documents {
+		label := state.Labels[doc.Name]
+		if label == "" {
+			continue
+		}
+		c := byLabel[label]
+		if c == nil {
+			c = &Collection{Name: label, Documents: []DocumentInfo{}}
+			byLabel[label] = c
+		}
+		c.Size++
+		if documentsField != nil {
+			c.Documents = append(c.Documents, documentInfo(doc, documentsField))
+		}
+	}
+	for _, c := range byLabel {
+		collections = append(collections, *c)
+	}
+	sort.Slice(collections, func(i, j int) bool {
+		if collections[i].Size != collections[j].Size {
+			return collections[i].Size > collections[j].Size
+		}
+		return collections[i].Name < collections[j].Name
+	})
+	return collections
+}
+
+// resolves a root field of the Query type (caller holds the lock)
+//
+//	documents(offset: Int, limit: Int): [Document]
+//	document(name: String!): Document
+//	search(query: String!, limit: Int, ranker: String): SearchResponse
+//	term(term: String!): TermPostings
+//	termStats(terms: [String!]!): [TermStats]
+//	collections: [Collection]
+//	collection(name: String!): Collection
+//	stats(top: Int): CollectionStats
+func resolveQueryField(field *gqlField, rankings map[*gqlField]fieldRanking) (interface{}, error) {
+	switch field.Name {
+	case "documents":
+		offset, limit := intArg(field, "offset", 0), intArg(field, "limit", len(state.Documents))
+		docs := []DocumentInfo{}
+		for i := max(offset, 0); i < len(state.Documents) && len(docs) < limit; i++ {
+			docs = append(docs, documentInfo(state.Documents[i], field))
+		}
+		return docs, nil
+
+	case "document":
+		name, ok := stringArg(field, "name")
+		if !ok {
+			return nil, fmt.Errorf("argument 'name' is required")
+		}
+		for _, doc := range state.Documents {
+			if doc.Name == name {
+				return documentInfo(doc, field), nil
+			}
+		}
+		return nil, nil
+
+	case "search":
+		query, ok := stringArg(field, "query")
+		if !ok {
+			return nil, fmt.Errorf("argument 'query' is required")
+		}
+		return resolveSearch(field, query, rankings[field])
+
+	case "term":
+		term, ok := stringArg(field, "term")
+		if !ok {
+			return nil, fmt.Errorf("argument 'term' is required")
+		}
+		if postings, found := lookupTermPostings(strings.ToLower(term)); found {
+			return postings, nil
+		}
+		return nil, nil
+
+	case "termStats":
+		terms, ok := field.Args["terms"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("argument 'terms' is required")
+		}
+		stats := []TermStats{}
+		for _, value := range terms {
+			term, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("argument 'terms' must be a list of strings")
+			}
+			postings, _ := lookupTermPostings(strings.ToLower(term))
+			stats = append(stats, TermStats{
+				Term:                postings.Term,
+				DocumentFrequency:   postings.DocumentFrequency,
+				CollectionFrequency: postings.CollectionFrequency,
+				IDF:                 postings.IDF,
+				RankedIDF:           postings.RankedIDF,
+			})
+		}
+		return stats, nil
+
+	case "collections":
+		return labelCollections(field), nil
+
+	case "collection":
+		name, ok := stringArg(field, "name")
+		if !ok {
+			return nil, fmt.Errorf("argument 'name' is required")
+		}
+		for _, c := range labelCollections(field) {
+			if c.Name == name {
+				return c, nil
+			}
+		}
+		return nil, nil
+
+	case "stats":
+		return collectionStats(intArg(field, "top", 20)), nil
+	}
+	return nil, fmt.Errorf("cannot query field '%s' on 'Query'", field.Name)
+}
+
+// fieldRanking is the ranking of a search field, done before the lock is taken
+type fieldRanking struct {
+	results []SearchResult
+	err     error
+}
+
+// ranks every search field over the same view of the collection without the lock
+func rankSearchFields(selections []*gqlField) map[*gqlField]fieldRanking {
+	var searches []*gqlField
+	var rankers []string
+	for _, field := range selections {
+		if field.Name == "search" {
+			ranker, _ := stringArg(field, "ranker")
+			searches, rankers = append(searches, field), append(rankers, ranker)
+		}
+	}
+	if len(searches) == 0 {
+		return nil
+	}
+
+	state.Lock()
+	view, err := snapshotCorpus(rankers...)
+	state.Unlock()
+	rankings := make(map[*gqlField]fieldRanking, len(searches))
+	for i, field := range searches {
+		query, ok := stringArg(field, "query")
+		if !ok {
+			continue // reported by resolveQueryField
+		}
+		if err != nil {
+			rankings[field] = fieldRanking{err: err}
+			continue
+		}
+		results, err := view.rank(rankers[i], normalizeQuery(query), nil)
+		rankings[field] = fieldRanking{results: results, err: err}
+	}
+	return rankings
+}
+
+// shapes the ranking of the search, computing snippets, document metadata and
+// interpretations only when selected (caller holds the lock)
+func resolveSearch(field *gqlField, query string, ranking fieldRanking) (ShapedSearchResponse, error) {
+	response := ShapedSearchResponse{
+		Results:         []ShapedSearchResult{},
+		Coverage:        queryCoverage(unrewritten(query)),
+		Interpretations: []QueryInterpretation{},
+	}
+
+	limit := intArg(field, "limit", 0)
+	if ranking.err != nil {
+		return response, ranking.err
+	}
+	results := liveResults(ranking.results)
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	wantSnippets := false
+	var documentField *gqlField
+	if resultsField := field.selected("results"); resultsField != nil {
+		wantSnippets = resultsField.selected("snippet") != nil
+		documentField = resultsField.selected("document")
+	}
+	queryTerms := strings.Fields(strings.ToLower(query))
+	for _, result := range results {
+		shaped := ShapedSearchResult{FileName: result.FileName, Score: result.Score}
+		if i := documentIndex(result.FileName); i >= 0 && (wantSnippets || documentField != nil) {
+			doc := state.Documents[i]
+			if wantSnippets {
+				shaped.Snippet = documentSnippet(doc, queryTerms)
+			}
+			if documentField != nil {
+				info := documentInfo(doc, documentField)
+				shaped.Document = &info
+			}
+		}
+		response.Results = append(response.Results, shaped)
+	}
+
+	if field.selected("ambiguous") != nil || field.selected("interpretations") != nil {
+		response.Interpretations = queryInterpretations(query)
+		response.Ambiguous = isAmbiguous(response.Interpretations)
+	}
+	return response, nil
+}
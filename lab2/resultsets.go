@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"ir/internal/apierror"
+	"ir/internal/engine"
+)
+
+// ResultSet is a saved list of matching documents, kept by name so that it
+// survives changes of the collection
+type ResultSet struct {
+	Name      string   `json:"name"`
+	Query     string   `json:"query"` // query or set expression that produced it
+	Documents []string `json:"documents"`
+}
+
+type ResultSetRequest struct {
+	Name  string `json:"name" maxLength:"200"`
+	Query string `json:"query" maxLength:"10000"` // boolean query
+}
+
+type CombineRequest struct {
+	Op   string   `json:"op" enum:"union|intersection|difference"`
+	Sets []string `json:"sets"`
+	Name string   `json:"name" maxLength:"200"` // saves the outcome under this name when set
+}
+
+type MaterializeRequest struct {
+	Name       string `json:"name"`                       // of the result set
+	Collection string `json:"collection" maxLength:"200"` // name of the new collection, that of the set by default
+}
+
+// positions of the saved documents that are still in the collection (caller holds the lock)
+func resultSetPostings(set ResultSet) engine.Postings {
+	wanted := make(map[string]bool, len(set.Documents))
+	for _, name := range set.Documents {
+		wanted[name] = true
+	}
+	postings := engine.Postings{}
+	for i, doc := range state.Documents {
+		if wanted[doc.Name] {
+			postings = append(postings, i)
+		}
+	}
+	return postings
+}
+
+func postingsNames(postings engine.Postings) []string {
+	names := make([]string, 0, len(postings))
+	for _, i := range postings {
+		names = append(names, state.Documents[i].Name)
+	}
+	return names
+}
+
+// combines saved sets from left to right with the given operation (caller holds the lock)
+func combineResultSets(op string, names []string) (engine.Postings, error) {
+	if len(names) < 2 {
+		return nil, fmt.Errorf("at least two result sets are required")
+	}
+
+	var result engine.Postings
+	for i, name := range names {
+		set, ok := state.ResultSets[name]
+		if !ok {
+			return nil, fmt.Errorf("result set '%s' not found", name)
+		}
+		postings := resultSetPostings(set)
+		if i == 0 {
+			result = postings
+			continue
+		}
+		switch op {
+		case "union":
+			result = engine.Union(result, postings)
+		case "intersection":
+			result = engine.Intersect(result, postings)
+		case "difference":
+			result = engine.Subtract(result, postings)
+		default:
+			return nil, fmt.Errorf("unknown operation '%s'", op)
+		}
+	}
+	return result, nil
+}
+
+// lists, saves (from a boolean query) and deletes result sets
+func resultSetsHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		sets := make([]ResultSet, 0, len(state.ResultSets))
+		for _, set := range state.ResultSets {
+			sets = append(sets, set)
+		}
+		sort.Slice(sets, func(i, j int) bool {
+			return sets[i].Name < sets[j].Name
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sets)
+
+	case http.MethodPost:
+		var requestData ResultSetRequest
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+
+		name := strings.TrimSpace(requestData.Name)
+		query := strings.ToLower(strings.TrimSpace(requestData.Query))
+		if name == "" || query == "" {
+			apierror.Error(w, "Error: Result set name and query are required.", http.StatusBadRequest)
+			return
+		}
+
+		results, _, err := booleanSearch(normalizeQuery(query))
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, "invalid_query", "Invalid query: "+err.Error())
+			return
+		}
+
+		set := ResultSet{Name: name, Query: query, Documents: results}
+		state.ResultSets[name] = set
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(set)
+
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		if _, ok := state.ResultSets[name]; !ok {
+			apierror.Error(w, "Error: Result set not found.", http.StatusNotFound)
+			return
+		}
+		delete(state.ResultSets, name)
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// computes the union, intersection or difference of saved result sets,
+// optionally saving the outcome as a new set
+func combineResultSetsHandler(w http.ResponseWriter, r *http.Request) {
+	var requestData CombineRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		apierror.InvalidJSON(w)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	postings, err := combineResultSets(requestData.Op, requestData.Sets)
+	if err != nil {
+		apierror.Error(w, "Error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	set := ResultSet{
+		Name:      strings.TrimSpace(requestData.Name),
+		Query:     requestData.Op + "(" + strings.Join(requestData.Sets, ", ") + ")",
+		Documents: postingsNames(postings),
+	}
+	if set.Name != "" {
+		state.ResultSets[set.Name] = set
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(set)
+}
+
+// copies the documents of a result set into a new named collection; the working
+// collection keeps all of its documents
+func materializeResultSetHandler(w http.ResponseWriter, r *http.Request) {
+	var requestData MaterializeRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		apierror.InvalidJSON(w)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	set, ok := state.ResultSets[requestData.Name]
+	if !ok {
+		apierror.Error(w, "Error: Result set not found.", http.StatusNotFound)
+		return
+	}
+
+	name := strings.TrimSpace(requestData.Collection)
+	if name == "" {
+		name = set.Name
+	}
+	if _, exists := state.Collections[name]; exists {
+		apierror.Write(w, http.StatusConflict, "already_exists", "Collection '"+name+"' already exists.")
+		return
+	}
+	c := materializeCollection(set.Name, resultSetPostings(set))
+	state.Collections[name] = c
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(c.summary(name))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ir/internal/engine"
+)
+
+// Okapi BM25 with the usual parameters
+var bm25Scorer = engine.BM25{K1: 1.2, B: 0.75}
+
+func termStats(doc Document) engine.TermStats {
+	return engine.TermStats{TermFreq: doc.TermFreq, Length: doc.Length}
+}
+
+// returns the cached collection statistics, building them if needed or adding
+// the documents indexed since as a new copy (caller holds the lock)
+func scoringStats() engine.CollectionStats {
+	if state.collection != nil && len(state.unscored) > 0 {
+		docs := make([]engine.TermStats, len(state.unscored))
+		for i, doc := range state.unscored {
+			docs[i] = termStats(doc)
+		}
+		stats := state.collection.WithDocuments(docs)
+		state.collection, state.unscored = &stats, nil
+	}
+	if state.collection != nil {
+		return *state.collection
+	}
+	docs := make([]engine.TermStats, len(state.Documents))
+	for i, doc := range state.Documents {
+		docs[i] = termStats(doc)
+	}
+	stats := engine.NewCollectionStats(docs)
+	state.collection = &stats
+	return stats
+}
+
+// BM25 score of the document for the query term frequencies
+func bm25Score(queryTF map[string]int, doc Document, collection engine.CollectionStats) float64 {
+	return bm25Scorer.Score(engine.TermStats{TermFreq: queryTF}, termStats(doc), collection)
+}
+
+// ranks the documents sharing a term with the query by the scorer over the
+// given documents and statistics; reads no other state, so it runs on a view
+// of the collection without the lock
+func scoreDocuments(scorer engine.Scorer, query string, docs []Document, collection engine.CollectionStats) []SearchResult {
+	queryStats := engine.TermStats{TermFreq: make(map[string]int)}
+	for _, term := range sentenceTerms(query) {
+		queryStats.TermFreq[term]++
+		queryStats.Length++
+	}
+
+	results := make([]SearchResult, 0)
+	for _, doc := range docs {
+		matched := false
+		for t := range queryStats.TermFreq {
+			if doc.TermFreq[t] > 0 {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			results = append(results, SearchResult{FileName: doc.Name, Score: scorer.Score(queryStats, termStats(doc), collection)})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results
+}
+
+// looks up a registered scorer; "name:param=value,..." overrides its parameters,
+// e.g. "lm:mu=500" or "lm-jm:lambda=0.7" for the language model smoothing
+func lookupScorer(ranker string) (engine.Scorer, bool, error) {
+	name, spec, tuned := strings.Cut(ranker, ":")
+	scorer, ok := engine.LookupScorer(name)
+	if !ok || !tuned {
+		return scorer, ok, nil
+	}
+	for _, assignment := range strings.Split(spec, ",") {
+		key, raw, _ := strings.Cut(assignment, "=")
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, true, fmt.Errorf("parameter '%s' of ranker '%s' must be a number", key, name)
+		}
+		switch s := scorer.(type) {
+		case engine.LanguageModel:
+			if key != "mu" || value <= 0 {
+				return nil, true, fmt.Errorf("ranker 'lm' takes mu, a positive number")
+			}
+			s.Mu = value
+			scorer = s
+		case engine.JelinekMercer:
+			if key != "lambda" || value <= 0 || value >= 1 {
+				return nil, true, fmt.Errorf("ranker 'lm-jm' takes lambda, between 0 and 1 exclusive")
+			}
+			s.Lambda = value
+			scorer = s
+		default:
+			return nil, true, fmt.Errorf("ranker '%s' has no parameters", name)
+		}
+	}
+	return scorer, true, nil
+}
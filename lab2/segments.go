@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+
+	"ir/internal/engine"
+	"ir/internal/segment"
+)
+
+// opens the segment directory given by -segments, or keeps the segments in memory
+func openSegments(dir string) (*segment.Set, error) {
+	if dir == "" {
+		return segment.NewSet(), nil
+	}
+	set, err := segment.OpenSet(dir)
+	if err != nil {
+		return nil, err
+	}
+	if infos := set.Segments(); len(infos) > 0 {
+		fmt.Printf("Opened %d index segments\n", len(infos))
+	}
+	return set, nil
+}
+
+// replaces the segments by one holding the given index of document IDs (caller holds the lock)
+func replaceSegments(index engine.Index) error {
+	if err := state.segments.Reset(); err != nil {
+		return err
+	}
+	return state.segments.Add(index, 0, state.nextID)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Sentence is a span of the original document text
+type Sentence struct {
+	Text  string `json:"text"`
+	Start int    `json:"start"` // byte offsets into the uploaded text
+	End   int    `json:"end"`
+}
+
+// byte offsets of a sentence in the text it was split from
+type sentenceSpan struct {
+	start, end int
+}
+
+func sentenceSpans(text string) []sentenceSpan {
+	sentences := splitSentences(text)
+	spans := make([]sentenceSpan, len(sentences))
+	for i, sentence := range sentences {
+		spans[i] = sentenceSpan{sentence.Start, sentence.End}
+	}
+	return spans
+}
+
+// the sentences of the document from the spans stored at indexing; none when
+// its text is not stored
+func documentSentences(doc Document) []Sentence {
+	text := searchableText(doc)
+	sentences := make([]Sentence, 0, len(doc.Sentences))
+	for _, span := range doc.Sentences {
+		if span.end <= len(text) {
+			sentences = append(sentences, Sentence{Text: text[span.start:span.end], Start: span.start, End: span.end})
+		}
+	}
+	return sentences
+}
+
+// splits text at sentence-final punctuation followed by whitespace and at blank
+// lines; normalized text without punctuation falls back to line breaks
+func splitSentences(text string) []Sentence {
+	var sentences []Sentence
+	start := 0
+
+	emit := func(end int) {
+		trimmed := strings.TrimSpace(text[start:end])
+		if trimmed != "" {
+			offset := start + strings.Index(text[start:end], trimmed)
+			sentences = append(sentences, Sentence{Text: trimmed, Start: offset, End: offset + len(trimmed)})
+		}
+		start = end
+	}
+
+	hasPunctuation := strings.ContainsAny(text, ".!?")
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '.' || c == '!' || c == '?':
+			end := i + 1
+			for end < len(text) && strings.IndexByte(".!?\"')", text[end]) >= 0 {
+				end++
+			}
+			if end == len(text) || unicode.IsSpace(rune(text[end])) {
+				emit(end)
+				i = end - 1
+			}
+		case c == '\n':
+			if !hasPunctuation || (i+1 < len(text) && text[i+1] == '\n') || (i+2 < len(text) && text[i+1] == '\r' && text[i+2] == '\n') {
+				emit(i + 1)
+			}
+		}
+	}
+	emit(len(text))
+	return sentences
+}
+
+// lowercased alphanumeric words of a sentence, matching the index terms
+func sentenceTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
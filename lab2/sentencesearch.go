@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"ir/internal/apierror"
+)
+
+// SentenceSearchResponse is returned by /api/search?mode=sentence
+type SentenceSearchResponse struct {
+	TookMs    float64         `json:"tookMs"`
+	TotalHits int             `json:"totalHits"` // matching documents before the limit
+	Results   []SentenceMatch `json:"results"`
+}
+
+type SentenceMatch struct {
+	FileName string `json:"fileName"`
+	Matches  int    `json:"matches"`  // sentences containing all the query terms
+	Sentence string `json:"sentence"` // the first of them
+}
+
+// the terms of a sentence as the query terms were normalized (caller holds the lock)
+func sentenceQueryTerms(text string) map[string]bool {
+	text = normalizeQuery(text)
+	terms := map[string]bool{}
+	for _, t := range sentenceTerms(text) {
+		terms[t] = true
+	}
+	return terms
+}
+
+// answers /api/search?mode=sentence with the documents having a sentence that
+// contains every query term, in any order; the spans stored at indexing are
+// checked on the documents containing all the terms (caller holds the lock)
+func sentenceSearchHandler(w http.ResponseWriter, r *http.Request, requestData SearchRequest, inSubset func(string) bool, started time.Time) {
+	query := sentenceTerms(requestData.Query)
+	if len(query) == 0 {
+		apierror.Write(w, http.StatusBadRequest, "invalid_query", "The query has no terms to search for.")
+		return
+	}
+
+	response := SentenceSearchResponse{Results: []SentenceMatch{}}
+	for _, doc := range state.Documents {
+		if !inSubset(doc.Name) {
+			continue
+		}
+		candidate := true
+		for _, t := range query {
+			if doc.TermFreq[t] == 0 {
+				candidate = false
+				break
+			}
+		}
+		if !candidate {
+			continue
+		}
+
+		match := SentenceMatch{FileName: doc.Name}
+		for _, sentence := range documentSentences(doc) {
+			terms := sentenceQueryTerms(sentence.Text)
+			all := true
+			for _, t := range query {
+				if !terms[t] {
+					all = false
+					break
+				}
+			}
+			if all {
+				if match.Matches == 0 {
+					match.Sentence = sentence.Text
+				}
+				match.Matches++
+			}
+		}
+		if match.Matches > 0 {
+			response.Results = append(response.Results, match)
+		}
+	}
+	sort.Slice(response.Results, func(i, j int) bool {
+		a, b := response.Results[i], response.Results[j]
+		if a.Matches != b.Matches {
+			return a.Matches > b.Matches
+		}
+		return a.FileName < b.FileName
+	})
+	response.TotalHits = len(response.Results)
+	if requestData.Limit > 0 && len(response.Results) > requestData.Limit {
+		response.Results = response.Results[:requestData.Limit]
+	}
+
+	results := make([]SearchResult, len(response.Results))
+	for i, match := range response.Results {
+		results[i] = SearchResult{FileName: match.FileName, Score: float64(match.Matches)}
+	}
+	logQuery(requestData.Query, "sentence", started, results)
+
+	if format := negotiateFormat(w, r); format != "json" {
+		t := table{Root: "results", Row: "result", Columns: []string{"fileName", "matches", "sentence"}}
+		for _, match := range response.Results {
+			t.Rows = append(t.Rows, []string{match.FileName, strconv.Itoa(match.Matches), match.Sentence})
+		}
+		writeTable(w, format, t)
+		return
+	}
+	response.TookMs = float64(time.Since(started).Microseconds()) / 1000
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
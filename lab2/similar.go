@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"ir/internal/apierror"
+)
+
+// finds the documents most similar to the source document (cosine over TF-IDF or BM25)
+func similarDocuments(source Document, exclude string, ranker string, limit int) []SearchResult {
+	results := make([]SearchResult, 0)
+
+	switch ranker {
+	case "bm25":
+		collection := scoringStats()
+		for _, doc := range state.Documents {
+			if doc.Name == exclude {
+				continue
+			}
+			if score := bm25Score(source.TermFreq, doc, collection); score > 0.0 {
+				results = append(results, SearchResult{FileName: doc.Name, Score: score})
+			}
+		}
+
+	default:
+		cache := documentVectors()
+		sourceVector := tfidfVector(source, cache.idf)
+		sourceNorm := sourceVector.norm()
+		for i, doc := range state.Documents {
+			if doc.Name == exclude {
+				continue
+			}
+			if score := sparseCosine(sourceVector, sourceNorm, cache.vectors[i], cache.norms[i]); score > 0.0 {
+				results = append(results, SearchResult{FileName: doc.Name, Score: score})
+			}
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// the document to compare with: a stored one by name, or raw text analyzed
+// like an upload; on failure also returns the HTTP status (caller holds the lock)
+func querySource(name, text string) (Document, int, error) {
+	if name != "" {
+		for _, doc := range state.Documents {
+			if doc.Name == name {
+				return doc, http.StatusOK, nil
+			}
+		}
+		return Document{}, http.StatusNotFound, fmt.Errorf("Document not found.")
+	}
+
+	doc, err := analyzeTerms("text", strings.NewReader(text), state.Analysis)
+	if err != nil {
+		return Document{}, http.StatusBadRequest, err
+	}
+	return doc, http.StatusOK, nil
+}
+
+type SimilarRequest struct {
+	Document string `json:"document"`
+	Text     string `json:"text"`
+	Ranker   string `json:"ranker" enum:"|cosine|bm25"` // "cosine" by default
+	Limit    int    `json:"limit" minimum:"0"`
+}
+
+// POST /api/similar {"document": "Doc1.txt"} or {"text": "..."}
+func similarHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData SimilarRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		apierror.InvalidJSON(w)
+		return
+	}
+	if (requestData.Document == "") == (strings.TrimSpace(requestData.Text) == "") {
+		apierror.Error(w, "Error: Provide either a document name or text.", http.StatusBadRequest)
+		return
+	}
+	if requestData.Ranker != "" && requestData.Ranker != "cosine" && requestData.Ranker != "bm25" {
+		apierror.Error(w, "Error: Unknown ranker. Use cosine or bm25.", http.StatusBadRequest)
+		return
+	}
+	if requestData.Limit <= 0 {
+		requestData.Limit = 10
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	if len(state.Documents) == 0 {
+		apierror.Write(w, http.StatusBadRequest, "no_documents", "No documents uploaded. Please add documents first.")
+		return
+	}
+
+	source, status, err := querySource(requestData.Document, requestData.Text)
+	if err != nil {
+		apierror.Error(w, "Error: "+err.Error(), status)
+		return
+	}
+
+	response := map[string]interface{}{
+		"results": similarDocuments(source, requestData.Document, requestData.Ranker, requestData.Limit),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"ir/internal/apierror"
+	"ir/internal/engine"
+)
+
+const snapshotVersion = 1
+
+// Snapshot is a portable copy of the collection: documents, index and configuration
+type Snapshot struct {
+	Version   int                `json:"version"`
+	CreatedAt time.Time          `json:"createdAt"`
+	Documents []SnapshotDocument `json:"documents"`
+	Index     engine.Index       `json:"index"` // postings refer to positions in documents
+	Config    SnapshotConfig     `json:"config"`
+}
+
+type SnapshotDocument struct {
+	Name     string         `json:"name"`
+	Content  string         `json:"content,omitempty"`
+	Raw      string         `json:"raw,omitempty"`
+	TermFreq map[string]int `json:"termFreq"`
+	Length   int            `json:"length"`
+	Uploaded time.Time      `json:"uploadedAt,omitzero"`
+	Language string         `json:"language,omitempty"`
+
+	DuplicateOf string `json:"duplicateOf,omitempty"`
+	Sections    []int  `json:"sections,omitempty"`
+}
+
+type SnapshotConfig struct {
+	Analysis      engine.AnalysisConfig       `json:"analysis"`
+	Synonyms      SynonymConfig               `json:"synonyms"`
+	Passages      PassageConfig               `json:"passages"`
+	Priors        PriorConfig                 `json:"priors"`
+	Dedup         DedupConfig                 `json:"dedup"`
+	Fetcher       FetcherConfig               `json:"fetcher"`
+	Uploads       UploadConfig                `json:"uploads"`
+	Embedder      EmbedderConfig              `json:"embedder"` // without the API key
+	Reranker      RerankerConfig              `json:"reranker"`
+	Labels        map[string]string           `json:"labels"`
+	Metadata      map[string]DocumentMetadata `json:"metadata,omitempty"`
+	MetadataTypes map[string]string           `json:"metadataTypes,omitempty"`
+}
+
+// copies the collection into a snapshot (caller holds the lock)
+func takeSnapshot() Snapshot {
+	return snapshotOf(engine.AllDocuments(len(state.Documents)))
+}
+
+// copies the documents at the given positions into a snapshot, their postings
+// renumbered to the positions in it (caller holds the lock)
+func snapshotOf(positions engine.Postings) Snapshot {
+	renumbered := make(map[int]int, len(positions))
+	for i, position := range positions {
+		renumbered[position] = i
+	}
+	index := engine.Index{}
+	for term, postings := range positionalIndex() {
+		for _, position := range postings {
+			if i, ok := renumbered[position]; ok {
+				index[term] = append(index[term], i)
+			}
+		}
+	}
+
+	snapshot := Snapshot{
+		Version:   snapshotVersion,
+		CreatedAt: time.Now(),
+		Documents: make([]SnapshotDocument, len(positions)),
+		Index:     index,
+		Config: SnapshotConfig{
+			Analysis:      state.Analysis,
+			Synonyms:      state.Synonyms,
+			Passages:      state.PassageConfig,
+			Priors:        state.Priors,
+			Dedup:         state.Dedup,
+			Fetcher:       state.Fetcher,
+			Uploads:       state.Uploads,
+			Embedder:      state.Embedder,
+			Reranker:      state.Reranker,
+			Labels:        map[string]string{},
+			Metadata:      map[string]DocumentMetadata{},
+			MetadataTypes: state.MetadataTypes,
+		},
+	}
+	snapshot.Config.Embedder.APIKey = ""
+	for i, position := range positions {
+		doc := state.Documents[position]
+		if label, ok := state.Labels[doc.Name]; ok {
+			snapshot.Config.Labels[doc.Name] = label
+		}
+		if fields, ok := state.Metadata[doc.Name]; ok {
+			snapshot.Config.Metadata[doc.Name] = fields
+		}
+		content, raw := doc.text()
+		snapshot.Documents[i] = SnapshotDocument{Name: doc.Name, Content: content, Raw: raw, TermFreq: doc.TermFreq, Length: doc.Length, Uploaded: doc.Uploaded, Language: doc.Language, DuplicateOf: doc.DuplicateOf, Sections: doc.Sections}
+	}
+	return snapshot
+}
+
+// checks the snapshot before anything of the collection is replaced; returns
+// its reranker configuration with the defaults older snapshots leave out
+func validateSnapshot(snapshot Snapshot) (RerankerConfig, error) {
+	if snapshot.Version != snapshotVersion {
+		return RerankerConfig{}, fmt.Errorf("unsupported snapshot version %d", snapshot.Version)
+	}
+	if err := snapshot.Config.Analysis.Validate(); err != nil {
+		return RerankerConfig{}, err
+	}
+	if err := snapshot.Config.Passages.validate(); err != nil {
+		return RerankerConfig{}, err
+	}
+	if err := snapshot.Config.Dedup.validate(); err != nil {
+		return RerankerConfig{}, err
+	}
+	if err := snapshot.Config.Fetcher.validate(); snapshot.Config.Fetcher != (FetcherConfig{}) && err != nil {
+		return RerankerConfig{}, err
+	}
+	if err := snapshot.Config.Uploads.validate(); snapshot.Config.Uploads != (UploadConfig{}) && err != nil {
+		return RerankerConfig{}, err
+	}
+	if err := snapshot.Config.Embedder.validate(); err != nil {
+		return RerankerConfig{}, err
+	}
+	reranker := snapshot.Config.Reranker
+	if reranker.TopN == 0 { // older snapshots and hand-written ones leave them out
+		reranker.TopN = defaultRerankerConfig.TopN
+	}
+	if reranker.TimeoutMs == 0 {
+		reranker.TimeoutMs = defaultRerankerConfig.TimeoutMs
+	}
+	if err := reranker.validate(); err != nil {
+		return RerankerConfig{}, err
+	}
+	seen := make(map[string]bool, len(snapshot.Documents))
+	for _, doc := range snapshot.Documents {
+		if doc.Name == "" || seen[doc.Name] {
+			return RerankerConfig{}, fmt.Errorf("document names must be unique and not empty")
+		}
+		seen[doc.Name] = true
+	}
+	for term, postings := range snapshot.Index {
+		for i, docID := range postings {
+			if docID < 0 || docID >= len(snapshot.Documents) || (i > 0 && postings[i-1] >= docID) {
+				return RerankerConfig{}, fmt.Errorf("invalid postings for '%s'", term)
+			}
+		}
+	}
+	return reranker, nil
+}
+
+// replaces the collection with a validated snapshot; the reranker and
+// embedding services it points at are only applied with endpoints set,
+// otherwise the local ones are kept and the URLs left out are returned. The
+// documents are analyzed and swapped into the segments and the store before
+// the working set is replaced, so a failed write leaves the collection as it
+// was (caller holds the lock)
+func restoreSnapshot(snapshot Snapshot, reranker RerankerConfig, endpoints bool) ([]string, error) {
+	analysis := snapshot.Config.Analysis
+	analysis.Policy = analysis.CharacterPolicy()
+	config := indexConfig{analysis: analysis, passages: snapshot.Config.Passages, biwords: state.biwords != nil}
+	docs := make([]Document, len(snapshot.Documents))
+	index := engine.Index{}
+	for i, doc := range snapshot.Documents {
+		docs[i] = Document{Name: doc.Name, Content: doc.Content, Raw: doc.Raw, TermFreq: doc.TermFreq, Length: doc.Length, Uploaded: doc.Uploaded, Language: doc.Language, DuplicateOf: doc.DuplicateOf, Sections: doc.Sections, id: i}
+		enrichDocument(&docs[i], config)
+		for term := range doc.TermFreq {
+			index[term] = append(index[term], i)
+		}
+	}
+
+	previous, covered := state.segments.Decode(), state.segments.Documents()
+	if err := state.segments.Replace(index, len(docs)); err != nil {
+		return nil, err
+	}
+	if err := state.store.Replace(docs); err != nil {
+		state.segments.Replace(previous, covered) // back to the postings of the collection kept
+		return nil, err
+	}
+
+	state.Documents = []Document{}
+	state.nextID = 0
+	resetBiwords()
+	state.Versions = map[string]*versionHistory{}
+	state.Embeddings = map[string][]float32{}
+	invalidateCaches()
+	state.Analysis = analysis
+	state.PassageConfig = snapshot.Config.Passages
+	state.Priors = snapshot.Config.Priors
+	state.Dedup = snapshot.Config.Dedup
+	if snapshot.Config.Fetcher != (FetcherConfig{}) { // older snapshots keep the current settings
+		state.Fetcher = snapshot.Config.Fetcher
+	}
+	if snapshot.Config.Uploads != (UploadConfig{}) {
+		state.Uploads = snapshot.Config.Uploads
+	}
+	var ignored []string
+	if reranker.URL == "" || reranker.URL == state.Reranker.URL || endpoints {
+		state.Reranker = reranker
+	} else {
+		ignored = append(ignored, reranker.URL)
+	}
+	embedder := snapshot.Config.Embedder
+	if embedder.URL != "" && embedder.URL == state.Embedder.URL {
+		embedder.APIKey = state.Embedder.APIKey // keep the local key for the same endpoint
+	}
+	if embedder.URL == "" || embedder.URL == state.Embedder.URL || endpoints {
+		state.Embedder = embedder
+	} else {
+		ignored = append(ignored, embedder.URL)
+	}
+	state.Labels = snapshot.Config.Labels
+	if state.Labels == nil {
+		state.Labels = map[string]string{}
+	}
+	state.Metadata = snapshot.Config.Metadata
+	if state.Metadata == nil {
+		state.Metadata = map[string]DocumentMetadata{}
+	}
+	state.MetadataTypes = snapshot.Config.MetadataTypes
+	if state.MetadataTypes == nil {
+		state.MetadataTypes = map[string]string{}
+	}
+	// term frequencies already include any synonym expansion
+	state.Synonyms = newSynonymConfig([][]string{}, false)
+
+	_, offloads := state.store.(textLoader)
+	for _, doc := range docs {
+		doc.stored = offloads
+		indexStoredDocument(doc)
+	}
+	state.Synonyms = newSynonymConfig(snapshot.Config.Synonyms.Groups, snapshot.Config.Synonyms.ExpandIndex)
+	if snapshot.Index != nil {
+		state.boolean = newBooleanIndex(snapshot.Index)
+	}
+	return ignored, nil
+}
+
+// GET /api/export downloads the collection as a gzip-compressed JSON snapshot
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="snapshot.json.gz"`)
+	gz := gzip.NewWriter(w)
+	json.NewEncoder(gz).Encode(takeSnapshot())
+	gz.Close()
+}
+
+// POST /api/import with a snapshot from /api/export as the body replaces the
+// collection; ?endpoints=true also takes over its reranker and embedder URLs
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	state.Lock()
+	limit := int64(state.Uploads.MaxTotalMBytes) << 20
+	state.Unlock()
+
+	// the upload limit applies to the snapshot compressed and decompressed
+	gz, err := gzip.NewReader(http.MaxBytesReader(w, r.Body, limit))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		apierror.Write(w, http.StatusRequestEntityTooLarge, "too_large", fmt.Sprintf("The snapshot is larger than %d MB.", limit>>20))
+		return
+	}
+	if err != nil {
+		apierror.Error(w, "Error: Snapshot must be gzip-compressed.", http.StatusBadRequest)
+		return
+	}
+	decompressed := &sizeLimiter{r: gz, n: limit}
+	var snapshot Snapshot
+	if err := json.NewDecoder(decompressed).Decode(&snapshot); err != nil {
+		if decompressed.exceeded || errors.As(err, &tooLarge) {
+			apierror.Write(w, http.StatusRequestEntityTooLarge, "too_large", fmt.Sprintf("The snapshot is larger than %d MB.", limit>>20))
+			return
+		}
+		apierror.Error(w, "Error: Invalid snapshot: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	reranker, err := validateSnapshot(snapshot)
+	if err != nil {
+		apierror.Error(w, "Error: Invalid snapshot: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	ignored, err := restoreSnapshot(snapshot, reranker, r.URL.Query().Get("endpoints") == "true")
+	if err != nil {
+		apierror.Error(w, "Error: Could not store the snapshot: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Printf("Snapshot imported. Documents: %d\n", len(state.Documents))
+	for _, url := range ignored {
+		fmt.Printf("Snapshot endpoint %s not applied, the local one is kept\n", url)
+	}
+
+	response := map[string]interface{}{
+		"documents": documentNames(),
+		"createdAt": snapshot.CreatedAt,
+	}
+	if len(ignored) > 0 {
+		response["ignoredEndpoints"] = ignored
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,47 @@
+package main
+
+import "strings"
+
+// tokens shown on each side of the first matching term
+const snippetWindow = 10
+
+// the words to show for the normalized tokens: as uploaded while they line up
+// one to one, e.g. "Köln" for the folded "koln", else the tokens themselves
+func displayTokens(tokens []string, raw string) []string {
+	if original := strings.Fields(raw); len(original) == len(tokens) {
+		return original
+	}
+	return tokens
+}
+
+// short excerpt of the stored text around the first occurrence of a query term
+func documentSnippet(doc Document, queryTerms []string) string {
+	content, raw := doc.text()
+	if content == "" {
+		return ""
+	}
+	wanted := make(map[string]bool, len(queryTerms))
+	for _, t := range queryTerms {
+		wanted[t] = true
+	}
+
+	tokens := strings.Fields(content)
+	center := 0
+	for i, t := range tokens {
+		if wanted[t] {
+			center = i
+			break
+		}
+	}
+
+	tokens = displayTokens(tokens, raw)
+	start, end := max(center-snippetWindow, 0), min(center+snippetWindow+1, len(tokens))
+	snippet := strings.Join(tokens[start:end], " ")
+	if start > 0 {
+		snippet = "... " + snippet
+	}
+	if end < len(tokens) {
+		snippet += " ..."
+	}
+	return snippet
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	kgramSize             = 2
+	minKgramJaccard       = 0.3
+	maxSpellingDistance   = 2
+	maxSpellingCandidates = 5
+)
+
+type SpellingCandidate struct {
+	Term              string  `json:"term"`
+	Distance          int     `json:"distance"` // Levenshtein distance to the query term
+	Jaccard           float64 `json:"jaccard"`  // overlap of the k-gram sets
+	DocumentFrequency int     `json:"documentFrequency"`
+}
+
+type SpellingSuggestion struct {
+	Term       string              `json:"term"`
+	Candidates []SpellingCandidate `json:"candidates"`
+}
+
+// k-gram index over the vocabulary, extended as documents are added and
+// rebuilt lazily after removals
+type kgramIndex struct {
+	postings map[string][]string // k-gram -> vocabulary terms containing it
+	df       map[string]int
+}
+
+// k-grams of the term padded with '$' boundary markers, e.g. $c ca at t$
+func kgrams(term string) map[string]bool {
+	padded := []rune("$" + term + "$")
+	grams := make(map[string]bool)
+	for i := 0; i+kgramSize <= len(padded); i++ {
+		grams[string(padded[i:i+kgramSize])] = true
+	}
+	return grams
+}
+
+// returns the cached k-gram index, building it if needed (caller holds the lock)
+func vocabularyKgrams() *kgramIndex {
+	if state.kgrams != nil {
+		return state.kgrams
+	}
+
+	index := &kgramIndex{postings: map[string][]string{}, df: map[string]int{}}
+	for _, doc := range state.Documents {
+		for t := range doc.TermFreq {
+			index.df[t]++
+		}
+	}
+	for t := range index.df {
+		for gram := range kgrams(t) {
+			index.postings[gram] = append(index.postings[gram], t)
+		}
+	}
+
+	state.kgrams = index
+	return index
+}
+
+// Levenshtein distance with unit costs
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+// closest vocabulary terms: k-gram Jaccard filters the candidates, edit distance ranks them
+func spellingCandidates(term string) []SpellingCandidate {
+	index := vocabularyKgrams()
+	grams := kgrams(term)
+
+	shared := make(map[string]int)
+	for gram := range grams {
+		for _, t := range index.postings[gram] {
+			shared[t]++
+		}
+	}
+
+	candidates := []SpellingCandidate{}
+	for t, overlap := range shared {
+		jaccard := float64(overlap) / float64(len(grams)+len(kgrams(t))-overlap)
+		if jaccard < minKgramJaccard {
+			continue
+		}
+		distance := editDistance(term, t)
+		if distance > maxSpellingDistance {
+			continue
+		}
+		candidates = append(candidates, SpellingCandidate{Term: t, Distance: distance, Jaccard: jaccard, DocumentFrequency: index.df[t]})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Distance != b.Distance {
+			return a.Distance < b.Distance
+		}
+		if a.Jaccard != b.Jaccard {
+			return a.Jaccard > b.Jaccard
+		}
+		if a.DocumentFrequency != b.DocumentFrequency {
+			return a.DocumentFrequency > b.DocumentFrequency
+		}
+		return a.Term < b.Term
+	})
+	if len(candidates) > maxSpellingCandidates {
+		candidates = candidates[:maxSpellingCandidates]
+	}
+	return candidates
+}
+
+// suggestions for every query term missing from the vocabulary and the query with
+// each of them replaced by its best candidate ("" when nothing could be corrected)
+func spellingSuggestions(query string) ([]SpellingSuggestion, string) {
+	index := vocabularyKgrams()
+	terms := strings.Fields(strings.ToLower(query))
+
+	var suggestions []SpellingSuggestion
+	corrected := make([]string, len(terms))
+	changed := false
+	for i, term := range terms {
+		corrected[i] = term
+		if index.df[term] > 0 {
+			continue
+		}
+		candidates := spellingCandidates(term)
+		if len(candidates) == 0 {
+			continue
+		}
+		suggestions = append(suggestions, SpellingSuggestion{Term: term, Candidates: candidates})
+		corrected[i] = candidates[0].Term
+		changed = true
+	}
+
+	if !changed {
+		return suggestions, ""
+	}
+	return suggestions, strings.Join(corrected, " ")
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"ir/internal/engine"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS documents (
+	sequence     INTEGER PRIMARY KEY, -- the document ID
+	name         TEXT NOT NULL UNIQUE,
+	content      TEXT NOT NULL,
+	raw          TEXT NOT NULL,
+	term_freq    TEXT NOT NULL, -- JSON object
+	length       INTEGER NOT NULL,
+	uploaded_at  TEXT NOT NULL, -- RFC 3339, empty when not recorded
+	language     TEXT NOT NULL,
+	duplicate_of TEXT NOT NULL,
+	sections     TEXT NOT NULL  -- JSON array
+);
+CREATE TABLE IF NOT EXISTS postings (
+	term     TEXT NOT NULL,
+	sequence INTEGER NOT NULL,
+	PRIMARY KEY (term, sequence)
+) WITHOUT ROWID;
+CREATE INDEX IF NOT EXISTS postings_sequence ON postings (sequence);
+`
+
+// sqliteStore keeps the documents and their postings in an SQLite database;
+// the text stays on disk and is read when needed, so the corpus is not bound
+// by memory
+type sqliteStore struct {
+	db *sql.DB
+}
+
+func openSQLiteStore(dir string) (*sqliteStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(dir, "documents.db")+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1) // one writer, the statements queue for it
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+// the metadata of every document in ID order; the text is left in the database
+func (s *sqliteStore) LoadDocuments() ([]Document, error) {
+	rows, err := s.db.Query(`SELECT sequence, name, term_freq, length, uploaded_at, language, duplicate_of, sections FROM documents ORDER BY sequence`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []Document{}
+	for rows.Next() {
+		var doc Document
+		var termFreq, uploaded, sections string
+		if err := rows.Scan(&doc.id, &doc.Name, &termFreq, &doc.Length, &uploaded, &doc.Language, &doc.DuplicateOf, &sections); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(termFreq), &doc.TermFreq); err != nil {
+			return nil, fmt.Errorf("%s: %v", doc.Name, err)
+		}
+		if err := json.Unmarshal([]byte(sections), &doc.Sections); err != nil {
+			return nil, fmt.Errorf("%s: %v", doc.Name, err)
+		}
+		if uploaded != "" {
+			if doc.Uploaded, err = time.Parse(time.RFC3339Nano, uploaded); err != nil {
+				return nil, fmt.Errorf("%s: %v", doc.Name, err)
+			}
+		}
+		doc.stored = true
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// writes the documents and their postings in one transaction under their IDs;
+// a document replaces the stored one of the same name
+func (s *sqliteStore) SaveDocuments(docs []Document) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, doc := range docs {
+		if err := deleteStored(tx, doc.Name); err != nil {
+			return err
+		}
+		if err := insertStored(tx, doc); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// swaps the stored collection for the documents in one transaction
+func (s *sqliteStore) Replace(docs []Document) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"postings", "documents"} {
+		if _, err := tx.Exec(`DELETE FROM ` + table); err != nil {
+			return err
+		}
+	}
+	for _, doc := range docs {
+		if err := insertStored(tx, doc); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// writes the document and its postings under its ID within the transaction
+func insertStored(tx *sql.Tx, doc Document) error {
+	termFreq, err := json.Marshal(doc.TermFreq)
+	if err != nil {
+		return err
+	}
+	sections, err := json.Marshal(doc.Sections)
+	if err != nil {
+		return err
+	}
+	uploaded := ""
+	if !doc.Uploaded.IsZero() {
+		uploaded = doc.Uploaded.Format(time.RFC3339Nano)
+	}
+	if _, err := tx.Exec(`INSERT INTO documents (sequence, name, content, raw, term_freq, length, uploaded_at, language, duplicate_of, sections) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		doc.id, doc.Name, doc.Content, doc.Raw, string(termFreq), doc.Length, uploaded, doc.Language, doc.DuplicateOf, string(sections)); err != nil {
+		return err
+	}
+	for t := range doc.TermFreq {
+		if _, err := tx.Exec(`INSERT INTO postings (term, sequence) VALUES (?, ?)`, t, doc.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removes the named document and its postings within the transaction
+func deleteStored(tx *sql.Tx, name string) error {
+	if _, err := tx.Exec(`DELETE FROM postings WHERE sequence IN (SELECT sequence FROM documents WHERE name = ?)`, name); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`DELETE FROM documents WHERE name = ?`, name)
+	return err
+}
+
+func (s *sqliteStore) LoadText(name string) (string, string, error) {
+	var content, raw string
+	err := s.db.QueryRow(`SELECT content, raw FROM documents WHERE name = ?`, name).Scan(&content, &raw)
+	if err == sql.ErrNoRows {
+		return "", "", nil
+	}
+	return content, raw, err
+}
+
+// the stored postings of document IDs
+func (s *sqliteStore) LoadIndex() (engine.Index, error) {
+	rows, err := s.db.Query(`SELECT term, sequence FROM postings ORDER BY term, sequence`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	index := engine.Index{}
+	for rows.Next() {
+		var term string
+		var sequence int
+		if err := rows.Scan(&term, &sequence); err != nil {
+			return nil, err
+		}
+		index[term] = append(index[term], sequence)
+	}
+	return index, rows.Err()
+}
+
+// rewrites the postings of the terms as the index has them, deleting the terms
+// it lacks
+func (s *sqliteStore) ReplacePostings(index engine.Index, terms []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, term := range terms {
+		if _, err := tx.Exec(`DELETE FROM postings WHERE term = ?`, term); err != nil {
+			return err
+		}
+		for _, sequence := range index[term] {
+			if _, err := tx.Exec(`INSERT INTO postings (term, sequence) VALUES (?, ?)`, term, sequence); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Delete(name string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := deleteStored(tx, name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// reclaims the pages of deleted documents
+func (s *sqliteStore) Compact() error {
+	_, err := s.db.Exec(`VACUUM`)
+	return err
+}
+
+func (s *sqliteStore) Clear() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range []string{"postings", "documents"} {
+		if _, err := tx.Exec(`DELETE FROM ` + table); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
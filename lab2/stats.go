@@ -0,0 +1,428 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"ir/internal/apierror"
+	"ir/internal/engine"
+	"ir/internal/segment"
+)
+
+type TermCount struct {
+	Term  string `json:"term"`
+	Count int    `json:"count"`
+}
+
+// IndexSnapshot captures the corpus statistics at one point in time
+type IndexSnapshot struct {
+	Name           string    `json:"name"`
+	TakenAt        time.Time `json:"takenAt"`
+	Documents      int       `json:"documents"`
+	Tokens         int       `json:"tokens"`
+	VocabularySize int       `json:"vocabularySize"`
+
+	DocumentFrequency   map[string]int `json:"-"`
+	CollectionFrequency map[string]int `json:"-"`
+}
+
+type DFShift struct {
+	Term      string  `json:"term"`
+	From      int     `json:"from"`
+	To        int     `json:"to"`
+	Delta     int     `json:"delta"`
+	FromRatio float64 `json:"fromRatio"` // df / number of documents
+	ToRatio   float64 `json:"toRatio"`
+}
+
+// StatsDiff describes the corpus drift between two snapshots
+type StatsDiff struct {
+	From             IndexSnapshot `json:"from"`
+	To               IndexSnapshot `json:"to"`
+	DocumentsDelta   int           `json:"documentsDelta"`
+	TokensDelta      int           `json:"tokensDelta"`
+	VocabularyGrowth int           `json:"vocabularyGrowth"`
+	AddedTerms       int           `json:"addedTerms"`
+	RemovedTerms     int           `json:"removedTerms"`
+	NewTerms         []TermCount   `json:"newTerms"`  // most frequent terms that did not exist before
+	LostTerms        []TermCount   `json:"lostTerms"` // most frequent terms that no longer exist
+	DFShifts         []DFShift     `json:"dfShifts"`
+	TopTermsEntered  []string      `json:"topTermsEntered"`
+	TopTermsLeft     []string      `json:"topTermsLeft"`
+}
+
+// collects df/cf statistics over the current documents
+func takeIndexSnapshot(name string) IndexSnapshot {
+	snapshot := IndexSnapshot{
+		Name:                name,
+		TakenAt:             time.Now(),
+		Documents:           len(state.Documents),
+		DocumentFrequency:   make(map[string]int),
+		CollectionFrequency: make(map[string]int),
+	}
+
+	for _, doc := range state.Documents {
+		snapshot.Tokens += doc.Length
+		for t, tf := range doc.TermFreq {
+			snapshot.CollectionFrequency[t] += tf
+			snapshot.DocumentFrequency[t]++
+		}
+	}
+
+	snapshot.VocabularySize = len(snapshot.DocumentFrequency)
+	return snapshot
+}
+
+// the n terms with the highest counts, ties broken alphabetically
+func topTerms(counts map[string]int, n int) []TermCount {
+	terms := make([]TermCount, 0, len(counts))
+	for t, c := range counts {
+		terms = append(terms, TermCount{Term: t, Count: c})
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].Count != terms[j].Count {
+			return terms[i].Count > terms[j].Count
+		}
+		return terms[i].Term < terms[j].Term
+	})
+	if len(terms) > n {
+		terms = terms[:n]
+	}
+	return terms
+}
+
+func diffSnapshots(from, to IndexSnapshot, n int) StatsDiff {
+	diff := StatsDiff{
+		From:             from,
+		To:               to,
+		DocumentsDelta:   to.Documents - from.Documents,
+		TokensDelta:      to.Tokens - from.Tokens,
+		VocabularyGrowth: to.VocabularySize - from.VocabularySize,
+	}
+
+	added := make(map[string]int)
+	removed := make(map[string]int)
+	var shifts []DFShift
+
+	for t, df := range to.DocumentFrequency {
+		fromDF, ok := from.DocumentFrequency[t]
+		if !ok {
+			added[t] = df
+		}
+		if df != fromDF {
+			shifts = append(shifts, DFShift{Term: t, From: fromDF, To: df, Delta: df - fromDF})
+		}
+	}
+	for t, df := range from.DocumentFrequency {
+		if _, ok := to.DocumentFrequency[t]; !ok {
+			removed[t] = df
+			shifts = append(shifts, DFShift{Term: t, From: df, To: 0, Delta: -df})
+		}
+	}
+
+	for i := range shifts {
+		if from.Documents > 0 {
+			shifts[i].FromRatio = float64(shifts[i].From) / float64(from.Documents)
+		}
+		if to.Documents > 0 {
+			shifts[i].ToRatio = float64(shifts[i].To) / float64(to.Documents)
+		}
+	}
+	sort.Slice(shifts, func(i, j int) bool {
+		a, b := abs(shifts[i].Delta), abs(shifts[j].Delta)
+		if a != b {
+			return a > b
+		}
+		return shifts[i].Term < shifts[j].Term
+	})
+	if len(shifts) > n {
+		shifts = shifts[:n]
+	}
+
+	diff.AddedTerms = len(added)
+	diff.RemovedTerms = len(removed)
+	diff.NewTerms = topTerms(added, n)
+	diff.LostTerms = topTerms(removed, n)
+	diff.DFShifts = shifts
+	if diff.DFShifts == nil {
+		diff.DFShifts = []DFShift{}
+	}
+
+	// changes in the top-n terms by collection frequency
+	fromTop := make(map[string]bool)
+	for _, tc := range topTerms(from.CollectionFrequency, n) {
+		fromTop[tc.Term] = true
+	}
+	toTop := make(map[string]bool)
+	diff.TopTermsEntered = []string{}
+	for _, tc := range topTerms(to.CollectionFrequency, n) {
+		toTop[tc.Term] = true
+		if !fromTop[tc.Term] {
+			diff.TopTermsEntered = append(diff.TopTermsEntered, tc.Term)
+		}
+	}
+	diff.TopTermsLeft = []string{}
+	for _, tc := range topTerms(from.CollectionFrequency, n) {
+		if !toTop[tc.Term] {
+			diff.TopTermsLeft = append(diff.TopTermsLeft, tc.Term)
+		}
+	}
+
+	return diff
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// finds a saved snapshot by name; "current" (or empty) is the live index
+func findSnapshot(name string) (IndexSnapshot, bool) {
+	if name == "" || name == "current" {
+		return takeIndexSnapshot("current"), true
+	}
+	for _, snapshot := range state.Snapshots {
+		if snapshot.Name == name {
+			return snapshot, true
+		}
+	}
+	return IndexSnapshot{}, false
+}
+
+type SnapshotRequest struct {
+	Name string `json:"name" maxLength:"200"`
+}
+
+// lists or takes statistics snapshots
+func snapshotsHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		snapshots := state.Snapshots
+		if snapshots == nil {
+			snapshots = []IndexSnapshot{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snapshots)
+
+	case http.MethodPost:
+		var requestData SnapshotRequest
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+
+		name := strings.TrimSpace(requestData.Name)
+		if name == "" {
+			name = fmt.Sprintf("snapshot-%d", len(state.Snapshots)+1)
+		}
+		if _, exists := findSnapshot(name); exists {
+			apierror.Error(w, "Error: Snapshot name already in use.", http.StatusConflict)
+			return
+		}
+
+		snapshot := takeIndexSnapshot(name)
+		state.Snapshots = append(state.Snapshots, snapshot)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snapshot)
+
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// compares two snapshots: GET /api/stats/diff?from=a&to=b&top=10
+func statsDiffHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	top, ok := intParam(r, "top", 10)
+	if !ok || top == 0 {
+		apierror.Error(w, "Error: 'top' must be a positive integer.", http.StatusBadRequest)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	if params.Get("from") == "" {
+		apierror.Error(w, "Error: 'from' snapshot is required.", http.StatusBadRequest)
+		return
+	}
+	from, ok := findSnapshot(params.Get("from"))
+	if !ok {
+		apierror.Error(w, "Error: Snapshot '"+params.Get("from")+"' not found.", http.StatusNotFound)
+		return
+	}
+	to, ok := findSnapshot(params.Get("to"))
+	if !ok {
+		apierror.Error(w, "Error: Snapshot '"+params.Get("to")+"' not found.", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diffSnapshots(from, to, top))
+}
+
+type ZipfPoint struct {
+	Rank      int    `json:"rank"`
+	Term      string `json:"term"`
+	Frequency int    `json:"frequency"`
+}
+
+type HeapsPoint struct {
+	Documents      int `json:"documents"`
+	Tokens         int `json:"tokens"`
+	VocabularySize int `json:"vocabularySize"`
+}
+
+// CollectionStats answers the standard corpus analysis questions
+type CollectionStats struct {
+	Documents             int                     `json:"documents"`
+	Tokens                int                     `json:"tokens"`
+	VocabularySize        int                     `json:"vocabularySize"`
+	AverageDocumentLength float64                 `json:"averageDocumentLength"`
+	TopTerms              []TermCount             `json:"topTerms"`
+	Zipf                  []ZipfPoint             `json:"zipf"`         // collection frequency by rank
+	ZipfExponent          float64                 `json:"zipfExponent"` // s in cf ~ rank^-s
+	Heaps                 []HeapsPoint            `json:"heaps"`        // vocabulary growth in upload order
+	HeapsK                float64                 `json:"heapsK"`       // V = K * T^beta
+	HeapsBeta             float64                 `json:"heapsBeta"`
+	Compression           engine.CompressionStats `json:"compression"` // postings of the boolean index
+	Segments              []segment.Info          `json:"segments"`
+	BufferedDocuments     int                     `json:"bufferedDocuments"` // indexed, not yet flushed into a segment
+	DeletedDocuments      int                     `json:"deletedDocuments"`  // tombstoned, reclaimed by /api/optimize
+}
+
+// longest data series returned for plotting
+const maxSeriesPoints = 500
+
+// ranks to plot: all of them for small vocabularies, log-spaced otherwise
+func sampleRanks(n int) []int {
+	if n <= maxSeriesPoints {
+		ranks := make([]int, n)
+		for i := range ranks {
+			ranks[i] = i + 1
+		}
+		return ranks
+	}
+
+	var ranks []int
+	step := math.Pow(float64(n), 1.0/float64(maxSeriesPoints-1))
+	for x := 1.0; int(x) <= n; x *= step {
+		if rank := int(x); len(ranks) == 0 || rank != ranks[len(ranks)-1] {
+			ranks = append(ranks, rank)
+		}
+	}
+	if ranks[len(ranks)-1] != n {
+		ranks = append(ranks, n)
+	}
+	return ranks
+}
+
+// least squares fit of y = a + b*x
+func linearFit(xs, ys []float64) (float64, float64) {
+	n := float64(len(xs))
+	if n < 2 {
+		return 0, 0
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+		sumXY += xs[i] * ys[i]
+		sumXX += xs[i] * xs[i]
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, 0
+	}
+	b := (n*sumXY - sumX*sumY) / denominator
+	a := (sumY - b*sumX) / n
+	return a, b
+}
+
+func collectionStats(top int) CollectionStats {
+	snapshot := takeIndexSnapshot("current")
+	stats := CollectionStats{
+		Documents:      snapshot.Documents,
+		Tokens:         snapshot.Tokens,
+		VocabularySize: snapshot.VocabularySize,
+		TopTerms:       topTerms(snapshot.CollectionFrequency, top),
+		Zipf:           []ZipfPoint{},
+		Heaps:          []HeapsPoint{},
+		Compression:    booleanIndexes().terms.Stats(),
+	}
+	stats.Segments = state.segments.Segments()
+	stats.BufferedDocuments = state.segments.Buffered()
+	stats.DeletedDocuments = state.segments.Deleted()
+	if stats.Documents > 0 {
+		stats.AverageDocumentLength = float64(stats.Tokens) / float64(stats.Documents)
+	}
+
+	// Zipf: log(cf) = log(C) - s*log(rank)
+	ranked := topTerms(snapshot.CollectionFrequency, snapshot.VocabularySize)
+	var logRanks, logFreqs []float64
+	for _, rank := range sampleRanks(len(ranked)) {
+		tc := ranked[rank-1]
+		stats.Zipf = append(stats.Zipf, ZipfPoint{Rank: rank, Term: tc.Term, Frequency: tc.Count})
+		logRanks = append(logRanks, math.Log(float64(rank)))
+		logFreqs = append(logFreqs, math.Log(float64(tc.Count)))
+	}
+	_, slope := linearFit(logRanks, logFreqs)
+	stats.ZipfExponent = -slope
+
+	// Heaps: log(V) = log(K) + beta*log(T)
+	seen := make(map[string]bool)
+	tokens := 0
+	var logTokens, logVocab []float64
+	for i, doc := range state.Documents {
+		tokens += doc.Length
+		for t := range doc.TermFreq {
+			seen[t] = true
+		}
+		stats.Heaps = append(stats.Heaps, HeapsPoint{Documents: i + 1, Tokens: tokens, VocabularySize: len(seen)})
+		logTokens = append(logTokens, math.Log(float64(tokens)))
+		logVocab = append(logVocab, math.Log(float64(len(seen))))
+	}
+	intercept, beta := linearFit(logTokens, logVocab)
+	if beta != 0 {
+		stats.HeapsK = math.Exp(intercept)
+		stats.HeapsBeta = beta
+	}
+
+	return stats
+}
+
+// GET /api/stats?top=20
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	top, ok := intParam(r, "top", 20)
+	if !ok || top == 0 {
+		apierror.Error(w, "Error: 'top' must be a positive integer.", http.StatusBadRequest)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collectionStats(top))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+
+	"ir/internal/engine"
+)
+
+// Store persists the analyzed documents of the collection. The in-memory state
+// stays the working copy; postings and statistics are rebuilt from the stored
+// term frequencies when the documents are loaded.
+type Store interface {
+	LoadDocuments() ([]Document, error)  // in upload order with their IDs
+	SaveDocuments(docs []Document) error // under their IDs, all of them or none; replaces stored documents of the same names
+	Replace(docs []Document) error       // swaps the whole collection for the documents, all of them or none
+	Delete(name string) error
+	Clear() error
+	Close() error
+}
+
+// textLoader is implemented by stores that keep the document text on disk only
+type textLoader interface {
+	LoadText(name string) (content, raw string, err error)
+}
+
+// compactor is implemented by stores that leave garbage behind on deletion
+type compactor interface {
+	Compact() error
+}
+
+// indexLoader is implemented by stores that persist the postings lists
+type indexLoader interface {
+	LoadIndex() (engine.Index, error)                         // postings of document IDs
+	ReplacePostings(index engine.Index, terms []string) error // rewrites the terms' postings, dropping those not in the index
+}
+
+// opens the store selected by the --storage flag
+func openStore(kind, dir string) (Store, error) {
+	switch kind {
+	case "memory":
+		return memoryStore{}, nil
+	case "sqlite":
+		return openSQLiteStore(dir)
+	case "kv":
+		return openKVStore(dir)
+	}
+	return nil, fmt.Errorf("unknown storage '%s', use 'memory', 'sqlite' or 'kv'", kind)
+}
+
+// memoryStore keeps nothing beyond the process, the original behaviour
+type memoryStore struct{}
+
+func (memoryStore) LoadDocuments() ([]Document, error) { return nil, nil }
+func (memoryStore) SaveDocuments([]Document) error     { return nil }
+func (memoryStore) Replace([]Document) error           { return nil }
+func (memoryStore) Delete(string) error                { return nil }
+func (memoryStore) Clear() error                       { return nil }
+func (memoryStore) Close() error                       { return nil }
+
+// loads the persisted documents into the working set at startup
+func restoreDocuments() error {
+	docs, err := state.store.LoadDocuments()
+	if err != nil {
+		return err
+	}
+	// segments left from another collection are rebuilt, matching ones are kept
+	next := 0
+	if len(docs) > 0 {
+		next = docs[len(docs)-1].id + 1
+	}
+	covered := state.segments.Documents()
+	if covered > next {
+		if err := state.segments.Reset(); err != nil {
+			return err
+		}
+		covered = 0
+	}
+	// tombstones live in memory only: the documents deleted before the restart
+	// are tombstoned again, their postings stay in the segments until a merge
+	stored := make(map[int]bool, len(docs))
+	for _, doc := range docs {
+		stored[doc.id] = true
+	}
+	for id := range covered {
+		if !stored[id] {
+			state.segments.Delete(id)
+		}
+	}
+	config := currentIndexConfig()
+	for _, doc := range docs {
+		enrichDocument(&doc, config)
+		indexStoredDocument(doc)
+	}
+	loader, persisted := state.store.(indexLoader)
+	if persisted {
+		if err := repairStoredPostings(loader, docs); err != nil {
+			return err
+		}
+	}
+	if persisted && covered == 0 {
+		index, err := loader.LoadIndex()
+		if err != nil {
+			return err
+		}
+		state.boolean = newBooleanIndex(index)
+	}
+	if len(docs) > 0 {
+		fmt.Printf("Restored %d documents from the store\n", len(docs))
+		checkIndexIntegrity()
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ir/internal/apierror"
+	"ir/internal/engine"
+)
+
+// trigram index over the document text as uploaded, extended as documents are
+// added and rebuilt lazily after removals; a substring can only occur in the documents containing all
+// of its trigrams, so only those are verified
+type trigramIndex struct {
+	postings map[string]engine.Postings // trigram (3 bytes) -> positions in state.Documents
+}
+
+// SubstringSearchResponse is returned by /api/search?mode=substring
+type SubstringSearchResponse struct {
+	TookMs     float64     `json:"tookMs"`
+	TotalHits  int         `json:"totalHits"`  // matching documents before the limit
+	Candidates int         `json:"candidates"` // documents the trigram index left to verify
+	Results    []TextMatch `json:"results"`
+}
+
+// returns the cached trigram index, building it if needed (caller holds the lock)
+func documentTrigrams() *trigramIndex {
+	if state.trigrams != nil {
+		return state.trigrams
+	}
+
+	index := &trigramIndex{postings: map[string]engine.Postings{}}
+	for i, doc := range state.Documents {
+		index.add(i, searchableText(doc))
+	}
+	state.trigrams = index
+	return index
+}
+
+// adds the trigrams of the text of the document at position i, which follows
+// all the positions indexed so far
+func (index *trigramIndex) add(i int, text string) {
+	seen := map[string]bool{}
+	for j := 0; j+3 <= len(text); j++ {
+		if gram := text[j : j+3]; !seen[gram] {
+			seen[gram] = true
+			index.postings[gram] = append(index.postings[gram], i)
+		}
+	}
+}
+
+// the text substring and regex searches run on: as uploaded, else normalized
+func searchableText(doc Document) string {
+	content, raw := doc.text()
+	if raw == "" {
+		return content
+	}
+	return raw
+}
+
+// positions of the documents that may contain the substring; every document
+// for substrings shorter than a trigram
+func (index *trigramIndex) candidates(substring string) engine.Postings {
+	if len(substring) < 3 {
+		return engine.AllDocuments(len(state.Documents))
+	}
+	grams := map[string]bool{}
+	for j := 0; j+3 <= len(substring); j++ {
+		grams[substring[j:j+3]] = true
+	}
+	// the rarest trigrams first keep the intersections small
+	lists := make([]engine.Postings, 0, len(grams))
+	for gram := range grams {
+		lists = append(lists, index.postings[gram])
+	}
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	result := lists[0]
+	for _, postings := range lists[1:] {
+		if len(result) == 0 {
+			break
+		}
+		result = engine.Intersect(result, postings)
+	}
+	return result
+}
+
+// answers /api/search?mode=substring with the documents containing the query
+// verbatim, case-sensitive, most occurrences first (caller holds the lock)
+func substringSearchHandler(w http.ResponseWriter, r *http.Request, requestData SearchRequest, inSubset func(string) bool, started time.Time) {
+	substring := requestData.Query
+	if substring == "" {
+		apierror.Write(w, http.StatusBadRequest, "invalid_query", "The substring to search for is empty.")
+		return
+	}
+
+	candidates := documentTrigrams().candidates(substring)
+	response := SubstringSearchResponse{Candidates: len(candidates), Results: []TextMatch{}}
+	for _, i := range candidates {
+		doc := state.Documents[i]
+		if !inSubset(doc.Name) {
+			continue
+		}
+		text := searchableText(doc)
+		offset := strings.Index(text, substring)
+		if offset < 0 {
+			continue
+		}
+		response.Results = append(response.Results, TextMatch{
+			FileName:    doc.Name,
+			Matches:     strings.Count(text, substring),
+			FirstOffset: offset,
+			FirstMatch:  substring,
+		})
+	}
+	sort.SliceStable(response.Results, func(i, j int) bool {
+		return response.Results[i].Matches > response.Results[j].Matches
+	})
+	response.TotalHits = len(response.Results)
+	if requestData.Limit > 0 && len(response.Results) > requestData.Limit {
+		response.Results = response.Results[:requestData.Limit]
+	}
+
+	results := make([]SearchResult, len(response.Results))
+	for i, match := range response.Results {
+		results[i] = SearchResult{FileName: match.FileName, Score: float64(match.Matches)}
+	}
+	logQuery(requestData.Query, "substring", started, results)
+
+	if format := negotiateFormat(w, r); format != "json" {
+		writeTable(w, format, matchesTable(response.Results))
+		return
+	}
+	response.TookMs = float64(time.Since(started).Microseconds()) / 1000
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func matchesTable(matches []TextMatch) table {
+	t := table{Root: "results", Row: "result", Columns: []string{"fileName", "matches", "firstOffset", "firstMatch"}}
+	for _, match := range matches {
+		t.Rows = append(t.Rows, []string{match.FileName, strconv.Itoa(match.Matches), strconv.Itoa(match.FirstOffset), match.FirstMatch})
+	}
+	return t
+}
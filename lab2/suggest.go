@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"ir/internal/apierror"
+)
+
+const defaultSuggestions = 10
+
+// trieNode is a node of the prefix trie over the vocabulary
+type trieNode struct {
+	children  map[rune]*trieNode
+	term      string // set when a vocabulary term ends here
+	frequency int    // collection frequency of that term
+}
+
+type Completion struct {
+	Query     string `json:"query"` // full suggested query
+	Term      string `json:"term"`  // completed last term
+	Frequency int    `json:"frequency"`
+	Source    string `json:"source"` // "history" for past queries, otherwise "vocabulary"
+}
+
+func (n *trieNode) insert(term string, frequency int) {
+	node := n
+	for _, r := range term {
+		child, ok := node.children[r]
+		if !ok {
+			child = &trieNode{children: map[rune]*trieNode{}}
+			node.children[r] = child
+		}
+		node = child
+	}
+	node.term = term
+	node.frequency += frequency
+}
+
+// node reached by the prefix, nil when no term starts with it
+func (n *trieNode) find(prefix string) *trieNode {
+	node := n
+	for _, r := range prefix {
+		if node = node.children[r]; node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+// all terms below the node
+func (n *trieNode) collect(completions []Completion) []Completion {
+	if n.term != "" {
+		completions = append(completions, Completion{Term: n.term, Frequency: n.frequency, Source: "vocabulary"})
+	}
+	for _, child := range n.children {
+		completions = child.collect(completions)
+	}
+	return completions
+}
+
+// returns the cached vocabulary trie, building it if needed (caller holds the lock)
+func vocabularyTrie() *trieNode {
+	if state.trie != nil {
+		return state.trie
+	}
+	root := &trieNode{children: map[rune]*trieNode{}}
+	for _, doc := range state.Documents {
+		for t, tf := range doc.TermFreq {
+			root.insert(t, tf)
+		}
+	}
+	state.trie = root
+	return root
+}
+
+// past queries with results that extend the prefix, most frequent first
+func historyCompletions(prefix string) []Completion {
+	normalized := strings.Join(strings.Fields(prefix), " ")
+	counts := countQueries(state.queryLog.entries, func(entry QueryLogEntry) bool {
+		return entry.Hits > 0 && entry.Query != normalized && strings.HasPrefix(entry.Query, normalized)
+	})
+
+	result := make([]Completion, len(counts))
+	for i, c := range counts {
+		words := strings.Fields(c.Query)
+		result[i] = Completion{Query: c.Query, Term: words[len(words)-1], Frequency: c.Count, Source: "history"}
+	}
+	return result
+}
+
+// completes the last word of the prefix: past queries first, then the most frequent terms
+func completions(prefix string, limit int) []Completion {
+	prefix = strings.ToLower(strings.TrimLeft(prefix, " "))
+	if strings.TrimSpace(prefix) == "" || strings.HasSuffix(prefix, " ") {
+		return []Completion{}
+	}
+
+	words := strings.Fields(prefix)
+	last := words[len(words)-1]
+	head := strings.Join(words[:len(words)-1], " ")
+
+	var vocabulary []Completion
+	if node := vocabularyTrie().find(last); node != nil {
+		vocabulary = node.collect(nil)
+	}
+	sort.Slice(vocabulary, func(i, j int) bool {
+		if vocabulary[i].Frequency != vocabulary[j].Frequency {
+			return vocabulary[i].Frequency > vocabulary[j].Frequency
+		}
+		return vocabulary[i].Term < vocabulary[j].Term
+	})
+	for i := range vocabulary {
+		vocabulary[i].Query = strings.TrimSpace(head + " " + vocabulary[i].Term)
+	}
+
+	result := []Completion{}
+	seen := make(map[string]bool)
+	for _, c := range append(historyCompletions(prefix), vocabulary...) {
+		if len(result) == limit {
+			break
+		}
+		if !seen[c.Query] {
+			seen[c.Query] = true
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// GET /api/suggest?prefix=infor&limit=10
+func suggestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, ok := intParam(r, "limit", defaultSuggestions)
+	if !ok || limit <= 0 {
+		apierror.Error(w, "Error: Invalid limit.", http.StatusBadRequest)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(completions(r.URL.Query().Get("prefix"), limit))
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"ir/internal/apierror"
+)
+
+const defaultSummarySentences = 3
+
+type SummarySentence struct {
+	Sentence
+	Index int     `json:"index"` // position of the sentence in the document
+	Score float64 `json:"score"`
+}
+
+type Summary struct {
+	Document  string            `json:"document"`
+	Method    string            `json:"method"`
+	Sentences []SummarySentence `json:"sentences"` // in document order
+	Total     int               `json:"totalSentences"`
+}
+
+// TF-IDF vector of a sentence using the document's term weights
+func sentenceVector(terms []string, weights SparseVector) SparseVector {
+	vector := SparseVector{}
+	for _, t := range terms {
+		if w, ok := weights[t]; ok {
+			vector[t] = w
+		}
+	}
+	return vector
+}
+
+// scores sentences by the summed TF-IDF weight of the distinct terms they cover,
+// or by TextRank over the cosine similarity graph of the sentences
+func scoreSentences(sentences []Sentence, weights SparseVector, method string) []float64 {
+	vectors := make([]SparseVector, len(sentences))
+	for i, sentence := range sentences {
+		vectors[i] = sentenceVector(sentenceTerms(sentence.Text), weights)
+	}
+
+	if method == "textrank" {
+		norms := make([]float64, len(vectors))
+		for i, v := range vectors {
+			norms[i] = v.norm()
+		}
+		similarity := make([][]float64, len(vectors))
+		for i := range similarity {
+			similarity[i] = make([]float64, len(vectors))
+			for j := range vectors {
+				if i != j {
+					similarity[i][j] = sparseCosine(vectors[i], norms[i], vectors[j], norms[j])
+				}
+			}
+		}
+		return pageRank(similarity)
+	}
+
+	scores := make([]float64, len(vectors))
+	for i, v := range vectors {
+		for _, w := range v {
+			scores[i] += w
+		}
+	}
+	return scores
+}
+
+type SummarizeRequest struct {
+	Document  string `json:"document"`
+	Sentences int    `json:"sentences" minimum:"1"`
+	Method    string `json:"method" enum:"tfidf|textrank"`
+}
+
+// POST /api/summarize {"document": "Doc1.txt", "sentences": 3, "method": "tfidf|textrank"}
+func summarizeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	requestData := SummarizeRequest{Sentences: defaultSummarySentences, Method: "tfidf"}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		apierror.InvalidJSON(w)
+		return
+	}
+	if requestData.Method != "tfidf" && requestData.Method != "textrank" {
+		apierror.Error(w, "Error: method must be 'tfidf' or 'textrank'.", http.StatusBadRequest)
+		return
+	}
+	if requestData.Sentences <= 0 {
+		requestData.Sentences = defaultSummarySentences
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	i := documentIndex(requestData.Document)
+	if i < 0 {
+		apierror.Error(w, "Error: Document not found.", http.StatusNotFound)
+		return
+	}
+	sentences := documentSentences(state.Documents[i])
+	if len(sentences) == 0 {
+		apierror.Error(w, "Error: Document text is not stored, it cannot be summarized.", http.StatusBadRequest)
+		return
+	}
+
+	scores := scoreSentences(sentences, documentVectors().vectors[i], requestData.Method)
+
+	ranked := make([]SummarySentence, len(sentences))
+	for j, sentence := range sentences {
+		ranked[j] = SummarySentence{Sentence: sentence, Index: j, Score: scores[j]}
+	}
+	sort.SliceStable(ranked, func(a, b int) bool {
+		return ranked[a].Score > ranked[b].Score
+	})
+	ranked = ranked[:min(requestData.Sentences, len(ranked))]
+	sort.Slice(ranked, func(a, b int) bool {
+		return ranked[a].Index < ranked[b].Index
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Summary{
+		Document:  state.Documents[i].Name,
+		Method:    requestData.Method,
+		Sentences: ranked,
+		Total:     len(sentences),
+	})
+}
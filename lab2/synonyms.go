@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"ir/internal/apierror"
+)
+
+// synonyms are single normalized terms
+var synonymTermRegex = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// SynonymConfig is the thesaurus of the collection
+type SynonymConfig struct {
+	Groups [][]string `json:"groups"`
+	// also add the synonyms of every term to documents uploaded afterwards
+	ExpandIndex bool `json:"expandIndex"`
+
+	lookup map[string][]string // term -> other members of its groups
+}
+
+// parses a synonym file: one group of equivalent terms per line, e.g. "car,auto,automobile";
+// empty lines and lines starting with '#' are skipped
+func parseSynonyms(r io.Reader) ([][]string, error) {
+	groups := [][]string{}
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		group := []string{}
+		for _, term := range strings.Split(line, ",") {
+			term = strings.ToLower(strings.TrimSpace(term))
+			if term == "" {
+				continue
+			}
+			if !synonymTermRegex.MatchString(term) {
+				return nil, fmt.Errorf("line %d: '%s' is not a single term", lineNumber, term)
+			}
+			group = append(group, term)
+		}
+		if len(group) < 2 {
+			return nil, fmt.Errorf("line %d: a group needs at least two terms", lineNumber)
+		}
+		groups = append(groups, group)
+	}
+	return groups, scanner.Err()
+}
+
+func newSynonymConfig(groups [][]string, expandIndex bool) SynonymConfig {
+	config := SynonymConfig{Groups: groups, ExpandIndex: expandIndex, lookup: map[string][]string{}}
+	for _, group := range groups {
+		for _, term := range group {
+			for _, other := range group {
+				if other != term && !containsTerm(config.lookup[term], other) {
+					config.lookup[term] = append(config.lookup[term], other)
+				}
+			}
+		}
+	}
+	return config
+}
+
+func containsTerm(terms []string, term string) bool {
+	for _, t := range terms {
+		if t == term {
+			return true
+		}
+	}
+	return false
+}
+
+// adds the synonyms of every query term after it; returns the query unchanged
+// when nothing was added
+func expandSynonyms(query string, config SynonymConfig) (string, bool) {
+	terms := strings.Fields(strings.ToLower(query))
+	seen := make(map[string]bool)
+	for _, t := range terms {
+		seen[t] = true
+	}
+
+	expanded := make([]string, 0, len(terms))
+	added := false
+	for _, t := range terms {
+		expanded = append(expanded, t)
+		for _, synonym := range config.lookup[t] {
+			if !seen[synonym] {
+				seen[synonym] = true
+				expanded = append(expanded, synonym)
+				added = true
+			}
+		}
+	}
+	if !added {
+		return query, false
+	}
+	return strings.Join(expanded, " "), true
+}
+
+// index-time expansion: every synonym counts as often as the term itself
+func expandDocumentSynonyms(doc *Document, config SynonymConfig) {
+	additions := make(map[string]int)
+	for t, tf := range doc.TermFreq {
+		for _, synonym := range config.lookup[t] {
+			additions[synonym] += tf
+		}
+	}
+	for t, tf := range additions {
+		doc.TermFreq[t] += tf
+	}
+}
+
+// GET returns the thesaurus, POST uploads a synonym file (form field "file",
+// optional "expandIndex=true") and DELETE removes it
+func synonymsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			apierror.Error(w, "Error: Synonym file is required.", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		groups, err := parseSynonyms(file)
+		if err != nil {
+			apierror.Error(w, "Error: Invalid synonym file: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		state.Lock()
+		state.Synonyms = newSynonymConfig(groups, r.FormValue("expandIndex") == "true")
+		state.Unlock()
+		fmt.Println("Synonym groups loaded:", len(groups))
+	case http.MethodDelete:
+		state.Lock()
+		state.Synonyms = newSynonymConfig([][]string{}, false)
+		state.Unlock()
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state.Synonyms)
+}
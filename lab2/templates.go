@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"ir/internal/apierror"
+	"ir/internal/engine"
+)
+
+// QueryTemplate is a saved boolean query with {{param}} placeholders, e.g.
+// name:{{kind}} and {{topic}} and not draft
+type QueryTemplate struct {
+	Name   string   `json:"name"`
+	Query  string   `json:"query"`
+	Params []string `json:"params"`
+}
+
+type TemplateRequest struct {
+	Name  string `json:"name" maxLength:"200"`
+	Query string `json:"query" maxLength:"10000"`
+}
+
+type RunTemplateRequest struct {
+	Name   string            `json:"name"`
+	Params map[string]string `json:"params"`
+}
+
+// matches {{param}} placeholders inside a template query
+var placeholderRegex = regexp.MustCompile(`\{\{\s*([a-z0-9_]+)\s*\}\}`)
+
+// parameter values are substituted as single terms, never as operators
+var paramValueRegex = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// a term that reads as a field other than name: or as a comparison, such as
+// title:x or date>x, neither of which the boolean grammar has
+var unsupportedFieldRegex = regexp.MustCompile(`^([a-z0-9_]+)(:|[<>]=?|=)`)
+
+// checks that the template parses as a boolean query using only the fields the
+// grammar supports, with single terms in place of the placeholders
+func validateTemplate(query string) error {
+	ast, err := engine.ParseQuery(placeholderRegex.ReplaceAllString(query, "x"))
+	if err != nil {
+		return err
+	}
+	return checkTemplateFields(ast)
+}
+
+func checkTemplateFields(node *engine.QueryNode) error {
+	if node == nil {
+		return nil
+	}
+	if node.Op == "term" && node.Field == "" {
+		if match := unsupportedFieldRegex.FindStringSubmatch(node.Term); match != nil {
+			return fmt.Errorf("unsupported field '%s%s', boolean queries only have '%s'", match[1], match[2], engine.NameFieldPrefix)
+		}
+	}
+	for _, child := range node.Children {
+		if err := checkTemplateFields(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returns the unique placeholder names in order of first appearance
+func templateParams(query string) []string {
+	params := []string{}
+	seen := make(map[string]bool)
+	for _, match := range placeholderRegex.FindAllStringSubmatch(query, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			params = append(params, match[1])
+		}
+	}
+	return params
+}
+
+// substitutes parameter values into the template query
+func renderTemplate(tmpl QueryTemplate, values map[string]string) (string, error) {
+	substitutions := make(map[string]string)
+	for _, param := range tmpl.Params {
+		value, ok := values[param]
+		if !ok {
+			return "", fmt.Errorf("missing value for parameter '%s'", param)
+		}
+		value = strings.ToLower(strings.TrimSpace(value))
+		if !paramValueRegex.MatchString(value) {
+			return "", fmt.Errorf("invalid value for parameter '%s': must be a single term", param)
+		}
+		substitutions[param] = value
+	}
+
+	rendered := placeholderRegex.ReplaceAllStringFunc(tmpl.Query, func(placeholder string) string {
+		name := placeholderRegex.FindStringSubmatch(placeholder)[1]
+		return substitutions[name]
+	})
+	return rendered, nil
+}
+
+// lists, saves and deletes query templates
+func templatesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		state.Lock()
+		templates := make([]QueryTemplate, 0, len(state.Templates))
+		for _, tmpl := range state.Templates {
+			templates = append(templates, tmpl)
+		}
+		state.Unlock()
+
+		sort.Slice(templates, func(i, j int) bool {
+			return templates[i].Name < templates[j].Name
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(templates)
+
+	case http.MethodPost:
+		var requestData TemplateRequest
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+
+		name := strings.TrimSpace(requestData.Name)
+		query := strings.ToLower(strings.TrimSpace(requestData.Query))
+		if name == "" || query == "" {
+			apierror.Error(w, "Error: Template name and query are required.", http.StatusBadRequest)
+			return
+		}
+		if err := validateTemplate(query); err != nil {
+			apierror.Write(w, http.StatusBadRequest, "invalid_query", "Invalid template: "+err.Error())
+			return
+		}
+
+		tmpl := QueryTemplate{
+			Name:   name,
+			Query:  query,
+			Params: templateParams(query),
+		}
+
+		state.Lock()
+		state.Templates[name] = tmpl
+		state.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tmpl)
+
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+
+		state.Lock()
+		defer state.Unlock()
+
+		if _, ok := state.Templates[name]; !ok {
+			apierror.Error(w, "Error: Template not found.", http.StatusNotFound)
+			return
+		}
+		delete(state.Templates, name)
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// runs a saved template with the given parameter values as a boolean search
+func runTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
+	var requestData RunTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		apierror.InvalidJSON(w)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	tmpl, ok := state.Templates[requestData.Name]
+	if !ok {
+		apierror.Error(w, "Error: Template not found.", http.StatusNotFound)
+		return
+	}
+	if len(state.Documents) == 0 {
+		apierror.Write(w, http.StatusBadRequest, "no_documents", "No documents uploaded. Please add documents first.")
+		return
+	}
+
+	query, err := renderTemplate(tmpl, requestData.Params)
+	if err != nil {
+		apierror.Error(w, "Error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results, _, err := booleanSearch(normalizeQuery(query))
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, "invalid_query", "Invalid query: "+err.Error())
+		return
+	}
+
+	response := BooleanSearchResponse{TotalHits: len(results), Results: results}
+	response.TookMs = float64(time.Since(started).Microseconds()) / 1000
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
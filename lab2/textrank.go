@@ -0,0 +1,84 @@
+package main
+
+import "math"
+
+const (
+	textRankDamping    = 0.85
+	textRankIterations = 50
+	textRankTolerance  = 1e-6
+	textRankWindow     = 4 // co-occurrence window for keyword graphs, in tokens
+)
+
+// weighted PageRank over an undirected graph given as a symmetric weight matrix
+func pageRank(weights [][]float64) []float64 {
+	n := len(weights)
+	scores := make([]float64, n)
+	if n == 0 {
+		return scores
+	}
+
+	outgoing := make([]float64, n)
+	for i, row := range weights {
+		for _, w := range row {
+			outgoing[i] += w
+		}
+	}
+	for i := range scores {
+		scores[i] = 1.0 / float64(n)
+	}
+
+	next := make([]float64, n)
+	for range textRankIterations {
+		delta := 0.0
+		for i := range n {
+			rank := 0.0
+			for j := range n {
+				if weights[j][i] > 0 && outgoing[j] > 0 {
+					rank += weights[j][i] / outgoing[j] * scores[j]
+				}
+			}
+			next[i] = (1-textRankDamping)/float64(n) + textRankDamping*rank
+			delta += math.Abs(next[i] - scores[i])
+		}
+		scores, next = next, scores
+		if delta < textRankTolerance {
+			break
+		}
+	}
+	return scores
+}
+
+// TextRank keyword scores over the co-occurrence graph of the allowed tokens
+func textRankKeywords(tokens []string, allowed func(string) bool) SparseVector {
+	ids := make(map[string]int)
+	var terms []string
+	for _, t := range tokens {
+		if _, ok := ids[t]; !ok && allowed(t) {
+			ids[t] = len(terms)
+			terms = append(terms, t)
+		}
+	}
+
+	weights := make([][]float64, len(terms))
+	for i := range weights {
+		weights[i] = make([]float64, len(terms))
+	}
+	for i, t := range tokens {
+		a, ok := ids[t]
+		if !ok {
+			continue
+		}
+		for j := i + 1; j < len(tokens) && j < i+textRankWindow; j++ {
+			if b, ok := ids[tokens[j]]; ok && a != b {
+				weights[a][b]++
+				weights[b][a]++
+			}
+		}
+	}
+
+	scores := SparseVector{}
+	for i, score := range pageRank(weights) {
+		scores[terms[i]] = score
+	}
+	return scores
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+
+	"ir/internal/apierror"
+)
+
+const (
+	defaultTopics     = 10
+	defaultIterations = 500
+	defaultTopicBeta  = 0.01
+	topicWords        = 10
+)
+
+// ldaModel is a latent Dirichlet allocation fitted by collapsed Gibbs sampling
+// (Griffiths & Steyvers, 2004)
+type ldaModel struct {
+	iterations  int
+	alpha, beta float64
+	terms       []string
+	phi         [][]float64    // topic -> term distribution, aligned with terms
+	theta       [][]float64    // document -> topic mixture, aligned with documents
+	documents   []string       // names at fitting time
+	dominant    map[string]int // document name -> topic of the largest share
+}
+
+type TopicsRequest struct {
+	K          int     `json:"k" minimum:"1" maximum:"200"`
+	Iterations int     `json:"iterations" minimum:"1" maximum:"10000"`
+	Alpha      float64 `json:"alpha" minimum:"0"` // document-topic prior, 50/k when 0
+	Beta       float64 `json:"beta" minimum:"0"`  // topic-term prior, 0.01 when 0
+}
+
+type Topic struct {
+	ID    int          `json:"id"`
+	Words []TermWeight `json:"words"` // most probable terms
+}
+
+type DocumentTopics struct {
+	Document string    `json:"document"`
+	Dominant int       `json:"dominant"`
+	Mixture  []float64 `json:"mixture"` // share of each topic
+}
+
+type TopicModel struct {
+	K          int              `json:"k"`
+	Iterations int              `json:"iterations"`
+	Alpha      float64          `json:"alpha"`
+	Beta       float64          `json:"beta"`
+	Terms      int              `json:"terms"`
+	Topics     []Topic          `json:"topics"`
+	Documents  []DocumentTopics `json:"documents"`
+}
+
+// fits k topics to the term frequencies of the documents (caller holds the lock)
+func buildLDA(k, iterations int, alpha, beta float64) *ldaModel {
+	vocabulary := map[string]int{}
+	var terms []string
+	for _, doc := range state.Documents {
+		for t := range doc.TermFreq {
+			if _, ok := vocabulary[t]; !ok {
+				vocabulary[t] = len(terms)
+				terms = append(terms, t)
+			}
+		}
+	}
+	sort.Strings(terms)
+	for i, t := range terms {
+		vocabulary[t] = i
+	}
+
+	// every token of a document as a term ID, in a fixed order for reproducible samples
+	tokens := make([][]int, len(state.Documents))
+	for d, doc := range state.Documents {
+		docTerms := make([]string, 0, len(doc.TermFreq))
+		for t := range doc.TermFreq {
+			docTerms = append(docTerms, t)
+		}
+		sort.Strings(docTerms)
+		for _, t := range docTerms {
+			for range doc.TermFreq[t] {
+				tokens[d] = append(tokens[d], vocabulary[t])
+			}
+		}
+	}
+
+	v := len(terms)
+	docTopic := make([][]int, len(tokens))    // n_dk
+	topicTerm := make([][]int, k)             // n_kw
+	topicTotal := make([]int, k)              // n_k
+	assignments := make([][]int, len(tokens)) // z_di
+	for z := range k {
+		topicTerm[z] = make([]int, v)
+	}
+	rng := rand.New(rand.NewPCG(1, 1))
+	for d, doc := range tokens {
+		docTopic[d] = make([]int, k)
+		assignments[d] = make([]int, len(doc))
+		for i, w := range doc {
+			z := rng.IntN(k)
+			assignments[d][i] = z
+			docTopic[d][z]++
+			topicTerm[z][w]++
+			topicTotal[z]++
+		}
+	}
+
+	weights := make([]float64, k)
+	vBeta := float64(v) * beta
+	for range iterations {
+		for d, doc := range tokens {
+			for i, w := range doc {
+				z := assignments[d][i]
+				docTopic[d][z]--
+				topicTerm[z][w]--
+				topicTotal[z]--
+
+				// p(z | rest) ~ (n_dk + alpha) (n_kw + beta) / (n_k + V beta)
+				total := 0.0
+				for t := range k {
+					total += (float64(docTopic[d][t]) + alpha) * (float64(topicTerm[t][w]) + beta) / (float64(topicTotal[t]) + vBeta)
+					weights[t] = total
+				}
+				u := rng.Float64() * total
+				z = sort.SearchFloat64s(weights, u)
+				z = min(z, k-1)
+
+				assignments[d][i] = z
+				docTopic[d][z]++
+				topicTerm[z][w]++
+				topicTotal[z]++
+			}
+		}
+	}
+
+	model := &ldaModel{
+		iterations: iterations,
+		alpha:      alpha,
+		beta:       beta,
+		terms:      terms,
+		phi:        make([][]float64, k),
+		theta:      make([][]float64, len(tokens)),
+		documents:  make([]string, len(tokens)),
+		dominant:   make(map[string]int, len(tokens)),
+	}
+	for z := range k {
+		model.phi[z] = make([]float64, v)
+		for w := range v {
+			model.phi[z][w] = (float64(topicTerm[z][w]) + beta) / (float64(topicTotal[z]) + vBeta)
+		}
+	}
+	for d, doc := range tokens {
+		model.theta[d] = make([]float64, k)
+		best := 0
+		for z := range k {
+			model.theta[d][z] = (float64(docTopic[d][z]) + alpha) / (float64(len(doc)) + float64(k)*alpha)
+			if model.theta[d][z] > model.theta[d][best] {
+				best = z
+			}
+		}
+		name := state.Documents[d].Name
+		model.documents[d] = name
+		model.dominant[name] = best
+	}
+	return model
+}
+
+func (m *ldaModel) info() TopicModel {
+	info := TopicModel{
+		K:          len(m.phi),
+		Iterations: m.iterations,
+		Alpha:      m.alpha,
+		Beta:       m.beta,
+		Terms:      len(m.terms),
+		Topics:     make([]Topic, len(m.phi)),
+		Documents:  make([]DocumentTopics, len(m.theta)),
+	}
+	for z, distribution := range m.phi {
+		weights := SparseVector{}
+		for w, p := range distribution {
+			weights[m.terms[w]] = p
+		}
+		info.Topics[z] = Topic{ID: z, Words: topWeights(weights, topicWords)}
+	}
+	for d, mixture := range m.theta {
+		info.Documents[d] = DocumentTopics{Document: m.documents[d], Dominant: m.dominant[m.documents[d]], Mixture: mixture}
+	}
+	return info
+}
+
+// the filter keeping the documents whose dominant topic is the requested one;
+// every document when none is requested (caller holds the lock)
+func topicSubset(topic *int) (func(string) bool, error) {
+	if topic == nil {
+		return func(string) bool { return true }, nil
+	}
+	if state.topics == nil {
+		return nil, fmt.Errorf("topic filter needs a topic model, POST /api/topics first")
+	}
+	if *topic < 0 || *topic >= len(state.topics.phi) {
+		return nil, fmt.Errorf("topic must be between 0 and %d", len(state.topics.phi)-1)
+	}
+	return func(name string) bool {
+		dominant, ok := state.topics.dominant[name]
+		return ok && dominant == *topic
+	}, nil
+}
+
+// GET describes the current topic model, POST {"k": 10, "iterations": 500}
+// (re)fits it to the collection; the model is dropped whenever documents change
+func topicsHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		if state.topics == nil {
+			apierror.Error(w, "Error: Topic model is not built.", http.StatusNotFound)
+			return
+		}
+	case http.MethodPost:
+		requestData := TopicsRequest{K: defaultTopics, Iterations: defaultIterations}
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			apierror.InvalidJSON(w)
+			return
+		}
+		if requestData.K <= 0 || requestData.Iterations <= 0 {
+			apierror.Error(w, "Error: k and iterations must be positive.", http.StatusBadRequest)
+			return
+		}
+		if len(state.Documents) == 0 {
+			apierror.Write(w, http.StatusBadRequest, "no_documents", "No documents uploaded. Please add documents first.")
+			return
+		}
+		if requestData.Alpha == 0 {
+			requestData.Alpha = 50 / float64(requestData.K)
+		}
+		if requestData.Beta == 0 {
+			requestData.Beta = defaultTopicBeta
+		}
+		state.topics = buildLDA(requestData.K, requestData.Iterations, requestData.Alpha, requestData.Beta)
+		fmt.Println("Topic model built with", requestData.K, "topics")
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state.topics.info())
+}
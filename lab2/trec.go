@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"ir/internal/apierror"
+)
+
+// TREC files are whitespace separated, so spaces in document names become underscores
+func trecID(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// parses "qid iteration docid relevance" lines; blank lines and # comments are skipped
+func parseTRECQrels(r io.Reader) ([]Qrel, error) {
+	var qrels []Qrel
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("line %d: expected 4 fields, got %d", line, len(fields))
+		}
+		relevance, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid relevance '%s'", line, fields[3])
+		}
+		qrels = append(qrels, Qrel{QueryID: fields[0], Document: fields[2], Relevance: relevance})
+	}
+	return qrels, scanner.Err()
+}
+
+// the qrels file is matched against document names as written by trecID
+func trecDocumentName(id string) string {
+	for _, doc := range state.Documents {
+		if trecID(doc.Name) == id {
+			return doc.Name
+		}
+	}
+	return id
+}
+
+// GET exports the judgments as a TREC qrels file, POST imports one from the multipart "file"
+func trecQrelsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		state.Lock()
+		defer state.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, qrel := range qrelList() {
+			fmt.Fprintf(w, "%s 0 %s %d\n", qrel.QueryID, trecID(qrel.Document), qrel.Relevance)
+		}
+	case http.MethodPost:
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			apierror.Error(w, "Error: Qrels file is required.", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		qrels, err := parseTRECQrels(file)
+		if err != nil {
+			apierror.Error(w, "Error: Invalid qrels file: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		state.Lock()
+		defer state.Unlock()
+
+		for _, qrel := range qrels {
+			qrel.Document = trecDocumentName(qrel.Document)
+			addQrel(qrel)
+		}
+		fmt.Println("TREC qrels loaded:", len(qrels))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(qrelList())
+	default:
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+type TRECRunRequest struct {
+	Ranker string         `json:"ranker"`
+	Hybrid *HybridOptions `json:"hybrid"`
+	Tag    string         `json:"tag"`
+	Depth  int            `json:"depth" minimum:"1"`
+}
+
+// POST /api/eval/run/trec {"ranker": "bm25", "tag": "bm25", "depth": 1000} returns the run
+// of every evaluation query as "qid Q0 docid rank score tag" lines
+func trecRunHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	requestData := TRECRunRequest{Depth: 1000}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		apierror.InvalidJSON(w)
+		return
+	}
+	if requestData.Depth <= 0 {
+		apierror.Error(w, "Error: depth must be positive.", http.StatusBadRequest)
+		return
+	}
+	if requestData.Tag == "" {
+		requestData.Tag = requestData.Ranker
+		if requestData.Tag == "" {
+			requestData.Tag = "cosine"
+		}
+	}
+	requestData.Tag = trecID(requestData.Tag)
+
+	// every query of the run ranks over the same view, without the lock
+	state.Lock()
+	queries := slices.Clone(state.EvalQueries)
+	view, err := snapshotCorpus(requestData.Ranker)
+	state.Unlock()
+	if len(queries) == 0 {
+		apierror.Error(w, "Error: No evaluation queries. Please add queries first.", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		apierror.Error(w, "Error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var run strings.Builder
+	for _, query := range queries {
+		results, err := view.rank(requestData.Ranker, normalizeQuery(query.Query), requestData.Hybrid)
+		if err != nil {
+			apierror.Error(w, "Error: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		for i, result := range results[:min(requestData.Depth, len(results))] {
+			fmt.Fprintf(&run, "%s Q0 %s %d %.6f %s\n", trecID(query.ID), trecID(result.FileName), i+1, result.Score, requestData.Tag)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", requestData.Tag+".run"))
+	io.WriteString(w, run.String())
+}
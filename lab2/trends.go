@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"ir/internal/apierror"
+)
+
+const (
+	maxTrendTerms   = 20
+	maxTrendBuckets = 1200 // a century of months
+)
+
+// TrendBucket counts the terms over the documents dated within one month or year
+type TrendBucket struct {
+	Bucket    string             `json:"bucket"` // "2024-01" or "2024"
+	Documents int                `json:"documents"`
+	Tokens    int                `json:"tokens"`
+	Counts    map[string]int     `json:"counts"`
+	Relative  map[string]float64 `json:"relative"` // counts per thousand tokens of the bucket
+}
+
+type TermTrends struct {
+	Field    string        `json:"field"`
+	Interval string        `json:"interval"`
+	Terms    []string      `json:"terms"`
+	Undated  int           `json:"undated"` // documents without a date, left out
+	Buckets  []TrendBucket `json:"buckets"`
+}
+
+// the date of the document in the field: "uploaded" for the upload time, else
+// the first value of a date metadata field (caller holds the lock)
+func documentDate(doc Document, field string) (time.Time, bool) {
+	if field == "uploaded" {
+		return doc.Uploaded, !doc.Uploaded.IsZero()
+	}
+	for _, value := range metadataValues(doc.Name, field) {
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// the first declared date field in name order, "uploaded" without one (caller holds the lock)
+func defaultDateField() string {
+	best := ""
+	for field, fieldType := range state.MetadataTypes {
+		if fieldType == "date" && (best == "" || field < best) {
+			best = field
+		}
+	}
+	if best == "" {
+		return "uploaded"
+	}
+	return best
+}
+
+// GET /api/trends?terms=search&terms=index&field=date&interval=month|year
+// counts the terms in the documents of each month or year, the empty buckets
+// between the first and the last date included so the series can be plotted
+func trendsHandler(w http.ResponseWriter, r *http.Request) {
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "month"
+	}
+	if interval != "month" && interval != "year" {
+		apierror.Error(w, "Error: 'interval' must be month or year.", http.StatusBadRequest)
+		return
+	}
+	var terms []string
+	for _, raw := range r.URL.Query()["terms"] {
+		for _, t := range sentenceTerms(raw) {
+			if !contains(terms, t) {
+				terms = append(terms, t)
+			}
+		}
+	}
+	if len(terms) == 0 || len(terms) > maxTrendTerms {
+		apierror.Error(w, "Error: Between 1 and 20 terms are required.", http.StatusBadRequest)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	field := r.URL.Query().Get("field")
+	if field == "" {
+		field = defaultDateField()
+	}
+	if field != "uploaded" && state.MetadataTypes[field] != "date" {
+		apierror.Error(w, "Error: 'field' must be 'uploaded' or a declared date field.", http.StatusBadRequest)
+		return
+	}
+
+	// buckets by the first day of the month or year
+	truncate := func(t time.Time) time.Time {
+		if interval == "year" {
+			return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+		}
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	next := func(t time.Time) time.Time {
+		if interval == "year" {
+			return t.AddDate(1, 0, 0)
+		}
+		return t.AddDate(0, 1, 0)
+	}
+	layout := "2006-01"
+	if interval == "year" {
+		layout = "2006"
+	}
+
+	newBucket := func() *TrendBucket {
+		bucket := &TrendBucket{Counts: map[string]int{}, Relative: map[string]float64{}}
+		for _, t := range terms {
+			bucket.Counts[t], bucket.Relative[t] = 0, 0
+		}
+		return bucket
+	}
+
+	result := TermTrends{Field: field, Interval: interval, Terms: terms, Buckets: []TrendBucket{}}
+	buckets := map[time.Time]*TrendBucket{}
+	for _, doc := range state.Documents {
+		date, ok := documentDate(doc, field)
+		if !ok {
+			result.Undated++
+			continue
+		}
+		key := truncate(date.UTC())
+		bucket, ok := buckets[key]
+		if !ok {
+			bucket = newBucket()
+			buckets[key] = bucket
+		}
+		bucket.Documents++
+		bucket.Tokens += doc.Length
+		for _, t := range terms {
+			bucket.Counts[t] += doc.TermFreq[t]
+		}
+	}
+
+	keys := make([]time.Time, 0, len(buckets))
+	for key := range buckets {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Before(keys[j]) })
+	if len(keys) > 0 {
+		for key := keys[0]; !key.After(keys[len(keys)-1]); key = next(key) {
+			if len(result.Buckets) == maxTrendBuckets {
+				apierror.Error(w, "Error: The dates span too many buckets, try interval=year.", http.StatusBadRequest)
+				return
+			}
+			bucket, ok := buckets[key]
+			if !ok {
+				bucket = newBucket()
+			}
+			bucket.Bucket = key.Format(layout)
+			for _, t := range terms {
+				if bucket.Tokens > 0 {
+					bucket.Relative[t] = 1000 * float64(bucket.Counts[t]) / float64(bucket.Tokens)
+				}
+			}
+			result.Buckets = append(result.Buckets, *bucket)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"math"
+	"sort"
+
+	"ir/internal/engine"
+)
+
+// SparseVector maps terms to weights
+type SparseVector map[string]float64
+
+// TF-IDF vectors of all documents, rebuilt lazily after the corpus changes
+type vectorCache struct {
+	vectors []SparseVector // aligned with state.Documents
+	norms   []float64
+	idf     map[string]float64
+	terms   []string // sorted vocabulary, for prefix lookups
+}
+
+// returns the cached document vectors, building them if needed (caller holds the lock)
+func documentVectors() *vectorCache {
+	if state.vectors != nil {
+		return state.vectors
+	}
+
+	cache := &vectorCache{
+		vectors: make([]SparseVector, len(state.Documents)),
+		norms:   make([]float64, len(state.Documents)),
+		idf:     make(map[string]float64),
+	}
+
+	df := make(map[string]int)
+	for _, doc := range state.Documents {
+		for t := range doc.TermFreq {
+			df[t]++
+		}
+	}
+	for t, n := range df {
+		cache.idf[t] = inverseDocumentFrequency(n, len(state.Documents))
+		cache.terms = append(cache.terms, t)
+	}
+	sort.Strings(cache.terms)
+
+	for i, doc := range state.Documents {
+		cache.vectors[i] = tfidfVector(doc, cache.idf)
+		cache.norms[i] = cache.vectors[i].norm()
+	}
+
+	state.vectors = cache
+	return cache
+}
+
+// drops the cached vectors, k-gram and trigram indexes, trie, models and statistics; called whenever
+// documents are removed or replaced, which is also announced to the /ws clients
+func invalidateCaches() {
+	state.vectors = nil
+	state.kgrams = nil
+	state.trigrams = nil
+	state.trie = nil
+	state.lsi = nil
+	state.topics = nil
+	state.boolean = nil
+	state.collection, state.unscored = nil, nil
+	publishStats()
+}
+
+// takes the document appended at position i into the caches: the vocabulary
+// indexes, the trie and the name index add its terms, the collection
+// statistics add it on their next use; the TF-IDF vectors and the fitted
+// models weigh every document by the idf the document changes, so they alone
+// are dropped (caller holds the lock)
+func documentAdded(i int) {
+	doc := state.Documents[i]
+	if index := state.kgrams; index != nil {
+		for t := range doc.TermFreq {
+			if index.df[t] == 0 {
+				for gram := range kgrams(t) {
+					index.postings[gram] = append(index.postings[gram], t)
+				}
+			}
+			index.df[t]++
+		}
+	}
+	if index := state.trigrams; index != nil {
+		index.add(i, searchableText(doc))
+	}
+	if root := state.trie; root != nil {
+		for t, tf := range doc.TermFreq {
+			root.insert(t, tf)
+		}
+	}
+	if index := state.boolean; index != nil {
+		index.names.Add(doc.id, engine.NameTokens(doc.Name))
+		index.positions[doc.id] = i
+	}
+	if state.collection != nil {
+		state.unscored = append(state.unscored, doc)
+	}
+	state.vectors = nil
+	state.lsi = nil
+	state.topics = nil
+	publishStats()
+}
+
+// weights each term of the document by tf * idf
+func tfidfVector(doc Document, idf map[string]float64) SparseVector {
+	vector := make(SparseVector, len(doc.TermFreq))
+	for t := range doc.TermFreq {
+		if weight := calculateTF(t, doc) * idf[t]; weight > 0 {
+			vector[t] = weight
+		}
+	}
+	return vector
+}
+
+func (v SparseVector) norm() float64 {
+	sumSq := 0.0
+	for _, weight := range v {
+		sumSq += weight * weight
+	}
+	return math.Sqrt(sumSq)
+}
+
+func (v SparseVector) dot(other SparseVector) float64 {
+	// iterate over the smaller vector
+	if len(other) < len(v) {
+		v, other = other, v
+	}
+	dot := 0.0
+	for t, weight := range v {
+		dot += weight * other[t]
+	}
+	return dot
+}
+
+// cosine similarity of two sparse vectors with precomputed norms
+func sparseCosine(a SparseVector, aNorm float64, b SparseVector, bNorm float64) float64 {
+	if aNorm == 0.0 || bNorm == 0.0 {
+		return 0.0
+	}
+	return a.dot(b) / (aNorm * bNorm)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ir/internal/apierror"
+)
+
+// previous versions kept per document; older ones are dropped
+const maxDocumentVersions = 10
+
+// largest diff table, in compared line pairs, after trimming the common prefix and suffix
+const maxDiffCells = 4_000_000
+
+// DocumentVersion describes one version of a document
+type DocumentVersion struct {
+	Version int       `json:"version"`
+	Time    time.Time `json:"time,omitzero"` // unknown for the originally uploaded version
+	Length  int       `json:"length"`        // tokens
+	Current bool      `json:"current,omitempty"`
+
+	raw string // text as uploaded
+}
+
+// the version history of one document, kept in memory
+type versionHistory struct {
+	Current  int               // number of the current version
+	Updated  time.Time         // when the current version was written
+	Previous []DocumentVersion // oldest first, at most maxDocumentVersions
+}
+
+// DiffLine is one line of a line-based diff
+type DiffLine struct {
+	Op   string `json:"op"` // "=", "-" (only in the old version) or "+" (only in the new one)
+	Text string `json:"text"`
+}
+
+type DiffResponse struct {
+	Name    string     `json:"name"`
+	From    int        `json:"from"`
+	To      int        `json:"to"`
+	Added   int        `json:"added"`
+	Removed int        `json:"removed"`
+	Lines   []DiffLine `json:"lines"`
+}
+
+// history of the named document; documents never replaced are at version 1 (caller holds the lock)
+func documentHistory(name string) *versionHistory {
+	if history, ok := state.Versions[name]; ok {
+		return history
+	}
+	return &versionHistory{Current: 1}
+}
+
+// keeps the replaced document with its text as a previous version; returns the
+// new version number (caller holds the lock)
+func recordVersion(old Document, raw string) int {
+	history := documentHistory(old.Name)
+	history.Previous = append(history.Previous, DocumentVersion{
+		Version: history.Current,
+		Time:    history.Updated,
+		Length:  old.Length,
+		raw:     raw,
+	})
+	if len(history.Previous) > maxDocumentVersions {
+		history.Previous = history.Previous[len(history.Previous)-maxDocumentVersions:]
+	}
+	history.Current++
+	history.Updated = time.Now()
+	state.Versions[old.Name] = history
+	return history.Current
+}
+
+// all kept versions of the document at position i, the current one last (caller holds the lock)
+func documentVersions(i int) []DocumentVersion {
+	doc := state.Documents[i]
+	history := documentHistory(doc.Name)
+	versions := append([]DocumentVersion{}, history.Previous...)
+	return append(versions, DocumentVersion{
+		Version: history.Current,
+		Time:    history.Updated,
+		Length:  doc.Length,
+		Current: true,
+		raw:     doc.raw(),
+	})
+}
+
+func findVersion(versions []DocumentVersion, number int) (DocumentVersion, bool) {
+	for _, version := range versions {
+		if version.Version == number {
+			return version, true
+		}
+	}
+	return DocumentVersion{}, false
+}
+
+// line diff by longest common subsequence
+func diffLines(a, b string) ([]DiffLine, error) {
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+	mx, my := x[prefix:len(x)-suffix], y[prefix:len(y)-suffix]
+	if len(mx)*len(my) > maxDiffCells {
+		return nil, fmt.Errorf("versions differ in too many lines to diff")
+	}
+
+	// lcs[i][j] is the LCS length of mx[i:] and my[j:]
+	lcs := make([][]int, len(mx)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(my)+1)
+	}
+	for i := len(mx) - 1; i >= 0; i-- {
+		for j := len(my) - 1; j >= 0; j-- {
+			if mx[i] == my[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := make([]DiffLine, 0, len(x)+len(my))
+	for _, line := range x[:prefix] {
+		lines = append(lines, DiffLine{"=", line})
+	}
+	i, j := 0, 0
+	for i < len(mx) || j < len(my) {
+		switch {
+		case i < len(mx) && j < len(my) && mx[i] == my[j]:
+			lines = append(lines, DiffLine{"=", mx[i]})
+			i++
+			j++
+		case i < len(mx) && (j == len(my) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, DiffLine{"-", mx[i]})
+			i++
+		default:
+			lines = append(lines, DiffLine{"+", my[j]})
+			j++
+		}
+	}
+	for _, line := range x[len(x)-suffix:] {
+		lines = append(lines, DiffLine{"=", line})
+	}
+	return lines, nil
+}
+
+// GET /api/documents/{name}/versions lists the kept versions, with the ETag of the current one
+func versionsHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	i := documentIndex(r.PathValue("name"))
+	if i < 0 {
+		apierror.Error(w, "Error: Document not found.", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", documentETag(state.Documents[i]))
+	json.NewEncoder(w).Encode(documentVersions(i))
+}
+
+// GET /api/documents/{name}/versions/{version} returns the text of a version as uploaded
+func versionTextHandler(w http.ResponseWriter, r *http.Request) {
+	number, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil {
+		apierror.Error(w, "Error: Invalid version.", http.StatusBadRequest)
+		return
+	}
+
+	state.Lock()
+	defer state.Unlock()
+
+	i := documentIndex(r.PathValue("name"))
+	if i < 0 {
+		apierror.Error(w, "Error: Document not found.", http.StatusNotFound)
+		return
+	}
+	version, ok := findVersion(documentVersions(i), number)
+	if !ok {
+		apierror.Error(w, "Error: Version not found.", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, version.raw)
+}
+
+// GET /api/documents/{name}/diff?from=1&to=2 compares two versions line by line;
+// to defaults to the current version, from to the one before it
+func versionDiffHandler(w http.ResponseWriter, r *http.Request) {
+	state.Lock()
+	defer state.Unlock()
+
+	name := r.PathValue("name")
+	i := documentIndex(name)
+	if i < 0 {
+		apierror.Error(w, "Error: Document not found.", http.StatusNotFound)
+		return
+	}
+	versions := documentVersions(i)
+	to, ok := intParam(r, "to", versions[len(versions)-1].Version)
+	if !ok {
+		apierror.Error(w, "Error: 'to' must be a positive integer.", http.StatusBadRequest)
+		return
+	}
+	from, ok := intParam(r, "from", to-1)
+	if !ok {
+		apierror.Error(w, "Error: 'from' must be a positive integer.", http.StatusBadRequest)
+		return
+	}
+	fromVersion, ok1 := findVersion(versions, from)
+	toVersion, ok2 := findVersion(versions, to)
+	if !ok1 || !ok2 {
+		apierror.Error(w, "Error: Version not found.", http.StatusNotFound)
+		return
+	}
+
+	lines, err := diffLines(fromVersion.raw, toVersion.raw)
+	if err != nil {
+		apierror.Error(w, "Error: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	response := DiffResponse{Name: name, From: from, To: to, Lines: lines}
+	for _, line := range lines {
+		switch line.Op {
+		case "+":
+			response.Added++
+		case "-":
+			response.Removed++
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ir/internal/apierror"
+)
+
+type VocabularyEntry struct {
+	Term                string `json:"term"`
+	DocumentFrequency   int    `json:"documentFrequency"`
+	CollectionFrequency int    `json:"collectionFrequency"`
+}
+
+type VocabularyPage struct {
+	Total  int               `json:"total"` // matching terms before pagination
+	Offset int               `json:"offset"`
+	Limit  int               `json:"limit"`
+	Terms  []VocabularyEntry `json:"terms"`
+}
+
+const (
+	defaultVocabularyLimit = 50
+	maxVocabularyLimit     = 1000
+)
+
+// parses an optional non-negative integer query parameter
+func intParam(r *http.Request, name string, fallback int) (int, bool) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return fallback, true
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// GET /api/vocabulary?prefix=inf&offset=0&limit=50&sort=term|df|cf
+func vocabularyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	offset, ok := intParam(r, "offset", 0)
+	if !ok {
+		apierror.Error(w, "Error: 'offset' must be a non-negative integer.", http.StatusBadRequest)
+		return
+	}
+	limit, ok := intParam(r, "limit", defaultVocabularyLimit)
+	if !ok || limit == 0 {
+		apierror.Error(w, "Error: 'limit' must be a positive integer.", http.StatusBadRequest)
+		return
+	}
+	if limit > maxVocabularyLimit {
+		limit = maxVocabularyLimit
+	}
+
+	prefix := strings.ToLower(r.URL.Query().Get("prefix"))
+	sortBy := r.URL.Query().Get("sort")
+	if sortBy == "" {
+		sortBy = "term"
+	}
+	if sortBy != "term" && sortBy != "df" && sortBy != "cf" {
+		apierror.Error(w, "Error: 'sort' must be term, df or cf.", http.StatusBadRequest)
+		return
+	}
+
+	state.Lock()
+	snapshot := takeIndexSnapshot("current")
+	state.Unlock()
+
+	entries := []VocabularyEntry{}
+	for term, df := range snapshot.DocumentFrequency {
+		if strings.HasPrefix(term, prefix) {
+			entries = append(entries, VocabularyEntry{
+				Term:                term,
+				DocumentFrequency:   df,
+				CollectionFrequency: snapshot.CollectionFrequency[term],
+			})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		switch {
+		case sortBy == "df" && a.DocumentFrequency != b.DocumentFrequency:
+			return a.DocumentFrequency > b.DocumentFrequency
+		case sortBy == "cf" && a.CollectionFrequency != b.CollectionFrequency:
+			return a.CollectionFrequency > b.CollectionFrequency
+		}
+		return a.Term < b.Term
+	})
+
+	page := VocabularyPage{Total: len(entries), Offset: offset, Limit: limit}
+	if offset < len(entries) {
+		end := min(offset+limit, len(entries))
+		page.Terms = entries[offset:end]
+	} else {
+		page.Terms = []VocabularyEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
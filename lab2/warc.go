@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const maxArchivedPages = 10000
+
+// splitWARC reads the response records of a WARC archive, plain or gzipped
+// per record as Common Crawl and wget write them, and returns the text of the
+// HTML and plain text pages that answered 200; each is named after the archive
+// and its URL and keeps the URL and the crawl date as metadata
+func splitWARC(name string, r io.Reader) ([]archivedDocument, error) {
+	buffered := bufio.NewReader(r)
+	if magic, _ := buffered.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		defer gz.Close()
+		buffered = bufio.NewReader(gz)
+	}
+
+	archive := strings.TrimSuffix(strings.TrimSuffix(path.Base(name), ".gz"), ".warc")
+	var docs []archivedDocument
+	seen := map[string]bool{}
+	for len(docs) < maxArchivedPages {
+		headers, block, err := readWARCRecord(buffered)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if headers.Get("WARC-Type") != "response" || !strings.HasPrefix(headers.Get("Content-Type"), "application/http") {
+			continue
+		}
+		target := headers.Get("WARC-Target-URI")
+		title, text, ok := archivedPage(block)
+		if !ok || text == "" {
+			continue
+		}
+		docName := archivedName(archive, target)
+		if seen[docName] {
+			continue // revisited, the first capture counts
+		}
+		seen[docName] = true
+
+		fields := DocumentMetadata{"url": {target}}
+		if date := headers.Get("WARC-Date"); date != "" {
+			fields["crawled"] = []string{date}
+		}
+		if title != "" {
+			fields["title"] = []string{title}
+			text = title + "\n\n" + text
+		}
+		docs = append(docs, archivedDocument{name: docName, text: text, metadata: fields})
+	}
+	return docs, nil
+}
+
+// reads the version line, the headers and the block of the next record
+func readWARCRecord(r *bufio.Reader) (textproto.MIMEHeader, []byte, error) {
+	var version string
+	for version == "" {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && strings.TrimSpace(line) == "" {
+				return nil, nil, io.EOF
+			}
+			return nil, nil, fmt.Errorf("truncated record")
+		}
+		version = strings.TrimSpace(line) // blank lines end the previous record
+	}
+	if !strings.HasPrefix(version, "WARC/") {
+		return nil, nil, fmt.Errorf("not a WARC record: %.40q", version)
+	}
+
+	headers, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, nil, fmt.Errorf("bad record headers: %v", err)
+	}
+	length, err := strconv.ParseInt(headers.Get("Content-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return nil, nil, fmt.Errorf("record without Content-Length")
+	}
+	block := make([]byte, length)
+	if _, err := io.ReadFull(r, block); err != nil {
+		return nil, nil, fmt.Errorf("truncated record")
+	}
+	return headers, block, nil
+}
+
+// the title and text of an archived HTTP response, ok for pages that answered
+// 200 with HTML or plain text
+func archivedPage(block []byte) (string, string, bool) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(block)), nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return "", "", false
+	}
+	defer resp.Body.Close()
+
+	var body io.Reader = resp.Body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return "", "", false
+		}
+		body = gz
+	}
+	data, err := io.ReadAll(body)
+	if err != nil && len(data) == 0 {
+		return "", "", false
+	}
+	page := strings.ToValidUTF8(string(data), "")
+
+	contentType := resp.Header.Get("Content-Type")
+	switch {
+	case strings.Contains(contentType, "html"):
+		title, text := htmlToText(page)
+		return title, text, true
+	case strings.HasPrefix(contentType, "text/plain"):
+		return "", strings.TrimSpace(page), true
+	}
+	return "", "", false
+}
+
+// "archive/example.com/docs/intro" for http://example.com/docs/intro.html;
+// the index page of a directory is named index
+func archivedName(archive, target string) string {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return archive + "/" + strings.Trim(target, "/")
+	}
+	p := strings.TrimSuffix(u.Path, path.Ext(u.Path))
+	if p == "" || strings.HasSuffix(p, "/") {
+		p += "index"
+	}
+	if u.RawQuery != "" {
+		p += "?" + u.RawQuery
+	}
+	return archive + "/" + u.Host + p
+}